@@ -18,6 +18,7 @@ import (
 	"github.com/hashicorp/hcl"
 
 	svchost "github.com/hashicorp/terraform-svchost"
+	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/tfdiags"
 )
 
@@ -38,6 +39,28 @@ type Config struct {
 	// avoid repeatedly re-downloading over the Internet.
 	PluginCacheDir string `hcl:"plugin_cache_dir"`
 
+	// PluginCacheMaxSizeMB and PluginCacheMaxAgeDays optionally enable
+	// eviction of least-recently-used packages from the plugin cache
+	// directory, by total size in megabytes and by time since last use
+	// respectively. Zero for either means the corresponding limit is not
+	// enforced.
+	PluginCacheMaxSizeMB  int `hcl:"plugin_cache_max_size_mb"`
+	PluginCacheMaxAgeDays int `hcl:"plugin_cache_max_age_days"`
+
+	// ProviderCacheDirOverrides optionally maps provider source addresses
+	// to alternative local cache directories, so that the packages for
+	// particular providers can live somewhere other than the default
+	// location, such as on faster local storage. Providers with no entry
+	// here use the default configuration-specific cache directory.
+	ProviderCacheDirOverrides map[string]string `hcl:"provider_cache_dir_overrides"`
+
+	// ProviderDevOverrides optionally maps provider source addresses to
+	// local executables (or directories containing them) that should be
+	// used in place of whatever package is installed in the cache, which
+	// lets provider developers test freshly-built binaries without
+	// reinstalling them after every build.
+	ProviderDevOverrides map[string]string `hcl:"provider_dev_overrides"`
+
 	Hosts map[string]*ConfigHost `hcl:"host"`
 
 	Credentials        map[string]map[string]interface{}   `hcl:"credentials"`
@@ -48,6 +71,10 @@ type Config struct {
 	// configuration, but we decode into a slice here so that we can handle
 	// that validation at validation time rather than initial decode time.
 	ProviderInstallation []*ProviderInstallation
+
+	// ProviderSigning configures signature verification for provider
+	// packages installed from filesystem and network mirrors.
+	ProviderSigning *ProviderSigningConfig `hcl:"provider_signing"`
 }
 
 // ConfigHost is the structure of the "host" nested block within the CLI
@@ -172,6 +199,14 @@ func loadConfigFile(path string) (*Config, tfdiags.Diagnostics) {
 		result.PluginCacheDir = os.ExpandEnv(result.PluginCacheDir)
 	}
 
+	for k, v := range result.ProviderCacheDirOverrides {
+		result.ProviderCacheDirOverrides[k] = os.ExpandEnv(v)
+	}
+
+	for k, v := range result.ProviderDevOverrides {
+		result.ProviderDevOverrides[k] = os.ExpandEnv(v)
+	}
+
 	return result, diags
 }
 
@@ -259,6 +294,27 @@ func (c *Config) Validate() tfdiags.Diagnostics {
 		}
 	}
 
+	// Check that all "provider_cache_dir_overrides" keys are valid provider
+	// source addresses.
+	for givenAddr := range c.ProviderCacheDirOverrides {
+		_, addrDiags := addrs.ParseProviderSourceString(givenAddr)
+		if addrDiags.HasErrors() {
+			diags = diags.Append(
+				fmt.Errorf("The provider_cache_dir_overrides entry %q does not have a valid provider source address", givenAddr),
+			)
+		}
+	}
+
+	// Likewise for "provider_dev_overrides" keys.
+	for givenAddr := range c.ProviderDevOverrides {
+		_, addrDiags := addrs.ParseProviderSourceString(givenAddr)
+		if addrDiags.HasErrors() {
+			diags = diags.Append(
+				fmt.Errorf("The provider_dev_overrides entry %q does not have a valid provider source address", givenAddr),
+			)
+		}
+	}
+
 	// Should have zero or one "credentials_helper" blocks
 	if len(c.CredentialsHelpers) > 1 {
 		diags = diags.Append(
@@ -308,6 +364,35 @@ func (c1 *Config) Merge(c2 *Config) *Config {
 		result.PluginCacheDir = c2.PluginCacheDir
 	}
 
+	result.PluginCacheMaxSizeMB = c1.PluginCacheMaxSizeMB
+	if result.PluginCacheMaxSizeMB == 0 {
+		result.PluginCacheMaxSizeMB = c2.PluginCacheMaxSizeMB
+	}
+	result.PluginCacheMaxAgeDays = c1.PluginCacheMaxAgeDays
+	if result.PluginCacheMaxAgeDays == 0 {
+		result.PluginCacheMaxAgeDays = c2.PluginCacheMaxAgeDays
+	}
+
+	if (len(c1.ProviderCacheDirOverrides) + len(c2.ProviderCacheDirOverrides)) > 0 {
+		result.ProviderCacheDirOverrides = make(map[string]string)
+		for addr, dir := range c1.ProviderCacheDirOverrides {
+			result.ProviderCacheDirOverrides[addr] = dir
+		}
+		for addr, dir := range c2.ProviderCacheDirOverrides {
+			result.ProviderCacheDirOverrides[addr] = dir
+		}
+	}
+
+	if (len(c1.ProviderDevOverrides) + len(c2.ProviderDevOverrides)) > 0 {
+		result.ProviderDevOverrides = make(map[string]string)
+		for addr, path := range c1.ProviderDevOverrides {
+			result.ProviderDevOverrides[addr] = path
+		}
+		for addr, path := range c2.ProviderDevOverrides {
+			result.ProviderDevOverrides[addr] = path
+		}
+	}
+
 	if (len(c1.Hosts) + len(c2.Hosts)) > 0 {
 		result.Hosts = make(map[string]*ConfigHost)
 		for name, host := range c1.Hosts {
@@ -346,6 +431,11 @@ func (c1 *Config) Merge(c2 *Config) *Config {
 		result.ProviderInstallation = append(result.ProviderInstallation, c2.ProviderInstallation...)
 	}
 
+	result.ProviderSigning = c1.ProviderSigning
+	if c2.ProviderSigning != nil {
+		result.ProviderSigning = c2.ProviderSigning
+	}
+
 	return &result
 }
 
@@ -193,6 +193,22 @@ func TestConfigValidate(t *testing.T) {
 			},
 			1, // no more than one provider_installation block allowed
 		},
+		"provider_cache_dir_overrides good": {
+			&Config{
+				ProviderCacheDirOverrides: map[string]string{
+					"registry.terraform.io/hashicorp/aws": "/fast/cache",
+				},
+			},
+			0,
+		},
+		"provider_cache_dir_overrides with bad provider address": {
+			&Config{
+				ProviderCacheDirOverrides: map[string]string{
+					"not//valid": "/fast/cache",
+				},
+			},
+			1, // provider_cache_dir_overrides entry has invalid address
+		},
 	}
 
 	for name, test := range tests {
@@ -164,6 +164,38 @@ func (s *CredentialsSource) ForHost(host svchost.Hostname) (svcauth.HostCredenti
 	return nil, nil
 }
 
+// TLSClientCertFilesForHost returns the paths of the TLS client certificate
+// and key files configured for the given host, for services that demand
+// mutual TLS rather than (or in addition to) a token. They come from the
+// optional "client_cert_file" and "client_key_file" attributes of the
+// host's "credentials" block; ok is false unless both are set.
+func (s *CredentialsSource) TLSClientCertFilesForHost(host svchost.Hostname) (certFile, keyFile string, ok bool) {
+	v, exists := s.configured[host]
+	if !exists {
+		return "", "", false
+	}
+	certFile = credentialsObjectAttr(v, "client_cert_file")
+	keyFile = credentialsObjectAttr(v, "client_key_file")
+	if certFile == "" || keyFile == "" {
+		return "", "", false
+	}
+	return certFile, keyFile, true
+}
+
+// credentialsObjectAttr reads an optional string attribute from a
+// credentials object value, returning an empty string if it is absent,
+// null, or not a string.
+func credentialsObjectAttr(v cty.Value, name string) string {
+	if !v.Type().IsObjectType() || !v.Type().HasAttribute(name) {
+		return ""
+	}
+	av := v.GetAttr(name)
+	if av.IsNull() || av.Type() != cty.String {
+		return ""
+	}
+	return av.AsString()
+}
+
 func (s *CredentialsSource) StoreForHost(host svchost.Hostname, credentials svcauth.HostCredentialsWritable) error {
 	return s.updateHostCredentials(host, credentials)
 }
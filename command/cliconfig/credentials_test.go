@@ -87,6 +87,54 @@ func TestCredentialsForHost(t *testing.T) {
 	})
 }
 
+func TestCredentialsTLSClientCertFilesForHost(t *testing.T) {
+	credSrc := &CredentialsSource{
+		configured: map[svchost.Hostname]cty.Value{
+			"mtls.example.com": cty.ObjectVal(map[string]cty.Value{
+				"client_cert_file": cty.StringVal("/etc/terraform/client.crt"),
+				"client_key_file":  cty.StringVal("/etc/terraform/client.key"),
+			}),
+			"token-only.example.com": cty.ObjectVal(map[string]cty.Value{
+				"token": cty.StringVal("abc123"),
+			}),
+			"cert-only.example.com": cty.ObjectVal(map[string]cty.Value{
+				"client_cert_file": cty.StringVal("/etc/terraform/client.crt"),
+			}),
+		},
+	}
+
+	t.Run("complete certificate configuration", func(t *testing.T) {
+		certFile, keyFile, ok := credSrc.TLSClientCertFilesForHost("mtls.example.com")
+		if !ok {
+			t.Fatalf("no certificate found; expected one")
+		}
+		if got, want := certFile, "/etc/terraform/client.crt"; got != want {
+			t.Errorf("wrong certificate file %q; want %q", got, want)
+		}
+		if got, want := keyFile, "/etc/terraform/client.key"; got != want {
+			t.Errorf("wrong key file %q; want %q", got, want)
+		}
+	})
+
+	t.Run("token-only configuration", func(t *testing.T) {
+		if _, _, ok := credSrc.TLSClientCertFilesForHost("token-only.example.com"); ok {
+			t.Errorf("certificate found; expected none")
+		}
+	})
+
+	t.Run("certificate without key", func(t *testing.T) {
+		if _, _, ok := credSrc.TLSClientCertFilesForHost("cert-only.example.com"); ok {
+			t.Errorf("certificate found; expected none")
+		}
+	})
+
+	t.Run("unknown host", func(t *testing.T) {
+		if _, _, ok := credSrc.TLSClientCertFilesForHost("other.example.com"); ok {
+			t.Errorf("certificate found; expected none")
+		}
+	})
+}
+
 func TestCredentialsStoreForget(t *testing.T) {
 	d, err := ioutil.TempDir("", "terraform-cliconfig-test")
 	if err != nil {
@@ -188,6 +188,99 @@ func decodeProviderInstallationFromConfig(hclFile *hclast.File) ([]*ProviderInst
 				location = ProviderInstallationNetworkMirror(bodyContent.URL)
 				include = bodyContent.Include
 				exclude = bodyContent.Exclude
+			case "oci_mirror":
+				type BodyContent struct {
+					Repository string   `hcl:"repository"`
+					Include    []string `hcl:"include"`
+					Exclude    []string `hcl:"exclude"`
+				}
+				var bodyContent BodyContent
+				err := hcl.DecodeObject(&bodyContent, methodBody)
+				if err != nil {
+					diags = diags.Append(tfdiags.Sourceless(
+						tfdiags.Error,
+						"Invalid provider_installation method block",
+						fmt.Sprintf("Invalid %s block at %s: %s.", methodTypeStr, block.Pos(), err),
+					))
+					continue
+				}
+				if bodyContent.Repository == "" {
+					diags = diags.Append(tfdiags.Sourceless(
+						tfdiags.Error,
+						"Invalid provider_installation method block",
+						fmt.Sprintf("Invalid %s block at %s: \"repository\" argument is required.", methodTypeStr, block.Pos()),
+					))
+					continue
+				}
+				location = ProviderInstallationOCIMirror(bodyContent.Repository)
+				include = bodyContent.Include
+				exclude = bodyContent.Exclude
+			case "s3_mirror":
+				type BodyContent struct {
+					Bucket   string   `hcl:"bucket"`
+					Prefix   string   `hcl:"prefix"`
+					Region   string   `hcl:"region"`
+					Endpoint string   `hcl:"endpoint"`
+					Include  []string `hcl:"include"`
+					Exclude  []string `hcl:"exclude"`
+				}
+				var bodyContent BodyContent
+				err := hcl.DecodeObject(&bodyContent, methodBody)
+				if err != nil {
+					diags = diags.Append(tfdiags.Sourceless(
+						tfdiags.Error,
+						"Invalid provider_installation method block",
+						fmt.Sprintf("Invalid %s block at %s: %s.", methodTypeStr, block.Pos(), err),
+					))
+					continue
+				}
+				if bodyContent.Bucket == "" {
+					diags = diags.Append(tfdiags.Sourceless(
+						tfdiags.Error,
+						"Invalid provider_installation method block",
+						fmt.Sprintf("Invalid %s block at %s: \"bucket\" argument is required.", methodTypeStr, block.Pos()),
+					))
+					continue
+				}
+				location = ProviderInstallationS3Mirror{
+					Bucket:   bodyContent.Bucket,
+					Prefix:   bodyContent.Prefix,
+					Region:   bodyContent.Region,
+					Endpoint: bodyContent.Endpoint,
+				}
+				include = bodyContent.Include
+				exclude = bodyContent.Exclude
+			case "gcs_mirror":
+				type BodyContent struct {
+					Bucket  string   `hcl:"bucket"`
+					Prefix  string   `hcl:"prefix"`
+					Include []string `hcl:"include"`
+					Exclude []string `hcl:"exclude"`
+				}
+				var bodyContent BodyContent
+				err := hcl.DecodeObject(&bodyContent, methodBody)
+				if err != nil {
+					diags = diags.Append(tfdiags.Sourceless(
+						tfdiags.Error,
+						"Invalid provider_installation method block",
+						fmt.Sprintf("Invalid %s block at %s: %s.", methodTypeStr, block.Pos(), err),
+					))
+					continue
+				}
+				if bodyContent.Bucket == "" {
+					diags = diags.Append(tfdiags.Sourceless(
+						tfdiags.Error,
+						"Invalid provider_installation method block",
+						fmt.Sprintf("Invalid %s block at %s: \"bucket\" argument is required.", methodTypeStr, block.Pos()),
+					))
+					continue
+				}
+				location = ProviderInstallationGCSMirror{
+					Bucket: bodyContent.Bucket,
+					Prefix: bodyContent.Prefix,
+				}
+				include = bodyContent.Include
+				exclude = bodyContent.Exclude
 			default:
 				diags = diags.Append(tfdiags.Sourceless(
 					tfdiags.Error,
@@ -225,6 +318,9 @@ type ProviderInstallationMethod struct {
 //     ProviderInstallationDirect:                install from the provider's origin registry
 //     ProviderInstallationFilesystemMirror(dir): install from a local filesystem mirror
 //     ProviderInstallationNetworkMirror(host):   install from a network mirror
+//     ProviderInstallationOCIMirror(addr):       install from repositories in an OCI registry
+//     ProviderInstallationS3Mirror{...}:         install from a mirror in an S3 bucket
+//     ProviderInstallationGCSMirror{...}:        install from a mirror in a GCS bucket
 type ProviderInstallationLocation interface {
 	providerInstallationLocation()
 }
@@ -263,3 +359,47 @@ func (i ProviderInstallationNetworkMirror) providerInstallationLocation() {}
 func (i ProviderInstallationNetworkMirror) GoString() string {
 	return fmt.Sprintf("cliconfig.ProviderInstallationNetworkMirror(%q)", i)
 }
+
+// ProviderInstallationOCIMirror is a ProviderInstallationSourceLocation
+// representing installation from provider repositories in an OCI-compatible
+// registry. The string value is the registry hostname optionally followed by
+// a repository name prefix, such as "registry.example.com/terraform-providers",
+// exactly as written in the configuration.
+type ProviderInstallationOCIMirror string
+
+func (i ProviderInstallationOCIMirror) providerInstallationLocation() {}
+
+func (i ProviderInstallationOCIMirror) GoString() string {
+	return fmt.Sprintf("cliconfig.ProviderInstallationOCIMirror(%q)", i)
+}
+
+// ProviderInstallationS3Mirror is a ProviderInstallationSourceLocation
+// representing installation from a mirror laid out in an S3 bucket (or an
+// S3-compatible store), using the same index and package structure as a
+// network mirror.
+type ProviderInstallationS3Mirror struct {
+	Bucket   string
+	Prefix   string
+	Region   string
+	Endpoint string
+}
+
+func (i ProviderInstallationS3Mirror) providerInstallationLocation() {}
+
+func (i ProviderInstallationS3Mirror) GoString() string {
+	return fmt.Sprintf("cliconfig.ProviderInstallationS3Mirror{Bucket: %q, Prefix: %q, Region: %q, Endpoint: %q}", i.Bucket, i.Prefix, i.Region, i.Endpoint)
+}
+
+// ProviderInstallationGCSMirror is a ProviderInstallationSourceLocation
+// representing installation from a mirror laid out in a Google Cloud Storage
+// bucket, using the same index and package structure as a network mirror.
+type ProviderInstallationGCSMirror struct {
+	Bucket string
+	Prefix string
+}
+
+func (i ProviderInstallationGCSMirror) providerInstallationLocation() {}
+
+func (i ProviderInstallationGCSMirror) GoString() string {
+	return fmt.Sprintf("cliconfig.ProviderInstallationGCSMirror{Bucket: %q, Prefix: %q}", i.Bucket, i.Prefix)
+}
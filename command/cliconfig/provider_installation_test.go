@@ -31,6 +31,25 @@ func TestLoadConfig_providerInstallation(t *testing.T) {
 							{
 								Location: ProviderInstallationFilesystemMirror("/tmp/example2"),
 							},
+							{
+								Location: ProviderInstallationOCIMirror("registry.example.com/terraform-providers"),
+								Include:  []string{"registry.terraform.io/*/*"},
+							},
+							{
+								Location: ProviderInstallationS3Mirror{
+									Bucket: "terraform-providers",
+									Prefix: "mirror",
+									Region: "us-west-2",
+								},
+								Include: []string{"registry.terraform.io/*/*"},
+							},
+							{
+								Location: ProviderInstallationGCSMirror{
+									Bucket: "terraform-providers",
+									Prefix: "mirror",
+								},
+								Include: []string{"registry.terraform.io/*/*"},
+							},
 							{
 								Location: ProviderInstallationDirect,
 								Exclude:  []string{"example.com/*/*"},
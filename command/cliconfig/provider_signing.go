@@ -0,0 +1,30 @@
+package cliconfig
+
+// ProviderSigningConfig is the structure of the optional "provider_signing"
+// block within the CLI configuration, which configures signature
+// verification for provider packages installed from filesystem and network
+// mirrors:
+//
+//     provider_signing {
+//       require_signatures = true
+//       keys "examplecorp" {
+//         key_files = ["/etc/terraform/examplecorp.asc"]
+//       }
+//     }
+//
+// Each "keys" block names a provider namespace and the ASCII-armored GPG
+// key files trusted to sign mirror packages in that namespace. The special
+// namespace "*" applies to namespaces without their own block.
+type ProviderSigningConfig struct {
+	// RequireSignatures makes a mirror package without a valid signature an
+	// installation error rather than just a warning.
+	RequireSignatures bool `hcl:"require_signatures"`
+
+	Keys map[string]*ProviderSigningKeys `hcl:"keys"`
+}
+
+// ProviderSigningKeys is the structure of the "keys" nested block within a
+// provider_signing block.
+type ProviderSigningKeys struct {
+	KeyFiles []string `hcl:"key_files"`
+}
@@ -33,6 +33,80 @@ type InitCommand struct {
 
 	// getPlugins is for the -get-plugins flag
 	getPlugins bool
+
+	// pluginConcurrency is for the -plugin-concurrency flag, limiting how
+	// many provider packages may be fetched at the same time. Zero selects
+	// the installer's default.
+	pluginConcurrency int
+
+	// jsonOutput is for the -json flag, which replaces the human-oriented
+	// provider installation progress text with a machine-readable stream of
+	// JSON objects, one per line.
+	jsonOutput bool
+
+	// pluginDirOptional is for the -plugin-dir-optional flag, which makes a
+	// -plugin-dir pattern that matches no directories a no-op instead of
+	// an error.
+	pluginDirOptional bool
+
+	// dryRun is for the -dry-run flag, which reports the provider packages
+	// that installation would fetch and then exits without modifying
+	// anything.
+	dryRun bool
+
+	// reinstallProviders is for the -reinstall-providers flag, which purges
+	// providers from the local cache and the recorded selections before
+	// installation so that corrupted packages get replaced.
+	reinstallProviders reinstallProvidersFlag
+}
+
+// reinstallProvidersFlag is the flag.Value for -reinstall-providers, which
+// can appear either bare, selecting every provider, or with a provider
+// source address, selecting just that provider. The form with an address
+// may be repeated.
+type reinstallProvidersFlag struct {
+	all       bool
+	providers []addrs.Provider
+}
+
+func (f *reinstallProvidersFlag) String() string { return "" }
+
+// IsBoolFlag allows the bare -reinstall-providers form, with no value.
+func (f *reinstallProvidersFlag) IsBoolFlag() bool { return true }
+
+func (f *reinstallProvidersFlag) Set(raw string) error {
+	switch raw {
+	case "true": // the bare form arrives as the literal "true"
+		f.all = true
+		return nil
+	case "false":
+		f.all = false
+		return nil
+	}
+	provider, diags := addrs.ParseProviderSourceString(raw)
+	if diags.HasErrors() {
+		return fmt.Errorf("invalid provider source address %q: %s", raw, diags.Err())
+	}
+	f.providers = append(f.providers, provider)
+	return nil
+}
+
+// active is whether the flag was used at all.
+func (f *reinstallProvidersFlag) active() bool {
+	return f.all || len(f.providers) > 0
+}
+
+// matches is whether the given provider is among those the flag selected.
+func (f *reinstallProvidersFlag) matches(provider addrs.Provider) bool {
+	if f.all {
+		return true
+	}
+	for _, p := range f.providers {
+		if p == provider {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *InitCommand) Run(args []string) int {
@@ -40,6 +114,7 @@ func (c *InitCommand) Run(args []string) int {
 	var flagBackend, flagGet, flagUpgrade bool
 	var flagPluginPath FlagStringSlice
 	var flagVerifyPlugins bool
+	var flagLockfile string
 	flagConfigExtra := newRawFlags("-backend-config")
 
 	args = c.Meta.process(args)
@@ -55,7 +130,14 @@ func (c *InitCommand) Run(args []string) int {
 	cmdFlags.BoolVar(&c.reconfigure, "reconfigure", false, "reconfigure")
 	cmdFlags.BoolVar(&flagUpgrade, "upgrade", false, "")
 	cmdFlags.Var(&flagPluginPath, "plugin-dir", "plugin directory")
+	cmdFlags.BoolVar(&c.pluginDirOptional, "plugin-dir-optional", false, "tolerate -plugin-dir patterns that match nothing")
+	cmdFlags.BoolVar(&c.dryRun, "dry-run", false, "report the provider packages that would be installed without installing them")
+	cmdFlags.Var(&c.reinstallProviders, "reinstall-providers", "purge and reinstall providers")
+	cmdFlags.IntVar(&c.pluginConcurrency, "plugin-concurrency", 0, "maximum number of concurrent provider downloads")
+	cmdFlags.BoolVar(&c.Meta.ProviderInstallOffline, "offline", false, "install providers from local directories only")
 	cmdFlags.BoolVar(&flagVerifyPlugins, "verify-plugins", true, "verify plugins")
+	cmdFlags.BoolVar(&c.jsonOutput, "json", false, "machine readable output")
+	cmdFlags.StringVar(&flagLockfile, "lockfile", "", "Set a dependency lockfile mode")
 	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
@@ -63,6 +145,16 @@ func (c *InitCommand) Run(args []string) int {
 
 	var diags tfdiags.Diagnostics
 
+	switch flagLockfile {
+	case "":
+		// Normal behavior: the lock data records whatever was selected.
+	case "readonly":
+		c.Meta.providerLockfileReadOnly = true
+	default:
+		c.Ui.Error(fmt.Sprintf("The -lockfile option value %q is not valid. The only supported mode is \"readonly\".", flagLockfile))
+		return 1
+	}
+
 	if len(flagPluginPath) > 0 {
 		c.pluginPath = flagPluginPath
 		c.getPlugins = false
@@ -231,6 +323,18 @@ func (c *InitCommand) Run(args []string) int {
 		return 1
 	}
 
+	// In dry-run mode we stop here, reporting what provider installation
+	// would fetch without touching the backend, the state, or the cache.
+	if c.dryRun {
+		dryRunDiags := c.dryRunProviders(earlyConfig, flagPluginPath)
+		diags = diags.Append(dryRunDiags)
+		c.showDiagnostics(diags)
+		if dryRunDiags.HasErrors() {
+			return 1
+		}
+		return 0
+	}
+
 	var back backend.Backend
 	if flagBackend {
 
@@ -422,6 +526,82 @@ the backend configuration is present and valid.
 	return back, true, diags
 }
 
+// dryRunProviders resolves the configuration's provider requirements
+// against the configured installation source and reports the packages that
+// an installation would fetch, without modifying the provider cache or the
+// lock file.
+func (c *InitCommand) dryRunProviders(earlyConfig *earlyconfig.Config, pluginDirs []string) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+
+	reqs, moreDiags := earlyConfig.ProviderRequirements()
+	diags = diags.Append(moreDiags)
+	if moreDiags.HasErrors() {
+		return diags
+	}
+	// Dev-overridden and unmanaged providers are never installed, so they
+	// don't appear in the report either.
+	for provider := range c.providerDevOverrides() {
+		delete(reqs, provider)
+	}
+	for provider := range c.unmanagedProviders() {
+		delete(reqs, provider)
+	}
+
+	var inst *providercache.Installer
+	if len(pluginDirs) == 0 {
+		inst = c.providerInstaller()
+	} else {
+		source, err := c.providerCustomLocalDirectorySource(pluginDirs, c.pluginDirOptional)
+		if err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid plugin search directory",
+				fmt.Sprintf("Invalid -plugin-dir option: %s.", err),
+			))
+			return diags
+		}
+		inst = c.providerInstallerCustomSource(source)
+	}
+
+	planned, err := inst.InstallDryRun(context.TODO(), reqs)
+	if err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to plan provider installation",
+			fmt.Sprintf("Could not determine the packages that installation would fetch: %s.", err),
+		))
+		return diags
+	}
+
+	if len(planned) == 0 {
+		c.Ui.Output("No provider packages would be installed.")
+		return diags
+	}
+	c.Ui.Output("Provider packages that would be installed:")
+	for _, plan := range planned {
+		checksum := plan.Checksum
+		if checksum == "" {
+			checksum = "(not yet recorded in the lock file)"
+		}
+		var download string
+		switch {
+		case plan.InGlobalCache:
+			download = "none (already present in the shared cache directory)"
+		case plan.SizeBytes == 0:
+			download = "none (local package)"
+		case plan.SizeBytes > 0:
+			download = humanBytes(plan.SizeBytes)
+		default:
+			download = "unknown"
+		}
+		c.Ui.Output(fmt.Sprintf(
+			"- %s v%s\n    package:  %s\n    checksum: %s\n    download: %s",
+			plan.Provider.ForDisplay(), plan.Version.String(), plan.Location, checksum, download,
+		))
+	}
+	return diags
+}
+
 // Load the complete module tree, and fetch any missing providers.
 // This method outputs its own Ui.
 func (c *InitCommand) getProviders(earlyConfig *earlyconfig.Config, state *states.State, upgrade bool, pluginDirs []string) (output bool, diags tfdiags.Diagnostics) {
@@ -437,6 +617,35 @@ func (c *InitCommand) getProviders(earlyConfig *earlyconfig.Config, state *state
 		reqs = reqs.Merge(stateReqs)
 	}
 
+	// Providers subject to a development override are not installed at all:
+	// the override's locally-built binary stands in for the package, so
+	// requesting installation would be wasted work at best and a confusing
+	// version-selection failure at worst. A prominent warning makes sure
+	// an init with overrides active can't be mistaken for a normal one.
+	if devOverrides := c.providerDevOverrides(); len(devOverrides) > 0 {
+		for provider := range devOverrides {
+			delete(reqs, provider)
+		}
+		c.Ui.Warn(devOverridesNotice(devOverrides) + "\n")
+	}
+
+	// Providers satisfied by reattachment to an already-running process are
+	// never installed, so any version constraints for them have no effect
+	// and the user should know that.
+	for provider, config := range c.unmanagedProviders() {
+		if constraints, exists := reqs[provider]; exists && len(constraints) > 0 {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Warning,
+				"Provider version constraints ignored for unmanaged provider",
+				fmt.Sprintf(
+					"Provider %s is being satisfied by an unmanaged server process (pid %d) configured via TF_PROVIDER_REATTACH, so the version constraints %q will not be honored.",
+					provider.ForDisplay(), config.Reattach.Pid,
+					getproviders.VersionConstraintsString(constraints),
+				),
+			))
+		}
+	}
+
 	var inst *providercache.Installer
 	if len(pluginDirs) == 0 {
 		// By default we use a source that looks for providers in all of the
@@ -447,9 +656,49 @@ func (c *InitCommand) getProviders(earlyConfig *earlyconfig.Config, state *state
 		// the usual sources and forces Terraform to consult only the given
 		// directories. Anything not available in one of those directories
 		// is not available for installation.
-		source := c.providerCustomLocalDirectorySource(pluginDirs)
+		source, err := c.providerCustomLocalDirectorySource(pluginDirs, c.pluginDirOptional)
+		if err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid plugin search directory",
+				fmt.Sprintf("Invalid -plugin-dir option: %s.", err),
+			))
+			return false, diags
+		}
+		// The paths were canonicalized while building the source, so we
+		// echo the resolved forms to let the user confirm what will
+		// actually be searched.
+		if !c.jsonOutput {
+			c.Ui.Output("Searching for provider plugins in the following directories:")
+			for _, selector := range source.(getproviders.MultiSource) {
+				c.Ui.Output(fmt.Sprintf("- %s", selector.Source.(*getproviders.FilesystemMirrorSource).BaseDir()))
+			}
+		}
 		inst = c.providerInstallerCustomSource(source)
 	}
+	if c.pluginConcurrency > 0 {
+		inst.SetConcurrency(c.pluginConcurrency)
+	}
+
+	// A requested reinstallation purges its providers before anything is
+	// installed, so that the installation below has to replace the purged
+	// packages from the configured source.
+	if c.reinstallProviders.active() {
+		purged, err := inst.PurgeProviders(c.reinstallProviders.providers)
+		if err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Failed to purge provider packages",
+				fmt.Sprintf("Could not purge the provider packages selected for reinstallation: %s.", err),
+			))
+			return false, diags
+		}
+		if !c.jsonOutput {
+			for _, cached := range purged {
+				c.Ui.Output(fmt.Sprintf("- Purged %s v%s", cached.Provider.ForDisplay(), cached.Version))
+			}
+		}
+	}
 
 	// Because we're currently just streaming a series of events sequentially
 	// into the terminal, we're showing only a subset of the events to keep
@@ -482,12 +731,31 @@ func (c *InitCommand) getProviders(earlyConfig *earlyconfig.Config, state *state
 				c.Ui.Info(fmt.Sprintf("- Finding latest version of %s...", provider.ForDisplay()))
 			}
 		},
+		QueryPackagesWarning: func(provider addrs.Provider, warnings []string) {
+			// These are advisory notices from the provider's source, such
+			// as a registry marking the provider as deprecated, so they
+			// are shown without interrupting installation.
+			for _, warning := range warnings {
+				c.Ui.Warn(c.Colorize().Color(fmt.Sprintf("[reset][yellow]Warning: %s %s[reset]", provider.ForDisplay(), warning)))
+			}
+		},
 		LinkFromCacheBegin: func(provider addrs.Provider, version getproviders.Version, cacheRoot string) {
 			c.Ui.Info(fmt.Sprintf("- Using %s v%s from the shared cache directory", provider.ForDisplay(), version))
 		},
 		FetchPackageBegin: func(provider addrs.Provider, version getproviders.Version, location getproviders.PackageLocation) {
 			c.Ui.Info(fmt.Sprintf("- Installing %s v%s...", provider.ForDisplay(), version))
 		},
+		FetchPackageProgress: func(provider addrs.Provider, version getproviders.Version, bytesFetched, bytesTotal int64) {
+			// Since we're only streaming log lines here, rather than
+			// updating a status in-place, we rely on the installer's own
+			// throttling of these events to keep this output at a
+			// reasonable length.
+			if bytesTotal > 0 {
+				c.Ui.Info(fmt.Sprintf("- Downloading %s v%s: %s of %s (%d%%)", provider.ForDisplay(), version, humanBytes(bytesFetched), humanBytes(bytesTotal), bytesFetched*100/bytesTotal))
+			} else {
+				c.Ui.Info(fmt.Sprintf("- Downloading %s v%s: %s so far", provider.ForDisplay(), version, humanBytes(bytesFetched)))
+			}
+		},
 		QueryPackagesFailure: func(provider addrs.Provider, err error) {
 			diags = diags.Append(tfdiags.Sourceless(
 				tfdiags.Error,
@@ -553,22 +821,70 @@ func (c *InitCommand) getProviders(earlyConfig *earlyconfig.Config, state *state
 		},
 	}
 
+	if c.jsonOutput {
+		// In the machine-readable mode we discard the human-oriented
+		// progress reports above entirely, in favor of a stream of JSON
+		// objects that CI systems can parse.
+		evts = c.jsonInstallerEvents(&diags)
+	}
+	if c.Meta.ProviderInstallerEvents != nil {
+		// An embedding program that wants to render installation progress
+		// itself takes precedence over both of the presentations above.
+		evts = c.Meta.ProviderInstallerEvents
+	}
+
 	mode := providercache.InstallNewProvidersOnly
 	if upgrade {
 		mode = providercache.InstallUpgrades
 	}
-	// TODO: Use a context that will be cancelled when the Terraform
-	// process receives SIGINT.
-	ctx := evts.OnContext(context.TODO())
-	selected, err := inst.EnsureProviderVersions(ctx, reqs, mode)
-	if err != nil {
-		// The errors captured in "err" should be redundant with what we
-		// received via the InstallerEvents callbacks above, so we'll
-		// just return those as long as we have some.
-		if !diags.HasErrors() {
-			diags = diags.Append(err)
+	// When we're not looking for upgrades and every requirement is already
+	// satisfied by an installed, checksum-verified package, the full
+	// installation codepath would only re-derive what the lock data already
+	// says, so we skip it without constructing any network requests. This
+	// also skips the usual per-provider progress output, so we leave a
+	// one-line note to keep the short-circuit observable.
+	var selected getproviders.Selections
+	if mode == providercache.InstallNewProvidersOnly && len(reqs) > 0 {
+		selected, _ = inst.RequirementsSatisfied(reqs)
+	}
+	if selected != nil {
+		if !c.jsonOutput {
+			c.Ui.Output("All providers already installed and verified; skipped network lookup")
+		}
+	} else {
+		// TODO: Use a context that will be cancelled when the Terraform
+		// process receives SIGINT.
+		ctx := evts.OnContext(context.TODO())
+		var err error
+		selected, err = inst.EnsureProviderVersions(ctx, reqs, mode)
+		if err != nil {
+			// The errors captured in "err" should be redundant with what we
+			// received via the InstallerEvents callbacks above, so we'll
+			// just return those as long as we have some.
+			if !diags.HasErrors() {
+				diags = diags.Append(err)
+			}
+			return true, diags
+		}
+	}
+
+	// After a reinstallation we report the checksums now on record, so the
+	// user can confirm that the purged packages really were replaced.
+	if c.reinstallProviders.active() && !c.jsonOutput {
+		if hashes, err := inst.SelectedPackageHashes(); err == nil {
+			reinstalled := make([]addrs.Provider, 0, len(selected))
+			for provider := range selected {
+				if c.reinstallProviders.matches(provider) && hashes[provider] != "" {
+					reinstalled = append(reinstalled, provider)
+				}
+			}
+			sort.Slice(reinstalled, func(i, j int) bool {
+				return reinstalled[i].LessThan(reinstalled[j])
+			})
+			for _, provider := range reinstalled {
+				c.Ui.Output(fmt.Sprintf("- %s v%s is now recorded with checksum %s", provider.ForDisplay(), selected[provider], hashes[provider]))
+			}
 		}
-		return true, diags
 	}
 
 	// If any providers have "floating" versions (completely unconstrained)
@@ -582,7 +898,7 @@ func (c *InitCommand) getProviders(earlyConfig *earlyconfig.Config, state *state
 			constraintSuggestions[addr.ForDisplay()] = "~> " + version.String()
 		}
 	}
-	if len(constraintSuggestions) != 0 {
+	if len(constraintSuggestions) != 0 && !c.jsonOutput {
 		names := make([]string, 0, len(constraintSuggestions))
 		for name := range constraintSuggestions {
 			names = append(names, name)
@@ -679,20 +995,43 @@ func (c *InitCommand) AutocompleteArgs() complete.Predictor {
 
 func (c *InitCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
-		"-backend":        completePredictBoolean,
-		"-backend-config": complete.PredictFiles("*.tfvars"), // can also be key=value, but we can't "predict" that
-		"-force-copy":     complete.PredictNothing,
-		"-from-module":    completePredictModuleSource,
-		"-get":            completePredictBoolean,
-		"-get-plugins":    completePredictBoolean,
-		"-input":          completePredictBoolean,
-		"-lock":           completePredictBoolean,
-		"-lock-timeout":   complete.PredictAnything,
-		"-no-color":       complete.PredictNothing,
-		"-plugin-dir":     complete.PredictDirs(""),
-		"-reconfigure":    complete.PredictNothing,
-		"-upgrade":        completePredictBoolean,
-		"-verify-plugins": completePredictBoolean,
+		"-backend":             completePredictBoolean,
+		"-backend-config":      complete.PredictFiles("*.tfvars"), // can also be key=value, but we can't "predict" that
+		"-dry-run":             complete.PredictNothing,
+		"-force-copy":          complete.PredictNothing,
+		"-from-module":         completePredictModuleSource,
+		"-get":                 completePredictBoolean,
+		"-get-plugins":         completePredictBoolean,
+		"-input":               completePredictBoolean,
+		"-json":                complete.PredictNothing,
+		"-lock":                completePredictBoolean,
+		"-lock-timeout":        complete.PredictAnything,
+		"-lockfile":            complete.PredictAnything,
+		"-no-color":            complete.PredictNothing,
+		"-offline":             complete.PredictNothing,
+		"-plugin-concurrency":  complete.PredictAnything,
+		"-plugin-dir":          complete.PredictDirs(""),
+		"-plugin-dir-optional": complete.PredictNothing,
+		"-reconfigure":         complete.PredictNothing,
+		"-reinstall-providers": complete.PredictAnything,
+		"-upgrade":             completePredictBoolean,
+		"-verify-plugins":      completePredictBoolean,
+	}
+}
+
+// humanBytes formats a byte count for download progress messages, using
+// binary multiples to match how provider release sizes are usually
+// discussed.
+func humanBytes(n int64) string {
+	switch {
+	case n >= 1024*1024*1024:
+		return fmt.Sprintf("%.1fGiB", float64(n)/(1024*1024*1024))
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1fKiB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%dB", n)
 	}
 }
 
@@ -727,6 +1066,11 @@ Options:
                        times. The backend type must be in the configuration
                        itself.
 
+  -dry-run             Report the provider packages that installation would
+                       fetch, with their URLs and recorded checksums, and
+                       then exit without modifying anything. Useful for
+                       pre-staging packages for an air-gapped environment.
+
   -force-copy          Suppress prompts about copying state data. This is
                        equivalent to providing a "yes" to all confirmation
                        prompts.
@@ -741,20 +1085,64 @@ Options:
   -input=true          Ask for input if necessary. If false, will error if
                        input was required.
 
+  -json                Replace the provider installation progress text with
+                       a machine-readable stream of JSON objects, one per
+                       line, for consumption by CI systems and other
+                       automation.
+
   -lock=true           Lock the state file when locking is supported.
 
   -lock-timeout=0s     Duration to retry a state lock.
 
+  -lockfile=MODE       Set a dependency lockfile mode. The only supported
+                       mode is "readonly", which verifies that the provider
+                       requirements can be satisfied exactly by the locked
+                       versions and hashes, and fails if any selection would
+                       change, without ever updating the lock data.
+
   -no-color            If specified, output won't contain any color.
 
+  -offline             Install providers only from local filesystem mirror
+                       directories and the global plugin cache, without any
+                       network access. Providers that are available only
+                       from a registry or network mirror will cause an
+                       error naming the local directories that were
+                       searched. The TF_PROVIDER_INSTALL_OFFLINE
+                       environment variable has the same effect.
+
+  -plugin-concurrency=n Limit the number of concurrent provider plugin
+                       downloads. By default up to four plugins are
+                       downloaded at the same time. The
+                       TF_PROVIDER_INSTALL_CONCURRENCY environment variable
+                       sets the same limit for every run.
+
   -plugin-dir          Directory containing plugin binaries. This overrides all
-                       default search paths for plugins, and prevents the 
+                       default search paths for plugins, and prevents the
                        automatic installation of plugins. This flag can be used
-                       multiple times.
+                       multiple times. A shell-style glob pattern selects all
+                       of the directories it matches, and a path ending in
+                       "/..." searches recursively for directories laid out
+                       as filesystem mirrors. A leading ~ refers to the
+                       current user's home directory, and relative paths are
+                       resolved against the current working directory.
+
+  -plugin-dir-optional Tolerate -plugin-dir patterns that match no
+                       directories, instead of treating that as an error.
 
   -reconfigure         Reconfigure the backend, ignoring any saved
                        configuration.
 
+  -reinstall-providers Discard the installed provider packages and their
+                       recorded selections before installing, forcing a
+                       fresh install from the configured source. Useful
+                       when a cached package has been corrupted. With no
+                       value every provider is reinstalled; with a
+                       provider source address, which may be given
+                       multiple times, only the named providers are.
+                       Shared cache copies that fail checksum
+                       verification are deleted and re-downloaded rather
+                       than re-linked.
+
   -upgrade=false       If installing modules (-get) or plugins (-get-plugins),
                        ignore previously-downloaded objects and install the
                        latest version allowed within configured constraints.
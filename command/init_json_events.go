@@ -0,0 +1,222 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// jsonInstallerEvent is the wire format for one line of the machine-readable
+// provider installation stream selected by "terraform init -json".
+//
+// The set of "type" values and the fields populated for each of them are a
+// compatibility constraint: consumers parse this output in CI systems, so
+// changes here must be additive only.
+type jsonInstallerEvent struct {
+	// Type is one of "version_query", "version_warning", "download_begin",
+	// "download_progress", "verify", "install_complete", or "error".
+	Type string `json:"type"`
+
+	// Provider is the fully-qualified provider source address.
+	Provider string `json:"provider,omitempty"`
+
+	// Version is the selected provider version, once one is known.
+	Version string `json:"version,omitempty"`
+
+	// Constraints is the version constraint string being queried, for
+	// "version_query" events.
+	Constraints string `json:"constraints,omitempty"`
+
+	// Source describes where the package is coming from: a download
+	// location for "download_begin", or a special marker such as
+	// "builtin" or a cache directory for "install_complete" events that
+	// did not require a download.
+	Source string `json:"source,omitempty"`
+
+	// BytesFetched and BytesTotal report download progress. BytesTotal is
+	// omitted when the server did not declare a total size.
+	BytesFetched int64 `json:"bytes_fetched,omitempty"`
+	BytesTotal   int64 `json:"bytes_total,omitempty"`
+
+	// Authentication summarizes the package authentication outcome for
+	// "verify" events, and Warning carries any non-fatal caveat about it.
+	// Warning also carries the message for "version_warning" events, which
+	// report advisories the provider source attached to the selected
+	// version, such as a deprecation notice.
+	Authentication string `json:"authentication,omitempty"`
+	Warning        string `json:"warning,omitempty"`
+
+	// Hash is the "h1:"-prefixed hash of the installed package directory,
+	// for "install_complete" events where it could be computed.
+	Hash string `json:"hash,omitempty"`
+
+	// Error is the error message for "error" events.
+	Error string `json:"error,omitempty"`
+}
+
+// jsonInstallerEvents returns an InstallerEvents that streams one JSON
+// object per line to the UI instead of the usual human-oriented progress
+// text, for "terraform init -json".
+//
+// Errors are both streamed as "error" events and appended to the given
+// diagnostics so that the caller's error handling works the same way in
+// both output modes.
+func (c *InitCommand) jsonInstallerEvents(diags *tfdiags.Diagnostics) *providercache.InstallerEvents {
+	emit := func(evt jsonInstallerEvent) {
+		// We use an encoder rather than json.Marshal directly so that we
+		// can disable HTML escaping, which would otherwise mangle the ">="
+		// in version constraint strings.
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(evt); err != nil {
+			// Should never happen: the event struct contains only
+			// marshalable field types.
+			panic(fmt.Sprintf("failed to marshal installer event: %s", err))
+		}
+		c.Ui.Output(strings.TrimSuffix(buf.String(), "\n"))
+	}
+	emitError := func(provider addrs.Provider, version string, err error) {
+		emit(jsonInstallerEvent{
+			Type:     "error",
+			Provider: provider.String(),
+			Version:  version,
+			Error:    err.Error(),
+		})
+	}
+
+	return &providercache.InstallerEvents{
+		QueryPackagesBegin: func(provider addrs.Provider, versionConstraints getproviders.VersionConstraints) {
+			emit(jsonInstallerEvent{
+				Type:        "version_query",
+				Provider:    provider.String(),
+				Constraints: getproviders.VersionConstraintsString(versionConstraints),
+			})
+		},
+		QueryPackagesWarning: func(provider addrs.Provider, warnings []string) {
+			for _, warning := range warnings {
+				emit(jsonInstallerEvent{
+					Type:     "version_warning",
+					Provider: provider.String(),
+					Warning:  warning,
+				})
+			}
+		},
+		ProviderAlreadyInstalled: func(provider addrs.Provider, selectedVersion getproviders.Version) {
+			emit(jsonInstallerEvent{
+				Type:     "install_complete",
+				Provider: provider.String(),
+				Version:  selectedVersion.String(),
+				Source:   "already_installed",
+			})
+		},
+		BuiltInProviderAvailable: func(provider addrs.Provider) {
+			emit(jsonInstallerEvent{
+				Type:     "install_complete",
+				Provider: provider.String(),
+				Source:   "builtin",
+			})
+		},
+		BuiltInProviderFailure: func(provider addrs.Provider, err error) {
+			emitError(provider, "", err)
+			*diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid dependency on built-in provider",
+				fmt.Sprintf("Cannot use %s: %s.", provider.ForDisplay(), err),
+			))
+		},
+		QueryPackagesFailure: func(provider addrs.Provider, err error) {
+			emitError(provider, "", err)
+			*diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Failed to query available provider packages",
+				fmt.Sprintf("Could not retrieve the list of available versions for provider %s: %s.", provider.ForDisplay(), err),
+			))
+		},
+		LinkFromCacheSuccess: func(provider addrs.Provider, version getproviders.Version, localDir string) {
+			emit(jsonInstallerEvent{
+				Type:     "install_complete",
+				Provider: provider.String(),
+				Version:  version.String(),
+				Source:   "shared_cache",
+				Hash:     installedPackageHash(provider, version, localDir),
+			})
+		},
+		LinkFromCacheFailure: func(provider addrs.Provider, version getproviders.Version, err error) {
+			emitError(provider, version.String(), err)
+			*diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Failed to install provider from shared cache",
+				fmt.Sprintf("Error while importing %s v%s from the shared cache directory: %s.", provider.ForDisplay(), version, err),
+			))
+		},
+		FetchPackageBegin: func(provider addrs.Provider, version getproviders.Version, location getproviders.PackageLocation) {
+			emit(jsonInstallerEvent{
+				Type:     "download_begin",
+				Provider: provider.String(),
+				Version:  version.String(),
+				Source:   location.String(),
+			})
+		},
+		FetchPackageProgress: func(provider addrs.Provider, version getproviders.Version, bytesFetched, bytesTotal int64) {
+			evt := jsonInstallerEvent{
+				Type:         "download_progress",
+				Provider:     provider.String(),
+				Version:      version.String(),
+				BytesFetched: bytesFetched,
+			}
+			if bytesTotal > 0 {
+				evt.BytesTotal = bytesTotal
+			}
+			emit(evt)
+		},
+		FetchPackageSuccess: func(provider addrs.Provider, version getproviders.Version, localDir string, authResult *getproviders.PackageAuthenticationResult) {
+			verifyEvt := jsonInstallerEvent{
+				Type:     "verify",
+				Provider: provider.String(),
+				Version:  version.String(),
+			}
+			if authResult != nil {
+				verifyEvt.Authentication = authResult.String()
+				verifyEvt.Warning = authResult.Warning
+			}
+			emit(verifyEvt)
+			emit(jsonInstallerEvent{
+				Type:     "install_complete",
+				Provider: provider.String(),
+				Version:  version.String(),
+				Hash:     installedPackageHash(provider, version, localDir),
+			})
+		},
+		FetchPackageFailure: func(provider addrs.Provider, version getproviders.Version, err error) {
+			emitError(provider, version.String(), err)
+			*diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Failed to install provider",
+				fmt.Sprintf("Error while installing %s v%s: %s", provider.ForDisplay(), version, err),
+			))
+		},
+	}
+}
+
+// installedPackageHash computes the hash of a just-installed package
+// directory, returning an empty string (causing the field to be omitted)
+// if the directory can't be hashed for any reason.
+func installedPackageHash(provider addrs.Provider, version getproviders.Version, localDir string) string {
+	cached := &providercache.CachedProvider{
+		Provider:   provider,
+		Version:    version,
+		PackageDir: localDir,
+	}
+	hash, err := cached.Hash()
+	if err != nil {
+		return ""
+	}
+	return hash
+}
@@ -0,0 +1,57 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// TestInitJSONInstallerEvents drives the -json event callbacks directly with
+// a scripted installation sequence and compares the emitted stream against a
+// golden file, so that accidental changes to the output schema are caught.
+func TestInitJSONInstallerEvents(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := &InitCommand{
+		Meta: Meta{
+			Ui: ui,
+		},
+	}
+
+	var diags tfdiags.Diagnostics
+	evts := c.jsonInstallerEvents(&diags)
+
+	provider := addrs.NewDefaultProvider("test")
+	otherProvider := addrs.NewDefaultProvider("other")
+	version := getproviders.MustParseVersion("1.2.0")
+	packageDir := filepath.Join("testdata", "init-json-events", "package")
+
+	evts.QueryPackagesBegin(provider, getproviders.MustParseVersionConstraints(">= 1.0.0"))
+	evts.FetchPackageBegin(provider, version, getproviders.PackageHTTPURL("https://releases.example.com/terraform-provider-test_1.2.0_linux_amd64.zip"))
+	evts.FetchPackageProgress(provider, version, 1024, 4096)
+	evts.FetchPackageProgress(provider, version, 4096, -1)
+	evts.FetchPackageSuccess(provider, version, packageDir, nil)
+	evts.QueryPackagesFailure(otherProvider, fmt.Errorf("could not connect to registry.terraform.io"))
+
+	wantRaw, err := ioutil.ReadFile(filepath.Join("testdata", "init-json-events", "events.jsonl"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := string(wantRaw)
+	got := ui.OutputWriter.String()
+	if got != want {
+		t.Errorf("wrong events\ngot:\n%swant:\n%s", got, want)
+	}
+
+	// The query failure must also surface as a diagnostic so that init
+	// still exits nonzero in the machine-readable mode.
+	if !diags.HasErrors() {
+		t.Errorf("no error diagnostics; the query failure should have produced one")
+	}
+}
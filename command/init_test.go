@@ -49,6 +49,50 @@ func TestInit_empty(t *testing.T) {
 	}
 }
 
+func TestInit_customInstallerEvents(t *testing.T) {
+	td := tempDir(t)
+	copy.CopyDir(testFixturePath("init-get-providers"), td)
+	defer os.RemoveAll(td)
+	defer testChdir(t, td)()
+
+	providerSource, close := newMockProviderSource(t, map[string][]string{
+		"exact":        []string{"1.2.3"},
+		"greater-than": []string{"2.3.4", "2.3.3", "2.3.0"},
+		"between":      []string{"3.4.5", "2.3.4", "1.2.3"},
+	})
+	defer close()
+
+	// An embedding program can take over installation progress reporting
+	// entirely by providing its own events through the Meta.
+	gotPending := false
+	evts := &providercache.InstallerEvents{
+		PendingProviders: func(reqs map[addrs.Provider]getproviders.VersionConstraints) {
+			gotPending = true
+		},
+	}
+
+	ui := new(cli.MockUi)
+	c := &InitCommand{
+		Meta: Meta{
+			testingOverrides:        metaOverridesForProvider(testProvider()),
+			Ui:                      ui,
+			ProviderSource:          providerSource,
+			ProviderInstallerEvents: evts,
+		},
+	}
+
+	args := []string{"-backend=false"}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: \n%s", ui.ErrorWriter.String())
+	}
+	if !gotPending {
+		t.Errorf("the custom PendingProviders event was never called")
+	}
+	if got := ui.OutputWriter.String(); strings.Contains(got, "Initializing provider plugins") {
+		t.Errorf("the default provider installation output was printed despite the custom events:\n%s", got)
+	}
+}
+
 func TestInit_multipleArgs(t *testing.T) {
 	// Create a temporary working directory that is empty
 	td := tempDir(t)
@@ -770,6 +814,59 @@ func TestInit_inputFalse(t *testing.T) {
 	}
 }
 
+func TestInit_dryRun(t *testing.T) {
+	// Create a temporary working directory that is empty
+	td := tempDir(t)
+	copy.CopyDir(testFixturePath("init-get-providers"), td)
+	defer os.RemoveAll(td)
+	defer testChdir(t, td)()
+
+	overrides := metaOverridesForProvider(testProvider())
+	ui := new(cli.MockUi)
+	providerSource, close := newMockProviderSource(t, map[string][]string{
+		"exact":        []string{"1.2.3"},
+		"greater-than": []string{"2.3.4", "2.3.3", "2.3.0"},
+		"between":      []string{"3.4.5", "2.3.4", "1.2.3"},
+	})
+	defer close()
+	m := Meta{
+		testingOverrides: overrides,
+		Ui:               ui,
+		ProviderSource:   providerSource,
+	}
+
+	c := &InitCommand{
+		Meta: m,
+	}
+
+	args := []string{
+		"-dry-run",
+	}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: \n%s", ui.ErrorWriter.String())
+	}
+
+	// The report must name the versions that installation would select.
+	output := ui.OutputWriter.String()
+	if !strings.Contains(output, "Provider packages that would be installed:") {
+		t.Errorf("output does not announce the planned packages:\n%s", output)
+	}
+	for _, want := range []string{
+		"hashicorp/exact v1.2.3",
+		"hashicorp/greater-than v2.3.4",
+		"hashicorp/between v2.3.4",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("planned packages do not mention %q:\n%s", want, output)
+		}
+	}
+
+	// Nothing may have been installed.
+	if _, err := os.Stat(".terraform/plugins"); !os.IsNotExist(err) {
+		t.Errorf("dry run created the local provider cache directory")
+	}
+}
+
 func TestInit_getProvider(t *testing.T) {
 	// Create a temporary working directory that is empty
 	td := tempDir(t)
@@ -6,12 +6,14 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/terraform-svchost/disco"
@@ -24,6 +26,7 @@ import (
 	"github.com/hashicorp/terraform/helper/experiment"
 	"github.com/hashicorp/terraform/helper/wrappedstreams"
 	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
 	"github.com/hashicorp/terraform/providers"
 	"github.com/hashicorp/terraform/provisioners"
 	"github.com/hashicorp/terraform/terraform"
@@ -75,11 +78,181 @@ type Meta struct {
 	// into the given directory.
 	PluginCacheDir string
 
+	// PluginCacheMaxSizeMB and PluginCacheMaxAgeDays, when non-zero,
+	// enable eviction of least-recently-used packages from PluginCacheDir
+	// after each successful provider installation run, limiting the cache
+	// by total size and by time since last use respectively.
+	PluginCacheMaxSizeMB  int
+	PluginCacheMaxAgeDays int
+
+	// ProviderCacheDirOverrides optionally maps provider source address
+	// strings to alternative cache directories, so that the packages for
+	// particular providers can be resolved from somewhere other than the
+	// default configuration-specific cache directory.
+	ProviderCacheDirOverrides map[string]string
+
+	// ProviderDevOverrides optionally maps provider source address strings
+	// to locally-built provider executables (or directories containing
+	// them) that take the place of whatever package is installed for that
+	// provider, bypassing installation and checksum verification entirely.
+	// The TF_PROVIDER_DEV_OVERRIDES environment variable can add to or
+	// replace entries in this map.
+	ProviderDevOverrides map[string]string
+
 	// ProviderSource allows determining the available versions of a provider
 	// and determines where a distribution package for a particular
 	// provider version can be obtained.
 	ProviderSource getproviders.Source
 
+	// ProviderSigningPolicy optionally configures signature verification
+	// for provider packages installed from mirror directories, including
+	// the directories named with the -plugin-dir option. It comes from the
+	// provider_signing block in the CLI configuration.
+	ProviderSigningPolicy *getproviders.MirrorSigningPolicy
+
+	// AdditionalBuiltinProviders optionally registers extra in-process
+	// providers in the special terraform.io/builtin/... namespace, for
+	// programs that embed the command package and want to offer providers
+	// of their own without a separate installation step. The names here
+	// must not collide with the providers that are built in to Terraform
+	// itself, such as "terraform"; registering such a name panics at
+	// startup.
+	AdditionalBuiltinProviders map[string]providers.Factory
+
+	// DisableBuiltinTerraformProvider omits the built-in "terraform"
+	// provider from the set of always-available providers, for restricted
+	// distributions that must forbid its data sources. A configuration
+	// that uses the provider anyway then fails with the usual diagnostic
+	// for an unavailable provider. This cannot be combined with an
+	// AdditionalBuiltinProviders entry reusing the "terraform" name.
+	DisableBuiltinTerraformProvider bool
+
+	// TestProviderFactories optionally supplies in-memory provider
+	// implementations for use by tests of command flows, keyed by the
+	// provider addresses they stand in for. providerFactories merges these
+	// last, so a matching entry overrides whatever the installer, a dev
+	// override, or a reattach configuration would have produced for the
+	// same address. Setting this outside of a "go test" binary is an
+	// error, so it can't be abused to redirect real operations.
+	TestProviderFactories map[addrs.Provider]providers.Factory
+
+	// PluginLogWriter, if non-nil, receives the log output of all provider
+	// plugin processes, both managed and unmanaged. When nil the plugin
+	// logs go to stderr, intermingled with Terraform's own output, which
+	// is the historical behavior.
+	PluginLogWriter io.Writer
+
+	// PluginLogDir, if non-empty, names a directory where each provider's
+	// plugin log output is written to its own append-only file, named
+	// after the provider address and the Terraform process id. This takes
+	// precedence over PluginLogWriter. Files are rotated once they exceed
+	// a size limit, so they don't grow without bound. The
+	// TF_PROVIDER_LOG_DIR environment variable provides the same behavior
+	// when this field is unset.
+	PluginLogDir string
+
+	// ProviderInstallerEvents, if non-nil, replaces the CLI's own progress
+	// output during provider installation. Programs that embed Terraform
+	// and present their own UX can set this to observe each installation
+	// phase, including per-provider download progress, and render it
+	// however they like. When nil, "terraform init" prints its usual
+	// human-oriented (or, with -json, machine-readable) progress reports.
+	ProviderInstallerEvents *providercache.InstallerEvents
+
+	// PluginLifecycleEvents, if non-nil, receives notifications at the key
+	// points in each provider plugin's lifecycle: launch, handshake,
+	// dispense, and teardown. Programs that embed Terraform can use this to
+	// feed their own tracing or metrics systems. When nil, the lifecycle
+	// is not reported anywhere other than the usual logs.
+	PluginLifecycleEvents *PluginLifecycleEvents
+
+	// ProviderInstallOffline, if set, restricts provider installation to
+	// local sources only: any part of ProviderSource that would consult a
+	// registry or a network mirror is disabled, leaving only filesystem
+	// mirrors and the global plugin cache. This is set by the -offline
+	// option to "terraform init" and by the TF_PROVIDER_INSTALL_OFFLINE
+	// environment variable.
+	ProviderInstallOffline bool
+
+	// providerLockfileReadOnly, if set, makes provider installation verify
+	// the requirements against the recorded lock data without changing it,
+	// failing if any selection or hash would change. This is set by the
+	// -lockfile=readonly option to "terraform init".
+	providerLockfileReadOnly bool
+
+	// ProviderEnvAllowlist, when non-empty, restricts the environment
+	// variables passed to launched provider processes to only the named
+	// variables. ProviderEnvDenylist withholds the named variables while
+	// passing everything else through. When both are empty, providers
+	// inherit the full Terraform environment, which is the historical
+	// behavior. Both lists name variables without values, e.g. "AWS_PROFILE".
+	ProviderEnvAllowlist []string
+	ProviderEnvDenylist  []string
+
+	// ProviderMinimalEnv, if set, launches providers with only a small
+	// baseline environment (PATH, HOME, and platform equivalents) plus
+	// whatever ProviderEnvAllowlist names, instead of the full Terraform
+	// environment. This is for multi-tenant setups where provider binaries
+	// from different sources must not see each other's secrets. The
+	// TF_PROVIDER_MINIMAL_ENV environment variable enables the same mode.
+	ProviderMinimalEnv bool
+
+	// ProviderMemoryLimitMB and ProviderCPULimitSeconds, when non-zero,
+	// apply OS-level resource limits to launched provider processes so a
+	// runaway provider cannot take down a shared host. On platforms that
+	// can't apply a given limit to a child process the setting is ignored
+	// with a debug log.
+	ProviderMemoryLimitMB   int
+	ProviderCPULimitSeconds int
+
+	// DisablePluginTLS, if set, turns off the automatic mutual TLS that
+	// normally protects connections to provider plugins. This exists for
+	// local development against providers launched under a debugger, where
+	// the certificate exchange gets in the way; the default is always
+	// TLS on.
+	DisablePluginTLS bool
+
+	// ProviderClientPooling, if set, shares one running subprocess per
+	// provider between all factory invocations in this command, with the
+	// process terminated when its last consumer is closed. Off by default
+	// because pooled consumers share a single Configure call and all
+	// observe a crash together. TF_PROVIDER_CLIENT_POOL enables the same
+	// behavior.
+	ProviderClientPooling bool
+
+	// ProviderReuseExperiment, if set, enables the experimental sharing of
+	// one provider process between aliased configurations of the same
+	// provider, implying ProviderClientPooling. The aliases must all use
+	// identical provider configurations, and a crash of the shared process
+	// is observed by every alias. TF_EXPERIMENT_PROVIDER_REUSE enables the
+	// same behavior.
+	ProviderReuseExperiment bool
+
+	// providerPool is the lazily-created pool backing
+	// ProviderClientPooling and ProviderReuseExperiment.
+	providerPool *providerClientPool
+
+	// warmedProviders holds provider instances that WarmProviders launched
+	// ahead of need, until a factory call consumes them.
+	warmedProviders *warmedProviderSet
+
+	// providerStartupTimes accumulates how long each provider launched by
+	// this command took from the start of its plugin launch to a
+	// successful dispense, for the startup timing report. Guarded by
+	// providerStartupMu because providers can launch concurrently; the
+	// mutex is behind a pointer because Meta values get copied around,
+	// and is created along with the recording sink. See
+	// Meta.ProviderStartupTimes for the reader side.
+	providerStartupMu    *sync.Mutex
+	providerStartupTimes map[addrs.Provider][]time.Duration
+
+	// ProviderParallelism, when positive, limits how many provider
+	// processes launched by this command may run at the same time;
+	// additional launches wait for a running provider to be closed.
+	// Zero means no limit. Unmanaged (reattached) providers are already
+	// running and so don't count against the limit.
+	ProviderParallelism int
+
 	// OverrideDataDir, if non-empty, overrides the return value of the
 	// DataDir method for situations where the local .terraform/ directory
 	// is not suitable, e.g. because of a read-only filesystem.
@@ -166,6 +339,12 @@ type Meta struct {
 	//
 	// compactWarnings (-compact-warnings) selects a more compact presentation
 	// of warnings in the output when they are not accompanied by errors.
+	//
+	// noSchemaCache (-no-schema-cache) bypasses the persisted provider
+	// schema cache, forcing every schema to be fetched from a live
+	// provider. Provider developers iterating on a schema with dev
+	// overrides need this because their package contents (and so the cache
+	// key) may not change between builds.
 	statePath        string
 	stateOutPath     string
 	backupPath       string
@@ -176,6 +355,7 @@ type Meta struct {
 	forceInitCopy    bool
 	reconfigure      bool
 	compactWarnings  bool
+	noSchemaCache    bool
 
 	// Used with the import command to allow import of state when no matching config exists.
 	allowMissingConfig bool
@@ -400,6 +580,7 @@ func (m *Meta) extendedFlagSet(n string) *flag.FlagSet {
 	f.BoolVar(&m.input, "input", true, "input")
 	f.Var((*FlagTargetSlice)(&m.targets), "target", "resource to target")
 	f.BoolVar(&m.compactWarnings, "compact-warnings", false, "use compact warnings")
+	f.BoolVar(&m.noSchemaCache, "no-schema-cache", false, "bypass the persisted provider schema cache")
 
 	if m.variableArgs.items == nil {
 		m.variableArgs = newRawFlags("-var")
@@ -1,13 +1,25 @@
 package command
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	hclog "github.com/hashicorp/go-hclog"
 	plugin "github.com/hashicorp/go-plugin"
+	homedir "github.com/mitchellh/go-homedir"
 
 	"github.com/hashicorp/terraform/addrs"
 	terraformProvider "github.com/hashicorp/terraform/builtin/providers/terraform"
@@ -15,15 +27,28 @@ import (
 	"github.com/hashicorp/terraform/internal/providercache"
 	tfplugin "github.com/hashicorp/terraform/plugin"
 	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/tfdiags"
 )
 
 // The TF_DISABLE_PLUGIN_TLS environment variable is intended only for use by
 // the plugin SDK test framework, to reduce startup overhead when rapidly
 // launching and killing lots of instances of the same provider.
 //
-// This is not intended to be set by end-users.
+// This is not intended to be set by end-users; they should use the
+// DisablePluginTLS field on Meta instead, via whatever flag the command
+// surfaces it as.
 var enableProviderAutoMTLS = os.Getenv("TF_DISABLE_PLUGIN_TLS") == ""
 
+// pluginAutoMTLS returns whether provider plugin connections should be
+// protected by go-plugin's AutoMTLS, which is the default. It is disabled
+// either by the Meta-level DisablePluginTLS setting -- the sanctioned way,
+// for example when providers run under a debugger where the certificate
+// exchange gets in the way -- or by the TF_DISABLE_PLUGIN_TLS environment
+// variable that the plugin SDK's test framework relies on.
+func (m *Meta) pluginAutoMTLS() bool {
+	return enableProviderAutoMTLS && !m.DisablePluginTLS
+}
+
 // providerInstaller returns an object that knows how to install providers and
 // how to recover the selections from a prior installation process.
 //
@@ -55,13 +80,28 @@ func (m *Meta) providerInstallerCustomSource(source getproviders.Source) *provid
 	targetDir := m.providerLocalCacheDir()
 	globalCacheDir := m.providerGlobalCacheDir()
 	inst := providercache.NewInstaller(targetDir, source)
+	inst.SetLockTimeout(providerCacheLockTimeout())
+	inst.SetLockfileReadOnly(m.providerLockfileReadOnly)
+	inst.SetConcurrency(providerInstallConcurrency())
+	inst.SetDownloadRateLimit(providerDownloadRateLimit())
 	if globalCacheDir != nil {
 		inst.SetGlobalCacheDir(globalCacheDir)
+		if m.PluginCacheMaxSizeMB > 0 || m.PluginCacheMaxAgeDays > 0 {
+			inst.SetGlobalCacheEvictionPolicy(providercache.CacheEvictionPolicy{
+				MaxSize: int64(m.PluginCacheMaxSizeMB) * 1024 * 1024,
+				MaxAge:  time.Duration(m.PluginCacheMaxAgeDays) * 24 * time.Hour,
+			})
+		}
 	}
+	// The set here includes both Terraform's own built-in providers and any
+	// extras registered in AdditionalBuiltinProviders by an embedding
+	// program, sorted so that the installer sees them in a consistent order
+	// regardless of map iteration.
 	var builtinProviderTypes []string
 	for ty := range m.internalProviders() {
 		builtinProviderTypes = append(builtinProviderTypes, ty)
 	}
+	sort.Strings(builtinProviderTypes)
 	inst.SetBuiltInProviderTypes(builtinProviderTypes)
 	return inst
 }
@@ -75,14 +115,161 @@ func (m *Meta) providerInstallerCustomSource(source getproviders.Source) *provid
 //
 // If the given list of directories is empty then the resulting source will
 // have no providers available for installation at all.
-func (m *Meta) providerCustomLocalDirectorySource(dirs []string) getproviders.Source {
+// Each of the given paths may also be a shell-style glob pattern, in which
+// case every directory it matches becomes its own filesystem mirror source.
+// A pattern that matches no directories is an error, because silently
+// installing from an empty source would just produce a confusing "provider
+// not found" failure later.
+// A path ending in "/..." instead names a root directory to search
+// recursively: every directory beneath it that contains the registry-style
+// hostname/namespace/type mirror layout becomes its own source, and
+// directories that don't match that layout are skipped.
+//
+// Each path is canonicalized before use: a leading ~ is expanded to the
+// current user's home directory and relative paths are resolved against the
+// current working directory, so later working-directory changes can't
+// silently redirect the search. A literal path that doesn't exist or isn't
+// a directory is an error naming the resolved absolute path.
+//
+// With optional set, an entry that resolves to no directories at all is
+// skipped instead of being an error, for callers that pass a speculative
+// set of search locations. The glob matches for each entry are used in
+// lexical order, so precedence between them is deterministic.
+func (m *Meta) providerCustomLocalDirectorySource(dirs []string, optional bool) (getproviders.Source, error) {
 	var ret getproviders.MultiSource
 	for _, dir := range dirs {
-		ret = append(ret, getproviders.MultiSourceSelector{
-			Source: getproviders.NewFilesystemMirrorSource(dir),
-		})
+		dir, err := homedir.Expand(dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot expand the home directory in -plugin-dir path %q: %s", dir, err)
+		}
+		expanded, err := expandPluginDirGlob(dir, optional)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range expanded {
+			absDir, err := filepath.Abs(dir)
+			if err != nil {
+				return nil, fmt.Errorf("cannot resolve -plugin-dir path %q: %s", dir, err)
+			}
+			if info, err := os.Stat(absDir); err != nil {
+				if optional {
+					continue
+				}
+				return nil, fmt.Errorf("the -plugin-dir directory %s does not exist", absDir)
+			} else if !info.IsDir() {
+				return nil, fmt.Errorf("the -plugin-dir path %s is not a directory", absDir)
+			}
+			fsSource := getproviders.NewFilesystemMirrorSource(absDir)
+			if m.ProviderSigningPolicy != nil {
+				fsSource.SetSigningPolicy(m.ProviderSigningPolicy)
+			}
+			ret = append(ret, getproviders.MultiSourceSelector{
+				Source: fsSource,
+			})
+		}
 	}
-	return ret
+	return ret, nil
+}
+
+// expandPluginDirGlob expands one -plugin-dir argument into the directories
+// it refers to. A path without any glob metacharacters is returned verbatim,
+// leaving it to the caller to decide whether the path must exist. With
+// optional set, a pattern that matches nothing expands to no directories
+// instead of being an error.
+func expandPluginDirGlob(pattern string, optional bool) ([]string, error) {
+	if root := strings.TrimSuffix(pattern, "/..."); root != pattern {
+		return discoverPluginMirrorDirs(root, optional)
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+	// Patterns are accepted with either separator, since on Windows it's
+	// common to write them with forward slashes to avoid any confusion
+	// with the escaping rules of the shell in use.
+	matches, err := filepath.Glob(filepath.FromSlash(pattern))
+	if err != nil {
+		return nil, fmt.Errorf("invalid -plugin-dir glob pattern %q: %s", pattern, err)
+	}
+	var dirs []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			dirs = append(dirs, match)
+		}
+	}
+	if len(dirs) == 0 && !optional {
+		return nil, fmt.Errorf("the -plugin-dir glob pattern %q matched no directories", pattern)
+	}
+	// filepath.Glob already returns its matches in lexical order, so the
+	// precedence between the resulting sources is deterministic.
+	return dirs, nil
+}
+
+// discoverPluginMirrorDirs walks the directory tree under the given root
+// and returns every directory that is itself the root of a registry-style
+// filesystem mirror, which we recognize by it containing at least one
+// hostname/namespace/type chain of subdirectories. Directories that don't
+// match that layout are skipped silently, so a vendor tree can mix mirror
+// directories with unrelated content.
+func discoverPluginMirrorDirs(root string, optional bool) ([]string, error) {
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if !looksLikePluginMirrorDir(path) {
+			return nil
+		}
+		dirs = append(dirs, path)
+		// A mirror root's own subdirectories are provider packages, not
+		// further mirrors, so there's no reason to descend into them.
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot search for provider mirror directories under %q: %s", root, err)
+	}
+	if len(dirs) == 0 && !optional {
+		return nil, fmt.Errorf("no provider mirror directories were found under %q", root)
+	}
+	return dirs, nil
+}
+
+// looksLikePluginMirrorDir decides whether the given directory directly
+// contains the hostname/namespace/type layout that
+// getproviders.FilesystemMirrorSource expects at its root. The hostname
+// level is recognized by containing a dot, which distinguishes it from the
+// namespace and type levels.
+func looksLikePluginMirrorDir(dir string) bool {
+	hosts, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, host := range hosts {
+		if !host.IsDir() || !strings.Contains(host.Name(), ".") {
+			continue
+		}
+		namespaces, err := ioutil.ReadDir(filepath.Join(dir, host.Name()))
+		if err != nil {
+			continue
+		}
+		for _, namespace := range namespaces {
+			if !namespace.IsDir() {
+				continue
+			}
+			types, err := ioutil.ReadDir(filepath.Join(dir, host.Name(), namespace.Name()))
+			if err != nil {
+				continue
+			}
+			for _, typeName := range types {
+				if typeName.IsDir() {
+					return true
+				}
+			}
+		}
+	}
+	return false
 }
 
 // providerLocalCacheDir returns an object representing the
@@ -101,7 +288,149 @@ func (m *Meta) providerLocalCacheDir() *providercache.Dir {
 	if dir == "" {
 		return nil // cache disabled
 	}
-	return providercache.NewDir(dir)
+	ret := providercache.NewDir(dir)
+	ret.SetForceCopy(providerCacheForceCopy())
+	return ret
+}
+
+// providerCacheDirOverrides returns the per-provider alternative cache
+// directories configured via provider_cache_dir_overrides in the CLI
+// configuration, keyed by parsed provider address. Entries whose keys are
+// not valid provider source addresses are skipped with a log message;
+// the CLI config loader reports them to the user as errors already.
+//
+// The result is nil when no overrides are configured, which is the common
+// case.
+func (m *Meta) providerCacheDirOverrides() map[addrs.Provider]*providercache.Dir {
+	if len(m.ProviderCacheDirOverrides) == 0 {
+		return nil
+	}
+	ret := make(map[addrs.Provider]*providercache.Dir, len(m.ProviderCacheDirOverrides))
+	for addrStr, dir := range m.ProviderCacheDirOverrides {
+		provider, diags := addrs.ParseProviderSourceString(addrStr)
+		if diags.HasErrors() {
+			log.Printf("[WARN] ignoring cache dir override for invalid provider address %q", addrStr)
+			continue
+		}
+		ret[provider] = providercache.NewDir(dir)
+	}
+	return ret
+}
+
+// providerVerifyOnLaunch decides whether provider factories should recompute
+// each package's checksum immediately before launching its executable,
+// rather than trusting the verification done when the selections were first
+// recalled. TF_PROVIDER_VERIFY_ON_LAUNCH opts in to the extra check, which
+// matters for deployments that must detect a cached binary being swapped
+// between "terraform init" and a later operation, at the cost of rehashing
+// the package on every launch.
+func providerVerifyOnLaunch() bool {
+	return os.Getenv("TF_PROVIDER_VERIFY_ON_LAUNCH") != ""
+}
+
+// verifyOnLaunchFactory wraps a provider factory so that each call first
+// recomputes the package's checksum and compares it against the one recorded
+// by "terraform init", refusing to launch the executable if they disagree.
+func verifyOnLaunchFactory(factory providers.Factory, meta *providercache.CachedProvider, expectedHash string) providers.Factory {
+	return func() (providers.Interface, error) {
+		actualHash, err := meta.Hash()
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify checksum of %s v%s before launch: %s", meta.Provider.ForDisplay(), meta.Version, err)
+		}
+		if actualHash != expectedHash {
+			return nil, fmt.Errorf("the package for %s v%s was modified after 'terraform init' selected it: recorded checksum %s, but the package now has checksum %s; refusing to launch the possibly-tampered-with executable", meta.Provider.ForDisplay(), meta.Version, expectedHash, actualHash)
+		}
+		return factory()
+	}
+}
+
+// providerCacheForceCopy decides whether installation into the local cache
+// directory should always deep-copy provider packages, rather than preferring
+// symlinks or hard links from the global cache. Links are normally the best
+// choice because they avoid duplicating package contents on disk, but some
+// filesystems and backup tools mishandle them, so TF_PLUGIN_CACHE_FORCE_COPY
+// provides an escape hatch.
+func providerCacheForceCopy() bool {
+	return os.Getenv("TF_PLUGIN_CACHE_FORCE_COPY") != ""
+}
+
+// providerCacheLockTimeout decides how long provider installation will wait
+// for the exclusive lock on a cache directory that another Terraform process
+// is holding, such as when several "terraform init" runs share a plugin
+// cache in a CI matrix. The default is to wait indefinitely, which preserves
+// the behavior from before the lock timeout existed; setting
+// TF_PLUGIN_CACHE_LOCK_TIMEOUT to a duration like "90s" makes contended
+// installs fail with an error instead of hanging.
+func providerCacheLockTimeout() time.Duration {
+	raw := os.Getenv("TF_PLUGIN_CACHE_LOCK_TIMEOUT")
+	if raw == "" {
+		return 0
+	}
+	timeout, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("[WARN] invalid TF_PLUGIN_CACHE_LOCK_TIMEOUT %q: %s; waiting indefinitely instead", raw, err)
+		return 0
+	}
+	return timeout
+}
+
+// providerInstallConcurrency decides the default limit on simultaneous
+// provider package downloads during installation, which the
+// -plugin-concurrency option to "terraform init" can override. Setting
+// TF_PROVIDER_INSTALL_CONCURRENCY to a small number like 1 or 2 is a way
+// to stay under a mirror's connection limits without passing the flag on
+// every run; zero (the default) selects the installer's own default.
+func providerInstallConcurrency() int {
+	raw := os.Getenv("TF_PROVIDER_INSTALL_CONCURRENCY")
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		log.Printf("[WARN] invalid TF_PROVIDER_INSTALL_CONCURRENCY %q: must be a positive whole number; using the default concurrency instead", raw)
+		return 0
+	}
+	return n
+}
+
+// providerDownloadRateLimit decides the limit on aggregate provider package
+// download throughput, in bytes per second, from the
+// TF_PROVIDER_DOWNLOAD_LIMIT environment variable. The value is a number of
+// bytes with an optional KB, MB, or GB suffix, such as "5MB".
+//
+// Zero, which is also the result for an unset or invalid value, means no
+// throttling.
+func providerDownloadRateLimit() int64 {
+	raw := os.Getenv("TF_PROVIDER_DOWNLOAD_LIMIT")
+	if raw == "" {
+		return 0
+	}
+	// The rate is inherently per second, so an explicit "/s" as in "10MB/s"
+	// is accepted and means the same thing as just "10MB".
+	rate := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(raw)), "/S")
+	numStr := rate
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1024 * 1024 * 1024},
+		{"MB", 1024 * 1024},
+		{"KB", 1024},
+		{"B", 1},
+	} {
+		if trimmed := strings.TrimSuffix(rate, unit.suffix); trimmed != rate {
+			numStr = trimmed
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(numStr), 10, 64)
+	if err != nil || n < 1 {
+		log.Printf("[WARN] invalid TF_PROVIDER_DOWNLOAD_LIMIT %q: must be a positive number of bytes per second, optionally with a KB, MB, or GB suffix and a trailing \"/s\"; downloads will not be throttled", raw)
+		return 0
+	}
+	return n * multiplier
 }
 
 // providerGlobalCacheDir returns an object representing the shared global
@@ -143,9 +472,23 @@ func (m *Meta) providerInstallSource() getproviders.Source {
 		// always-empty source.
 		return getproviders.MultiSource(nil)
 	}
+	if m.providerInstallIsOffline() {
+		// In offline mode we strip out anything in the configured source
+		// that would require network access, leaving only local filesystem
+		// mirror directories (and, separately, the global plugin cache).
+		return newOfflineProviderSource(m.ProviderSource)
+	}
 	return m.ProviderSource
 }
 
+// providerInstallIsOffline decides whether provider installation should be
+// restricted to local sources only, either because the user passed -offline
+// to "terraform init" or because the TF_PROVIDER_INSTALL_OFFLINE environment
+// variable is set.
+func (m *Meta) providerInstallIsOffline() bool {
+	return m.ProviderInstallOffline || os.Getenv("TF_PROVIDER_INSTALL_OFFLINE") != ""
+}
+
 // providerFactories uses the selections made previously by an installer in
 // the local cache directory (m.providerLocalCacheDir) to produce a map
 // from provider addresses to factory functions to create instances of
@@ -161,10 +504,71 @@ func (m *Meta) providerFactories() (map[addrs.Provider]providers.Factory, error)
 	// providerInstallerCustomSource here because we're only using this
 	// installer for its SelectedPackages method, which does not consult
 	// any provider sources.
+	// Validate the startup timeout setting up front, so that a typo in the
+	// environment fails before any operation begins rather than partway
+	// through an apply.
+	if _, err := pluginStartTimeoutConfig(); err != nil {
+		return nil, err
+	}
+	// The TLS settings get the same up-front validation, for the same
+	// reason.
+	if _, err := providerTLSConfig(); err != nil {
+		return nil, err
+	}
+
 	inst := m.providerInstaller()
-	selected, err := inst.SelectedPackages()
-	if err != nil {
-		return nil, fmt.Errorf("failed to recall provider packages selected by earlier 'terraform init': %s", err)
+	selected, selErr := inst.SelectedPackages()
+	var selErrs map[addrs.Provider]error
+	if selErr != nil {
+		instErr, ok := selErr.(providercache.InstallerError)
+		if !ok {
+			return nil, fmt.Errorf("failed to recall provider packages selected by earlier 'terraform init': %s", selErr)
+		}
+		// A providercache.InstallerError means that one or more of the
+		// selected packages is no longer usable, but "selected" still
+		// contains every package that verified correctly, so we continue
+		// building factories for those and report all of the problems
+		// together below rather than stopping at the first one.
+		selErrs = instErr.ProviderErrors
+	}
+
+	// Development overrides replace whatever the installer selected for the
+	// affected providers, including any problems the selections had: a
+	// developer pointing at a locally-built binary doesn't care that the
+	// installed package it shadows is broken.
+	devOverrides := m.providerDevOverrides()
+	for provider, path := range devOverrides {
+		cached, err := devOverrideCachedProvider(provider, path)
+		if err != nil {
+			return nil, err
+		}
+		delete(selErrs, provider)
+		selected[provider] = cached
+	}
+	if len(devOverrides) > 0 && m.Ui != nil {
+		// The same prominent notice appears in init, so that no operation
+		// using overridden providers can be mistaken for one using the
+		// installed packages.
+		m.Ui.Warn(devOverridesNotice(devOverrides) + "\n")
+	}
+
+	// Advisory warnings recorded when these packages were selected -- such
+	// as a registry marking a provider version as deprecated -- are repeated
+	// on every run, so they stay visible beyond the init that first
+	// reported them.
+	if warnings, err := inst.SelectedPackageWarnings(); err == nil && len(warnings) > 0 && m.Ui != nil {
+		warnedProviders := make([]addrs.Provider, 0, len(warnings))
+		for provider := range warnings {
+			warnedProviders = append(warnedProviders, provider)
+		}
+		sort.Slice(warnedProviders, func(i, j int) bool {
+			return warnedProviders[i].String() < warnedProviders[j].String()
+		})
+		for _, provider := range warnedProviders {
+			for _, warning := range warnings[provider] {
+				m.Ui.Warn(fmt.Sprintf("Warning: %s %s", provider.ForDisplay(), warning))
+			}
+		}
 	}
 
 	// The internal providers are _always_ available, even if the configuration
@@ -176,54 +580,1137 @@ func (m *Meta) providerFactories() (map[addrs.Provider]providers.Factory, error)
 	for name, factory := range internalFactories {
 		factories[addrs.NewBuiltInProvider(name)] = factory
 	}
+	env := m.providerEnv()
+	limits := m.providerResourceLimits()
+	// All of the factories from this call share one semaphore, so the
+	// parallelism limit applies across every provider in the operation
+	// rather than per provider type.
+	sem := newProviderLaunchSemaphore(m.ProviderParallelism)
+	pool := m.providerClientPool()
+	autoMTLS := m.pluginAutoMTLS()
+	procState := m.providerProcessStateFile()
+	// Anything still recorded from an earlier run is an orphan left behind
+	// by a Terraform process that died without shutting its providers down,
+	// so we clean those up before launching new ones.
+	for _, rec := range procState.reapOrphans() {
+		log.Printf("[INFO] reaped orphaned provider process %d (%s) from a previous run", rec.Pid, rec.Executable)
+	}
+	// In verify-on-launch mode each factory re-checks its package against
+	// the checksum recorded at init time immediately before launching, to
+	// close the window in which a cached binary could be swapped between
+	// init and a later operation. The rehash is not free on large
+	// packages, so it's opt-in.
+	var launchHashes map[addrs.Provider]string
+	if providerVerifyOnLaunch() {
+		var err error
+		launchHashes, err = inst.SelectedPackageHashes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the recorded provider checksums: %s", err)
+		}
+		// A development override runs a binary the installer has never
+		// seen, so any hash recorded for a package it shadows must not be
+		// checked against it.
+		for provider := range devOverrides {
+			delete(launchHashes, provider)
+		}
+	}
+	cacheOverrides := m.providerCacheDirOverrides()
+	// The startup timing recorder wraps any sink the caller registered, so
+	// both see the same events.
+	lifecycleEvents := m.pluginLifecycleEventsWithMetrics()
+	warmed := m.warmedProviderSetInit()
 	for provider, cached := range selected {
-		factories[provider] = providerFactory(cached)
+		// A cache dir override redirects this provider to a package of the
+		// same selected version kept in an alternative directory, such as
+		// faster local storage. If the override directory doesn't have that
+		// version then we fall back to the default cache rather than
+		// failing, since the selection there has already been verified.
+		if overrideDir, exists := cacheOverrides[provider]; exists {
+			if alt := overrideDir.ProviderVersion(provider, cached.Version); alt != nil {
+				log.Printf("[DEBUG] using cache dir override for %s v%s", provider.ForDisplay(), cached.Version)
+				cached = alt
+			} else {
+				log.Printf("[WARN] cache dir override for %s does not contain the selected v%s, so the default cache directory is used instead", provider.ForDisplay(), cached.Version)
+			}
+		}
+		logOutput, err := m.pluginLogOutputFor(provider)
+		if err != nil {
+			return nil, err
+		}
+		factory := providerFactory(cached, logOutput, env, limits, sem, autoMTLS, procState, lifecycleEvents)
+		if expected, exists := launchHashes[provider]; exists && expected != "" {
+			factory = verifyOnLaunchFactory(factory, cached, expected)
+		}
+		if pool != nil {
+			factory = pool.Factory(providerPoolKey{
+				provider:   provider,
+				executable: cached.ExecutableFile,
+			}, factory)
+		}
+		// The lazy wrapper goes on the outside so that a schema served
+		// from the cache doesn't cost a launch (or a pool reference).
+		if cache := m.providerSchemaCacheFor(provider, cached); cache != nil {
+			factory = lazyProviderFactory(cache, factory)
+		}
+		factories[provider] = warmedProviderFactory(warmed, provider, factory)
+	}
+
+	// Any providers for which the user has supplied reattach information
+	// take priority over whatever the installer selected, because the
+	// whole point of the reattach mechanism is to connect to an
+	// already-running server that is standing in for the installed package.
+	unmanaged, err := unmanagedProviderConfigs()
+	if err != nil {
+		return nil, err
+	}
+	for provider, config := range unmanaged {
+		logOutput, err := m.pluginLogOutputFor(provider)
+		if err != nil {
+			return nil, err
+		}
+		factories[provider] = unmanagedProviderFactory(provider, config, logOutput, lifecycleEvents)
+	}
+
+	// Test doubles registered by a test harness are merged last so that
+	// they shadow whatever any of the mechanisms above resolved for the
+	// same addresses, giving command-level tests an in-memory provider
+	// without a plugin binary or a reattach process.
+	if len(m.TestProviderFactories) > 0 {
+		if !runningUnderGoTest() {
+			// This seam must never redirect a real operation, so outside of
+			// a test binary a populated map is an error rather than a no-op.
+			return nil, fmt.Errorf("TestProviderFactories is set, but this is not a test binary")
+		}
+		for provider, factory := range m.TestProviderFactories {
+			delete(selErrs, provider)
+			factories[provider] = factory
+		}
+	}
+
+	if len(selErrs) > 0 {
+		// We still return the partial factories map here so that callers
+		// that only inspect it, rather than launching anything, can proceed.
+		return factories, ProviderFactoriesError{
+			ProviderErrors: selErrs,
+			CacheDir:       filepath.Join(m.DataDir(), "plugins"),
+		}
 	}
 	return factories, nil
 }
 
+// ProviderFactoriesError is the error type that providerFactories returns
+// when the packages selected by the most recent 'terraform init' can no
+// longer all be honored, such as when a package was deleted or modified
+// after installation. It carries the affected provider addresses and the
+// cache directory they were expected in, so that callers can build a
+// structured presentation instead of parsing the flat message.
+type ProviderFactoriesError struct {
+	// ProviderErrors describes what is wrong with each affected provider's
+	// selected package.
+	ProviderErrors map[addrs.Provider]error
+
+	// CacheDir is the local cache directory the selections were recalled
+	// from.
+	CacheDir string
+}
+
+// Providers returns the affected provider addresses, sorted so that
+// reports based on them are deterministic between runs.
+func (err ProviderFactoriesError) Providers() []addrs.Provider {
+	providers := make([]addrs.Provider, 0, len(err.ProviderErrors))
+	for provider := range err.ProviderErrors {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].String() < providers[j].String()
+	})
+	return providers
+}
+
+// Error lists every affected provider in one message, so that a user with
+// several broken packages can learn about all of them from one failure
+// instead of fixing them one at a time.
+func (err ProviderFactoriesError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "the provider packages selected by the most recent 'terraform init' (in %s) are no longer all usable:", err.CacheDir)
+	for _, provider := range err.Providers() {
+		fmt.Fprintf(&b, "\n  - %s: %s", provider.ForDisplay(), err.ProviderErrors[provider])
+	}
+	b.WriteString("\n\nRun 'terraform init' to reinstall the affected providers.")
+	return b.String()
+}
+
+// Diagnostics converts the error into one diagnostic per affected provider,
+// each naming the provider, the cache directory, the problem, and the fix,
+// for callers that present failures through tfdiags.
+func (err ProviderFactoriesError) Diagnostics() tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	for _, provider := range err.Providers() {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Provider package is no longer usable",
+			fmt.Sprintf(
+				"The package that 'terraform init' installed for %s in %s can no longer be used: %s.\n\nRun 'terraform init' to reinstall this provider.",
+				provider.ForDisplay(), err.CacheDir, err.ProviderErrors[provider],
+			),
+		))
+	}
+	return diags
+}
+
+// runningUnderGoTest recognizes whether the current process is a "go test"
+// binary, by looking for one of the flags that the testing package always
+// registers.
+func runningUnderGoTest() bool {
+	return flag.Lookup("test.v") != nil
+}
+
 func (m *Meta) internalProviders() map[string]providers.Factory {
-	return map[string]providers.Factory{
+	ret := map[string]providers.Factory{
 		"terraform": func() (providers.Interface, error) {
 			return terraformProvider.NewProvider(), nil
 		},
 	}
+	for name, factory := range m.AdditionalBuiltinProviders {
+		if _, exists := ret[name]; exists {
+			// An embedder shadowing one of Terraform's own built-in
+			// providers would change the meaning of existing configurations,
+			// so that's always a mistake in the embedding program.
+			panic(fmt.Sprintf("additional builtin provider %q collides with a provider built in to Terraform", name))
+		}
+		ret[name] = factory
+	}
+	if m.DisableBuiltinTerraformProvider {
+		// The removal happens after the collision check above so that an
+		// embedding program can't use this flag to substitute its own
+		// provider under the reserved "terraform" name.
+		delete(ret, "terraform")
+	}
+	return ret
+}
+
+// providerMinimalEnvBase is the set of environment variables that launched
+// provider processes always receive in minimal environment mode, because a
+// subprocess can't reasonably run without them. Anything else must be opted
+// in via ProviderEnvAllowlist.
+var providerMinimalEnvBase = []string{
+	"PATH",
+	"HOME",
+	"TMPDIR",
+	"TEMP",       // Windows
+	"SystemRoot", // Windows
+}
+
+// providerEnv returns the environment to give to launched provider
+// processes, applying the ProviderMinimalEnv, ProviderEnvAllowlist, and
+// ProviderEnvDenylist settings to the current process environment. A nil
+// result means the provider should inherit the full environment, which is
+// what exec.Cmd does for a nil Env.
+func (m *Meta) providerEnv() []string {
+	minimal := m.ProviderMinimalEnv || os.Getenv("TF_PROVIDER_MINIMAL_ENV") != ""
+	if !minimal && len(m.ProviderEnvAllowlist) == 0 && len(m.ProviderEnvDenylist) == 0 {
+		return nil
+	}
+
+	allowed := make(map[string]bool, len(m.ProviderEnvAllowlist))
+	if minimal {
+		// In minimal mode everything is denied by default, so the baseline
+		// variables join the user's allowlist rather than the allowlist
+		// being optional.
+		for _, name := range providerMinimalEnvBase {
+			allowed[name] = true
+		}
+	}
+	for _, name := range m.ProviderEnvAllowlist {
+		allowed[name] = true
+	}
+	denied := make(map[string]bool, len(m.ProviderEnvDenylist))
+	for _, name := range m.ProviderEnvDenylist {
+		denied[name] = true
+	}
+
+	full := os.Environ()
+	env := make([]string, 0, len(full))
+	for _, entry := range full {
+		name := entry
+		if eq := strings.IndexByte(entry, '='); eq >= 0 {
+			name = entry[:eq]
+		}
+		if len(allowed) > 0 && !allowed[name] {
+			continue
+		}
+		if denied[name] {
+			continue
+		}
+		env = append(env, entry)
+	}
+	return env
+}
+
+// providerClientPool returns the pool through which provider instances are
+// shared when client pooling is enabled, or nil -- the default -- meaning
+// every factory call launches a fresh subprocess. Pooling is enabled by the
+// ProviderClientPooling field or the TF_PROVIDER_CLIENT_POOL environment
+// variable.
+// The provider reuse experiment (ProviderReuseExperiment or
+// TF_EXPERIMENT_PROVIDER_REUSE) also enables the pool and additionally
+// shares one process between aliased configurations of a provider, with
+// their Configure calls multiplexed over it.
+func (m *Meta) providerClientPool() *providerClientPool {
+	reuse := m.ProviderReuseExperiment || os.Getenv("TF_EXPERIMENT_PROVIDER_REUSE") != ""
+	pooling := m.ProviderClientPooling || os.Getenv("TF_PROVIDER_CLIENT_POOL") != ""
+	if !pooling && !reuse {
+		return nil
+	}
+	if m.providerPool == nil {
+		m.providerPool = newProviderClientPool()
+	}
+	m.providerPool.shareAliases = reuse
+	return m.providerPool
+}
+
+// PluginLifecycleEvents is a set of optional callbacks that are invoked at
+// the key points in a provider plugin's lifecycle, for callers that want to
+// observe plugin activity for tracing or metrics without changing how the
+// plugins behave. Set it via Meta.PluginLifecycleEvents.
+//
+// All of the callbacks are optional, and a nil PluginLifecycleEvents as a
+// whole is also valid, leaving behavior entirely unchanged. The callbacks
+// may be invoked concurrently for different providers, so any shared state
+// they touch must be synchronized by the callee.
+type PluginLifecycleEvents struct {
+	// LaunchStart is called when a provider launch begins: for a managed
+	// provider once its process is about to be started, and for an
+	// unmanaged provider once connection to its existing server begins.
+	LaunchStart func(provider addrs.Provider)
+
+	// HandshakeComplete is called once the plugin handshake has succeeded,
+	// with the protocol version that was negotiated and the time elapsed
+	// since LaunchStart for the same provider.
+	HandshakeComplete func(provider addrs.Provider, protocolVersion int, elapsed time.Duration)
+
+	// DispenseComplete is called once the provider interface is ready for
+	// the caller to use, with the total time elapsed since LaunchStart.
+	DispenseComplete func(provider addrs.Provider, elapsed time.Duration)
+
+	// Teardown is called after a provider connection has been closed, with
+	// the total time the provider was available, measured from LaunchStart.
+	Teardown func(provider addrs.Provider, uptime time.Duration)
+}
+
+// providerStartupMetricsEnvName names the environment variable that, when
+// set to a file path, causes every provider startup duration observed by
+// this process to be appended to that file as one JSON object per line, for
+// diagnosing which providers dominate startup cost.
+const providerStartupMetricsEnvName = "TF_PROVIDER_STARTUP_METRICS"
+
+// pluginLifecycleEventsWithMetrics returns the lifecycle event sink that
+// provider factories use: it records startup timing for the metrics kept on
+// Meta and then forwards every event to whatever sink the caller registered
+// in PluginLifecycleEvents.
+func (m *Meta) pluginLifecycleEventsWithMetrics() *PluginLifecycleEvents {
+	if m.providerStartupMu == nil {
+		m.providerStartupMu = new(sync.Mutex)
+	}
+	user := m.PluginLifecycleEvents
+	return &PluginLifecycleEvents{
+		LaunchStart: func(provider addrs.Provider) {
+			user.launchStart(provider)
+		},
+		HandshakeComplete: func(provider addrs.Provider, protocolVersion int, elapsed time.Duration) {
+			user.handshakeComplete(provider, protocolVersion, elapsed)
+		},
+		DispenseComplete: func(provider addrs.Provider, elapsed time.Duration) {
+			m.recordProviderStartup(provider, elapsed)
+			user.dispenseComplete(provider, elapsed)
+		},
+		Teardown: func(provider addrs.Provider, uptime time.Duration) {
+			user.teardown(provider, uptime)
+		},
+	}
+}
+
+// recordProviderStartup accumulates one observed provider startup duration,
+// measured from the start of the plugin launch to a successful dispense.
+func (m *Meta) recordProviderStartup(provider addrs.Provider, elapsed time.Duration) {
+	m.providerStartupMu.Lock()
+	if m.providerStartupTimes == nil {
+		m.providerStartupTimes = make(map[addrs.Provider][]time.Duration)
+	}
+	m.providerStartupTimes[provider] = append(m.providerStartupTimes[provider], elapsed)
+	m.providerStartupMu.Unlock()
+
+	log.Printf("[DEBUG] provider %s became ready in %s", provider, elapsed)
+	if filename := os.Getenv(providerStartupMetricsEnvName); filename != "" {
+		appendProviderStartupMetric(filename, provider, elapsed)
+	}
+}
+
+// ProviderStartupTimes returns the startup durations recorded so far for
+// each provider launched by this command, in launch order. A provider that
+// launched more than once, for example after a crash, has one entry per
+// launch. The result is a copy, so it stays valid while further providers
+// launch.
+func (m *Meta) ProviderStartupTimes() map[addrs.Provider][]time.Duration {
+	if m.providerStartupMu == nil { // no recording sink was ever built
+		return make(map[addrs.Provider][]time.Duration)
+	}
+	m.providerStartupMu.Lock()
+	defer m.providerStartupMu.Unlock()
+	ret := make(map[addrs.Provider][]time.Duration, len(m.providerStartupTimes))
+	for provider, times := range m.providerStartupTimes {
+		ret[provider] = append([]time.Duration(nil), times...)
+	}
+	return ret
+}
+
+// appendProviderStartupMetric appends one startup observation to the
+// metrics file named by TF_PROVIDER_STARTUP_METRICS. A failure to write is
+// only logged, because metrics collection must never break an operation.
+func appendProviderStartupMetric(filename string, provider addrs.Provider, elapsed time.Duration) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("[WARN] cannot write provider startup metric to %s: %s", filename, err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "{\"provider\":%q,\"startup_ms\":%d}\n", provider.String(), elapsed.Milliseconds())
+}
+
+// The unexported dispatch methods tolerate a nil receiver and nil callbacks
+// so that the factory code can call them unconditionally.
+
+func (e *PluginLifecycleEvents) launchStart(provider addrs.Provider) {
+	if e == nil || e.LaunchStart == nil {
+		return
+	}
+	e.LaunchStart(provider)
+}
+
+func (e *PluginLifecycleEvents) handshakeComplete(provider addrs.Provider, protocolVersion int, elapsed time.Duration) {
+	if e == nil || e.HandshakeComplete == nil {
+		return
+	}
+	e.HandshakeComplete(provider, protocolVersion, elapsed)
+}
+
+func (e *PluginLifecycleEvents) dispenseComplete(provider addrs.Provider, elapsed time.Duration) {
+	if e == nil || e.DispenseComplete == nil {
+		return
+	}
+	e.DispenseComplete(provider, elapsed)
+}
+
+func (e *PluginLifecycleEvents) teardown(provider addrs.Provider, uptime time.Duration) {
+	if e == nil || e.Teardown == nil {
+		return
+	}
+	e.Teardown(provider, uptime)
 }
 
 // providerFactory produces a provider factory that runs up the executable
 // file in the given cache package and uses go-plugin to implement
 // providers.Interface against it.
-func providerFactory(meta *providercache.CachedProvider) providers.Factory {
+//
+// logOutput receives the log output of the launched plugin process; a nil
+// value selects stderr.
+//
+// env is the environment for the launched process; nil means to inherit
+// the full environment of the Terraform process itself. limits, when
+// enabled, applies OS-level resource limits to the process after launch.
+// sem, when non-nil, bounds how many providers launched through it may be
+// running at once; the slot is held until the provider is closed.
+//
+// Unmanaged providers (see unmanagedProviderFactory) are deliberately not
+// subject to the semaphore, because their processes are already running
+// before Terraform connects to them.
+//
+// autoMTLS selects whether the connection is protected by go-plugin's
+// generated certificates; see Meta.pluginAutoMTLS.
+//
+// events, when non-nil, receives lifecycle notifications for each launch
+// the factory performs.
+func providerFactory(meta *providercache.CachedProvider, logOutput io.Writer, env []string, limits providerResourceLimits, sem *providerLaunchSemaphore, autoMTLS bool, procState *providerProcessState, events *PluginLifecycleEvents) providers.Factory {
 	return func() (providers.Interface, error) {
+		if err := sem.Acquire(defaultProviderLaunchWait); err != nil {
+			return nil, fmt.Errorf("failed to start provider %s: %s", meta.Provider, err)
+		}
+		// The launch is considered to start only once a semaphore slot is
+		// held, so that time spent queued behind other providers isn't
+		// counted against this one.
+		launchedAt := time.Now()
+		events.launchStart(meta.Provider)
+		// The slot is released by gracefulShutdownProvider.Close on success;
+		// on any failure path below it must be released here instead.
+		launched := false
+		defer func() {
+			if !launched {
+				sem.Release()
+			}
+		}()
+
 		logger := hclog.New(&hclog.LoggerOptions{
 			Name:   "plugin",
-			Level:  hclog.Trace,
-			Output: os.Stderr,
+			Level:  pluginLogLevelFor(meta.Provider),
+			Output: pluginLogOutput(logOutput),
 		})
 
-		config := &plugin.ClientConfig{
-			Cmd:              exec.Command(meta.ExecutableFile),
-			HandshakeConfig:  tfplugin.Handshake,
-			VersionedPlugins: tfplugin.VersionedPlugins,
-			Managed:          true,
-			Logger:           logger,
-			AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
-			AutoMTLS:         enableProviderAutoMTLS,
+		startTimeout, timeoutErr := pluginStartTimeoutConfig()
+		if timeoutErr != nil {
+			// providerFactories validates this setting before any factory
+			// runs, so normally we can't get here; if we somehow do, the
+			// default keeps the launch usable.
+			startTimeout = defaultPluginStartTimeout
 		}
-		client := plugin.NewClient(config)
-		rpcClient, err := client.Client()
+
+		tlsConfig, err := providerTLSConfig()
 		if err != nil {
+			// Also validated up front by providerFactories, but unlike the
+			// timeout there's no safe default to fall back on here.
+			return nil, fmt.Errorf("failed to start provider %s: %s", meta.Provider, err)
+		}
+
+		// A missing execute bit would otherwise surface as a bare
+		// "permission denied" from the OS once the launch is attempted,
+		// so it's checked up front where the provider and the cause can
+		// be named.
+		if err := checkProviderExecutable(meta.Provider, meta.ExecutableFile); err != nil {
 			return nil, err
 		}
 
+		var cmd *exec.Cmd
+		var stderrBuf *stderrTailBuffer
+		newConfig := func() *plugin.ClientConfig {
+			cmd = exec.Command(meta.ExecutableFile)
+			cmd.Env = env
+			// Each provider leads its own process group (or, on Windows,
+			// its own job object) so that signals aimed at Terraform's
+			// group can't race with managed shutdown, and so that
+			// shutdown can clean up any grandchild processes too.
+			configureProviderProcAttr(cmd)
+			// The raw stderr of the provider is retained (bounded) so that
+			// if the provider crashes on startup we can include whatever it
+			// printed -- usually a panic message -- in the error, and any
+			// non-hclog lines in it are also forwarded through the plugin
+			// logger tagged with the provider address, so that output from
+			// a panicking provider is attributable when several providers
+			// are running at once.
+			stderrBuf = &stderrTailBuffer{}
+			config := &plugin.ClientConfig{
+				Cmd:              cmd,
+				HandshakeConfig:  tfplugin.Handshake,
+				VersionedPlugins: tfplugin.VersionedPlugins,
+				Managed:          true,
+				Logger:           logger,
+				Stderr:           io.MultiWriter(stderrBuf, newProviderStderrLogger(logger, meta.Provider)),
+				StartTimeout:     startTimeout,
+				AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+				AutoMTLS:         autoMTLS,
+
+				// When env is nil the provider inherits our full
+				// environment as before; otherwise the filtered
+				// environment in env is all the provider gets.
+				SkipHostEnv: env != nil,
+			}
+			if tlsConfig != nil {
+				// Organizational key material replaces the ephemeral
+				// AutoMTLS certificates entirely.
+				config.TLSConfig = tlsConfig
+				config.AutoMTLS = false
+			}
+			return config
+		}
+
+		// If a launch fails with an error that looks transient then we'll
+		// try again with exponential backoff, as long as the process-wide
+		// retry budget permits it, so that a few flaky providers can't cause
+		// an unbounded number of total retries across a whole operation.
+		var client *plugin.Client
+		var rpcClient plugin.ClientProtocol
+		retried := false
+		attempt := 0
+		for {
+			// The go-plugin client is not reusable once its launch has
+			// failed, so each attempt needs a fresh client and config.
+			client = plugin.NewClient(newConfig())
+			var err error
+			rpcClient, err = pluginClientStart(client, startTimeout)
+			if err == nil {
+				break
+			}
+			client.Kill()
+			if errLooksLikeTransientLaunchFailure(err) && providerLaunchRetryBudget.Spend() {
+				retried = true
+				attempt++
+				wait := providerLaunchRetryWait(attempt)
+				log.Printf("[DEBUG] failed to start provider %s (attempt %d): %s; retrying in %s", meta.Provider, attempt, err, wait)
+				time.Sleep(wait)
+				continue
+			}
+			if timeoutErr, ok := err.(errPluginStartTimeout); ok {
+				return nil, withStderrTail(fmt.Errorf("provider %s (%s) did not complete its startup handshake within %s; if the machine is heavily loaded, consider raising the timeout with TF_PROVIDER_STARTUP_TIMEOUT", meta.Provider, meta.ExecutableFile, timeoutErr.timeout), stderrBuf)
+			}
+			if retried {
+				return nil, withStderrTail(fmt.Errorf("failed to start provider %s after retrying: %s (shared retry budget exhausted)", meta.Provider, err), stderrBuf)
+			}
+			if errLooksLikeProtocolMismatch(err) {
+				return nil, fmt.Errorf(
+					"failed to start provider %s: %s\n\nThe provider was built for a plugin protocol version that this version of Terraform does not support (supported versions: %v). Either upgrade Terraform or select an older release of this provider.",
+					meta.Provider, err, supportedProtocolVersions(),
+				)
+			}
+			if errLooksLikeClockSkew(err) {
+				return nil, fmt.Errorf(
+					"failed to start provider %s: %s\n\nThis error reports a certificate validity problem, which is commonly caused by clock skew between Terraform and the provider process. Check that the system clock is set correctly.",
+					meta.Provider, err,
+				)
+			}
+			return nil, withStderrTail(err, stderrBuf)
+		}
+
+		events.handshakeComplete(meta.Provider, client.NegotiatedVersion(), time.Since(launchedAt))
+
+		// The limits are applied after launch because the platforms we can
+		// apply them on allow adjusting a running process, and this way a
+		// failure to apply them doesn't interfere with the launch itself.
+		if cmd.Process != nil {
+			adoptProviderProcess(cmd.Process.Pid)
+			if limits.Enabled() {
+				applyProviderResourceLimits(cmd.Process.Pid, limits)
+			}
+		}
+
+		// Negotiation normally guarantees a version we support, but checking
+		// here turns any disagreement into an actionable message instead of
+		// a failure deep inside a later RPC, matching the up-front check
+		// that the unmanaged path applies to its reattach configuration.
+		if version := client.NegotiatedVersion(); version != 0 {
+			if _, ok := tfplugin.VersionedPlugins[version]; !ok {
+				client.Kill()
+				return nil, fmt.Errorf("provider %s speaks unsupported plugin protocol version %d; this version of Terraform supports versions %v", meta.Provider, version, supportedProtocolVersions())
+			}
+		}
+
 		raw, err := rpcClient.Dispense(tfplugin.ProviderPluginName)
 		if err != nil {
-			return nil, err
+			client.Kill()
+			return nil, withStderrTail(err, stderrBuf)
 		}
 
 		// store the client so that the plugin can kill the child process
 		p := raw.(*tfplugin.GRPCProvider)
 		p.PluginClient = client
-		return p, nil
+
+		// A provider can complete its handshake and then still fail to
+		// serve requests, which would otherwise only surface as a cryptic
+		// failure partway through a later operation, so by default we check
+		// that it responds before handing it to the caller. GetSchema is
+		// used because its result is cached in the client, so this doesn't
+		// add a round trip for providers that are working properly.
+		if !skipProviderStartupCheck() {
+			if resp := p.GetSchema(); resp.Diagnostics.HasErrors() {
+				client.Kill()
+				return nil, fmt.Errorf("provider %s started but is not responding: %s", meta.Provider, resp.Diagnostics.Err())
+			}
+		}
+		if cmd.Process != nil {
+			// The process is tracked in the data dir so that if Terraform
+			// itself dies without reaching the shutdown path below, the
+			// next run can find and reap the orphan.
+			rec := providerProcessRecord{
+				Pid:        cmd.Process.Pid,
+				Executable: meta.ExecutableFile,
+			}
+			rec.OwnerPid, rec.OwnerStart = ownProcessIdentity()
+			if reattach := client.ReattachConfig(); reattach != nil && reattach.Addr != nil && reattach.Addr.Network() == "unix" {
+				rec.SocketPath = reattach.Addr.String()
+			}
+			procState.record(rec)
+		}
+		launched = true
+		events.dispenseComplete(meta.Provider, time.Since(launchedAt))
+		return gracefulShutdownProvider{
+			Interface:  p,
+			provider:   meta.Provider,
+			process:    cmd.Process,
+			grace:      providerShutdownGrace(),
+			sem:        sem,
+			procState:  procState,
+			events:     events,
+			launchedAt: launchedAt,
+		}, nil
+	}
+}
+
+// defaultProviderShutdownGrace is how long a provider process is given to
+// exit after being asked to terminate before it is force-killed, unless
+// overridden via the TF_PROVIDER_SHUTDOWN_GRACE environment variable. Five
+// seconds is enough for most providers to finish reporting an in-flight
+// API call without noticeably delaying shutdown.
+const defaultProviderShutdownGrace = 5 * time.Second
+
+// providerShutdownGrace returns the grace period for provider shutdown,
+// honoring the TF_PROVIDER_SHUTDOWN_GRACE environment variable, whose value
+// is a duration string like "5s". Zero disables the graceful termination
+// signal altogether; an invalid value produces a warning and the default is
+// used instead.
+func providerShutdownGrace() time.Duration {
+	env := os.Getenv("TF_PROVIDER_SHUTDOWN_GRACE")
+	if env == "" {
+		return defaultProviderShutdownGrace
+	}
+	grace, err := time.ParseDuration(env)
+	if err != nil || grace < 0 {
+		log.Printf("[WARN] invalid TF_PROVIDER_SHUTDOWN_GRACE %q: must be a non-negative duration like \"5s\"; using the default %s", env, defaultProviderShutdownGrace)
+		return defaultProviderShutdownGrace
+	}
+	return grace
+}
+
+// gracefulShutdownProvider wraps a provider launched by providerFactory so
+// that closing it first asks the provider to halt in-flight work via its
+// Stop RPC, then sends the provider process a termination signal and allows
+// it a grace period to clean up any external resources it holds, before
+// falling through to go-plugin's usual kill behavior. The fallthrough is a
+// no-op if the process has already exited.
+type gracefulShutdownProvider struct {
+	providers.Interface
+	provider   addrs.Provider
+	process    *os.Process
+	grace      time.Duration
+	sem        *providerLaunchSemaphore
+	procState  *providerProcessState
+	events     *PluginLifecycleEvents
+	launchedAt time.Time
+}
+
+func (p gracefulShutdownProvider) Close() error {
+	// The process slot is given back once the provider is shut down, so
+	// that another queued provider launch can proceed.
+	defer p.sem.Release()
+	clean := false
+	if p.grace > 0 && p.process != nil {
+		// Stop gives the provider a chance to finish accounting for any
+		// in-flight cloud API call before its process goes away.
+		if err := p.Interface.Stop(); err != nil {
+			log.Printf("[DEBUG] provider %s Stop failed during shutdown: %s", p.provider, err)
+		}
+		// Signal delivery can fail on platforms without SIGTERM support, in
+		// which case we just skip straight to the usual kill path. The
+		// signal targets the provider's whole process group where the
+		// platform permits, so well-behaved grandchildren get a chance to
+		// clean up too.
+		if err := terminateProviderProcess(p.process); err == nil {
+			deadline := time.Now().Add(p.grace)
+			for time.Now().Before(deadline) {
+				// Signal 0 performs only the existence check, so an error
+				// here tells us the process has exited.
+				if p.process.Signal(syscall.Signal(0)) != nil {
+					clean = true
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+		if clean {
+			log.Printf("[DEBUG] provider %s exited cleanly within the shutdown grace period", p.provider)
+		} else {
+			log.Printf("[DEBUG] provider %s did not exit within the %s grace period and will be killed", p.provider, p.grace)
+		}
+	}
+	err := p.Interface.Close()
+	if p.process != nil {
+		// Anything still alive in the provider's process group at this
+		// point is an orphaned grandchild, which go-plugin's kill of the
+		// direct child alone would leave behind.
+		reapProviderGroup(p.process)
+		// The process went away through the normal path, so it no longer
+		// needs tracking for orphan cleanup.
+		p.procState.forget(p.process.Pid)
+	}
+	// The uptime covers the shutdown sequence too, since the provider's
+	// process can keep doing work right up until it exits.
+	p.events.teardown(p.provider, time.Since(p.launchedAt))
+	return err
+}
+
+// skipProviderStartupCheck decides whether the post-launch responsiveness
+// check in providerFactory should be skipped, which the
+// TF_SKIP_PROVIDER_STARTUP_CHECK environment variable allows for
+// performance-sensitive runs involving many provider instances.
+func skipProviderStartupCheck() bool {
+	return os.Getenv("TF_SKIP_PROVIDER_STARTUP_CHECK") != ""
+}
+
+// defaultPluginStartTimeout is how long we'll wait for a provider plugin to
+// complete its startup handshake before giving up on it, unless overridden
+// via the TF_PLUGIN_START_TIMEOUT environment variable.
+const defaultPluginStartTimeout = 60 * time.Second
+
+// pluginStartTimeout returns the handshake timeout for provider plugins,
+// honoring the TF_PLUGIN_START_TIMEOUT environment variable, whose value
+// is a duration string like "30s" or "2m". An invalid value produces a
+// warning and the default is used instead.
+func pluginStartTimeout() time.Duration {
+	env := os.Getenv("TF_PLUGIN_START_TIMEOUT")
+	if env == "" {
+		return defaultPluginStartTimeout
+	}
+	timeout, err := time.ParseDuration(env)
+	if err != nil || timeout <= 0 {
+		log.Printf("[WARN] invalid TF_PLUGIN_START_TIMEOUT %q: must be a positive duration like \"60s\"; using the default %s", env, defaultPluginStartTimeout)
+		return defaultPluginStartTimeout
+	}
+	return timeout
+}
+
+// pluginStartTimeoutConfig resolves the provider startup timeout, preferring
+// the TF_PROVIDER_STARTUP_TIMEOUT environment variable and falling back to
+// the older TF_PLUGIN_START_TIMEOUT behavior when it is unset.
+//
+// Unlike the older variable, an invalid TF_PROVIDER_STARTUP_TIMEOUT is
+// returned as an error so that the caller can fail early rather than
+// silently running with a default the user didn't ask for.
+func pluginStartTimeoutConfig() (time.Duration, error) {
+	env := os.Getenv("TF_PROVIDER_STARTUP_TIMEOUT")
+	if env == "" {
+		return pluginStartTimeout(), nil
+	}
+	timeout, err := time.ParseDuration(env)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid TF_PROVIDER_STARTUP_TIMEOUT %q: must be a positive duration like \"60s\"", env)
+	}
+	return timeout, nil
+}
+
+// errPluginStartTimeout indicates that a provider plugin failed to complete
+// its startup handshake within the allotted time.
+type errPluginStartTimeout struct {
+	timeout time.Duration
+}
+
+func (err errPluginStartTimeout) Error() string {
+	return fmt.Sprintf("plugin did not complete its handshake within %s", err.timeout)
+}
+
+// pluginClientStart runs the given go-plugin client's startup handshake
+// with a deadline, because a provider that deadlocks during startup would
+// otherwise leave Terraform waiting forever with no feedback. On timeout
+// the client is killed and an errPluginStartTimeout is returned.
+func pluginClientStart(client *plugin.Client, timeout time.Duration) (plugin.ClientProtocol, error) {
+	type startResult struct {
+		rpcClient plugin.ClientProtocol
+		err       error
+	}
+	done := make(chan startResult, 1)
+	go func() {
+		rpcClient, err := client.Client()
+		done <- startResult{rpcClient, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case result := <-done:
+		return result.rpcClient, result.err
+	case <-timer.C:
+		client.Kill()
+		return nil, errPluginStartTimeout{timeout}
+	}
+}
+
+// pluginLogLevel returns the log level to use for provider plugin loggers,
+// as chosen by the TF_PLUGIN_LOG_LEVEL environment variable.
+//
+// This is deliberately independent of Terraform's own log level, so that
+// chatty provider logs can be quieted without hiding Terraform's own
+// diagnostics. When the variable is unset the level is trace, preserving
+// the historical behavior; an invalid value produces a warning and also
+// falls back to trace.
+func pluginLogLevel() hclog.Level {
+	env := os.Getenv("TF_PLUGIN_LOG_LEVEL")
+	if env == "" {
+		return hclog.Trace
+	}
+	level, ok := parsePluginLogLevel(env)
+	if !ok {
+		log.Printf("[WARN] invalid TF_PLUGIN_LOG_LEVEL %q: must be one of trace, debug, info, warn, or error; using trace", env)
+		return hclog.Trace
+	}
+	return level
+}
+
+// parsePluginLogLevel converts a user-provided log level name into an hclog
+// level, reporting false for anything unrecognized.
+func parsePluginLogLevel(s string) (hclog.Level, bool) {
+	switch strings.ToLower(s) {
+	case "trace":
+		return hclog.Trace, true
+	case "debug":
+		return hclog.Debug, true
+	case "info":
+		return hclog.Info, true
+	case "warn":
+		return hclog.Warn, true
+	case "error":
+		return hclog.Error, true
+	default:
+		return hclog.Trace, false
+	}
+}
+
+// providerLogLevels caches the provider log level settings from the
+// environment, which are parsed only once per process because factories can
+// be called many times during a single operation.
+var providerLogLevels struct {
+	once      sync.Once
+	global    hclog.Level
+	hasGlobal bool
+	perType   map[string]hclog.Level
+}
+
+// pluginLogLevelFor returns the log level for the given provider's plugin
+// logger, preferring a TF_LOG_PROVIDER_<NAME> variable specific to the
+// provider (where <NAME> is the provider type uppercased and with dashes
+// replaced by underscores, e.g. TF_LOG_PROVIDER_AWS), then the global
+// TF_LOG_PROVIDER variable, and finally the behavior of pluginLogLevel.
+func pluginLogLevelFor(provider addrs.Provider) hclog.Level {
+	providerLogLevels.once.Do(parseProviderLogLevels)
+	name := strings.ReplaceAll(strings.ToUpper(provider.Type), "-", "_")
+	if level, ok := providerLogLevels.perType[name]; ok {
+		return level
+	}
+	if providerLogLevels.hasGlobal {
+		return providerLogLevels.global
+	}
+	return pluginLogLevel()
+}
+
+func parseProviderLogLevels() {
+	providerLogLevels.perType = make(map[string]hclog.Level)
+	if env := os.Getenv("TF_LOG_PROVIDER"); env != "" {
+		if level, ok := parsePluginLogLevel(env); ok {
+			providerLogLevels.global = level
+			providerLogLevels.hasGlobal = true
+		} else {
+			log.Printf("[WARN] invalid TF_LOG_PROVIDER %q: must be one of trace, debug, info, warn, or error; ignoring it", env)
+		}
+	}
+	const prefix = "TF_LOG_PROVIDER_"
+	for _, entry := range os.Environ() {
+		if !strings.HasPrefix(entry, prefix) {
+			continue
+		}
+		eq := strings.IndexByte(entry, '=')
+		if eq < len(prefix) {
+			continue
+		}
+		name, value := entry[len(prefix):eq], entry[eq+1:]
+		if level, ok := parsePluginLogLevel(value); ok {
+			providerLogLevels.perType[name] = level
+		} else {
+			log.Printf("[WARN] invalid %s%s %q: must be one of trace, debug, info, warn, or error; ignoring it", prefix, name, value)
+		}
+	}
+}
+
+// pluginLogOutput resolves the log writer to use for a provider plugin
+// logger, defaulting to stderr when the caller didn't provide one.
+func pluginLogOutput(logOutput io.Writer) io.Writer {
+	if logOutput != nil {
+		return logOutput
+	}
+	return os.Stderr
+}
+
+// supportedProtocolVersions returns the plugin protocol versions that this
+// build of Terraform can speak, in ascending order, for inclusion in error
+// messages about protocol negotiation.
+func supportedProtocolVersions() []int {
+	ret := make([]int, 0, len(tfplugin.VersionedPlugins))
+	for version := range tfplugin.VersionedPlugins {
+		ret = append(ret, version)
+	}
+	sort.Ints(ret)
+	return ret
+}
+
+// errLooksLikeProtocolMismatch recognizes the low-level error that go-plugin
+// produces when a provider server offers only plugin protocol versions that
+// this build of Terraform doesn't support.
+func errLooksLikeProtocolMismatch(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Incompatible API version with plugin")
+}
+
+// errLooksLikeClockSkew recognizes launch errors that report a TLS
+// certificate validity problem. The AutoMTLS certificates we exchange with
+// provider plugins are short-lived, so a validity error during the
+// handshake usually means the clocks of Terraform and the provider process
+// disagree, rather than anything being wrong with the certificates
+// themselves.
+func errLooksLikeClockSkew(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	// These substrings cover the messages produced by crypto/x509 for a
+	// certificate presented outside of its validity period.
+	return strings.Contains(msg, "certificate has expired or is not yet valid") ||
+		strings.Contains(msg, "certificate is not yet valid") ||
+		strings.Contains(msg, "certificate has expired")
+}
+
+// errLooksLikeTransientLaunchFailure returns true if the given plugin launch
+// error is of a kind that is likely to succeed if simply tried again, such
+// as the OS briefly refusing to exec a freshly-written binary or a port
+// allocation race. Errors that reflect a real incompatibility, like a
+// handshake version mismatch, are deliberately excluded because retrying
+// them would just delay the inevitable failure report.
+func errLooksLikeTransientLaunchFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(errPluginStartTimeout); ok {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "fork/exec") || // the OS refused to exec the binary, e.g. ETXTBSY while it's still being written
+		strings.Contains(msg, "text file busy") ||
+		strings.Contains(msg, "resource temporarily unavailable") || // EAGAIN under process/fd pressure
+		strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "connection reset")
+}
+
+// providerLaunchRetryWait returns how long to wait before the given launch
+// attempt (counting from 1), backing off exponentially with a modest cap so
+// that a busy machine gets a little time to recover between attempts.
+func providerLaunchRetryWait(attempt int) time.Duration {
+	wait := 250 * time.Millisecond << uint(attempt-1)
+	if max := 4 * time.Second; wait > max {
+		wait = max
+	}
+	return wait
+}
+
+// unmanagedProviderShutdown wraps a reattached provider so that closing it
+// only disconnects from the server. The process belongs to whoever launched
+// it -- a debugger, the plugin SDK's test harness -- so unlike a managed
+// provider it must never be signalled or killed by us.
+type unmanagedProviderShutdown struct {
+	providers.Interface
+	provider    addrs.Provider
+	rpcClient   plugin.ClientProtocol
+	events      *PluginLifecycleEvents
+	connectedAt time.Time
+}
+
+func (p unmanagedProviderShutdown) Close() error {
+	log.Printf("[DEBUG] disconnecting from unmanaged provider %s without stopping it", p.provider)
+	err := p.rpcClient.Close()
+	p.events.teardown(p.provider, time.Since(p.connectedAt))
+	return err
+}
+
+// unmanagedProviderFactory produces a provider factory that uses the
+// reattach information in the given unmanagedProviderConfig to connect to
+// an already-running provider server, rather than launching a new child
+// process.
+//
+// logOutput receives any log output from the go-plugin client; a nil value
+// selects stderr.
+//
+// events, when non-nil, receives lifecycle notifications for each
+// connection the factory makes.
+func unmanagedProviderFactory(provider addrs.Provider, config *unmanagedProviderConfig, logOutput io.Writer, events *PluginLifecycleEvents) providers.Factory {
+	return func() (providers.Interface, error) {
+		connectedAt := time.Now()
+		events.launchStart(provider)
+		// A stale reattach configuration pointing at a process that has
+		// already exited would otherwise fail deep inside go-plugin with a
+		// cryptic connection error, so we check the pid up front. The
+		// plugin SDK's test harness manages the server lifecycle itself, so
+		// we skip the check for its servers.
+		if !config.Test {
+			if err := processAlive(config.Reattach.Pid); err != nil {
+				return nil, fmt.Errorf("provider process %d for %s is not running; re-run your provider in debug mode and update TF_PROVIDER_REATTACH", config.Reattach.Pid, provider.ForDisplay())
+			}
+			// A unix socket that has disappeared from TMPDIR gets the same
+			// fast failure, rather than an opaque dial timeout. Only if
+			// every candidate transport is a missing unix socket is the
+			// configuration certainly unusable.
+			if err := reattachSocketsGone(config); err != nil {
+				return nil, fmt.Errorf("%s for %s; re-run your provider in debug mode and update TF_PROVIDER_REATTACH", err, provider.ForDisplay())
+			}
+		}
+
+		logger := hclog.New(&hclog.LoggerOptions{
+			Name:   "unmanaged-plugin",
+			Level:  pluginLogLevelFor(provider),
+			Output: pluginLogOutput(logOutput),
+		})
+
+		plugins, ok := tfplugin.VersionedPlugins[config.ProtocolVersion]
+		if !ok {
+			return nil, fmt.Errorf("unmanaged provider %s uses unsupported protocol version %d; this version of Terraform supports versions %v", provider, config.ProtocolVersion, supportedProtocolVersions())
+		}
+
+		// The configuration may list several candidate addresses for the
+		// server, so we'll try each in turn until one of them gives us a
+		// working client.
+		candidateAddrs := config.Addrs
+		if len(candidateAddrs) == 0 {
+			candidateAddrs = []net.Addr{config.Reattach.Addr}
+		}
+
+		var lastErr error
+		for _, addr := range candidateAddrs {
+			reattach := *config.Reattach
+			reattach.Addr = addr
+
+			// AutoMTLS is never used here: reattaching implies that the
+			// server already started up without the certificate exchange
+			// that AutoMTLS requires, so the connection is made in
+			// plaintext.
+			cfg := &plugin.ClientConfig{
+				HandshakeConfig:  tfplugin.Handshake,
+				Plugins:          plugins,
+				Reattach:         &reattach,
+				Managed:          false,
+				Logger:           logger,
+				AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+			}
+			client := plugin.NewClient(cfg)
+			rpcClient, err := pluginClientStart(client, pluginStartTimeout())
+			if err != nil {
+				client.Kill()
+				lastErr = err
+				continue
+			}
+			log.Printf("[DEBUG] connected to unmanaged provider %s at %s address %s", provider, addr.Network(), addr)
+			events.handshakeComplete(provider, client.NegotiatedVersion(), time.Since(connectedAt))
+
+			raw, err := rpcClient.Dispense(tfplugin.ProviderPluginName)
+			if err != nil {
+				rpcClient.Close()
+				return nil, err
+			}
+
+			p := raw.(*tfplugin.GRPCProvider)
+			if err := verifyUnmanagedProviderIdentity(provider, p); err != nil {
+				// The server belongs to whoever started it, so we only
+				// drop our connection rather than killing the process.
+				rpcClient.Close()
+				return nil, err
+			}
+			events.dispenseComplete(provider, time.Since(connectedAt))
+			return unmanagedProviderShutdown{
+				Interface:   p,
+				provider:    provider,
+				rpcClient:   rpcClient,
+				events:      events,
+				connectedAt: connectedAt,
+			}, nil
+		}
+		return nil, fmt.Errorf("failed to connect to unmanaged provider %s at any of its configured addresses: %s", provider, lastErr)
 	}
 }
@@ -0,0 +1,122 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+)
+
+// providerDevOverrides returns the effective set of development overrides,
+// keyed by parsed provider address: the entries from the CLI configuration
+// merged with any from the TF_PROVIDER_DEV_OVERRIDES environment variable,
+// with the environment winning for a provider named in both.
+//
+// TF_PROVIDER_DEV_OVERRIDES holds comma-separated entries of the form
+// "registry.terraform.io/hashicorp/null=/home/me/bin". Entries with an
+// invalid provider address are skipped with a log message; the CLI config
+// loader reports invalid configured addresses to the user as errors already.
+//
+// The result is nil when no overrides are active, which is the common case.
+func (m *Meta) providerDevOverrides() map[addrs.Provider]string {
+	env := os.Getenv("TF_PROVIDER_DEV_OVERRIDES")
+	if len(m.ProviderDevOverrides) == 0 && env == "" {
+		return nil
+	}
+	ret := make(map[addrs.Provider]string)
+	addOverride := func(addrStr, path string) {
+		provider, diags := addrs.ParseProviderSourceString(addrStr)
+		if diags.HasErrors() {
+			log.Printf("[WARN] ignoring dev override for invalid provider address %q", addrStr)
+			return
+		}
+		ret[provider] = path
+	}
+	for addrStr, path := range m.ProviderDevOverrides {
+		addOverride(addrStr, path)
+	}
+	for _, entry := range strings.Split(env, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		eq := strings.Index(entry, "=")
+		if eq < 0 {
+			log.Printf("[WARN] ignoring invalid TF_PROVIDER_DEV_OVERRIDES entry %q: expected <provider address>=<path>", entry)
+			continue
+		}
+		addOverride(entry[:eq], entry[eq+1:])
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// devOverrideCachedProvider produces the synthetic cache entry for a
+// provider subject to a development override, pointing at the locally-built
+// executable. The configured path may be either the executable itself or a
+// directory containing an executable with the standard
+// terraform-provider-<type> name prefix.
+//
+// No version is known for a locally-built binary, so the entry reports
+// version 0.0.0, and nothing here is subject to checksum verification: the
+// whole point of an override is to run a binary the installer has never
+// seen.
+func devOverrideCachedProvider(provider addrs.Provider, path string) (*providercache.CachedProvider, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("dev override for %s is not usable: %s", provider.ForDisplay(), err)
+	}
+
+	executable := path
+	if info.IsDir() {
+		wantPrefix := "terraform-provider-" + provider.Type
+		entries, err := filepath.Glob(filepath.Join(path, wantPrefix+"*"))
+		if err == nil && len(entries) > 0 {
+			// With several matching files (say, a binary and its debug
+			// symbols) the shortest name is the plain binary.
+			sort.Slice(entries, func(i, j int) bool {
+				return len(entries[i]) < len(entries[j])
+			})
+			executable = entries[0]
+		} else {
+			return nil, fmt.Errorf("dev override for %s is not usable: no %s* executable in %s", provider.ForDisplay(), wantPrefix, path)
+		}
+	}
+
+	return &providercache.CachedProvider{
+		Provider:       provider,
+		Version:        getproviders.MustParseVersion("0.0.0"),
+		PackageDir:     filepath.Dir(executable),
+		ExecutableFile: executable,
+	}, nil
+}
+
+// devOverridesNotice returns the text of the warning shown whenever
+// development overrides are active, so that the same prominent message
+// appears in init and in plan/apply output: a run using overridden
+// providers may behave differently than one using released packages, and
+// must not be mistaken for one.
+func devOverridesNotice(overrides map[addrs.Provider]string) string {
+	providers := make([]addrs.Provider, 0, len(overrides))
+	for provider := range overrides {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].LessThan(providers[j])
+	})
+
+	var b strings.Builder
+	b.WriteString("Provider development overrides are in effect for the following providers:\n")
+	for _, provider := range providers {
+		fmt.Fprintf(&b, " - %s at %s\n", provider.ForDisplay(), overrides[provider])
+	}
+	b.WriteString("\nOverridden providers are not installed, are exempt from version and checksum verification, and may behave differently than released versions. This should only be used for temporary local development.")
+	return b.String()
+}
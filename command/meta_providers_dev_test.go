@@ -0,0 +1,125 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+func TestProviderDevOverrides(t *testing.T) {
+	defer os.Unsetenv("TF_PROVIDER_DEV_OVERRIDES")
+
+	// With neither the config nor the environment set there are no
+	// overrides at all.
+	m := &Meta{}
+	if got := m.providerDevOverrides(); got != nil {
+		t.Errorf("wrong result %#v with nothing configured; want nil", got)
+	}
+
+	// The environment merges with the configuration, winning for a
+	// provider named in both, and invalid entries are skipped.
+	m = &Meta{
+		ProviderDevOverrides: map[string]string{
+			"registry.terraform.io/hashicorp/null":   "/from/config",
+			"registry.terraform.io/hashicorp/random": "/from/config",
+		},
+	}
+	os.Setenv("TF_PROVIDER_DEV_OVERRIDES", "registry.terraform.io/hashicorp/null=/from/env, not//valid=/nope, bare-entry")
+	got := m.providerDevOverrides()
+	if len(got) != 2 {
+		t.Fatalf("wrong number of overrides %d; want 2", len(got))
+	}
+	if path := got[addrs.NewDefaultProvider("null")]; path != "/from/env" {
+		t.Errorf("wrong path %q for null provider; want the environment's /from/env", path)
+	}
+	if path := got[addrs.NewDefaultProvider("random")]; path != "/from/config" {
+		t.Errorf("wrong path %q for random provider; want /from/config", path)
+	}
+}
+
+func TestDevOverrideCachedProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraform-test-dev-override")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	provider := addrs.NewDefaultProvider("null")
+	exePath := filepath.Join(dir, "terraform-provider-null")
+	if err := ioutil.WriteFile(exePath, []byte("executable"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A second matching file with a longer name must not shadow the plain
+	// binary.
+	if err := ioutil.WriteFile(exePath+"_debug", []byte("symbols"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory resolves to the executable inside it.
+	cached, err := devOverrideCachedProvider(provider, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cached.ExecutableFile != exePath {
+		t.Errorf("wrong executable %q; want %q", cached.ExecutableFile, exePath)
+	}
+	if got := cached.Version.String(); got != "0.0.0" {
+		t.Errorf("wrong version %q; want 0.0.0", got)
+	}
+
+	// Naming the executable directly works too.
+	cached, err = devOverrideCachedProvider(provider, exePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cached.ExecutableFile != exePath {
+		t.Errorf("wrong executable %q; want %q", cached.ExecutableFile, exePath)
+	}
+
+	// A directory with no matching executable is an error that names the
+	// expected file prefix.
+	empty := filepath.Join(dir, "empty")
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, err = devOverrideCachedProvider(provider, empty)
+	if err == nil {
+		t.Fatal("unexpected success with an empty directory")
+	}
+	if !strings.Contains(err.Error(), "terraform-provider-null") {
+		t.Fatalf("wrong error %q; want mention of the expected executable name", err)
+	}
+}
+
+func TestProviderFactories_devOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraform-test-dev-override")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exePath := filepath.Join(dir, "terraform-provider-null")
+	if err := ioutil.WriteFile(exePath, []byte("executable"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// No package for the provider is installed at all; the override alone
+	// must be enough to produce a factory.
+	m := &Meta{
+		OverrideDataDir: dir,
+		ProviderDevOverrides: map[string]string{
+			"registry.terraform.io/hashicorp/null": exePath,
+		},
+	}
+	factories, err := m.providerFactories()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, exists := factories[addrs.NewDefaultProvider("null")]; !exists {
+		t.Fatal("no factory for the dev-overridden provider")
+	}
+}
@@ -0,0 +1,161 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// defaultPluginLogMaxSize is the size at which a per-provider plugin log
+// file is rotated, unless overridden via the TF_PROVIDER_LOG_MAX_SIZE_MB
+// environment variable.
+const defaultPluginLogMaxSize = 64 * 1024 * 1024
+
+// pluginLogFiles tracks the per-provider log writers that have already been
+// opened during this command invocation, so that multiple factory calls for
+// the same provider share one file and the location is logged only once.
+var pluginLogFiles struct {
+	mu    sync.Mutex
+	files map[string]io.Writer
+}
+
+// pluginLogOutputFor returns the log writer that the plugin logger for the
+// given provider should use.
+//
+// When a log directory is configured -- via the PluginLogDir field or the
+// TF_PROVIDER_LOG_DIR environment variable -- each provider gets its own
+// append-only log file in that directory, named after the provider address
+// and the Terraform process id, and rotated once it grows beyond a size
+// limit. Otherwise all providers share PluginLogWriter, which may be nil to
+// select stderr.
+func (m *Meta) pluginLogOutputFor(provider addrs.Provider) (io.Writer, error) {
+	dir := m.PluginLogDir
+	if dir == "" {
+		dir = os.Getenv("TF_PROVIDER_LOG_DIR")
+	}
+	if dir == "" {
+		return m.PluginLogWriter, nil
+	}
+
+	filename := filepath.Join(dir, fmt.Sprintf("%s-%d.log", sanitizePluginLogName(provider.ForDisplay()), os.Getpid()))
+
+	pluginLogFiles.mu.Lock()
+	defer pluginLogFiles.mu.Unlock()
+	if w, ok := pluginLogFiles.files[filename]; ok {
+		return w, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create plugin log directory %s: %s", dir, err)
+	}
+	w, err := openRotatingLogFile(filename, pluginLogMaxSize())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plugin log file for %s: %s", provider.ForDisplay(), err)
+	}
+	log.Printf("[INFO] logs for provider %s are written to %s", provider.ForDisplay(), filename)
+	if pluginLogFiles.files == nil {
+		pluginLogFiles.files = make(map[string]io.Writer)
+	}
+	pluginLogFiles.files[filename] = w
+	return w, nil
+}
+
+// pluginLogMaxSize returns the size in bytes at which per-provider plugin
+// log files are rotated, honoring the TF_PROVIDER_LOG_MAX_SIZE_MB
+// environment variable. Zero disables rotation; an invalid value produces
+// a warning and the default is used instead.
+func pluginLogMaxSize() int64 {
+	env := os.Getenv("TF_PROVIDER_LOG_MAX_SIZE_MB")
+	if env == "" {
+		return defaultPluginLogMaxSize
+	}
+	mb, err := strconv.Atoi(env)
+	if err != nil || mb < 0 {
+		log.Printf("[WARN] invalid TF_PROVIDER_LOG_MAX_SIZE_MB %q: must be a non-negative whole number of megabytes; using the default", env)
+		return defaultPluginLogMaxSize
+	}
+	return int64(mb) * 1024 * 1024
+}
+
+// rotatingLogFile is an io.Writer that appends to a log file and, once the
+// file grows beyond maxSize, renames it aside with a ".1" suffix and starts
+// a fresh file, keeping at most one previous file. A maxSize of zero
+// disables rotation.
+type rotatingLogFile struct {
+	mu       sync.Mutex
+	filename string
+	maxSize  int64
+	f        *os.File
+	size     int64
+}
+
+func openRotatingLogFile(filename string, maxSize int64) (*rotatingLogFile, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	return &rotatingLogFile{
+		filename: filename,
+		maxSize:  maxSize,
+		f:        f,
+		size:     size,
+	}, nil
+}
+
+func (w *rotatingLogFile) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.maxSize > 0 && w.size+int64(len(p)) > w.maxSize {
+		w.rotate()
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingLogFile) rotate() {
+	w.f.Close()
+	// This replaces any previous rotated file, so at most two files exist
+	// for each provider at a time.
+	if err := os.Rename(w.filename, w.filename+".1"); err != nil {
+		log.Printf("[WARN] failed to rotate plugin log file %s: %s", w.filename, err)
+	}
+	f, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		// Keep writing to the old file rather than losing output entirely.
+		log.Printf("[WARN] failed to reopen plugin log file %s after rotation: %s", w.filename, err)
+		f, err = os.OpenFile(w.filename+".1", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return
+		}
+	}
+	w.f = f
+	w.size = 0
+}
+
+// sanitizePluginLogName converts a provider display address into a string
+// safe to use as a filename, replacing path separators and any other
+// unusual characters with underscores.
+func sanitizePluginLogName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '.' || r == '-' || r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,129 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+func TestPluginLogOutputFor(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "terraform-test-pluginlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	m := &Meta{PluginLogDir: tmpDir}
+	provider := addrs.NewDefaultProvider("null")
+
+	w, err := m.pluginLogOutputFor(provider)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := w.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("failed to write to plugin log: %s", err)
+	}
+
+	// A second call within the same invocation must return the same writer
+	// rather than opening the file again.
+	w2, err := m.pluginLogOutputFor(provider)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if w2 != w {
+		t.Error("second call returned a different writer; want the same open file")
+	}
+
+	filename := filepath.Join(tmpDir, fmt.Sprintf("hashicorp_null-%d.log", os.Getpid()))
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("expected log file %s: %s", filename, err)
+	}
+	if string(content) != "hello\n" {
+		t.Errorf("wrong log content %q; want %q", content, "hello\n")
+	}
+}
+
+func TestPluginLogOutputFor_noDir(t *testing.T) {
+	m := &Meta{}
+	w, err := m.pluginLogOutputFor(addrs.NewDefaultProvider("null"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if w != nil {
+		t.Errorf("wrong writer %v; want nil so the factory falls back to stderr", w)
+	}
+}
+
+func TestRotatingLogFile(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "terraform-test-pluginlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	filename := filepath.Join(tmpDir, "hashicorp_null.log")
+	w, err := openRotatingLogFile(filename, 16)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := w.Write([]byte("0123456789\n")); err != nil {
+		t.Fatalf("first write failed: %s", err)
+	}
+	// This write would push the file over the 16 byte limit, so it must go
+	// into a fresh file with the old content renamed aside.
+	if _, err := w.Write([]byte("abcdefghij\n")); err != nil {
+		t.Fatalf("second write failed: %s", err)
+	}
+
+	current, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read current log file: %s", err)
+	}
+	if got, want := string(current), "abcdefghij\n"; got != want {
+		t.Errorf("wrong current log content %q; want %q", got, want)
+	}
+	rotated, err := ioutil.ReadFile(filename + ".1")
+	if err != nil {
+		t.Fatalf("failed to read rotated log file: %s", err)
+	}
+	if got, want := string(rotated), "0123456789\n"; got != want {
+		t.Errorf("wrong rotated log content %q; want %q", got, want)
+	}
+}
+
+func TestSanitizePluginLogName(t *testing.T) {
+	got := sanitizePluginLogName("registry.terraform.io/hashicorp/null")
+	want := "registry.terraform.io_hashicorp_null"
+	if got != want {
+		t.Errorf("wrong result %q; want %q", got, want)
+	}
+}
+
+func TestPluginLogMaxSize(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int64
+	}{
+		{"", defaultPluginLogMaxSize},
+		{"10", 10 * 1024 * 1024},
+		{"0", 0}, // rotation disabled
+		{"lots", defaultPluginLogMaxSize},
+		{"-3", defaultPluginLogMaxSize},
+	}
+
+	defer os.Unsetenv("TF_PROVIDER_LOG_MAX_SIZE_MB")
+	for _, test := range tests {
+		t.Run(test.env, func(t *testing.T) {
+			os.Setenv("TF_PROVIDER_LOG_MAX_SIZE_MB", test.env)
+			if got := pluginLogMaxSize(); got != test.want {
+				t.Errorf("wrong size %d for %q; want %d", got, test.env, test.want)
+			}
+		})
+	}
+}
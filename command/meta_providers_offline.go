@@ -0,0 +1,87 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+// offlineProviderSource wraps another provider source and removes from it
+// anything that would require network access, leaving only local filesystem
+// mirror directories.
+//
+// When a requested provider is not available from any of the remaining
+// local directories, the error message lists the directories that were
+// searched so that an air-gapped user can see exactly where Terraform
+// looked, rather than a misleading report that the provider doesn't exist
+// at all.
+type offlineProviderSource struct {
+	local getproviders.Source
+
+	// searchedDirs are the base directories of the filesystem mirrors that
+	// remain enabled, for inclusion in "not found" error messages.
+	searchedDirs []string
+}
+
+var _ getproviders.Source = (*offlineProviderSource)(nil)
+
+// newOfflineProviderSource constructs an offlineProviderSource that retains
+// only the local parts of the given source.
+//
+// If the given source is a getproviders.MultiSource then each of its
+// selectors is retained or dropped individually, so that a configuration
+// mixing filesystem mirrors with registry or network mirror installation
+// degrades to just the filesystem mirrors. Any other source type that isn't
+// itself a filesystem mirror is dropped entirely, leaving a source that
+// reports no providers as available.
+func newOfflineProviderSource(underlying getproviders.Source) *offlineProviderSource {
+	ret := &offlineProviderSource{}
+	switch source := underlying.(type) {
+	case *getproviders.FilesystemMirrorSource:
+		ret.local = source
+		ret.searchedDirs = []string{source.BaseDir()}
+	case getproviders.MultiSource:
+		var keep getproviders.MultiSource
+		for _, selector := range source {
+			fsSource, ok := selector.Source.(*getproviders.FilesystemMirrorSource)
+			if !ok {
+				continue // requires network access, so excluded in offline mode
+			}
+			keep = append(keep, selector)
+			ret.searchedDirs = append(ret.searchedDirs, fsSource.BaseDir())
+		}
+		ret.local = keep
+	default:
+		// Anything else is assumed to need the network, so offline mode
+		// leaves no sources at all.
+		ret.local = getproviders.MultiSource(nil)
+	}
+	return ret
+}
+
+func (s *offlineProviderSource) AvailableVersions(provider addrs.Provider) (getproviders.VersionList, getproviders.Warnings, error) {
+	ret, warnings, err := s.local.AvailableVersions(provider)
+	if len(ret) == 0 && (err == nil || getproviders.ErrIsNotExist(err)) {
+		// An empty MultiSource reports no versions with no error, so we
+		// treat that the same as a "not known" error from a real source.
+		return nil, nil, s.notFoundError(provider)
+	}
+	return ret, warnings, err
+}
+
+func (s *offlineProviderSource) PackageMeta(provider addrs.Provider, version getproviders.Version, target getproviders.Platform) (getproviders.PackageMeta, error) {
+	ret, err := s.local.PackageMeta(provider, version, target)
+	if getproviders.ErrIsNotExist(err) {
+		return getproviders.PackageMeta{}, s.notFoundError(provider)
+	}
+	return ret, err
+}
+
+func (s *offlineProviderSource) notFoundError(provider addrs.Provider) error {
+	if len(s.searchedDirs) == 0 {
+		return fmt.Errorf("provider %s is not available locally and network installation is disabled (no local filesystem mirror directories are configured)", provider)
+	}
+	return fmt.Errorf("provider %s is not available locally and network installation is disabled (searched local mirror directories: %s)", provider, strings.Join(s.searchedDirs, ", "))
+}
@@ -0,0 +1,67 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+func TestOfflineProviderSource_filtersNetworkSources(t *testing.T) {
+	fsSource := getproviders.NewFilesystemMirrorSource("testdata/empty")
+	underlying := getproviders.MultiSource{
+		{Source: fsSource},
+		{Source: getproviders.NewMockSource(nil)}, // stands in for a registry source
+	}
+
+	source := newOfflineProviderSource(underlying)
+	if got, want := len(source.searchedDirs), 1; got != want {
+		t.Fatalf("wrong number of searched directories %d; want %d", got, want)
+	}
+	if got, want := source.searchedDirs[0], "testdata/empty"; got != want {
+		t.Errorf("wrong searched directory %q; want %q", got, want)
+	}
+	local, ok := source.local.(getproviders.MultiSource)
+	if !ok {
+		t.Fatalf("wrong local source type %T; want getproviders.MultiSource", source.local)
+	}
+	if got, want := len(local), 1; got != want {
+		t.Fatalf("wrong number of retained selectors %d; want %d", got, want)
+	}
+	if local[0].Source != getproviders.Source(fsSource) {
+		t.Error("retained selector is not the filesystem mirror source")
+	}
+}
+
+func TestOfflineProviderSource_notFoundError(t *testing.T) {
+	underlying := getproviders.MultiSource{
+		{Source: getproviders.NewFilesystemMirrorSource("testdata/empty")},
+	}
+	source := newOfflineProviderSource(underlying)
+
+	provider := addrs.NewDefaultProvider("nonexist")
+	_, _, err := source.AvailableVersions(provider)
+	if err == nil {
+		t.Fatal("unexpected success; want error listing searched directories")
+	}
+	if !strings.Contains(err.Error(), "network installation is disabled") {
+		t.Errorf("error %q does not mention that network installation is disabled", err)
+	}
+	if !strings.Contains(err.Error(), "testdata/empty") {
+		t.Errorf("error %q does not list the searched directory", err)
+	}
+}
+
+func TestOfflineProviderSource_noLocalSources(t *testing.T) {
+	source := newOfflineProviderSource(getproviders.NewMockSource(nil))
+
+	provider := addrs.NewDefaultProvider("nonexist")
+	_, _, err := source.AvailableVersions(provider)
+	if err == nil {
+		t.Fatal("unexpected success; want error about no local directories")
+	}
+	if !strings.Contains(err.Error(), "no local filesystem mirror directories are configured") {
+		t.Errorf("error %q does not mention the lack of local directories", err)
+	}
+}
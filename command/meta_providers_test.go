@@ -0,0 +1,746 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestPluginLogLevel(t *testing.T) {
+	tests := []struct {
+		env  string
+		want hclog.Level
+	}{
+		{"", hclog.Trace},
+		{"trace", hclog.Trace},
+		{"debug", hclog.Debug},
+		{"INFO", hclog.Info},
+		{"warn", hclog.Warn},
+		{"error", hclog.Error},
+		{"shouty", hclog.Trace}, // invalid values fall back to the default
+	}
+
+	defer os.Unsetenv("TF_PLUGIN_LOG_LEVEL")
+	for _, test := range tests {
+		t.Run(test.env, func(t *testing.T) {
+			os.Setenv("TF_PLUGIN_LOG_LEVEL", test.env)
+			if got := pluginLogLevel(); got != test.want {
+				t.Errorf("wrong level %v for %q; want %v", got, test.env, test.want)
+			}
+		})
+	}
+}
+
+func TestPluginAutoMTLS(t *testing.T) {
+	// The process-wide env var baseline was captured at startup, so we
+	// manipulate the variable it feeds rather than the environment.
+	oldEnable := enableProviderAutoMTLS
+	defer func() { enableProviderAutoMTLS = oldEnable }()
+
+	enableProviderAutoMTLS = true
+	m := &Meta{}
+	if !m.pluginAutoMTLS() {
+		t.Error("AutoMTLS is off by default; want on")
+	}
+
+	m.DisablePluginTLS = true
+	if m.pluginAutoMTLS() {
+		t.Error("AutoMTLS is on despite DisablePluginTLS")
+	}
+
+	// The SDK's env var keeps working regardless of the Meta setting.
+	m.DisablePluginTLS = false
+	enableProviderAutoMTLS = false
+	if m.pluginAutoMTLS() {
+		t.Error("AutoMTLS is on despite TF_DISABLE_PLUGIN_TLS")
+	}
+}
+
+func TestPluginLogLevelFor(t *testing.T) {
+	resetProviderLogLevels := func() {
+		providerLogLevels.once = sync.Once{}
+		providerLogLevels.hasGlobal = false
+		providerLogLevels.perType = nil
+	}
+	defer func() {
+		os.Unsetenv("TF_LOG_PROVIDER")
+		os.Unsetenv("TF_LOG_PROVIDER_NULL")
+		resetProviderLogLevels()
+	}()
+
+	os.Setenv("TF_LOG_PROVIDER", "info")
+	os.Setenv("TF_LOG_PROVIDER_NULL", "error")
+	resetProviderLogLevels()
+
+	// The per-provider override wins for the provider it names, while other
+	// providers get the global setting.
+	if got, want := pluginLogLevelFor(addrs.NewDefaultProvider("null")), hclog.Error; got != want {
+		t.Errorf("wrong level %v for null provider; want %v", got, want)
+	}
+	if got, want := pluginLogLevelFor(addrs.NewDefaultProvider("random")), hclog.Info; got != want {
+		t.Errorf("wrong level %v for random provider; want %v", got, want)
+	}
+
+	// An invalid per-provider value is ignored with a warning rather than
+	// masking the global setting.
+	os.Setenv("TF_LOG_PROVIDER_NULL", "shouty")
+	resetProviderLogLevels()
+	if got, want := pluginLogLevelFor(addrs.NewDefaultProvider("null")), hclog.Info; got != want {
+		t.Errorf("wrong level %v for null provider with invalid override; want %v", got, want)
+	}
+}
+
+func TestPluginStartTimeout(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", defaultPluginStartTimeout},
+		{"30s", 30 * time.Second},
+		{"2m", 2 * time.Minute},
+		{"bananas", defaultPluginStartTimeout}, // invalid values fall back to the default
+		{"-10s", defaultPluginStartTimeout},
+	}
+
+	defer os.Unsetenv("TF_PLUGIN_START_TIMEOUT")
+	for _, test := range tests {
+		t.Run(test.env, func(t *testing.T) {
+			os.Setenv("TF_PLUGIN_START_TIMEOUT", test.env)
+			if got := pluginStartTimeout(); got != test.want {
+				t.Errorf("wrong timeout %s for %q; want %s", got, test.env, test.want)
+			}
+		})
+	}
+}
+
+func TestPluginStartTimeoutConfig(t *testing.T) {
+	defer os.Unsetenv("TF_PROVIDER_STARTUP_TIMEOUT")
+
+	// A valid value wins over the default.
+	os.Setenv("TF_PROVIDER_STARTUP_TIMEOUT", "90s")
+	timeout, err := pluginStartTimeoutConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := 90 * time.Second; timeout != want {
+		t.Errorf("wrong timeout %s; want %s", timeout, want)
+	}
+
+	// Unlike the older TF_PLUGIN_START_TIMEOUT, an invalid value is an
+	// error so that a typo fails early instead of mid-operation.
+	os.Setenv("TF_PROVIDER_STARTUP_TIMEOUT", "bananas")
+	if _, err := pluginStartTimeoutConfig(); err == nil {
+		t.Error("unexpected success with invalid value; want error")
+	}
+
+	// When unset we fall back to the older variable's behavior.
+	os.Unsetenv("TF_PROVIDER_STARTUP_TIMEOUT")
+	timeout, err = pluginStartTimeoutConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if timeout != defaultPluginStartTimeout {
+		t.Errorf("wrong timeout %s; want the default %s", timeout, defaultPluginStartTimeout)
+	}
+}
+
+func TestProviderEnv(t *testing.T) {
+	defer os.Unsetenv("TF_TEST_PROVIDER_ENV_A")
+	defer os.Unsetenv("TF_TEST_PROVIDER_ENV_B")
+	os.Setenv("TF_TEST_PROVIDER_ENV_A", "a")
+	os.Setenv("TF_TEST_PROVIDER_ENV_B", "b")
+
+	contains := func(env []string, entry string) bool {
+		for _, e := range env {
+			if e == entry {
+				return true
+			}
+		}
+		return false
+	}
+
+	// With neither list set, providers inherit the full environment, which
+	// providerEnv represents as nil.
+	m := &Meta{}
+	if env := m.providerEnv(); env != nil {
+		t.Errorf("wrong result %#v with no lists set; want nil", env)
+	}
+
+	// An allowlist keeps only the named variables.
+	m = &Meta{ProviderEnvAllowlist: []string{"TF_TEST_PROVIDER_ENV_A"}}
+	env := m.providerEnv()
+	if !contains(env, "TF_TEST_PROVIDER_ENV_A=a") {
+		t.Errorf("allowlisted variable missing from %v", env)
+	}
+	if contains(env, "TF_TEST_PROVIDER_ENV_B=b") {
+		t.Errorf("non-allowlisted variable present in result")
+	}
+
+	// A denylist keeps everything except the named variables.
+	m = &Meta{ProviderEnvDenylist: []string{"TF_TEST_PROVIDER_ENV_B"}}
+	env = m.providerEnv()
+	if !contains(env, "TF_TEST_PROVIDER_ENV_A=a") {
+		t.Errorf("unrelated variable missing from denylist result")
+	}
+	if contains(env, "TF_TEST_PROVIDER_ENV_B=b") {
+		t.Errorf("denylisted variable present in result")
+	}
+
+	// Minimal mode keeps only the baseline variables plus any explicit
+	// allowlist entries.
+	m = &Meta{
+		ProviderMinimalEnv:   true,
+		ProviderEnvAllowlist: []string{"TF_TEST_PROVIDER_ENV_A"},
+	}
+	env = m.providerEnv()
+	if env == nil {
+		t.Fatal("minimal mode returned nil; want a curated environment")
+	}
+	if !contains(env, "TF_TEST_PROVIDER_ENV_A=a") {
+		t.Errorf("allowlisted variable missing from minimal environment")
+	}
+	if contains(env, "TF_TEST_PROVIDER_ENV_B=b") {
+		t.Errorf("non-allowlisted variable present in minimal environment")
+	}
+	if path := os.Getenv("PATH"); path != "" && !contains(env, "PATH="+path) {
+		t.Errorf("PATH missing from minimal environment")
+	}
+}
+
+func TestErrLooksLikeTransientLaunchFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("fork/exec /tmp/terraform-provider-null: text file busy"), true},
+		{errors.New("dial tcp 127.0.0.1:10000: connect: connection refused"), true},
+		{errors.New("Incompatible API version with plugin. Plugin version: 3, Client versions: [4 5]"), false},
+		{errPluginStartTimeout{30 * time.Second}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v", test.err), func(t *testing.T) {
+			if got := errLooksLikeTransientLaunchFailure(test.err); got != test.want {
+				t.Errorf("wrong result %t for %v; want %t", got, test.err, test.want)
+			}
+		})
+	}
+}
+
+func TestProviderFactoriesError(t *testing.T) {
+	nullProvider := addrs.NewDefaultProvider("null")
+	randomProvider := addrs.NewDefaultProvider("random")
+	err := ProviderFactoriesError{
+		ProviderErrors: map[addrs.Provider]error{
+			nullProvider:   errors.New("package for selected version 2.0.0 is no longer available in the local cache directory (expected at .terraform/plugins/registry.terraform.io/hashicorp/null/2.0.0/linux_amd64)"),
+			randomProvider: errors.New("package for selected version 1.2.0 is no longer available in the local cache directory (expected at .terraform/plugins/registry.terraform.io/hashicorp/random/1.2.0/linux_amd64)"),
+		},
+		CacheDir: ".terraform/plugins",
+	}
+
+	msg := err.Error()
+	for _, want := range []string{
+		"hashicorp/null",
+		"hashicorp/random",
+		"2.0.0",
+		"1.2.0",
+		".terraform/plugins/registry.terraform.io/hashicorp/null/2.0.0/linux_amd64",
+		"terraform init",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error does not mention %q:\n%s", want, msg)
+		}
+	}
+
+	// The listing must mention the null provider before the random provider
+	// so that the report is deterministic between runs.
+	if strings.Index(msg, "hashicorp/null") > strings.Index(msg, "hashicorp/random") {
+		t.Errorf("providers are not listed in sorted order:\n%s", msg)
+	}
+
+	wantProviders := []addrs.Provider{nullProvider, randomProvider}
+	if got := err.Providers(); !reflect.DeepEqual(got, wantProviders) {
+		t.Errorf("wrong providers %#v; want %#v", got, wantProviders)
+	}
+
+	diags := err.Diagnostics()
+	if got, want := len(diags), 2; got != want {
+		t.Fatalf("wrong number of diagnostics %d; want %d", got, want)
+	}
+	desc := diags[0].Description()
+	if got, want := desc.Summary, "Provider package is no longer usable"; got != want {
+		t.Errorf("wrong diagnostic summary %q; want %q", got, want)
+	}
+	for _, want := range []string{"hashicorp/null", ".terraform/plugins", "terraform init"} {
+		if !strings.Contains(desc.Detail, want) {
+			t.Errorf("diagnostic detail does not mention %q:\n%s", want, desc.Detail)
+		}
+	}
+}
+
+func TestErrLooksLikeClockSkew(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("connection refused"), false},
+		{errors.New("x509: certificate has expired or is not yet valid"), true},
+		{errors.New("x509: certificate is not yet valid"), true},
+		{fmt.Errorf("failed to dial: %s", errors.New("remote error: tls: bad certificate: certificate has expired")), true},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v", test.err), func(t *testing.T) {
+			if got := errLooksLikeClockSkew(test.err); got != test.want {
+				t.Errorf("wrong result %t for %v; want %t", got, test.err, test.want)
+			}
+		})
+	}
+}
+
+func TestErrLooksLikeProtocolMismatch(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("connection refused"), false},
+		{errors.New("Incompatible API version with plugin. Plugin version: 4, Client versions: [5 6]"), true},
+		{fmt.Errorf("failed to start: %s", errors.New("Incompatible API version with plugin. Plugin version: 7, Client versions: [5 6]")), true},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v", test.err), func(t *testing.T) {
+			if got := errLooksLikeProtocolMismatch(test.err); got != test.want {
+				t.Errorf("wrong result %t for %v; want %t", got, test.err, test.want)
+			}
+		})
+	}
+}
+
+func TestSupportedProtocolVersions(t *testing.T) {
+	got := supportedProtocolVersions()
+	if len(got) == 0 {
+		t.Fatal("no supported protocol versions")
+	}
+	if !sort.IntsAreSorted(got) {
+		t.Errorf("versions %v are not in ascending order", got)
+	}
+	found := false
+	for _, version := range got {
+		if version == 5 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("versions %v do not include protocol 5", got)
+	}
+}
+
+func TestInternalProviders_additionalBuiltin(t *testing.T) {
+	m := &Meta{
+		AdditionalBuiltinProviders: map[string]providers.Factory{
+			"testharness": func() (providers.Interface, error) {
+				return &terraform.MockProvider{}, nil
+			},
+		},
+	}
+
+	internal := m.internalProviders()
+	if _, exists := internal["terraform"]; !exists {
+		t.Error("missing the standard terraform builtin provider")
+	}
+	if _, exists := internal["testharness"]; !exists {
+		t.Error("missing the additional testharness builtin provider")
+	}
+
+	// Colliding with a provider built in to Terraform itself is a mistake
+	// in the embedding program, reported by panicking.
+	m.AdditionalBuiltinProviders["terraform"] = m.AdditionalBuiltinProviders["testharness"]
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a colliding builtin provider name")
+		}
+	}()
+	m.internalProviders()
+}
+
+func TestInternalProviders_disableTerraform(t *testing.T) {
+	m := &Meta{
+		DisableBuiltinTerraformProvider: true,
+		AdditionalBuiltinProviders: map[string]providers.Factory{
+			"testharness": func() (providers.Interface, error) {
+				return &terraform.MockProvider{}, nil
+			},
+		},
+	}
+
+	internal := m.internalProviders()
+	if _, exists := internal["terraform"]; exists {
+		t.Error("terraform builtin provider still present despite being disabled")
+	}
+	if _, exists := internal["testharness"]; !exists {
+		t.Error("missing the additional testharness builtin provider")
+	}
+
+	// Disabling the terraform provider must not open up its name for reuse
+	// by an embedding program.
+	m.AdditionalBuiltinProviders["terraform"] = m.AdditionalBuiltinProviders["testharness"]
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a colliding builtin provider name")
+		}
+	}()
+	m.internalProviders()
+}
+
+func TestProviderFactories_additionalBuiltin(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "terraform-test-meta-providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	m := &Meta{
+		OverrideDataDir: dataDir,
+		AdditionalBuiltinProviders: map[string]providers.Factory{
+			"testharness": func() (providers.Interface, error) {
+				return &terraform.MockProvider{}, nil
+			},
+		},
+	}
+
+	factories, err := m.providerFactories()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	factory, exists := factories[addrs.NewBuiltInProvider("testharness")]
+	if !exists {
+		t.Fatal("no factory for terraform.io/builtin/testharness")
+	}
+	p, err := factory()
+	if err != nil {
+		t.Fatalf("unexpected error instantiating the builtin provider: %s", err)
+	}
+	if _, ok := p.(*terraform.MockProvider); !ok {
+		t.Fatalf("wrong provider implementation %T", p)
+	}
+}
+
+func TestProviderFactories_testDoubles(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "terraform-test-meta-providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	provider := addrs.NewDefaultProvider("test")
+	m := &Meta{
+		OverrideDataDir: dataDir,
+		TestProviderFactories: map[addrs.Provider]providers.Factory{
+			provider: func() (providers.Interface, error) {
+				return &terraform.MockProvider{}, nil
+			},
+		},
+	}
+
+	factories, err := m.providerFactories()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	factory, exists := factories[provider]
+	if !exists {
+		t.Fatalf("no factory for %s", provider)
+	}
+	p, err := factory()
+	if err != nil {
+		t.Fatalf("unexpected error instantiating the test double: %s", err)
+	}
+	if _, ok := p.(*terraform.MockProvider); !ok {
+		t.Fatalf("wrong provider implementation %T", p)
+	}
+}
+
+func TestVerifyOnLaunchFactory(t *testing.T) {
+	pkgDir, err := ioutil.TempDir("", "terraform-test-verify-launch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pkgDir)
+
+	exePath := filepath.Join(pkgDir, "terraform-provider-null")
+	if err := ioutil.WriteFile(exePath, []byte("executable"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cached := &providercache.CachedProvider{
+		Provider:       addrs.NewDefaultProvider("null"),
+		Version:        getproviders.MustParseVersion("2.0.0"),
+		PackageDir:     pkgDir,
+		ExecutableFile: exePath,
+	}
+	hash, err := cached.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner := func() (providers.Interface, error) {
+		return &terraform.MockProvider{}, nil
+	}
+
+	// An unmodified package passes through to the wrapped factory.
+	factory := verifyOnLaunchFactory(inner, cached, hash)
+	if _, err := factory(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A package modified after init must be refused.
+	if err := ioutil.WriteFile(exePath, []byte("tampered"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, err = factory()
+	if err == nil {
+		t.Fatal("unexpected success after tampering with the package")
+	}
+	if !strings.Contains(err.Error(), "refusing to launch") {
+		t.Fatalf("wrong error %q; want refusal to launch", err)
+	}
+	if !strings.Contains(err.Error(), hash) {
+		t.Fatalf("wrong error %q; want mention of the recorded checksum %s", err, hash)
+	}
+}
+
+func TestProviderCustomLocalDirectorySource_globs(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "terraform-test-plugindir-glob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+	for _, dir := range []string{"2024-01/providers", "2024-02/providers"} {
+		if err := os.MkdirAll(filepath.Join(baseDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A matching regular file must not become a source.
+	if err := ioutil.WriteFile(filepath.Join(baseDir, "2024-03"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := new(Meta)
+
+	t.Run("pattern matching directories", func(t *testing.T) {
+		source, err := m.providerCustomLocalDirectorySource([]string{
+			filepath.Join(baseDir, "2024-*", "providers"),
+		}, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got, want := len(source.(getproviders.MultiSource)), 2; got != want {
+			t.Errorf("wrong number of sources %d; want %d", got, want)
+		}
+	})
+
+	t.Run("pattern matching only a file", func(t *testing.T) {
+		_, err := m.providerCustomLocalDirectorySource([]string{
+			filepath.Join(baseDir, "2024-03*"),
+		}, false)
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if got := err.Error(); !strings.Contains(got, "matched no directories") {
+			t.Errorf("wrong error %q", got)
+		}
+	})
+
+	t.Run("literal path that exists", func(t *testing.T) {
+		source, err := m.providerCustomLocalDirectorySource([]string{
+			filepath.Join(baseDir, "2024-01", "providers"),
+		}, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		multi := source.(getproviders.MultiSource)
+		if got, want := len(multi), 1; got != want {
+			t.Fatalf("wrong number of sources %d; want %d", got, want)
+		}
+		// The resulting source must use the resolved absolute path, so
+		// later working-directory changes can't redirect the search.
+		if got := multi[0].Source.(*getproviders.FilesystemMirrorSource).BaseDir(); !filepath.IsAbs(got) {
+			t.Errorf("base directory %q is not absolute", got)
+		}
+	})
+
+	t.Run("literal path that does not exist", func(t *testing.T) {
+		_, err := m.providerCustomLocalDirectorySource([]string{
+			filepath.Join(baseDir, "does-not-exist"),
+		}, false)
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if got := err.Error(); !strings.Contains(got, "does not exist") || !strings.Contains(got, filepath.Join(baseDir, "does-not-exist")) {
+			t.Errorf("wrong error %q", got)
+		}
+	})
+
+	t.Run("literal path that is a file", func(t *testing.T) {
+		_, err := m.providerCustomLocalDirectorySource([]string{
+			filepath.Join(baseDir, "2024-03"),
+		}, false)
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if got := err.Error(); !strings.Contains(got, "is not a directory") {
+			t.Errorf("wrong error %q", got)
+		}
+	})
+	t.Run("optional pattern matching nothing", func(t *testing.T) {
+		source, err := m.providerCustomLocalDirectorySource([]string{
+			filepath.Join(baseDir, "2025-*", "providers"),
+		}, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got, want := len(source.(getproviders.MultiSource)), 0; got != want {
+			t.Errorf("wrong number of sources %d; want %d", got, want)
+		}
+	})
+
+	t.Run("optional literal path that does not exist", func(t *testing.T) {
+		source, err := m.providerCustomLocalDirectorySource([]string{
+			filepath.Join(baseDir, "does-not-exist"),
+		}, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got, want := len(source.(getproviders.MultiSource)), 0; got != want {
+			t.Errorf("wrong number of sources %d; want %d", got, want)
+		}
+	})
+
+	t.Run("glob matches are in lexical order", func(t *testing.T) {
+		source, err := m.providerCustomLocalDirectorySource([]string{
+			filepath.Join(baseDir, "2024-*", "providers"),
+		}, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		multi := source.(getproviders.MultiSource)
+		var got []string
+		for _, selector := range multi {
+			got = append(got, selector.Source.(*getproviders.FilesystemMirrorSource).BaseDir())
+		}
+		if !sort.StringsAreSorted(got) {
+			t.Errorf("sources are not in lexical order: %#v", got)
+		}
+	})
+}
+
+func TestProviderCustomLocalDirectorySource_recursive(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "terraform-test-plugindir-recursive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+	// Two mirror directories at different depths, plus some unrelated
+	// content that must be skipped without error.
+	mirrorLayouts := []string{
+		"team-a/registry.example.com/awesomecorp/happycloud/1.0.0",
+		"team-b/nested/mirror.example.net/awesomecorp/sadcloud/1.0.0",
+		"docs/notes",
+	}
+	for _, dir := range mirrorLayouts {
+		if err := os.MkdirAll(filepath.Join(baseDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := new(Meta)
+
+	t.Run("finds nested mirrors", func(t *testing.T) {
+		source, err := m.providerCustomLocalDirectorySource([]string{
+			baseDir + "/...",
+		}, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got, want := len(source.(getproviders.MultiSource)), 2; got != want {
+			t.Errorf("wrong number of sources %d; want %d", got, want)
+		}
+	})
+
+	t.Run("no mirrors under root", func(t *testing.T) {
+		_, err := m.providerCustomLocalDirectorySource([]string{
+			filepath.Join(baseDir, "docs") + "/...",
+		}, false)
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if got := err.Error(); !strings.Contains(got, "no provider mirror directories") {
+			t.Errorf("wrong error %q", got)
+		}
+	})
+}
+
+func TestProviderInstallConcurrency(t *testing.T) {
+	tests := map[string]int{
+		"":    0,
+		"2":   2,
+		"0":   0,
+		"-1":  0,
+		"two": 0,
+	}
+	for value, want := range tests {
+		t.Run(fmt.Sprintf("%q", value), func(t *testing.T) {
+			os.Setenv("TF_PROVIDER_INSTALL_CONCURRENCY", value)
+			defer os.Unsetenv("TF_PROVIDER_INSTALL_CONCURRENCY")
+			if got := providerInstallConcurrency(); got != want {
+				t.Errorf("wrong concurrency %d; want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestProviderDownloadRateLimit(t *testing.T) {
+	tests := map[string]int64{
+		"":       0,
+		"1024":   1024,
+		"512KB":  512 * 1024,
+		"5MB":    5 * 1024 * 1024,
+		"1GB":    1024 * 1024 * 1024,
+		"2mb":    2 * 1024 * 1024,
+		"10MB/s": 10 * 1024 * 1024,
+		"2mb/s":  2 * 1024 * 1024,
+		"1024/s": 1024,
+		"100B":   100,
+		"0":      0,
+		"-5MB":   0,
+		"fastMB": 0,
+		"5MBs":   0,
+	}
+	for value, want := range tests {
+		t.Run(fmt.Sprintf("%q", value), func(t *testing.T) {
+			os.Setenv("TF_PROVIDER_DOWNLOAD_LIMIT", value)
+			defer os.Unsetenv("TF_PROVIDER_DOWNLOAD_LIMIT")
+			if got := providerDownloadRateLimit(); got != want {
+				t.Errorf("wrong rate limit %d; want %d", got, want)
+			}
+		})
+	}
+}
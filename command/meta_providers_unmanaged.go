@@ -0,0 +1,450 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	plugin "github.com/hashicorp/go-plugin"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/providers"
+)
+
+// unmanagedProviderConfig describes how to connect to a provider plugin
+// server that was started by some process other than Terraform itself, such
+// as a provider running under a debugger or one launched by the plugin SDK's
+// acceptance test harness.
+type unmanagedProviderConfig struct {
+	// ProtocolVersion is the provider protocol version that the running
+	// server speaks, which we use to select the correct plugin set when
+	// dispensing the provider interface.
+	ProtocolVersion int
+
+	// Reattach is the configuration passed to go-plugin so that it will
+	// connect to the already-running server rather than launching a new
+	// child process.
+	Reattach *plugin.ReattachConfig
+
+	// Addrs is the ordered list of candidate addresses for reaching the
+	// server, of which Reattach.Addr is always the first. When connecting,
+	// each address is tried in turn until one of them yields a working
+	// client, which supports test topologies where the reachable transport
+	// varies between runs.
+	Addrs []net.Addr
+
+	// Test is set when the server is being run by the plugin SDK's test
+	// framework, which manages the server's lifecycle itself.
+	Test bool
+}
+
+// unmanagedProviderConfigs reads the TF_PROVIDER_REATTACH environment
+// variable and returns the unmanaged provider configurations it describes,
+// keyed by provider address.
+//
+// The result is an empty map if the environment variable is unset. Providers
+// given here take priority over any managed installation of the same
+// provider address, which is the behavior the plugin SDK relies on when
+// running provider acceptance tests against an in-process server.
+func unmanagedProviderConfigs() (map[addrs.Provider]*unmanagedProviderConfig, error) {
+	env := os.Getenv("TF_PROVIDER_REATTACH")
+	filename := os.Getenv("TF_PROVIDER_REATTACH_FILE")
+	if env != "" {
+		if filename != "" {
+			log.Printf("[DEBUG] both TF_PROVIDER_REATTACH and TF_PROVIDER_REATTACH_FILE are set; using the inline TF_PROVIDER_REATTACH value")
+		}
+		return parseUnmanagedProviderConfigs(env)
+	}
+	if filename != "" {
+		// Reading the configuration from a file allows reattach setups too
+		// large to fit comfortably in an environment variable, such as for
+		// multi-provider acceptance test runs.
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reattach configuration from %s: %s", filename, err)
+		}
+		return parseUnmanagedProviderConfigs(string(data))
+	}
+	return nil, nil
+}
+
+// unmanagedProviders returns the providers that are being satisfied by
+// reattachment to already-running server processes, for callers that want
+// to report on them rather than connect to them.
+//
+// A malformed reattach configuration yields an empty result here; the
+// parse error itself is reported when provider factories are built, which
+// is the point where it actually prevents work from proceeding.
+func (m *Meta) unmanagedProviders() map[addrs.Provider]*unmanagedProviderConfig {
+	configs, err := unmanagedProviderConfigs()
+	if err != nil {
+		log.Printf("[WARN] ignoring malformed reattach configuration: %s", err)
+		return nil
+	}
+	return configs
+}
+
+// reattachTransportName returns a human-friendly name for the transport of
+// the given reattach address, for use in annotations like "reattached to
+// PID 1234 via unix socket".
+func reattachTransportName(addr net.Addr) string {
+	switch addr.Network() {
+	case "unix":
+		return "unix socket"
+	case "tcp":
+		return "tcp"
+	case "pipe":
+		return "named pipe"
+	default:
+		return addr.Network()
+	}
+}
+
+// parseUnmanagedProviderConfigs parses a TF_PROVIDER_REATTACH value in
+// either of its two supported formats, detecting the JSON form by its
+// leading "{".
+func parseUnmanagedProviderConfigs(env string) (map[addrs.Provider]*unmanagedProviderConfig, error) {
+	if strings.HasPrefix(strings.TrimSpace(env), "{") {
+		return parseReattachFromJSON(env)
+	}
+	return parseReattachFromEnv(env)
+}
+
+// parseReattachFromJSON parses the JSON form of TF_PROVIDER_REATTACH: an
+// object mapping provider source addresses to connection descriptions.
+//
+// This form is preferred over the legacy pipe-and-comma syntax handled by
+// parseReattachFromEnv because it can represent socket paths containing
+// the delimiter characters and leaves room for optional fields. A document
+// looks like:
+//
+//     {
+//       "registry.terraform.io/hashicorp/null": {
+//         "Protocol": "grpc",
+//         "ProtocolVersion": 5,
+//         "Addr": {
+//           "Network": "unix",
+//           "String": "/tmp/plugin123456"
+//         },
+//         "Pid": 1234,
+//         "Test": true
+//       }
+//     }
+func parseReattachFromJSON(env string) (map[addrs.Provider]*unmanagedProviderConfig, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(env), &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON in TF_PROVIDER_REATTACH: %s", err)
+	}
+
+	type jsonReattachEntry struct {
+		Protocol        string
+		ProtocolVersion int
+		Addr            struct {
+			Network string
+			String  string
+		}
+		Pid  int
+		Test bool
+	}
+
+	ret := make(map[addrs.Provider]*unmanagedProviderConfig, len(raw))
+	for addrStr, rawEntry := range raw {
+		provider, diags := addrs.ParseProviderSourceString(addrStr)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("invalid provider address %q in TF_PROVIDER_REATTACH: %s", addrStr, diags.Err())
+		}
+
+		var entry jsonReattachEntry
+		if err := json.Unmarshal(rawEntry, &entry); err != nil {
+			return nil, fmt.Errorf("invalid TF_PROVIDER_REATTACH entry for %q: %s", addrStr, err)
+		}
+
+		addr, err := resolveReattachAddr(entry.Addr.Network, entry.Addr.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TF_PROVIDER_REATTACH entry for %q: %s", addrStr, err)
+		}
+
+		if entry.ProtocolVersion == 0 {
+			// An omitted protocol version means the newest one this
+			// Terraform release supports.
+			entry.ProtocolVersion = defaultReattachProtocolVersion()
+		}
+
+		ret[provider] = &unmanagedProviderConfig{
+			ProtocolVersion: entry.ProtocolVersion,
+			Reattach: &plugin.ReattachConfig{
+				Protocol: plugin.Protocol(entry.Protocol),
+				Addr:     addr,
+				Pid:      entry.Pid,
+			},
+			Addrs: []net.Addr{addr},
+			Test:  entry.Test,
+		}
+	}
+	return ret, nil
+}
+
+// defaultReattachProtocolVersion returns the provider protocol version we
+// assume for any reattach configuration that doesn't specify a version
+// itself. This stays at 5 even though newer versions are supported, because
+// the servers old enough to omit the version all speak protocol 5; protocol
+// 6 servers must say so explicitly.
+func defaultReattachProtocolVersion() int {
+	return 5
+}
+
+// resolveReattachAddr produces a net.Addr for the given network and address
+// strings from a reattach configuration. The supported networks are "unix",
+// "tcp", and -- on Windows only -- "pipe" (with "npipe" as an alias).
+func resolveReattachAddr(network, addr string) (net.Addr, error) {
+	switch network {
+	case "unix":
+		return net.ResolveUnixAddr("unix", addr)
+	case "tcp":
+		return net.ResolveTCPAddr("tcp", addr)
+	case "pipe", "npipe":
+		return resolvePipeAddr(addr)
+	default:
+		return nil, fmt.Errorf("unknown address type %q", network)
+	}
+}
+
+// parseReattachFromEnv parses the value of the TF_PROVIDER_REATTACH
+// environment variable, which describes one or more provider plugin servers
+// that are already running and that Terraform should connect to instead of
+// launching the installed packages for those providers.
+//
+// The expected syntax is a comma-separated list of entries of the form:
+//
+//     HOSTNAME/NAMESPACE/TYPE=PROTOCOL|PROTOCOL_VERSION|NETWORK|ADDRESS|PID
+//
+// where NETWORK is "unix", "tcp", or -- on Windows only -- "pipe" (with
+// "npipe" accepted as an alias), matching the transports that the plugin
+// SDK can serve on for each platform.
+//
+// The delimiter characters "," "|" ";" and "=" may appear literally inside
+// a field -- most commonly in a socket path -- by preceding them with a
+// backslash, or the whole field value may be wrapped in double quotes, in
+// which case delimiters inside the quotes are taken literally. A backslash
+// followed by anything other than a delimiter or a quote is taken
+// literally, so that Windows named pipe paths like \\.\pipe\plugin need no
+// escaping. Anything emitting this syntax must apply the same escaping.
+func parseReattachFromEnv(env string) (map[addrs.Provider]*unmanagedProviderConfig, error) {
+	ret := map[addrs.Provider]*unmanagedProviderConfig{}
+	// A quoting problem found while separating the entries is deliberately
+	// not reported here: the offending quote stays inside one of the split
+	// results, and the per-entry parsing below reports it together with the
+	// provider key it belongs to.
+	entries, _ := splitEscaped(env, ',')
+	for _, entry := range entries {
+		eq := strings.Index(entry, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid TF_PROVIDER_REATTACH entry %q: must have the form <provider-address>=<connection-info>", entry)
+		}
+		// Provider addresses contain no delimiters needing escapes, so the
+		// first "=" always ends the address; any later "=" characters belong
+		// to the connection info, where they can appear escaped or quoted
+		// inside a socket path.
+		addrStr, connStr := entry[:eq], entry[eq+1:]
+		provider, diags := addrs.ParseProviderSourceString(addrStr)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("invalid provider address %q in TF_PROVIDER_REATTACH: %s", addrStr, diags.Err())
+		}
+
+		fields, err := splitEscaped(connStr, '|')
+		if err != nil {
+			return nil, fmt.Errorf("invalid TF_PROVIDER_REATTACH entry for %s: %s", provider, err)
+		}
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid TF_PROVIDER_REATTACH entry for %s: connection info must have the form protocol|protocol-version|network|address|pid", provider)
+		}
+
+		var protoVersion int
+		if fields[1] == "" {
+			// An omitted protocol version means the newest one this
+			// Terraform release supports.
+			protoVersion = defaultReattachProtocolVersion()
+		} else {
+			var err error
+			protoVersion, err = strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid protocol version %q for provider %s in TF_PROVIDER_REATTACH: %s", fields[1], provider, err)
+			}
+		}
+		pid, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid %q for provider %s in TF_PROVIDER_REATTACH: %s", fields[4], provider, err)
+		}
+
+		// The address field may give several candidate addresses separated
+		// by semicolons, to be tried in order when connecting.
+		addrStrs, err := splitEscaped(fields[3], ';')
+		if err != nil {
+			return nil, fmt.Errorf("invalid TF_PROVIDER_REATTACH entry for %s: %s", provider, err)
+		}
+		var addrs []net.Addr
+		for _, addrStr := range addrStrs {
+			addr, err := resolveReattachAddr(fields[2], unescapeReattachField(addrStr))
+			if err != nil {
+				return nil, fmt.Errorf("invalid TF_PROVIDER_REATTACH entry for %s: %s", provider, err)
+			}
+			addrs = append(addrs, addr)
+		}
+
+		ret[provider] = &unmanagedProviderConfig{
+			ProtocolVersion: protoVersion,
+			Reattach: &plugin.ReattachConfig{
+				Protocol: plugin.Protocol(fields[0]),
+				Addr:     addrs[0],
+				Pid:      pid,
+			},
+			Addrs: addrs,
+		}
+	}
+	return ret, nil
+}
+
+// reattachSocketsGone returns a non-nil error if the configuration's only
+// candidate transports are unix sockets whose paths no longer exist on disk,
+// which means any dial attempt is doomed to time out. A configuration with
+// at least one reachable-looking candidate returns nil, leaving the final
+// verdict to the actual connection attempts.
+func reattachSocketsGone(config *unmanagedProviderConfig) error {
+	candidates := config.Addrs
+	if len(candidates) == 0 {
+		candidates = []net.Addr{config.Reattach.Addr}
+	}
+	var firstMissing string
+	for _, addr := range candidates {
+		if addr.Network() != "unix" {
+			return nil // non-socket transports can't be pre-checked this way
+		}
+		if _, err := os.Stat(addr.String()); err == nil {
+			return nil
+		}
+		if firstMissing == "" {
+			firstMissing = addr.String()
+		}
+	}
+	return fmt.Errorf("socket %s no longer exists", firstMissing)
+}
+
+// verifyUnmanagedProviderIdentity checks that the server we just reattached
+// to under the given provider address actually appears to implement that
+// provider, so that a typo in TF_PROVIDER_REATTACH fails with a direct
+// message rather than baffling schema errors later in the plan.
+//
+// The provider protocol has no explicit identity call, but by convention
+// every resource type and data source name is prefixed with the provider's
+// type name, so a server whose schema contains no such name is almost
+// certainly the wrong one. Servers that report no resource types at all
+// give us nothing to check, so those only get a log message.
+func verifyUnmanagedProviderIdentity(provider addrs.Provider, p providers.Interface) error {
+	resp := p.GetSchema()
+	if resp.Diagnostics.HasErrors() {
+		// Schema problems will be reported with better context by whatever
+		// operation needed the schema, so they don't fail the identity
+		// check here.
+		log.Printf("[WARN] cannot verify the identity of the unmanaged provider server for %s: %s", provider.ForDisplay(), resp.Diagnostics.Err())
+		return nil
+	}
+	names := make([]string, 0, len(resp.ResourceTypes)+len(resp.DataSources))
+	for name := range resp.ResourceTypes {
+		names = append(names, name)
+	}
+	for name := range resp.DataSources {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		log.Printf("[WARN] cannot verify the identity of the unmanaged provider server for %s, because it reports no resource types or data sources", provider.ForDisplay())
+		return nil
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == provider.Type || strings.HasPrefix(name, provider.Type+"_") {
+			return nil
+		}
+	}
+	return fmt.Errorf("the unmanaged provider server reattached to for %s does not appear to implement that provider: its resource types (such as %q) do not match the provider name; check the provider address in TF_PROVIDER_REATTACH", provider.ForDisplay(), names[0])
+}
+
+// reattachEscapableDelim returns true for the delimiter characters that a
+// backslash can escape in a TF_PROVIDER_REATTACH value. A backslash before
+// any other character (except a double quote) is just a literal backslash,
+// which keeps Windows named pipe paths working without escaping.
+func reattachEscapableDelim(c byte) bool {
+	return c == ',' || c == '|' || c == ';' || c == '='
+}
+
+// splitEscaped splits s on the given separator character while honoring
+// backslash escapes and double-quoted spans, so that a separator preceded
+// by a backslash or enclosed in quotes is treated as part of the current
+// field rather than as a field boundary.
+//
+// The escape sequences and quotes themselves are left intact in the
+// returned fields, so that a field which itself contains further-delimited
+// parts (like the semicolon-separated address list inside a pipe-delimited
+// entry) can be split again with a different separator. Call
+// unescapeReattachField on a field once no further splitting of it is
+// needed.
+func splitEscaped(s string, sep byte) ([]string, error) {
+	var ret []string
+	var field strings.Builder
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && (reattachEscapableDelim(s[i+1]) || s[i+1] == '"'):
+			// Keep the backslash and the character it escapes together, so
+			// that nested splits see the sequence as still escaped.
+			field.WriteByte(s[i])
+			i++
+			field.WriteByte(s[i])
+		case s[i] == '"':
+			inQuotes = !inQuotes
+			field.WriteByte(s[i])
+		case s[i] == sep && !inQuotes:
+			ret = append(ret, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(s[i])
+		}
+	}
+	ret = append(ret, field.String())
+	if inQuotes {
+		// The fields accumulated so far are still returned, so that a
+		// caller in a position to name the entry being parsed can prefer
+		// to report the error with that context.
+		return ret, fmt.Errorf("unterminated quoted string")
+	}
+	return ret, nil
+}
+
+// unescapeReattachField removes the backslash escaping and enclosing quotes
+// from a single field previously extracted by splitEscaped, turning e.g.
+// `\,` into `,` and `"a,b"` into `a,b` while leaving any other backslashes
+// alone.
+func unescapeReattachField(s string) string {
+	if !strings.ContainsAny(s, `\"`) {
+		return s
+	}
+	var ret strings.Builder
+	ret.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && (reattachEscapableDelim(s[i+1]) || s[i+1] == '"'):
+			i++
+			ret.WriteByte(s[i])
+		case s[i] == '"':
+			// Quote characters only group; they are not part of the value.
+		default:
+			ret.WriteByte(s[i])
+		}
+	}
+	return ret.String()
+}
@@ -0,0 +1,511 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	plugin "github.com/hashicorp/go-plugin"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestParseReattachFromEnv(t *testing.T) {
+	env := "registry.terraform.io/hashicorp/null=grpc|5|unix|/tmp/plugin123456|1234"
+	got, err := parseReattachFromEnv(env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("wrong number of providers %d; want 1", len(got))
+	}
+	config := got[addrs.NewDefaultProvider("null")]
+	if config == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/null")
+	}
+	if got, want := config.ProtocolVersion, 5; got != want {
+		t.Errorf("wrong protocol version %d; want %d", got, want)
+	}
+	if got, want := string(config.Reattach.Protocol), "grpc"; got != want {
+		t.Errorf("wrong protocol %q; want %q", got, want)
+	}
+	if got, want := config.Reattach.Addr.Network(), "unix"; got != want {
+		t.Errorf("wrong network %q; want %q", got, want)
+	}
+	if got, want := config.Reattach.Addr.String(), "/tmp/plugin123456"; got != want {
+		t.Errorf("wrong address %q; want %q", got, want)
+	}
+	if got, want := config.Reattach.Pid, 1234; got != want {
+		t.Errorf("wrong pid %d; want %d", got, want)
+	}
+}
+
+func TestParseReattachFromEnv_mixedUnixAndPipe(t *testing.T) {
+	env := strings.Join([]string{
+		"registry.terraform.io/hashicorp/null=grpc|5|unix|/tmp/plugin123456|1234",
+		`registry.terraform.io/hashicorp/random=grpc|5|pipe|\\.\pipe\plugin654321|5678`,
+	}, ",")
+
+	got, err := parseReattachFromEnv(env)
+	if runtime.GOOS != "windows" {
+		// The "pipe" address type is valid only on Windows, so elsewhere
+		// the whole parse must fail with a message saying so, rather than
+		// the generic "unknown address type" error.
+		if err == nil {
+			t.Fatal("unexpected success; want error about named pipes")
+		}
+		if !strings.Contains(err.Error(), "named pipes are only supported on Windows") {
+			t.Fatalf("wrong error %q; want mention of Windows-only named pipes", err)
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("wrong number of providers %d; want 2", len(got))
+	}
+	config := got[addrs.NewDefaultProvider("random")]
+	if config == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/random")
+	}
+	if got, want := config.Reattach.Addr.Network(), "pipe"; got != want {
+		t.Errorf("wrong network %q; want %q", got, want)
+	}
+	if got, want := config.Reattach.Addr.String(), `\\.\pipe\plugin654321`; got != want {
+		t.Errorf("wrong address %q; want %q", got, want)
+	}
+}
+
+func TestParseReattachFromEnv_npipeAlias(t *testing.T) {
+	// "npipe" is accepted as an alias for "pipe", matching the network name
+	// that go-plugin itself uses for named pipe listeners.
+	env := `registry.terraform.io/hashicorp/null=grpc|5|npipe|\\.\pipe\plugin123456|1234`
+
+	got, err := parseReattachFromEnv(env)
+	if runtime.GOOS != "windows" {
+		if err == nil {
+			t.Fatal("unexpected success; want error about named pipes")
+		}
+		if !strings.Contains(err.Error(), "named pipes are only supported on Windows") {
+			t.Fatalf("wrong error %q; want mention of Windows-only named pipes", err)
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := got[addrs.NewDefaultProvider("null")]
+	if config == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/null")
+	}
+	if got, want := config.Reattach.Addr.Network(), "pipe"; got != want {
+		t.Errorf("wrong network %q; want %q", got, want)
+	}
+}
+
+func TestParseReattachFromJSON(t *testing.T) {
+	env := `{
+		"registry.terraform.io/hashicorp/null": {
+			"Protocol": "grpc",
+			"ProtocolVersion": 5,
+			"Addr": {
+				"Network": "unix",
+				"String": "/tmp/plugin,with|delimiters"
+			},
+			"Pid": 1234,
+			"Test": true
+		}
+	}`
+	got, err := parseUnmanagedProviderConfigs(env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("wrong number of providers %d; want 1", len(got))
+	}
+	config := got[addrs.NewDefaultProvider("null")]
+	if config == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/null")
+	}
+	if got, want := config.ProtocolVersion, 5; got != want {
+		t.Errorf("wrong protocol version %d; want %d", got, want)
+	}
+	if got, want := config.Reattach.Addr.String(), "/tmp/plugin,with|delimiters"; got != want {
+		t.Errorf("wrong address %q; want %q", got, want)
+	}
+	if got, want := config.Reattach.Pid, 1234; got != want {
+		t.Errorf("wrong pid %d; want %d", got, want)
+	}
+	if !config.Test {
+		t.Error("Test flag not set")
+	}
+}
+
+func TestParseReattachFromJSON_malformedEntry(t *testing.T) {
+	env := `{
+		"registry.terraform.io/hashicorp/null": {
+			"Protocol": "grpc",
+			"ProtocolVersion": "not-a-number"
+		}
+	}`
+	_, err := parseReattachFromJSON(env)
+	if err == nil {
+		t.Fatal("unexpected success; want error naming the provider key")
+	}
+	if !strings.Contains(err.Error(), `"registry.terraform.io/hashicorp/null"`) {
+		t.Fatalf("wrong error %q; want mention of the offending provider key", err)
+	}
+}
+
+func TestParseReattachFromEnv_fallbackAddrs(t *testing.T) {
+	env := "registry.terraform.io/hashicorp/null=grpc|5|unix|/tmp/plugin123456;/tmp/plugin654321|1234"
+	got, err := parseReattachFromEnv(env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := got[addrs.NewDefaultProvider("null")]
+	if config == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/null")
+	}
+	if got, want := len(config.Addrs), 2; got != want {
+		t.Fatalf("wrong number of candidate addresses %d; want %d", got, want)
+	}
+	if got, want := config.Addrs[0].String(), "/tmp/plugin123456"; got != want {
+		t.Errorf("wrong first address %q; want %q", got, want)
+	}
+	if got, want := config.Addrs[1].String(), "/tmp/plugin654321"; got != want {
+		t.Errorf("wrong second address %q; want %q", got, want)
+	}
+	if got, want := config.Reattach.Addr.String(), "/tmp/plugin123456"; got != want {
+		t.Errorf("wrong primary address %q; want %q", got, want)
+	}
+}
+
+func TestParseReattachFromEnv_defaultProtocolVersion(t *testing.T) {
+	// An empty protocol version field selects the newest protocol version
+	// this release supports.
+	env := "registry.terraform.io/hashicorp/null=grpc||unix|/tmp/plugin123456|1234"
+	got, err := parseReattachFromEnv(env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := got[addrs.NewDefaultProvider("null")]
+	if config == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/null")
+	}
+	if got, want := config.ProtocolVersion, defaultReattachProtocolVersion(); got != want {
+		t.Errorf("wrong protocol version %d; want %d", got, want)
+	}
+	if config.ProtocolVersion == 0 {
+		t.Error("default protocol version resolved to zero; want a real version from tfplugin.VersionedPlugins")
+	}
+}
+
+func TestUnmanagedProviderConfigs_fromFile(t *testing.T) {
+	config := `{
+		"registry.terraform.io/hashicorp/null": {
+			"Protocol": "grpc",
+			"ProtocolVersion": 5,
+			"Addr": {
+				"Network": "unix",
+				"String": "/tmp/plugin123456"
+			},
+			"Pid": 1234
+		}
+	}`
+	f, err := ioutil.TempFile("", "terraform-test-reattach")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	defer os.Unsetenv("TF_PROVIDER_REATTACH_FILE")
+	os.Setenv("TF_PROVIDER_REATTACH_FILE", f.Name())
+
+	got, err := unmanagedProviderConfigs()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("wrong number of providers %d; want 1", len(got))
+	}
+	if got[addrs.NewDefaultProvider("null")] == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/null")
+	}
+}
+
+func TestUnmanagedProviderConfigs_inlineTakesPrecedence(t *testing.T) {
+	defer os.Unsetenv("TF_PROVIDER_REATTACH")
+	defer os.Unsetenv("TF_PROVIDER_REATTACH_FILE")
+	os.Setenv("TF_PROVIDER_REATTACH", "registry.terraform.io/hashicorp/random=grpc|5|unix|/tmp/plugin123456|1234")
+	os.Setenv("TF_PROVIDER_REATTACH_FILE", "testdata/nonexistent-reattach-file")
+
+	// The inline variable wins, so the nonexistent file must not even be
+	// opened.
+	got, err := unmanagedProviderConfigs()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got[addrs.NewDefaultProvider("random")] == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/random")
+	}
+}
+
+func TestProcessAlive(t *testing.T) {
+	// Our own process is certainly running.
+	if err := processAlive(os.Getpid()); err != nil {
+		t.Errorf("processAlive failed for our own pid: %s", err)
+	}
+}
+
+func TestUnmanagedProviderFactory_deadPid(t *testing.T) {
+	// Run a short-lived child process and wait for it so we have a pid that
+	// is known not to be running anymore.
+	cmd := exec.Command("true")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start child process: %s", err)
+	}
+	pid := cmd.Process.Pid
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child process failed: %s", err)
+	}
+
+	provider := addrs.NewDefaultProvider("random")
+	config := &unmanagedProviderConfig{
+		ProtocolVersion: 5,
+		Reattach: &plugin.ReattachConfig{
+			Protocol: "grpc",
+			Addr:     &net.UnixAddr{Name: "/tmp/plugin123456", Net: "unix"},
+			Pid:      pid,
+		},
+	}
+
+	_, err := unmanagedProviderFactory(provider, config, nil, nil)()
+	if err == nil {
+		t.Fatal("unexpected success; want error about dead reattach target")
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("provider process %d for hashicorp/random is not running", pid)) {
+		t.Fatalf("wrong error %q; want mention of the dead pid", err)
+	}
+	if !strings.Contains(err.Error(), "update TF_PROVIDER_REATTACH") {
+		t.Fatalf("wrong error %q; want remediation advice", err)
+	}
+}
+
+func TestUnmanagedProviderFactory_missingSocket(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "terraform-test-reattach")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	socketPath := filepath.Join(tmpDir, "plugin123456")
+
+	// A live child process stands in for the provider, so the process check
+	// passes and the socket check is what must catch the problem. Our own
+	// pid would not be safe here because go-plugin kills the reattach
+	// target when a connection attempt fails.
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start child process: %s", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	provider := addrs.NewDefaultProvider("random")
+	config := &unmanagedProviderConfig{
+		ProtocolVersion: 5,
+		Reattach: &plugin.ReattachConfig{
+			Protocol: "grpc",
+			Addr:     &net.UnixAddr{Name: socketPath, Net: "unix"},
+			Pid:      cmd.Process.Pid,
+		},
+	}
+
+	_, err = unmanagedProviderFactory(provider, config, nil, nil)()
+	if err == nil {
+		t.Fatal("unexpected success; want error about missing socket")
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("socket %s no longer exists", socketPath)) {
+		t.Fatalf("wrong error %q; want mention of the missing socket", err)
+	}
+
+	// Once the socket exists, the pre-checks pass and failure moves on to
+	// the actual connection attempt instead.
+	if err := ioutil.WriteFile(socketPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = unmanagedProviderFactory(provider, config, nil, nil)()
+	if err == nil {
+		t.Fatal("unexpected success; want a connection error")
+	}
+	if strings.Contains(err.Error(), "no longer exists") {
+		t.Fatalf("wrong error %q; socket pre-check fired despite the socket existing", err)
+	}
+}
+
+func TestParseReattachFromEnv_escapedDelimiters(t *testing.T) {
+	env := `registry.terraform.io/hashicorp/null=grpc|5|unix|/tmp/weird\,dir/plugin|1234`
+	got, err := parseReattachFromEnv(env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("wrong number of providers %d; want 1", len(got))
+	}
+	config := got[addrs.NewDefaultProvider("null")]
+	if config == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/null")
+	}
+	if got, want := config.Reattach.Addr.String(), "/tmp/weird,dir/plugin"; got != want {
+		t.Errorf("wrong address %q; want %q", got, want)
+	}
+}
+
+func TestParseReattachFromEnv_escapedPipeInAddr(t *testing.T) {
+	env := `registry.terraform.io/hashicorp/null=grpc|5|unix|/tmp/odd\|path/plugin\;sock|1234`
+	got, err := parseReattachFromEnv(env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := got[addrs.NewDefaultProvider("null")]
+	if config == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/null")
+	}
+	if got, want := len(config.Addrs), 1; got != want {
+		t.Fatalf("wrong number of candidate addresses %d; want %d", got, want)
+	}
+	if got, want := config.Reattach.Addr.String(), "/tmp/odd|path/plugin;sock"; got != want {
+		t.Errorf("wrong address %q; want %q", got, want)
+	}
+}
+
+func TestParseReattachFromEnv_unknownNetwork(t *testing.T) {
+	env := "registry.terraform.io/hashicorp/null=grpc|5|carrierpigeon|coop|1234"
+	_, err := parseReattachFromEnv(env)
+	if err == nil {
+		t.Fatal("unexpected success; want error about unknown address type")
+	}
+	if !strings.Contains(err.Error(), "unknown address type") {
+		t.Fatalf("wrong error %q; want mention of unknown address type", err)
+	}
+}
+
+func TestParseReattachFromEnv_quotedAddr(t *testing.T) {
+	// A double-quoted address takes every delimiter character literally,
+	// which is the easier form to emit for TMPDIR values full of them.
+	socketPath := `/tmp/odd,dir|with;every=delimiter/plugin123456`
+	env := `registry.terraform.io/hashicorp/null=grpc|5|unix|"` + socketPath + `"|1234`
+
+	got, err := parseReattachFromEnv(env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := got[addrs.NewDefaultProvider("null")]
+	if config == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/null")
+	}
+	if got, want := config.Reattach.Addr.String(), socketPath; got != want {
+		t.Errorf("wrong address %q; want %q", got, want)
+	}
+	if got, want := config.Reattach.Pid, 1234; got != want {
+		t.Errorf("wrong pid %d; want %d", got, want)
+	}
+}
+
+func TestParseReattachFromEnv_escapedEveryDelimiter(t *testing.T) {
+	// The backslash form must round-trip the same path as the quoted form.
+	socketPath := `/tmp/odd,dir|with;every=delimiter/plugin123456`
+	escaped := `/tmp/odd\,dir\|with\;every\=delimiter/plugin123456`
+	env := `registry.terraform.io/hashicorp/null=grpc|5|unix|` + escaped + `|1234`
+
+	got, err := parseReattachFromEnv(env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := got[addrs.NewDefaultProvider("null")]
+	if config == nil {
+		t.Fatal("missing config for registry.terraform.io/hashicorp/null")
+	}
+	if got, want := config.Reattach.Addr.String(), socketPath; got != want {
+		t.Errorf("wrong address %q; want %q", got, want)
+	}
+}
+
+func TestParseReattachFromEnv_unterminatedQuote(t *testing.T) {
+	env := `registry.terraform.io/hashicorp/null=grpc|5|unix|"/tmp/plugin123456|1234`
+	_, err := parseReattachFromEnv(env)
+	if err == nil {
+		t.Fatal("unexpected success; want error about the unterminated quote")
+	}
+	if !strings.Contains(err.Error(), "unterminated quoted string") {
+		t.Fatalf("wrong error %q; want mention of the unterminated quote", err)
+	}
+	if !strings.Contains(err.Error(), "registry.terraform.io/hashicorp/null") {
+		t.Fatalf("wrong error %q; want mention of the provider being parsed", err)
+	}
+}
+
+func TestVerifyUnmanagedProviderIdentity(t *testing.T) {
+	schemaFor := func(resourceTypes ...string) *terraform.ProviderSchema {
+		schema := &terraform.ProviderSchema{
+			ResourceTypes: map[string]*configschema.Block{},
+		}
+		for _, name := range resourceTypes {
+			schema.ResourceTypes[name] = &configschema.Block{}
+		}
+		return schema
+	}
+
+	provider := addrs.NewDefaultProvider("random")
+
+	t.Run("matching name", func(t *testing.T) {
+		p := &terraform.MockProvider{
+			GetSchemaReturn: schemaFor("random_id", "random_pet"),
+		}
+		if err := verifyUnmanagedProviderIdentity(provider, p); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+	t.Run("wrong name", func(t *testing.T) {
+		p := &terraform.MockProvider{
+			GetSchemaReturn: schemaFor("null_resource"),
+		}
+		err := verifyUnmanagedProviderIdentity(provider, p)
+		if err == nil {
+			t.Fatal("unexpected success; want mismatch error")
+		}
+		if !strings.Contains(err.Error(), "does not appear to implement") {
+			t.Fatalf("wrong error %q; want mention of the mismatch", err)
+		}
+		if !strings.Contains(err.Error(), `"null_resource"`) {
+			t.Fatalf("wrong error %q; want mention of the reported resource type", err)
+		}
+	})
+	t.Run("no resource types", func(t *testing.T) {
+		// With nothing to compare against the check degrades to a log
+		// message rather than blocking a legitimate server.
+		p := &terraform.MockProvider{
+			GetSchemaReturn: schemaFor(),
+		}
+		if err := verifyUnmanagedProviderIdentity(provider, p); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// recordingLifecycleEvents captures every lifecycle notification it
+// receives, for asserting on what a factory reported.
+type recordingLifecycleEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recordingLifecycleEvents) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordingLifecycleEvents) sink() *PluginLifecycleEvents {
+	return &PluginLifecycleEvents{
+		LaunchStart: func(provider addrs.Provider) {
+			r.record("launch " + provider.String())
+		},
+		HandshakeComplete: func(provider addrs.Provider, protocolVersion int, elapsed time.Duration) {
+			r.record("handshake " + provider.String())
+		},
+		DispenseComplete: func(provider addrs.Provider, elapsed time.Duration) {
+			r.record("dispense " + provider.String())
+		},
+		Teardown: func(provider addrs.Provider, uptime time.Duration) {
+			r.record("teardown " + provider.String())
+		},
+	}
+}
+
+func TestPluginLifecycleEventsNil(t *testing.T) {
+	provider := addrs.NewDefaultProvider("null")
+
+	// A nil event sink must leave factory behavior unchanged, so its
+	// dispatch methods must tolerate both a nil receiver and a sink with
+	// only some of its callbacks populated.
+	var events *PluginLifecycleEvents
+	events.launchStart(provider)
+	events.handshakeComplete(provider, 5, time.Second)
+	events.dispenseComplete(provider, time.Second)
+	events.teardown(provider, time.Second)
+
+	partial := &PluginLifecycleEvents{
+		LaunchStart: func(addrs.Provider) {},
+	}
+	partial.launchStart(provider)
+	partial.handshakeComplete(provider, 5, time.Second)
+	partial.dispenseComplete(provider, time.Second)
+	partial.teardown(provider, time.Second)
+}
+
+func TestProviderFactoryLifecycleEventsOnFailure(t *testing.T) {
+	// An empty retry budget keeps the failing launch from sleeping through
+	// its backoff schedule before giving up.
+	oldBudget := providerLaunchRetryBudget
+	providerLaunchRetryBudget = newRetryBudget(0)
+	defer func() { providerLaunchRetryBudget = oldBudget }()
+
+	meta := &providercache.CachedProvider{
+		Provider:       addrs.NewDefaultProvider("null"),
+		Version:        getproviders.MustParseVersion("1.0.0"),
+		PackageDir:     "testdata/empty",
+		ExecutableFile: "testdata/empty/nonexistent-executable",
+	}
+
+	rec := &recordingLifecycleEvents{}
+	_, err := providerFactory(meta, nil, nil, providerResourceLimits{}, nil, true, nil, rec.sink())()
+	if err == nil {
+		t.Fatal("unexpected success launching null provider; want launch failure")
+	}
+
+	// The launch began but never reached the handshake, so only the start
+	// of the lifecycle may have been reported.
+	want := []string{"launch registry.terraform.io/hashicorp/null"}
+	if got := rec.events; len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("wrong events %#v; want %#v", got, want)
+	}
+}
+
+func TestGracefulShutdownProviderTeardownEvent(t *testing.T) {
+	rec := &recordingLifecycleEvents{}
+	p := gracefulShutdownProvider{
+		Interface:  &terraform.MockProvider{},
+		provider:   addrs.NewDefaultProvider("null"),
+		events:     rec.sink(),
+		launchedAt: time.Now(),
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"teardown registry.terraform.io/hashicorp/null"}
+	if got := rec.events; len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("wrong events %#v; want %#v", got, want)
+	}
+}
+
+func TestProviderStartupMetrics(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-startup-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	metricsPath := filepath.Join(tmpDirPath, "metrics.jsonl")
+	os.Setenv(providerStartupMetricsEnvName, metricsPath)
+	defer os.Unsetenv(providerStartupMetricsEnvName)
+
+	provider := addrs.NewDefaultProvider("null")
+	rec := &recordingLifecycleEvents{}
+	m := &Meta{PluginLifecycleEvents: rec.sink()}
+	events := m.pluginLifecycleEventsWithMetrics()
+
+	// A second dispense for the same provider models a relaunch after a
+	// crash, which must accumulate rather than overwrite.
+	events.launchStart(provider)
+	events.dispenseComplete(provider, 1500*time.Millisecond)
+	events.dispenseComplete(provider, 500*time.Millisecond)
+
+	times := m.ProviderStartupTimes()
+	if got, want := len(times[provider]), 2; got != want {
+		t.Fatalf("wrong number of recorded startups %d; want %d", got, want)
+	}
+	if got, want := times[provider][0], 1500*time.Millisecond; got != want {
+		t.Errorf("wrong first startup duration %s; want %s", got, want)
+	}
+
+	// The result is a copy, so mutating it must not affect later reads.
+	times[provider][0] = 0
+	if got, want := m.ProviderStartupTimes()[provider][0], 1500*time.Millisecond; got != want {
+		t.Errorf("recorded startup duration changed to %s after mutating a returned copy; want %s", got, want)
+	}
+
+	// The caller's own sink still sees every event.
+	want := []string{
+		"launch registry.terraform.io/hashicorp/null",
+		"dispense registry.terraform.io/hashicorp/null",
+		"dispense registry.terraform.io/hashicorp/null",
+	}
+	if got := rec.events; len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("wrong forwarded events %#v; want %#v", got, want)
+	}
+
+	data, err := ioutil.ReadFile(metricsPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if got, want := len(lines), 2; got != want {
+		t.Fatalf("wrong number of metrics lines %d; want %d", got, want)
+	}
+	if got, want := lines[0], `{"provider":"registry.terraform.io/hashicorp/null","startup_ms":1500}`; got != want {
+		t.Errorf("wrong metrics line %q; want %q", got, want)
+	}
+}
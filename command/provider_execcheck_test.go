@@ -0,0 +1,94 @@
+// +build !windows
+
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+func TestCheckProviderExecutable(t *testing.T) {
+	provider := addrs.NewDefaultProvider("null")
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-execcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	executableFile := filepath.Join(tmpDirPath, "terraform-provider-null")
+	if err := ioutil.WriteFile(executableFile, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A file we own without the execute bit must be reported with the
+	// provider, the path, and the missing bit.
+	err = checkProviderExecutable(provider, executableFile)
+	if err == nil {
+		t.Fatal("unexpected success for a non-executable file; want permission error")
+	}
+	for _, want := range []string{"hashicorp/null", executableFile, "0100", "chmod +x"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q: %s", want, err)
+		}
+	}
+
+	// A missing file is not this check's problem: the launch path reports
+	// it with a more specific error.
+	if err := checkProviderExecutable(provider, filepath.Join(tmpDirPath, "nonexistent")); err != nil {
+		t.Errorf("unexpected error for a missing file: %s", err)
+	}
+
+	// With the opt-in set, the missing bit on a file we own is repaired
+	// instead of reported.
+	os.Setenv(providerExecFixEnvName, "1")
+	defer os.Unsetenv(providerExecFixEnvName)
+	if err := checkProviderExecutable(provider, executableFile); err != nil {
+		t.Fatalf("unexpected error with %s set: %s", providerExecFixEnvName, err)
+	}
+	info, err := os.Stat(executableFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if info.Mode()&0100 == 0 {
+		t.Errorf("execute bit not added; file mode is %s", info.Mode())
+	}
+
+	// An executable file passes without needing any repair.
+	os.Unsetenv(providerExecFixEnvName)
+	if err := checkProviderExecutable(provider, executableFile); err != nil {
+		t.Errorf("unexpected error for an executable file: %s", err)
+	}
+}
+
+func TestFileGroupMembership(t *testing.T) {
+	// The primary group and every supplementary group count as membership,
+	// matching how the kernel decides which permission bits apply.
+	if member, conclusive := fileGroupMembership(os.Getgid()); !member || !conclusive {
+		t.Errorf("wrong result (%v, %v) for the primary group; want (true, true)", member, conclusive)
+	}
+	groups, err := os.Getgroups()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, gid := range groups {
+		if member, conclusive := fileGroupMembership(gid); !member || !conclusive {
+			t.Errorf("wrong result (%v, %v) for supplementary group %d; want (true, true)", member, conclusive, gid)
+		}
+	}
+
+	// A group we don't belong to is a conclusive non-membership.
+	bogus := 1 << 20
+	for _, gid := range append(groups, os.Getgid()) {
+		if gid == bogus {
+			bogus++
+		}
+	}
+	if member, conclusive := fileGroupMembership(bogus); member || !conclusive {
+		t.Errorf("wrong result (%v, %v) for group %d; want (false, true)", member, conclusive, bogus)
+	}
+}
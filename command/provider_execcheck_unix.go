@@ -0,0 +1,99 @@
+// +build !windows
+
+package command
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// providerExecFixEnvName names the environment variable that permits
+// checkProviderExecutable to repair a missing execute bit itself by
+// chmodding the file, instead of just reporting it. Only files owned by
+// the current user are ever modified.
+const providerExecFixEnvName = "TF_PROVIDER_FIX_EXECUTABLE_MODE"
+
+// fileGroupMembership reports whether the current user belongs to the
+// group that owns a file, checking the supplementary groups as well as the
+// primary one. The second result is false when the supplementary groups
+// can't be enumerated, in which case a negative first result is not
+// conclusive.
+func fileGroupMembership(gid int) (member, conclusive bool) {
+	if gid == os.Getgid() {
+		return true, true
+	}
+	groups, err := os.Getgroups()
+	if err != nil {
+		return false, false
+	}
+	for _, g := range groups {
+		if g == gid {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// checkProviderExecutable verifies, before a launch is attempted, that the
+// given provider's executable has execute permission for the current user.
+// Without this check the launch fails with a bare "permission denied" from
+// the OS that names neither the provider nor the cause, which comes up on
+// filesystems that drop permission bits, such as NFS exports with squashed
+// permissions or archives extracted without their modes.
+//
+// A file that doesn't exist at all is not reported here, because the
+// launch path produces a more specific error for that case.
+func checkProviderExecutable(provider addrs.Provider, executableFile string) error {
+	info, err := os.Stat(executableFile)
+	if err != nil {
+		return nil
+	}
+	mode := info.Mode()
+
+	// Which permission bit matters depends on how the current user relates
+	// to the file: the owner is judged by the owner bit alone, a member of
+	// the file's group by the group bit, and everyone else by the other
+	// bit, consulting supplementary group memberships the same way the
+	// kernel does. When the memberships can't be enumerated the group and
+	// other classes can't be told apart, so any execute bit is accepted
+	// rather than wrongly rejecting a file the kernel would exec.
+	var missing os.FileMode
+	owned := false
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		member, conclusive := fileGroupMembership(int(st.Gid))
+		switch {
+		case int(st.Uid) == os.Getuid():
+			owned = true
+			missing = 0100
+		case member:
+			missing = 0010
+		case !conclusive:
+			missing = 0111
+		default:
+			missing = 0001
+		}
+	} else {
+		missing = 0100
+	}
+	if mode&missing != 0 {
+		return nil
+	}
+
+	if owned && os.Getenv(providerExecFixEnvName) != "" {
+		if err := os.Chmod(executableFile, mode|0111); err == nil {
+			log.Printf("[INFO] added execute permission to %s for provider %s because %s is set", executableFile, provider, providerExecFixEnvName)
+			return nil
+		}
+		// If the chmod failed we fall through to the report below, which
+		// is more useful than the chmod error alone.
+	}
+
+	return fmt.Errorf(
+		"provider %s cannot be launched because its executable %s is missing the %#o (execute) permission bit for the current user; grant it with \"chmod +x\" or reinstall the provider with \"terraform init -reinstall-providers=%s\"",
+		provider.ForDisplay(), executableFile, missing, provider.ForDisplay(),
+	)
+}
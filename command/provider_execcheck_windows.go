@@ -0,0 +1,14 @@
+// +build windows
+
+package command
+
+import (
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// checkProviderExecutable is a no-op on Windows, where there is no execute
+// permission bit for a launch to trip over; whether a file can run is
+// decided by its extension and the ACLs that any open would hit anyway.
+func checkProviderExecutable(provider addrs.Provider, executableFile string) error {
+	return nil
+}
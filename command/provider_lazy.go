@@ -0,0 +1,173 @@
+package command
+
+import (
+	"sync"
+
+	"github.com/hashicorp/terraform/providers"
+)
+
+// lazyProviderFactory wraps a launching factory so that the subprocess is
+// only started by a call that truly needs the provider. GetSchema is served
+// from the persisted schema cache when possible, which matters because the
+// core fetches the schema of every provider in the lock file even for
+// operations -- such as a targeted plan -- that go on to use only a few of
+// them; with a warm cache the unused providers are never launched at all.
+func lazyProviderFactory(cache *providerSchemaCache, factory providers.Factory) providers.Factory {
+	return func() (providers.Interface, error) {
+		return &lazyProvider{
+			factory: factory,
+			cache:   cache,
+		}, nil
+	}
+}
+
+// lazyProvider is the providers.Interface implementation behind
+// lazyProviderFactory. All methods other than GetSchema, Stop, and Close
+// launch the real provider on first use and then delegate to it.
+type lazyProvider struct {
+	factory providers.Factory
+	cache   *providerSchemaCache
+
+	mu   sync.Mutex
+	inst providers.Interface
+	err  error
+}
+
+// realize launches the real provider if it isn't running yet. A failed
+// launch is remembered rather than retried, because the launching factory
+// already has its own retry policy.
+func (p *lazyProvider) realize() (providers.Interface, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inst == nil && p.err == nil {
+		p.inst, p.err = p.factory()
+	}
+	return p.inst, p.err
+}
+
+func (p *lazyProvider) GetSchema() (resp providers.GetSchemaResponse) {
+	if resp, ok := p.cache.Read(); ok {
+		return resp
+	}
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	resp = inst.GetSchema()
+	if !resp.Diagnostics.HasErrors() {
+		p.cache.Write(resp)
+	}
+	return resp
+}
+
+func (p *lazyProvider) PrepareProviderConfig(r providers.PrepareProviderConfigRequest) (resp providers.PrepareProviderConfigResponse) {
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	return inst.PrepareProviderConfig(r)
+}
+
+func (p *lazyProvider) ValidateResourceTypeConfig(r providers.ValidateResourceTypeConfigRequest) (resp providers.ValidateResourceTypeConfigResponse) {
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	return inst.ValidateResourceTypeConfig(r)
+}
+
+func (p *lazyProvider) ValidateDataSourceConfig(r providers.ValidateDataSourceConfigRequest) (resp providers.ValidateDataSourceConfigResponse) {
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	return inst.ValidateDataSourceConfig(r)
+}
+
+func (p *lazyProvider) UpgradeResourceState(r providers.UpgradeResourceStateRequest) (resp providers.UpgradeResourceStateResponse) {
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	return inst.UpgradeResourceState(r)
+}
+
+func (p *lazyProvider) Configure(r providers.ConfigureRequest) (resp providers.ConfigureResponse) {
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	return inst.Configure(r)
+}
+
+// Stop only has meaning for a running provider, so if we never launched one
+// there is nothing to halt.
+func (p *lazyProvider) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inst == nil {
+		return nil
+	}
+	return p.inst.Stop()
+}
+
+func (p *lazyProvider) ReadResource(r providers.ReadResourceRequest) (resp providers.ReadResourceResponse) {
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	return inst.ReadResource(r)
+}
+
+func (p *lazyProvider) PlanResourceChange(r providers.PlanResourceChangeRequest) (resp providers.PlanResourceChangeResponse) {
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	return inst.PlanResourceChange(r)
+}
+
+func (p *lazyProvider) ApplyResourceChange(r providers.ApplyResourceChangeRequest) (resp providers.ApplyResourceChangeResponse) {
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	return inst.ApplyResourceChange(r)
+}
+
+func (p *lazyProvider) ImportResourceState(r providers.ImportResourceStateRequest) (resp providers.ImportResourceStateResponse) {
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	return inst.ImportResourceState(r)
+}
+
+func (p *lazyProvider) ReadDataSource(r providers.ReadDataSourceRequest) (resp providers.ReadDataSourceResponse) {
+	inst, err := p.realize()
+	if err != nil {
+		resp.Diagnostics = resp.Diagnostics.Append(err)
+		return resp
+	}
+	return inst.ReadDataSource(r)
+}
+
+// Close shuts down the real provider if one was ever launched.
+func (p *lazyProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inst == nil {
+		return nil
+	}
+	return p.inst.Close()
+}
@@ -0,0 +1,153 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+	"github.com/hashicorp/terraform/providers"
+)
+
+// schemaTestProvider stands in for a launched provider in the lazy-launch
+// tests; only GetSchema and Close are ever called on it.
+type schemaTestProvider struct {
+	providers.Interface
+	schema providers.GetSchemaResponse
+}
+
+func (p *schemaTestProvider) GetSchema() providers.GetSchemaResponse {
+	return p.schema
+}
+
+func (p *schemaTestProvider) Close() error {
+	return nil
+}
+
+func testSchemaResponse() providers.GetSchemaResponse {
+	return providers.GetSchemaResponse{
+		Provider: providers.Schema{
+			Block: &configschema.Block{
+				Attributes: map[string]*configschema.Attribute{
+					"region": {Type: cty.String, Required: true},
+				},
+			},
+		},
+		ResourceTypes: map[string]providers.Schema{
+			"test_thing": {
+				Version: 1,
+				Block: &configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"attr": {Type: cty.String, Optional: true},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestLazyProviderSchemaCache(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "terraform-test-schemacache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	m := &Meta{OverrideDataDir: dataDir}
+
+	// The package directory contents determine the cache key, so we need a
+	// real directory to hash.
+	pkgDir := filepath.Join(dataDir, "pkg")
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkgDir, "terraform-provider-test"), []byte("v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := addrs.NewDefaultProvider("test")
+	cached := &providercache.CachedProvider{
+		Provider:       provider,
+		Version:        getproviders.MustParseVersion("1.0.0"),
+		PackageDir:     pkgDir,
+		ExecutableFile: filepath.Join(pkgDir, "terraform-provider-test"),
+	}
+
+	cache := m.providerSchemaCacheFor(provider, cached)
+	if cache == nil {
+		t.Fatal("no schema cache for hashable package")
+	}
+
+	launches := 0
+	factory := lazyProviderFactory(cache, func() (providers.Interface, error) {
+		launches++
+		return &schemaTestProvider{schema: testSchemaResponse()}, nil
+	})
+
+	// The first schema fetch has a cold cache and so must launch.
+	inst, err := factory()
+	if err != nil {
+		t.Fatalf("unexpected error from factory: %s", err)
+	}
+	resp := inst.GetSchema()
+	checkDiagsHasNoErrors(t, resp)
+	if launches != 1 {
+		t.Fatalf("wrong number of launches %d for cold cache; want 1", launches)
+	}
+	inst.Close()
+
+	// With a warm cache the schema is served without launching anything,
+	// which is the whole point: a targeted operation that needs only this
+	// provider's schema costs zero plugin launches.
+	inst, err = factory()
+	if err != nil {
+		t.Fatalf("unexpected error from factory: %s", err)
+	}
+	resp = inst.GetSchema()
+	checkDiagsHasNoErrors(t, resp)
+	if launches != 1 {
+		t.Fatalf("wrong number of launches %d for warm cache; want still 1", launches)
+	}
+	if _, ok := resp.ResourceTypes["test_thing"]; !ok {
+		t.Fatal("cached schema is missing the test_thing resource type")
+	}
+	got := resp.Provider.Block.Attributes["region"]
+	if got == nil || !got.Type.Equals(cty.String) || !got.Required {
+		t.Fatalf("cached provider schema did not round-trip: %#v", got)
+	}
+	if err := inst.Close(); err != nil {
+		t.Fatalf("unexpected error closing unlaunched provider: %s", err)
+	}
+
+	// Changing the package contents changes the hash and therefore the
+	// cache key, so the schema must be fetched live again.
+	if err := ioutil.WriteFile(filepath.Join(pkgDir, "terraform-provider-test"), []byte("v2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cache = m.providerSchemaCacheFor(provider, cached)
+	factory = lazyProviderFactory(cache, func() (providers.Interface, error) {
+		launches++
+		return &schemaTestProvider{schema: testSchemaResponse()}, nil
+	})
+	inst, err = factory()
+	if err != nil {
+		t.Fatalf("unexpected error from factory: %s", err)
+	}
+	resp = inst.GetSchema()
+	checkDiagsHasNoErrors(t, resp)
+	if launches != 2 {
+		t.Fatalf("wrong number of launches %d after package change; want 2", launches)
+	}
+}
+
+func checkDiagsHasNoErrors(t *testing.T, resp providers.GetSchemaResponse) {
+	t.Helper()
+	if resp.Diagnostics.HasErrors() {
+		t.Fatalf("unexpected error: %s", resp.Diagnostics.Err())
+	}
+}
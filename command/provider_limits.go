@@ -0,0 +1,29 @@
+package command
+
+// providerResourceLimits describes OS-level resource limits to apply to
+// launched provider processes, so that a runaway provider on a shared host
+// is killed by the kernel instead of starving unrelated work. Zero values
+// mean no limit.
+type providerResourceLimits struct {
+	// AddressSpace limits the total virtual address space of the process,
+	// in bytes.
+	AddressSpace int64
+
+	// CPUSeconds limits the total CPU time the process may consume, in
+	// seconds.
+	CPUSeconds int64
+}
+
+// Enabled returns true if at least one limit is set.
+func (l providerResourceLimits) Enabled() bool {
+	return l.AddressSpace > 0 || l.CPUSeconds > 0
+}
+
+// providerResourceLimits converts the limit settings on Meta into the
+// internal representation used when launching providers.
+func (m *Meta) providerResourceLimits() providerResourceLimits {
+	return providerResourceLimits{
+		AddressSpace: int64(m.ProviderMemoryLimitMB) * 1024 * 1024,
+		CPUSeconds:   int64(m.ProviderCPULimitSeconds),
+	}
+}
@@ -0,0 +1,38 @@
+// +build linux
+
+package command
+
+import (
+	"log"
+	"syscall"
+	"unsafe"
+)
+
+// applyProviderResourceLimits applies the given limits to the already
+// running process with the given pid, using the Linux prlimit mechanism.
+// Failure to apply a limit is reported in the log but is not fatal, because
+// a provider running without limits is still more useful than one that
+// doesn't run at all.
+func applyProviderResourceLimits(pid int, limits providerResourceLimits) {
+	if limits.AddressSpace > 0 {
+		setProviderRlimit(pid, syscall.RLIMIT_AS, uint64(limits.AddressSpace))
+	}
+	if limits.CPUSeconds > 0 {
+		setProviderRlimit(pid, syscall.RLIMIT_CPU, uint64(limits.CPUSeconds))
+	}
+}
+
+func setProviderRlimit(pid int, resource int, value uint64) {
+	rlim := syscall.Rlimit{Cur: value, Max: value}
+	_, _, errno := syscall.Syscall6(
+		syscall.SYS_PRLIMIT64,
+		uintptr(pid),
+		uintptr(resource),
+		uintptr(unsafe.Pointer(&rlim)),
+		0, // don't fetch the old limit
+		0, 0,
+	)
+	if errno != 0 {
+		log.Printf("[DEBUG] failed to set resource limit %d on provider process %d: %s", resource, pid, errno)
+	}
+}
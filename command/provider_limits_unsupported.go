@@ -0,0 +1,14 @@
+// +build !linux
+
+package command
+
+import (
+	"log"
+)
+
+// applyProviderResourceLimits is a no-op on platforms where we have no way
+// to adjust the limits of an already-running process; the configured limits
+// are ignored with a debug log rather than failing the launch.
+func applyProviderResourceLimits(pid int, limits providerResourceLimits) {
+	log.Printf("[DEBUG] provider resource limits are not supported on this platform; ignoring them for process %d", pid)
+}
@@ -0,0 +1,47 @@
+// +build !windows
+
+package command
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// configureProviderProcAttr arranges for a provider command to run in its
+// own process group, so that a signal delivered to Terraform's group (for
+// example a ^C aimed at a whole CI pipeline) doesn't race with our own
+// managed shutdown of the provider, and so that shutdown can target the
+// provider together with any grandchild processes it spawned.
+func configureProviderProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
+
+// adoptProviderProcess is a hook for any platform-specific tracking of a
+// freshly-launched provider process. On Unix the process group established
+// at fork time is all we need, so there is nothing more to do here.
+func adoptProviderProcess(pid int) {
+}
+
+// terminateProviderProcess delivers the graceful-termination signal to the
+// provider's whole process group, falling back to signalling just the
+// process itself if the group signal fails.
+func terminateProviderProcess(p *os.Process) error {
+	if err := syscall.Kill(-p.Pid, syscall.SIGTERM); err == nil {
+		return nil
+	}
+	return p.Signal(syscall.SIGTERM)
+}
+
+// reapProviderGroup force-kills anything still running in the provider's
+// process group, catching grandchild processes that go-plugin's kill of the
+// direct child alone would orphan. Because the provider led its own group,
+// its pid doubles as the group id even after the provider itself has exited.
+func reapProviderGroup(p *os.Process) {
+	if err := syscall.Kill(-p.Pid, syscall.SIGKILL); err == nil {
+		log.Printf("[DEBUG] killed remaining processes in provider process group %d", p.Pid)
+	}
+}
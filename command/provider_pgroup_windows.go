@@ -0,0 +1,157 @@
+// +build windows
+
+package command
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Windows has no direct analog of a Unix process group that signal delivery
+// can target, so each provider process is instead assigned to a job object
+// configured to kill all of its members when the last handle to it is
+// closed. Terraform holds the handle, so if Terraform exits for any reason
+// the OS tears down the provider and any grandchild processes it spawned;
+// an orderly shutdown terminates the job explicitly.
+
+var (
+	modkernel32Cmd               = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = modkernel32Cmd.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = modkernel32Cmd.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = modkernel32Cmd.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = modkernel32Cmd.NewProc("TerminateJobObject")
+)
+
+const (
+	_JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE = 0x2000
+
+	// information class for SetInformationJobObject
+	_JobObjectExtendedLimitInformation = 9
+
+	// dwDesiredAccess for OpenProcess
+	_PROCESS_SET_QUOTA = 0x0100
+	_PROCESS_TERMINATE = 0x0001
+)
+
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type ioCounters struct {
+	ReadOperationCount  uint64
+	WriteOperationCount uint64
+	ReadTransferCount   uint64
+	WriteTransferCount  uint64
+	OtherOperationCount uint64
+	OtherTransferCount  uint64
+}
+
+type jobObjectExtendedLimitInformation struct {
+	BasicLimitInformation jobObjectBasicLimitInformation
+	IoInfo                ioCounters
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// providerJobObjects tracks the job object handle for each provider process
+// we've launched, so that shutdown can terminate the whole job.
+var providerJobObjects struct {
+	mu      sync.Mutex
+	handles map[int]syscall.Handle
+}
+
+// configureProviderProcAttr places the provider in a new console process
+// group, so that a ^C aimed at Terraform's console doesn't reach the
+// provider directly and race with our own managed shutdown.
+func configureProviderProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// adoptProviderProcess assigns the given provider process to a
+// kill-on-close job object. Failures here are logged and otherwise ignored,
+// because the provider is still usable without the job object; we just lose
+// the guarantee of grandchild cleanup.
+func adoptProviderProcess(pid int) {
+	job, _, err := procCreateJobObjectW.Call(0, 0)
+	if job == 0 {
+		log.Printf("[DEBUG] failed to create job object for provider pid %d: %s", pid, err)
+		return
+	}
+
+	info := jobObjectExtendedLimitInformation{
+		BasicLimitInformation: jobObjectBasicLimitInformation{
+			LimitFlags: _JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+		},
+	}
+	r1, _, err := procSetInformationJobObject.Call(
+		job,
+		_JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)),
+		unsafe.Sizeof(info),
+	)
+	if r1 == 0 {
+		log.Printf("[DEBUG] failed to configure job object for provider pid %d: %s", pid, err)
+		syscall.CloseHandle(syscall.Handle(job))
+		return
+	}
+
+	proc, procErr := syscall.OpenProcess(_PROCESS_SET_QUOTA|_PROCESS_TERMINATE, false, uint32(pid))
+	if procErr != nil {
+		log.Printf("[DEBUG] failed to open provider pid %d for job assignment: %s", pid, procErr)
+		syscall.CloseHandle(syscall.Handle(job))
+		return
+	}
+	r1, _, err = procAssignProcessToJobObject.Call(job, uintptr(proc))
+	syscall.CloseHandle(proc)
+	if r1 == 0 {
+		log.Printf("[DEBUG] failed to assign provider pid %d to job object: %s", pid, err)
+		syscall.CloseHandle(syscall.Handle(job))
+		return
+	}
+
+	providerJobObjects.mu.Lock()
+	if providerJobObjects.handles == nil {
+		providerJobObjects.handles = make(map[int]syscall.Handle)
+	}
+	providerJobObjects.handles[pid] = syscall.Handle(job)
+	providerJobObjects.mu.Unlock()
+}
+
+// terminateProviderProcess would deliver a graceful-termination signal, but
+// Windows offers no way to do that for a non-console process, so this
+// always fails and the caller proceeds directly to the forced shutdown.
+func terminateProviderProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
+
+// reapProviderGroup terminates the provider's job object, taking any
+// grandchild processes with it, and releases the handle.
+func reapProviderGroup(p *os.Process) {
+	providerJobObjects.mu.Lock()
+	job, ok := providerJobObjects.handles[p.Pid]
+	if ok {
+		delete(providerJobObjects.handles, p.Pid)
+	}
+	providerJobObjects.mu.Unlock()
+	if !ok {
+		return
+	}
+	procTerminateJobObject.Call(uintptr(job), 1)
+	syscall.CloseHandle(job)
+}
@@ -0,0 +1,173 @@
+package command
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/providers"
+)
+
+// providerPoolKey identifies a poolable provider instance. The executable
+// path participates in the key alongside the address so that a provider
+// package replaced on disk during the life of the pool is not conflated
+// with a process launched from the old executable.
+type providerPoolKey struct {
+	provider   addrs.Provider
+	executable string
+}
+
+// providerClientPool shares running provider instances between factory
+// invocations, so that an operation which instantiates the same provider
+// many times can reuse one warm subprocess instead of paying the launch
+// cost for each instance. Each consumer holds a counted reference and the
+// subprocess is only terminated when the last reference is closed.
+//
+// Pooling is opt-in (see Meta.providerClientPool) because shared consumers
+// lose the isolation of a process per instance: they share a single
+// Configure and a crash is observed by all of them.
+type providerClientPool struct {
+	mu      sync.Mutex
+	entries map[providerPoolKey]*pooledProvider
+
+	// shareAliases additionally multiplexes Configure calls over the
+	// shared instance, so that several aliased configurations of the same
+	// provider can use one process: the first alias's Configure reaches
+	// the provider and identical repeats from other aliases are answered
+	// locally. Aliases whose configurations differ cannot share a process
+	// and are refused. This is part of the provider reuse experiment (see
+	// Meta.providerClientPool).
+	shareAliases bool
+}
+
+func newProviderClientPool() *providerClientPool {
+	return &providerClientPool{
+		entries: make(map[providerPoolKey]*pooledProvider),
+	}
+}
+
+// pooledProvider is one shared provider instance within a pool, together
+// with the bookkeeping needed to launch it exactly once and close it after
+// its last reference is released.
+type pooledProvider struct {
+	pool *providerClientPool
+	key  providerPoolKey
+
+	// refs is guarded by pool.mu; the remaining fields by mu.
+	refs int
+
+	mu       sync.Mutex
+	launched bool
+	inst     providers.Interface
+	err      error
+
+	// configured records the configuration the shared instance has
+	// accepted, used only when the pool is sharing aliases. A crash of the
+	// shared process needs no bookkeeping here: every reference holds the
+	// same client, so all aliases observe the failure on their next call.
+	configured    bool
+	configuredVal cty.Value
+}
+
+// Factory wraps the given factory so that its result is shared through the
+// pool under the given key. The first caller for a key performs the real
+// launch while any concurrent callers for the same key wait for it; a
+// failed launch is reported to every waiter and then forgotten, so a later
+// call will try launching again.
+func (p *providerClientPool) Factory(key providerPoolKey, launch providers.Factory) providers.Factory {
+	return func() (providers.Interface, error) {
+		p.mu.Lock()
+		entry, ok := p.entries[key]
+		if !ok {
+			entry = &pooledProvider{pool: p, key: key}
+			p.entries[key] = entry
+		}
+		entry.refs++
+		p.mu.Unlock()
+
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		if !entry.launched {
+			entry.inst, entry.err = launch()
+			entry.launched = true
+		}
+		if entry.err != nil {
+			err := entry.err
+			p.release(entry)
+			return nil, err
+		}
+		return &pooledProviderRef{
+			Interface: entry.inst,
+			entry:     entry,
+		}, nil
+	}
+}
+
+// release drops one reference to the given entry, closing the underlying
+// provider and removing the entry once the last reference is gone.
+func (p *providerClientPool) release(entry *pooledProvider) error {
+	p.mu.Lock()
+	entry.refs--
+	last := entry.refs == 0
+	if last {
+		delete(p.entries, entry.key)
+	}
+	p.mu.Unlock()
+	if last && entry.inst != nil {
+		return entry.inst.Close()
+	}
+	return nil
+}
+
+// pooledProviderRef is the per-consumer handle for a pooled provider.
+// Closing it releases the consumer's reference rather than terminating the
+// shared process; extra closes of the same handle are ignored.
+type pooledProviderRef struct {
+	providers.Interface
+	entry  *pooledProvider
+	mu     sync.Mutex
+	closed bool
+}
+
+// Configure passes the request through to the shared instance, except that
+// when the pool is sharing aliased configurations only the first Configure
+// reaches the provider: identical repeats succeed without another call, and
+// a conflicting configuration is refused, because a single process can only
+// hold one configuration at a time.
+func (r *pooledProviderRef) Configure(req providers.ConfigureRequest) (resp providers.ConfigureResponse) {
+	e := r.entry
+	if !e.pool.shareAliases {
+		return e.inst.Configure(req)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.configured {
+		if req.Config.RawEquals(e.configuredVal) {
+			return resp
+		}
+		resp.Diagnostics = resp.Diagnostics.Append(fmt.Errorf(
+			"provider %s is shared between aliased configurations but was asked for two different configurations; aliases can only share a provider process when their configurations are identical",
+			e.key.provider,
+		))
+		return resp
+	}
+	resp = e.inst.Configure(req)
+	if !resp.Diagnostics.HasErrors() {
+		e.configured = true
+		e.configuredVal = req.Config
+	}
+	return resp
+}
+
+func (r *pooledProviderRef) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.entry.pool.release(r.entry)
+}
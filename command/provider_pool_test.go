@@ -0,0 +1,184 @@
+package command
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/providers"
+)
+
+// poolTestProvider stands in for a launched provider; only Close and
+// Configure are ever called on it, so the embedded nil interface is never
+// reached.
+type poolTestProvider struct {
+	providers.Interface
+	closed     int
+	configured int
+}
+
+func (p *poolTestProvider) Close() error {
+	p.closed++
+	return nil
+}
+
+func (p *poolTestProvider) Configure(req providers.ConfigureRequest) providers.ConfigureResponse {
+	p.configured++
+	return providers.ConfigureResponse{}
+}
+
+func TestProviderClientPool(t *testing.T) {
+	pool := newProviderClientPool()
+	key := providerPoolKey{
+		provider:   addrs.NewDefaultProvider("null"),
+		executable: "/path/to/terraform-provider-null",
+	}
+
+	launched := 0
+	inst := &poolTestProvider{}
+	factory := pool.Factory(key, func() (providers.Interface, error) {
+		launched++
+		return inst, nil
+	})
+
+	first, err := factory()
+	if err != nil {
+		t.Fatalf("unexpected error from first factory call: %s", err)
+	}
+	second, err := factory()
+	if err != nil {
+		t.Fatalf("unexpected error from second factory call: %s", err)
+	}
+	if launched != 1 {
+		t.Fatalf("wrong number of launches %d; want 1", launched)
+	}
+
+	// The shared instance must stay alive until the last reference is
+	// closed, and extra closes of one handle must not steal the other's
+	// reference.
+	if err := first.Close(); err != nil {
+		t.Fatalf("unexpected error closing first handle: %s", err)
+	}
+	first.Close()
+	if inst.closed != 0 {
+		t.Fatal("provider was closed while a reference was still held")
+	}
+	if err := second.Close(); err != nil {
+		t.Fatalf("unexpected error closing second handle: %s", err)
+	}
+	if inst.closed != 1 {
+		t.Fatalf("wrong number of closes %d after last release; want 1", inst.closed)
+	}
+
+	// With all references gone the next factory call must launch afresh.
+	if _, err := factory(); err != nil {
+		t.Fatalf("unexpected error relaunching: %s", err)
+	}
+	if launched != 2 {
+		t.Fatalf("wrong number of launches %d after relaunch; want 2", launched)
+	}
+}
+
+func TestProviderClientPool_launchFailure(t *testing.T) {
+	pool := newProviderClientPool()
+	key := providerPoolKey{
+		provider:   addrs.NewDefaultProvider("null"),
+		executable: "/path/to/terraform-provider-null",
+	}
+
+	launched := 0
+	factory := pool.Factory(key, func() (providers.Interface, error) {
+		launched++
+		if launched == 1 {
+			return nil, errors.New("no luck this time")
+		}
+		return &poolTestProvider{}, nil
+	})
+
+	if _, err := factory(); err == nil {
+		t.Fatal("unexpected success from failing launch")
+	}
+
+	// A failed launch must not be cached: the next call tries again.
+	if _, err := factory(); err != nil {
+		t.Fatalf("unexpected error from second launch: %s", err)
+	}
+	if launched != 2 {
+		t.Fatalf("wrong number of launches %d; want 2", launched)
+	}
+}
+
+func TestProviderClientPool_sharedAliases(t *testing.T) {
+	pool := newProviderClientPool()
+	pool.shareAliases = true
+	key := providerPoolKey{
+		provider:   addrs.NewDefaultProvider("null"),
+		executable: "/path/to/terraform-provider-null",
+	}
+
+	inst := &poolTestProvider{}
+	factory := pool.Factory(key, func() (providers.Interface, error) {
+		return inst, nil
+	})
+
+	first, err := factory()
+	if err != nil {
+		t.Fatalf("unexpected error from first factory call: %s", err)
+	}
+	second, err := factory()
+	if err != nil {
+		t.Fatalf("unexpected error from second factory call: %s", err)
+	}
+
+	config := cty.ObjectVal(map[string]cty.Value{
+		"region": cty.StringVal("eu-west-1"),
+	})
+	if resp := first.Configure(providers.ConfigureRequest{Config: config}); resp.Diagnostics.HasErrors() {
+		t.Fatalf("unexpected error from first Configure: %s", resp.Diagnostics.Err())
+	}
+
+	// An identical Configure from the second alias is answered locally.
+	if resp := second.Configure(providers.ConfigureRequest{Config: config}); resp.Diagnostics.HasErrors() {
+		t.Fatalf("unexpected error from identical Configure: %s", resp.Diagnostics.Err())
+	}
+	if inst.configured != 1 {
+		t.Fatalf("wrong number of Configure calls %d on shared instance; want 1", inst.configured)
+	}
+
+	// A conflicting configuration cannot share the process.
+	otherConfig := cty.ObjectVal(map[string]cty.Value{
+		"region": cty.StringVal("us-east-1"),
+	})
+	resp := second.Configure(providers.ConfigureRequest{Config: otherConfig})
+	if !resp.Diagnostics.HasErrors() {
+		t.Fatal("unexpected success configuring shared provider with a different configuration")
+	}
+	if got := resp.Diagnostics.Err().Error(); !strings.Contains(got, "aliased configurations") {
+		t.Errorf("wrong error %q; want mention of aliased configurations", got)
+	}
+
+	first.Close()
+	second.Close()
+	if inst.closed != 1 {
+		t.Fatalf("wrong number of closes %d; want 1", inst.closed)
+	}
+}
+
+func TestMetaProviderClientPool(t *testing.T) {
+	m := &Meta{}
+	if pool := m.providerClientPool(); pool != nil {
+		t.Fatal("pooling is on by default; want it off")
+	}
+
+	m.ProviderClientPooling = true
+	pool := m.providerClientPool()
+	if pool == nil {
+		t.Fatal("no pool returned with ProviderClientPooling set")
+	}
+	if again := m.providerClientPool(); again != pool {
+		t.Fatal("providerClientPool returned a different pool on the second call")
+	}
+}
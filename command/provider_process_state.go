@@ -0,0 +1,225 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// providerProcessRecord describes one managed provider process that is (or
+// was) running on behalf of this working directory, so that a later
+// Terraform run can clean up processes orphaned by a crash of Terraform
+// itself.
+type providerProcessRecord struct {
+	Pid        int    `json:"pid"`
+	Executable string `json:"executable"`
+	SocketPath string `json:"socket_path,omitempty"`
+
+	// OwnerPid and OwnerStart identify the Terraform process that launched
+	// the provider, so that a later run can tell an orphan apart from a
+	// healthy provider belonging to a concurrent run in the same working
+	// directory. OwnerStart guards against the owner pid being reused by an
+	// unrelated process after the owner exits; zero means the start time
+	// was unavailable when the record was written.
+	OwnerPid   int   `json:"owner_pid,omitempty"`
+	OwnerStart int64 `json:"owner_start,omitempty"`
+}
+
+// ownProcessIdentity returns the owner fields to stamp into the records for
+// providers launched by this process.
+func ownProcessIdentity() (pid int, start int64) {
+	pid = os.Getpid()
+	if s, _, ok := terraformProcessStartTime(pid); ok {
+		start = s
+	}
+	return pid, start
+}
+
+// providerProcessState maintains a small file under the data directory
+// recording the provider processes launched by this working directory.
+// Entries are added as providers launch and removed again on clean
+// shutdown, so anything still present at the start of a later run is a
+// candidate orphan from a Terraform process that died without cleaning up.
+type providerProcessState struct {
+	path string
+	mu   sync.Mutex
+}
+
+// providerProcessStateFile returns the process-tracking state for this
+// working directory, or nil if there is no data directory to keep it in.
+func (m *Meta) providerProcessStateFile() *providerProcessState {
+	dataDir := m.DataDir()
+	if dataDir == "" {
+		return nil
+	}
+	return &providerProcessState{
+		path: filepath.Join(dataDir, "plugin-processes.json"),
+	}
+}
+
+func (s *providerProcessState) readLocked() []providerProcessRecord {
+	buf, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil // no file means no tracked processes
+	}
+	var records []providerProcessRecord
+	if err := json.Unmarshal(buf, &records); err != nil {
+		// A damaged state file cannot safely drive process cleanup, so
+		// we start over rather than guessing at its contents.
+		log.Printf("[WARN] ignoring invalid provider process state file %s: %s", s.path, err)
+		return nil
+	}
+	return records
+}
+
+func (s *providerProcessState) writeLocked(records []providerProcessRecord) {
+	if len(records) == 0 {
+		os.Remove(s.path)
+		return
+	}
+	buf, err := json.Marshal(records)
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(s.path), 0755) // ignore error; WriteFile reports better
+	if err := ioutil.WriteFile(s.path, buf, 0644); err != nil {
+		log.Printf("[WARN] failed to write provider process state file %s: %s", s.path, err)
+	}
+}
+
+// record adds an entry for a freshly-launched provider process. Tracking is
+// best-effort: a failure to record means only that a crash before the next
+// clean shutdown would leave this particular process for the operating
+// system to collect.
+func (s *providerProcessState) record(rec providerProcessRecord) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := s.readLocked()
+	for _, existing := range records {
+		if existing.Pid == rec.Pid {
+			return // already tracked, e.g. after a reattach
+		}
+	}
+	s.writeLocked(append(records, rec))
+}
+
+// forget removes the entry for the given pid, once the process has been
+// shut down through the normal path.
+func (s *providerProcessState) forget(pid int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := s.readLocked()
+	kept := records[:0]
+	for _, rec := range records {
+		if rec.Pid != pid {
+			kept = append(kept, rec)
+		}
+	}
+	s.writeLocked(kept)
+}
+
+// reapOrphans scans the recorded processes and terminates any that were
+// really orphaned: the Terraform process that launched them is gone, yet
+// they are still running and still executing the provider binary it
+// launched them from. A record whose owning Terraform process is still
+// alive describes a healthy provider belonging to a concurrent run in the
+// same working directory, so it is always left alone. The executable check
+// is what makes the rest safe: a pid that has been recycled for an
+// unrelated process no longer matches the recorded executable path, and a
+// process whose executable we cannot determine is left alone rather than
+// killed on suspicion.
+//
+// The returned records describe the processes that were actually reaped.
+func (s *providerProcessState) reapOrphans() []providerProcessRecord {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.readLocked()
+	if len(records) == 0 {
+		return nil
+	}
+
+	var reaped []providerProcessRecord
+	var kept []providerProcessRecord
+	for _, rec := range records {
+		if rec.OwnerPid != 0 {
+			ownerStart, ownerRunning, ownerOK := terraformProcessStartTime(rec.OwnerPid)
+			if ownerOK && rec.OwnerStart != 0 && ownerStart != rec.OwnerStart {
+				// The owner pid was reused by an unrelated process, so the
+				// Terraform run that launched this provider really is gone.
+				ownerRunning = false
+			}
+			if ownerRunning {
+				// The launching Terraform process is still alive, so its
+				// providers are not orphans no matter what state they are
+				// in; that process is responsible for them.
+				kept = append(kept, rec)
+				continue
+			}
+		}
+		exe, running, ok := providerProcessExecutable(rec.Pid)
+		if !running {
+			// The process is already gone, so only its stale record and
+			// any leftover socket need cleaning up.
+			removeProviderSocket(rec)
+			continue
+		}
+		if !ok {
+			// Still running but unverifiable; keep the record so a later
+			// run (perhaps with more privileges) can try again.
+			kept = append(kept, rec)
+			continue
+		}
+		if filepath.Clean(exe) != filepath.Clean(rec.Executable) {
+			// The pid was recycled for an unrelated process, which we must
+			// never touch. The record itself is stale, though.
+			log.Printf("[DEBUG] provider process %d is now %s, not %s; pid was recycled", rec.Pid, exe, rec.Executable)
+			removeProviderSocket(rec)
+			continue
+		}
+
+		process, err := os.FindProcess(rec.Pid)
+		if err != nil {
+			kept = append(kept, rec)
+			continue
+		}
+		log.Printf("[DEBUG] reaping orphaned provider process %d (%s)", rec.Pid, rec.Executable)
+		if err := terminateProviderProcess(process); err == nil {
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) {
+				if process.Signal(syscall.Signal(0)) != nil {
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+		reapProviderGroup(process)
+		removeProviderSocket(rec)
+		reaped = append(reaped, rec)
+	}
+
+	s.writeLocked(kept)
+	return reaped
+}
+
+// removeProviderSocket deletes the unix socket left behind by an orphaned
+// provider process, if the record has one. TMPDIR cleanup is best-effort.
+func removeProviderSocket(rec providerProcessRecord) {
+	if rec.SocketPath != "" {
+		os.Remove(rec.SocketPath)
+	}
+}
@@ -0,0 +1,135 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProviderProcessState(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "terraform-test-procstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	state := &providerProcessState{
+		path: filepath.Join(tmpDir, "plugin-processes.json"),
+	}
+
+	// Recording and forgetting round-trips through the state file.
+	state.record(providerProcessRecord{Pid: 1234, Executable: "/tmp/terraform-provider-null"})
+	state.record(providerProcessRecord{Pid: 5678, Executable: "/tmp/terraform-provider-random"})
+	state.mu.Lock()
+	records := state.readLocked()
+	state.mu.Unlock()
+	if got, want := len(records), 2; got != want {
+		t.Fatalf("wrong number of records %d; want %d", got, want)
+	}
+
+	state.forget(1234)
+	state.mu.Lock()
+	records = state.readLocked()
+	state.mu.Unlock()
+	if got, want := len(records), 1; got != want {
+		t.Fatalf("wrong number of records %d after forget; want %d", got, want)
+	}
+	if got, want := records[0].Pid, 5678; got != want {
+		t.Errorf("wrong surviving pid %d; want %d", got, want)
+	}
+
+	// Forgetting the last record removes the file entirely rather than
+	// leaving an empty one behind in the data dir.
+	state.forget(5678)
+	if _, err := os.Stat(state.path); !os.IsNotExist(err) {
+		t.Errorf("state file still exists after all records were forgotten")
+	}
+
+	// A nil state (no data dir) is inert.
+	var nilState *providerProcessState
+	nilState.record(providerProcessRecord{Pid: 1})
+	nilState.forget(1)
+	if reaped := nilState.reapOrphans(); reaped != nil {
+		t.Errorf("nil state reaped %#v; want nothing", reaped)
+	}
+}
+
+func TestProviderProcessStateReapOrphans(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "terraform-test-procstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	state := &providerProcessState{
+		path: filepath.Join(tmpDir, "plugin-processes.json"),
+	}
+
+	// Our own pid is certainly alive, but its executable is the test binary
+	// rather than the recorded provider path, so this simulates a pid that
+	// was recycled by an unrelated process: the stale record must be
+	// dropped without anything being killed.
+	state.record(providerProcessRecord{
+		Pid:        os.Getpid(),
+		Executable: filepath.Join(tmpDir, "terraform-provider-null"),
+	})
+	// This pid cannot be a real process, so its record is stale too.
+	state.record(providerProcessRecord{
+		Pid:        1 << 30,
+		Executable: filepath.Join(tmpDir, "terraform-provider-random"),
+	})
+
+	reaped := state.reapOrphans()
+	if len(reaped) != 0 {
+		t.Errorf("reaped %#v; want nothing, since neither record matches a provider process", reaped)
+	}
+	if _, err := os.Stat(state.path); !os.IsNotExist(err) {
+		t.Errorf("stale records were not dropped from the state file")
+	}
+}
+
+func TestProviderProcessStateReapOrphansConcurrentOwner(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "terraform-test-procstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	state := &providerProcessState{
+		path: filepath.Join(tmpDir, "plugin-processes.json"),
+	}
+
+	// A record whose owning Terraform process is still alive describes a
+	// healthy provider belonging to a concurrent run, so it must be kept
+	// untouched even though the provider pid itself cannot be verified.
+	ownerPid, ownerStart := ownProcessIdentity()
+	state.record(providerProcessRecord{
+		Pid:        1 << 30,
+		Executable: filepath.Join(tmpDir, "terraform-provider-null"),
+		OwnerPid:   ownerPid,
+		OwnerStart: ownerStart,
+	})
+	// A dead owner means its provider really is orphaned; with the provider
+	// pid also gone, only the stale record needs dropping.
+	state.record(providerProcessRecord{
+		Pid:        (1 << 30) + 1,
+		Executable: filepath.Join(tmpDir, "terraform-provider-random"),
+		OwnerPid:   1 << 30,
+	})
+
+	reaped := state.reapOrphans()
+	if len(reaped) != 0 {
+		t.Errorf("reaped %#v; want nothing, since no provider process is running", reaped)
+	}
+
+	state.mu.Lock()
+	records := state.readLocked()
+	state.mu.Unlock()
+	if got, want := len(records), 1; got != want {
+		t.Fatalf("wrong number of surviving records %d; want %d", got, want)
+	}
+	if got, want := records[0].OwnerPid, ownerPid; got != want {
+		t.Errorf("wrong surviving record owner %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,76 @@
+// +build !windows
+
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// providerProcessExecutable reports whether the process with the given pid
+// is still running and, where the platform allows, which executable it is
+// running. The ok result is true only when the executable path could be
+// determined, which callers use to distinguish "safe to compare" from
+// "cannot verify".
+func providerProcessExecutable(pid int) (exe string, running bool, ok bool) {
+	if err := syscall.Kill(pid, 0); err != nil {
+		if err == syscall.EPERM {
+			// The process exists but belongs to someone else, which also
+			// means it cannot be one of our providers to verify or kill.
+			return "", true, false
+		}
+		return "", false, false
+	}
+
+	// On Linux the kernel reports the executable directly; on other Unix
+	// systems this link doesn't exist, and we treat the process as
+	// unverifiable rather than guessing.
+	link, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return "", true, false
+	}
+	// The kernel appends this marker when the binary has been deleted or
+	// replaced since the process started, as happens when a provider is
+	// reinstalled while an orphan lingers.
+	link = strings.TrimSuffix(link, " (deleted)")
+	return link, true, true
+}
+
+// terraformProcessStartTime returns a stable identifier for when the
+// process with the given pid started, used together with the pid to tell a
+// live process apart from an unrelated one that happens to have reused its
+// pid. On Linux this is the kernel's start-time tick count from
+// /proc/<pid>/stat; on other Unix systems the start time is unavailable
+// and ok is false, with running still reported accurately.
+func terraformProcessStartTime(pid int) (start int64, running bool, ok bool) {
+	if err := syscall.Kill(pid, 0); err != nil {
+		if err == syscall.EPERM {
+			return 0, true, false
+		}
+		return 0, false, false
+	}
+	buf, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, true, false
+	}
+	// The comm field can itself contain spaces and parentheses, so fields
+	// are counted from after its closing parenthesis: starttime is field 22
+	// of the whole line, which is field 20 of the remainder.
+	rest := string(buf)
+	if idx := strings.LastIndex(rest, ")"); idx >= 0 {
+		rest = rest[idx+1:]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) < 20 {
+		return 0, true, false
+	}
+	start, err = strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return 0, true, false
+	}
+	return start, true, true
+}
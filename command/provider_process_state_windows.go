@@ -0,0 +1,63 @@
+// +build windows
+
+package command
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procQueryFullProcessImageNameW = modkernel32Cmd.NewProc("QueryFullProcessImageNameW")
+
+const _PROCESS_QUERY_LIMITED_INFORMATION = 0x1000
+
+// providerProcessExecutable reports whether the process with the given pid
+// is still running and, if so, which executable image it is running. The ok
+// result is true only when the image path could be determined, which
+// callers use to distinguish "safe to compare" from "cannot verify".
+func providerProcessExecutable(pid int) (exe string, running bool, ok bool) {
+	proc, err := syscall.OpenProcess(_PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		if err == syscall.ERROR_ACCESS_DENIED {
+			// The process exists but belongs to someone else, which also
+			// means it cannot be one of our providers to verify or kill.
+			return "", true, false
+		}
+		return "", false, false
+	}
+	defer syscall.CloseHandle(proc)
+
+	var buf [syscall.MAX_LONG_PATH]uint16
+	size := uint32(len(buf))
+	r1, _, _ := procQueryFullProcessImageNameW.Call(
+		uintptr(proc),
+		0, // Win32 path format
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&size)),
+	)
+	if r1 == 0 {
+		return "", true, false
+	}
+	return syscall.UTF16ToString(buf[:size]), true, true
+}
+
+// terraformProcessStartTime returns a stable identifier for when the
+// process with the given pid started, used together with the pid to tell a
+// live process apart from an unrelated one that happens to have reused its
+// pid. On Windows this is the creation time reported by GetProcessTimes.
+func terraformProcessStartTime(pid int) (start int64, running bool, ok bool) {
+	proc, err := syscall.OpenProcess(_PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		if err == syscall.ERROR_ACCESS_DENIED {
+			return 0, true, false
+		}
+		return 0, false, false
+	}
+	defer syscall.CloseHandle(proc)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(proc, &creation, &exit, &kernel, &user); err != nil {
+		return 0, true, false
+	}
+	return creation.Nanoseconds(), true, true
+}
@@ -0,0 +1,58 @@
+package command
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+// retryBudget is a thread-safe budget of retry attempts that is shared
+// between all of the provider launches for a particular Terraform process,
+// so that a few persistently-failing providers cannot cause an unbounded
+// number of total retries.
+type retryBudget struct {
+	mu        sync.Mutex
+	remaining int
+}
+
+// newRetryBudget constructs a retryBudget permitting the given total number
+// of retries. A budget of zero disables retrying altogether.
+func newRetryBudget(n int) *retryBudget {
+	return &retryBudget{
+		remaining: n,
+	}
+}
+
+// Spend consumes one retry from the budget, returning false if the budget
+// is already exhausted and therefore no further retry is permitted.
+//
+// Spend is safe to call concurrently from multiple provider launches.
+func (b *retryBudget) Spend() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining <= 0 {
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// providerLaunchRetryBudget is the retry budget shared by every provider
+// launch in this process. The size of the budget is configured with the
+// TF_PROVIDER_LAUNCH_RETRIES environment variable; the default of zero
+// preserves the historical behavior of failing on the first launch error.
+var providerLaunchRetryBudget = newRetryBudget(providerLaunchRetriesFromEnv())
+
+func providerLaunchRetriesFromEnv() int {
+	env := os.Getenv("TF_PROVIDER_LAUNCH_RETRIES")
+	if env == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(env)
+	if err != nil || n < 0 {
+		// An unparseable budget is treated as no budget at all, rather than
+		// failing an operation that would otherwise have succeeded.
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,87 @@
+package command
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+)
+
+func TestRetryBudgetSpend(t *testing.T) {
+	budget := newRetryBudget(3)
+
+	// Simulate several providers retrying concurrently: no matter how the
+	// spends interleave, exactly three of them may succeed.
+	const launches = 10
+	var wg sync.WaitGroup
+	results := make(chan bool, launches)
+	for i := 0; i < launches; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- budget.Spend()
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	spent := 0
+	for ok := range results {
+		if ok {
+			spent++
+		}
+	}
+	if spent != 3 {
+		t.Errorf("wrong number of successful spends %d; want 3", spent)
+	}
+	if budget.Spend() {
+		t.Error("Spend succeeded on exhausted budget")
+	}
+}
+
+func TestProviderFactoryRetryBudgetExhausted(t *testing.T) {
+	// Swap in a small budget shared by both of our failing launches, to
+	// make sure the second launch finds it already partly spent.
+	oldBudget := providerLaunchRetryBudget
+	providerLaunchRetryBudget = newRetryBudget(2)
+	defer func() { providerLaunchRetryBudget = oldBudget }()
+
+	meta1 := &providercache.CachedProvider{
+		Provider:       addrs.NewDefaultProvider("null"),
+		Version:        getproviders.MustParseVersion("1.0.0"),
+		PackageDir:     "testdata/empty",
+		ExecutableFile: "testdata/empty/nonexistent-executable",
+	}
+	meta2 := &providercache.CachedProvider{
+		Provider:       addrs.NewDefaultProvider("random"),
+		Version:        getproviders.MustParseVersion("1.0.0"),
+		PackageDir:     "testdata/empty",
+		ExecutableFile: "testdata/empty/nonexistent-executable",
+	}
+
+	// The first provider's launch fails repeatedly and so spends the whole
+	// shared budget before giving up.
+	_, err := providerFactory(meta1, nil, nil, providerResourceLimits{}, nil, true, nil, nil)()
+	if err == nil {
+		t.Fatal("unexpected success launching null provider; want launch failure")
+	}
+	if !strings.Contains(err.Error(), "retry budget exhausted") {
+		t.Errorf("wrong error %q; want mention of exhausted retry budget", err)
+	}
+
+	// The second provider then has no budget left, so it must fail on its
+	// first attempt without reporting any retries of its own.
+	_, err = providerFactory(meta2, nil, nil, providerResourceLimits{}, nil, true, nil, nil)()
+	if err == nil {
+		t.Fatal("unexpected success launching random provider; want launch failure")
+	}
+	if strings.Contains(err.Error(), "retry budget exhausted") {
+		t.Errorf("error %q mentions retrying, but the budget was already spent", err)
+	}
+	if providerLaunchRetryBudget.Spend() {
+		t.Error("budget still has retries left; want it fully spent")
+	}
+}
@@ -0,0 +1,127 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/providercache"
+	"github.com/hashicorp/terraform/providers"
+)
+
+// schemaCacheFormatVersion identifies the layout of the schema cache files,
+// so that a future change to the serialization can invalidate older files
+// instead of misreading them.
+const schemaCacheFormatVersion = 1
+
+// schemaCacheEntry is the serialized form of a provider's schema response.
+// Diagnostics are deliberately not part of it: only successful responses
+// are cached.
+type schemaCacheEntry struct {
+	FormatVersion int
+	Provider      providers.Schema
+	ProviderMeta  providers.Schema
+	ResourceTypes map[string]providers.Schema
+	DataSources   map[string]providers.Schema
+}
+
+// providerSchemaCache persists one provider's schema response in the data
+// directory, so that later commands can obtain the schema without starting
+// the provider at all. Each cache file is keyed by provider, version, and
+// package hash, so replacing the package automatically invalidates the
+// cache by way of a miss against the new key.
+type providerSchemaCache struct {
+	filename string
+}
+
+// providerSchemaCacheFor returns the schema cache location for the given
+// selected provider package, or nil if schema caching is disabled
+// (-no-schema-cache or TF_PROVIDER_NO_SCHEMA_CACHE) or the package can't be
+// hashed and so can't be cached safely.
+func (m *Meta) providerSchemaCacheFor(provider addrs.Provider, cached *providercache.CachedProvider) *providerSchemaCache {
+	if m.noSchemaCache || os.Getenv("TF_PROVIDER_NO_SCHEMA_CACHE") != "" {
+		return nil
+	}
+	hash, err := cached.Hash()
+	if err != nil {
+		log.Printf("[WARN] failed to hash the package for provider %s, so its schema won't be cached: %s", provider, err)
+		return nil
+	}
+	return &providerSchemaCache{
+		filename: filepath.Join(
+			m.DataDir(), "providers-schema",
+			provider.Hostname.ForDisplay(), provider.Namespace, provider.Type,
+			fmt.Sprintf("%s-%s.json", cached.Version.String(), sanitizeSchemaCacheHash(hash)),
+		),
+	}
+}
+
+// sanitizeSchemaCacheHash converts a package hash into a form that is safe
+// to use within a filename on all of our supported platforms.
+func sanitizeSchemaCacheHash(hash string) string {
+	return strings.NewReplacer(":", "-", "/", "_", "+", "-", "=", "").Replace(hash)
+}
+
+// Read returns the cached schema response, or ok=false if there is no
+// usable cache entry. A corrupt or unreadable file is treated the same as a
+// missing one, so the caller falls back to asking the provider itself and
+// then rewrites the entry.
+func (c *providerSchemaCache) Read() (resp providers.GetSchemaResponse, ok bool) {
+	data, err := ioutil.ReadFile(c.filename)
+	if err != nil {
+		return resp, false
+	}
+	var entry schemaCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Printf("[WARN] ignoring corrupt provider schema cache file %s: %s", c.filename, err)
+		return resp, false
+	}
+	if entry.FormatVersion != schemaCacheFormatVersion {
+		return resp, false
+	}
+	resp.Provider = entry.Provider
+	resp.ProviderMeta = entry.ProviderMeta
+	resp.ResourceTypes = entry.ResourceTypes
+	resp.DataSources = entry.DataSources
+	return resp, true
+}
+
+// Write stores the given schema response for later reads. Failures are
+// logged but not returned, because the cache is only an optimization.
+func (c *providerSchemaCache) Write(resp providers.GetSchemaResponse) {
+	if resp.Diagnostics.HasErrors() {
+		return
+	}
+	entry := schemaCacheEntry{
+		FormatVersion: schemaCacheFormatVersion,
+		Provider:      resp.Provider,
+		ProviderMeta:  resp.ProviderMeta,
+		ResourceTypes: resp.ResourceTypes,
+		DataSources:   resp.DataSources,
+	}
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		log.Printf("[WARN] failed to serialize provider schema for caching: %s", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.filename), 0755); err != nil {
+		log.Printf("[WARN] failed to create provider schema cache directory: %s", err)
+		return
+	}
+	// Write-then-rename so that a concurrent reader can't observe a
+	// partially-written entry.
+	tmp := c.filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("[WARN] failed to write provider schema cache file: %s", err)
+		return
+	}
+	if err := os.Rename(tmp, c.filename); err != nil {
+		os.Remove(tmp)
+		log.Printf("[WARN] failed to write provider schema cache file: %s", err)
+	}
+}
@@ -0,0 +1,104 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+	"github.com/hashicorp/terraform/providers"
+)
+
+func testSchemaCacheMeta(t *testing.T) (*Meta, addrs.Provider, *providercache.CachedProvider) {
+	t.Helper()
+	dataDir, err := ioutil.TempDir("", "terraform-test-schemacache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dataDir) })
+
+	pkgDir := filepath.Join(dataDir, "pkg")
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkgDir, "terraform-provider-test"), []byte("v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := addrs.NewDefaultProvider("test")
+	cached := &providercache.CachedProvider{
+		Provider:       provider,
+		Version:        getproviders.MustParseVersion("1.0.0"),
+		PackageDir:     pkgDir,
+		ExecutableFile: filepath.Join(pkgDir, "terraform-provider-test"),
+	}
+	return &Meta{OverrideDataDir: dataDir}, provider, cached
+}
+
+func TestProviderSchemaCache_corruptFile(t *testing.T) {
+	m, provider, cached := testSchemaCacheMeta(t)
+	cache := m.providerSchemaCacheFor(provider, cached)
+	if cache == nil {
+		t.Fatal("no schema cache for hashable package")
+	}
+
+	cache.Write(testSchemaResponse())
+	if _, ok := cache.Read(); !ok {
+		t.Fatal("no cache hit after writing an entry")
+	}
+
+	// A truncated or otherwise corrupt file must read as a miss...
+	if err := ioutil.WriteFile(cache.filename, []byte(`{"FormatVersion`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Read(); ok {
+		t.Fatal("cache hit from a corrupt file; want a miss")
+	}
+
+	// ...so that the caller falls back to the live provider and rewrites
+	// the entry, exactly as the lazy factory does.
+	launches := 0
+	factory := lazyProviderFactory(cache, func() (providers.Interface, error) {
+		launches++
+		return &schemaTestProvider{schema: testSchemaResponse()}, nil
+	})
+	inst, err := factory()
+	if err != nil {
+		t.Fatalf("unexpected error from factory: %s", err)
+	}
+	resp := inst.GetSchema()
+	checkDiagsHasNoErrors(t, resp)
+	if launches != 1 {
+		t.Fatalf("wrong number of launches %d for corrupt cache; want 1", launches)
+	}
+	if _, ok := cache.Read(); !ok {
+		t.Fatal("corrupt cache entry was not rewritten after the live fetch")
+	}
+
+	// A format version from the future is also a miss rather than an error.
+	if err := ioutil.WriteFile(cache.filename, []byte(`{"FormatVersion":999}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Read(); ok {
+		t.Fatal("cache hit from an unsupported format version; want a miss")
+	}
+}
+
+func TestProviderSchemaCache_disabled(t *testing.T) {
+	m, provider, cached := testSchemaCacheMeta(t)
+
+	m.noSchemaCache = true
+	if cache := m.providerSchemaCacheFor(provider, cached); cache != nil {
+		t.Error("got a schema cache with -no-schema-cache set; want nil")
+	}
+	m.noSchemaCache = false
+
+	os.Setenv("TF_PROVIDER_NO_SCHEMA_CACHE", "1")
+	defer os.Unsetenv("TF_PROVIDER_NO_SCHEMA_CACHE")
+	if cache := m.providerSchemaCacheFor(provider, cached); cache != nil {
+		t.Error("got a schema cache with TF_PROVIDER_NO_SCHEMA_CACHE set; want nil")
+	}
+}
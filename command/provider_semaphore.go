@@ -0,0 +1,60 @@
+package command
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultProviderLaunchWait is how long a provider launch will wait for a
+// process slot to become free before failing, when a provider parallelism
+// limit is configured.
+const defaultProviderLaunchWait = 2 * time.Minute
+
+// providerLaunchSemaphore limits how many provider processes may run at the
+// same time, so that a configuration with many distinct providers doesn't
+// exhaust the memory of a small machine by launching them all at once.
+//
+// A nil semaphore imposes no limit, which keeps the unlimited case free of
+// any locking.
+type providerLaunchSemaphore struct {
+	slots chan struct{}
+}
+
+// newProviderLaunchSemaphore returns a semaphore permitting n concurrently
+// running providers, or nil if n is zero or negative, meaning no limit.
+func newProviderLaunchSemaphore(n int) *providerLaunchSemaphore {
+	if n <= 0 {
+		return nil
+	}
+	return &providerLaunchSemaphore{
+		slots: make(chan struct{}, n),
+	}
+}
+
+// Acquire claims a process slot, waiting up to the given timeout for one to
+// become free. The timeout prevents a deadlock if a provider factory is
+// ever invoked from within another provider's call path; in that case the
+// error describes what was being waited for rather than hanging forever.
+func (s *providerLaunchSemaphore) Acquire(timeout time.Duration) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %s waiting for a provider process slot: %d providers are already running; raise the provider parallelism limit if this configuration legitimately needs more concurrent providers", timeout, cap(s.slots))
+	}
+}
+
+// Release returns a previously acquired slot. Extra calls are ignored so
+// that a double-closed provider can't corrupt the semaphore.
+func (s *providerLaunchSemaphore) Release() {
+	if s == nil {
+		return
+	}
+	select {
+	case <-s.slots:
+	default:
+	}
+}
@@ -0,0 +1,50 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProviderLaunchSemaphore(t *testing.T) {
+	sem := newProviderLaunchSemaphore(1)
+
+	if err := sem.Acquire(10 * time.Millisecond); err != nil {
+		t.Fatalf("unexpected error acquiring free slot: %s", err)
+	}
+
+	// With the only slot held, a second acquisition must time out with an
+	// error describing what was being waited for.
+	err := sem.Acquire(10 * time.Millisecond)
+	if err == nil {
+		t.Fatal("unexpected success acquiring held slot; want timeout")
+	}
+	if !strings.Contains(err.Error(), "provider process slot") {
+		t.Errorf("wrong error %q; want mention of a provider process slot", err)
+	}
+
+	sem.Release()
+	if err := sem.Acquire(10 * time.Millisecond); err != nil {
+		t.Errorf("unexpected error acquiring released slot: %s", err)
+	}
+
+	// Extra releases must be ignored rather than creating phantom slots
+	// or blocking.
+	sem.Release()
+	sem.Release()
+}
+
+func TestProviderLaunchSemaphoreUnlimited(t *testing.T) {
+	// A nil semaphore means no limit, so every acquisition must succeed
+	// immediately.
+	sem := newProviderLaunchSemaphore(0)
+	if sem != nil {
+		t.Fatalf("wrong semaphore %v for limit 0; want nil (unlimited)", sem)
+	}
+	for i := 0; i < 100; i++ {
+		if err := sem.Acquire(time.Millisecond); err != nil {
+			t.Fatalf("unexpected error from unlimited semaphore: %s", err)
+		}
+	}
+	sem.Release()
+}
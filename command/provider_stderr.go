@@ -0,0 +1,151 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	hclog "github.com/hashicorp/go-hclog"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// stderrTailBufferSize is how much of a provider's stderr output we retain
+// for inclusion in an error message if the provider fails to launch.
+const stderrTailBufferSize = 64 * 1024
+
+// stderrTailBuffer is an io.Writer that retains only the most recent
+// stderrTailBufferSize bytes written to it, so that a provider which floods
+// its stderr before crashing can't make Terraform buffer an unbounded
+// amount of output.
+type stderrTailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *stderrTailBuffer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	if excess := len(w.buf) - stderrTailBufferSize; excess > 0 {
+		w.buf = w.buf[excess:]
+	}
+	return len(p), nil
+}
+
+// Tail returns the retained output with surrounding whitespace trimmed, or
+// an empty string if the provider wrote nothing.
+func (w *stderrTailBuffer) Tail() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.TrimSpace(string(w.buf))
+}
+
+// defaultProviderStderrLogLevel is the level at which non-hclog stderr
+// output from providers is logged. Error is the default because in practice
+// such output is almost always a panic message or runtime trace; providers
+// doing routine logging use hclog, which go-plugin forwards at its own
+// level.
+const defaultProviderStderrLogLevel = hclog.Error
+
+// providerStderrLogLevel returns the level for non-hclog provider stderr
+// lines, honoring the TF_PROVIDER_STDERR_LOG_LEVEL environment variable. An
+// invalid value produces a warning and the default is used instead.
+func providerStderrLogLevel() hclog.Level {
+	env := os.Getenv("TF_PROVIDER_STDERR_LOG_LEVEL")
+	if env == "" {
+		return defaultProviderStderrLogLevel
+	}
+	level, ok := parsePluginLogLevel(env)
+	if !ok {
+		log.Printf("[WARN] invalid TF_PROVIDER_STDERR_LOG_LEVEL %q: must be one of trace, debug, info, warn, or error; using error", env)
+		return defaultProviderStderrLogLevel
+	}
+	return level
+}
+
+// providerStderrLogger is an io.Writer that forwards raw provider stderr
+// output, line by line, through a structured logger tagged with the
+// provider's address. Output that providers send through hclog is already
+// parsed and re-logged by go-plugin, so JSON lines are skipped here to
+// avoid duplicating them; everything else -- panic messages, Go runtime
+// traces, stray prints -- would otherwise appear unlabeled, making it hard
+// to tell which of several running providers produced it.
+type providerStderrLogger struct {
+	mu     sync.Mutex
+	logger hclog.Logger
+	level  hclog.Level
+	buf    []byte
+}
+
+func newProviderStderrLogger(logger hclog.Logger, provider addrs.Provider) *providerStderrLogger {
+	return &providerStderrLogger{
+		logger: logger.With("provider", provider.String()),
+		level:  providerStderrLogLevel(),
+	}
+}
+
+func (w *providerStderrLogger) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		nl := bytes.IndexByte(w.buf, '\n')
+		if nl < 0 {
+			break
+		}
+		line := string(w.buf[:nl])
+		w.buf = w.buf[nl+1:]
+		w.emit(line)
+	}
+	// A provider emitting an enormous amount of output with no newline at
+	// all must not make us buffer it without bound.
+	if len(w.buf) > stderrTailBufferSize {
+		w.emit(string(w.buf))
+		w.buf = w.buf[:0]
+	}
+	return len(p), nil
+}
+
+func (w *providerStderrLogger) emit(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	if strings.HasPrefix(line, "{") && json.Valid([]byte(line)) {
+		// Looks like hclog JSON, which go-plugin handles itself.
+		return
+	}
+	// This version of hclog has no level-parameterized log method, so we
+	// dispatch to the fixed-level ones.
+	switch w.level {
+	case hclog.Trace:
+		w.logger.Trace(line)
+	case hclog.Debug:
+		w.logger.Debug(line)
+	case hclog.Info:
+		w.logger.Info(line)
+	case hclog.Warn:
+		w.logger.Warn(line)
+	default:
+		w.logger.Error(line)
+	}
+}
+
+// withStderrTail annotates a provider launch error with the tail of the
+// provider's stderr output, which usually contains the panic message or
+// other crash detail that go-plugin's own error discards.
+func withStderrTail(err error, stderr *stderrTailBuffer) error {
+	if err == nil || stderr == nil {
+		return err
+	}
+	tail := stderr.Tail()
+	if tail == "" {
+		return err
+	}
+	return fmt.Errorf("%s\n\nThe provider wrote the following output before failing:\n%s", err, tail)
+}
@@ -0,0 +1,126 @@
+package command
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+)
+
+func TestStderrTailBuffer(t *testing.T) {
+	buf := &stderrTailBuffer{}
+	if got := buf.Tail(); got != "" {
+		t.Errorf("wrong tail %q for empty buffer; want empty", got)
+	}
+
+	buf.Write([]byte("hello\n"))
+	if got, want := buf.Tail(), "hello"; got != want {
+		t.Errorf("wrong tail %q; want %q", got, want)
+	}
+
+	// Writing more than the buffer size must keep only the most recent
+	// output.
+	big := strings.Repeat("x", stderrTailBufferSize)
+	buf.Write([]byte(big))
+	buf.Write([]byte("the end"))
+	tail := buf.Tail()
+	if len(tail) > stderrTailBufferSize {
+		t.Errorf("tail is %d bytes; want at most %d", len(tail), stderrTailBufferSize)
+	}
+	if !strings.HasSuffix(tail, "the end") {
+		t.Errorf("tail does not end with the most recent write")
+	}
+}
+
+func TestWithStderrTail(t *testing.T) {
+	base := errors.New("plugin exited before we could connect")
+
+	if got := withStderrTail(base, &stderrTailBuffer{}); got != base {
+		t.Errorf("error was wrapped even though the provider wrote nothing")
+	}
+	if got := withStderrTail(nil, &stderrTailBuffer{}); got != nil {
+		t.Errorf("wrong result %v for nil error; want nil", got)
+	}
+
+	buf := &stderrTailBuffer{}
+	buf.Write([]byte("panic: something exploded\n"))
+	got := withStderrTail(base, buf).Error()
+	if !strings.Contains(got, base.Error()) {
+		t.Errorf("wrapped error %q does not include the original error", got)
+	}
+	if !strings.Contains(got, "panic: something exploded") {
+		t.Errorf("wrapped error %q does not include the provider output", got)
+	}
+}
+
+func TestProviderStderrLogger(t *testing.T) {
+	var out strings.Builder
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:   "plugin",
+		Level:  hclog.Trace,
+		Output: &out,
+	})
+	w := newProviderStderrLogger(logger, addrs.NewDefaultProvider("null"))
+
+	// A line may arrive split across several writes and must only be
+	// logged once complete.
+	w.Write([]byte("panic: runtime error: "))
+	w.Write([]byte("invalid memory address\n"))
+
+	// hclog JSON lines are go-plugin's to handle, so they must be skipped.
+	w.Write([]byte("{\"@level\":\"info\",\"@message\":\"structured\"}\n"))
+
+	got := out.String()
+	if !strings.Contains(got, "panic: runtime error: invalid memory address") {
+		t.Errorf("output does not contain the plain stderr line:\n%s", got)
+	}
+	if !strings.Contains(got, "provider=registry.terraform.io/hashicorp/null") {
+		t.Errorf("output is not tagged with the provider address:\n%s", got)
+	}
+	if strings.Contains(got, "structured") {
+		t.Errorf("output duplicates an hclog JSON line:\n%s", got)
+	}
+}
+
+func TestProviderFactoryStderrCapture(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script as a fake provider")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "terraform-test-stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// A fake provider that prints a crash message and exits without ever
+	// speaking the plugin protocol.
+	script := filepath.Join(tmpDir, "terraform-provider-fake")
+	content := "#!/bin/sh\necho 'boom: fake provider exploded' >&2\nexit 1\n"
+	if err := ioutil.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := &providercache.CachedProvider{
+		Provider:       addrs.NewDefaultProvider("fake"),
+		Version:        getproviders.MustParseVersion("1.0.0"),
+		PackageDir:     tmpDir,
+		ExecutableFile: script,
+	}
+	_, err = providerFactory(meta, nil, nil, providerResourceLimits{}, nil, true, nil, nil)()
+	if err == nil {
+		t.Fatal("unexpected success launching fake provider; want failure")
+	}
+	if !strings.Contains(err.Error(), "boom: fake provider exploded") {
+		t.Errorf("error does not include the provider's stderr output:\n%s", err)
+	}
+}
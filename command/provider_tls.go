@@ -0,0 +1,75 @@
+package command
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Provider plugin connections are normally protected by go-plugin's
+// AutoMTLS, which generates an ephemeral certificate per launch. Security
+// teams that need to pin and audit the plugin transport can instead anchor
+// it to organizational key material through these environment variables:
+//
+//     TF_PROVIDER_TLS_CA_FILE      PEM file with the CA certificate(s) that
+//                                  provider server certificates must chain to
+//     TF_PROVIDER_TLS_CERT_FILE    PEM file with Terraform's client certificate
+//     TF_PROVIDER_TLS_KEY_FILE     PEM file with the client certificate's key
+//     TF_PROVIDER_TLS_SERVER_NAME  expected server certificate name
+//                                  (default "localhost")
+//
+// The CA file is required; the client certificate pair is optional and must
+// be given together. When none of the variables are set, AutoMTLS behavior
+// is unchanged.
+
+// defaultProviderTLSServerName matches the name that go-plugin's own served
+// certificates use, since plugin servers are always local processes.
+const defaultProviderTLSServerName = "localhost"
+
+// providerTLSConfig returns the TLS configuration to use for provider
+// plugin connections, or nil if no organizational key material is
+// configured and AutoMTLS should be used.
+func providerTLSConfig() (*tls.Config, error) {
+	caFile := os.Getenv("TF_PROVIDER_TLS_CA_FILE")
+	certFile := os.Getenv("TF_PROVIDER_TLS_CERT_FILE")
+	keyFile := os.Getenv("TF_PROVIDER_TLS_KEY_FILE")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if caFile == "" {
+		return nil, fmt.Errorf("TF_PROVIDER_TLS_CA_FILE must be set when configuring provider plugin TLS")
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("TF_PROVIDER_TLS_CERT_FILE and TF_PROVIDER_TLS_KEY_FILE must be set together")
+	}
+
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider TLS CA bundle: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no CA certificates found in %s", caFile)
+	}
+
+	serverName := os.Getenv("TF_PROVIDER_TLS_SERVER_NAME")
+	if serverName == "" {
+		serverName = defaultProviderTLSServerName
+	}
+
+	cfg := &tls.Config{
+		RootCAs:    pool,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load provider TLS client certificate: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
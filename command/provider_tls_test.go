@@ -0,0 +1,112 @@
+package command
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProviderTLSConfig(t *testing.T) {
+	defer os.Unsetenv("TF_PROVIDER_TLS_CA_FILE")
+	defer os.Unsetenv("TF_PROVIDER_TLS_CERT_FILE")
+	defer os.Unsetenv("TF_PROVIDER_TLS_KEY_FILE")
+	defer os.Unsetenv("TF_PROVIDER_TLS_SERVER_NAME")
+
+	// With nothing configured we must report no TLS config at all, leaving
+	// AutoMTLS in effect.
+	os.Unsetenv("TF_PROVIDER_TLS_CA_FILE")
+	os.Unsetenv("TF_PROVIDER_TLS_CERT_FILE")
+	os.Unsetenv("TF_PROVIDER_TLS_KEY_FILE")
+	cfg, err := providerTLSConfig()
+	if err != nil {
+		t.Fatalf("unexpected error with no TLS configuration: %s", err)
+	}
+	if cfg != nil {
+		t.Fatal("got a TLS config with nothing configured; want nil")
+	}
+
+	// A client certificate without its key is a configuration mistake.
+	os.Setenv("TF_PROVIDER_TLS_CA_FILE", "testdata/empty/nonexistent.pem")
+	os.Setenv("TF_PROVIDER_TLS_CERT_FILE", "testdata/empty/nonexistent.pem")
+	_, err = providerTLSConfig()
+	if err == nil || !strings.Contains(err.Error(), "must be set together") {
+		t.Errorf("wrong error %v for cert without key; want mention of setting both", err)
+	}
+	os.Unsetenv("TF_PROVIDER_TLS_CERT_FILE")
+
+	// A missing CA file must be reported rather than silently ignored.
+	_, err = providerTLSConfig()
+	if err == nil || !strings.Contains(err.Error(), "failed to read provider TLS CA bundle") {
+		t.Errorf("wrong error %v for missing CA file; want read failure", err)
+	}
+
+	// A real CA bundle produces a config anchored to it.
+	caFile := testProviderCAFile(t)
+	os.Setenv("TF_PROVIDER_TLS_CA_FILE", caFile)
+	cfg, err = providerTLSConfig()
+	if err != nil {
+		t.Fatalf("unexpected error with valid CA bundle: %s", err)
+	}
+	if cfg == nil || cfg.RootCAs == nil {
+		t.Fatal("config is missing the CA pool")
+	}
+	if got, want := cfg.ServerName, "localhost"; got != want {
+		t.Errorf("wrong default server name %q; want %q", got, want)
+	}
+
+	os.Setenv("TF_PROVIDER_TLS_SERVER_NAME", "plugins.example.com")
+	cfg, err = providerTLSConfig()
+	if err != nil {
+		t.Fatalf("unexpected error with server name override: %s", err)
+	}
+	if got, want := cfg.ServerName, "plugins.example.com"; got != want {
+		t.Errorf("wrong server name %q; want %q", got, want)
+	}
+}
+
+// testProviderCAFile writes a throwaway self-signed CA certificate to a
+// temporary file and returns its path.
+func testProviderCAFile(t *testing.T) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "terraform test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "terraform-test-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	caFile := filepath.Join(dir, "ca.pem")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(caFile, pemData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return caFile
+}
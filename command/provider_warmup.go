@@ -0,0 +1,108 @@
+package command
+
+import (
+	"log"
+	"sync"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/providers"
+)
+
+// warmedProviderSet holds provider instances that were launched ahead of
+// need by Meta.WarmProviders, until the graph walk asks for them. Guarded
+// by a mutex because warm-up launches run concurrently with each other
+// and potentially with the first factory calls of a graph walk.
+type warmedProviderSet struct {
+	mu   sync.Mutex
+	live map[addrs.Provider]providers.Interface
+}
+
+// put stores a warmed-up instance for the given provider. If one is
+// somehow already waiting then the new instance is shut down instead of
+// stored, so warm-up can never leak more than one process per provider.
+func (s *warmedProviderSet) put(provider addrs.Provider, p providers.Interface) {
+	s.mu.Lock()
+	if _, exists := s.live[provider]; exists {
+		s.mu.Unlock()
+		p.Close()
+		return
+	}
+	if s.live == nil {
+		s.live = make(map[addrs.Provider]providers.Interface)
+	}
+	s.live[provider] = p
+	s.mu.Unlock()
+}
+
+// take removes and returns the warmed-up instance for the given provider,
+// or nil if none is waiting.
+func (s *warmedProviderSet) take(provider addrs.Provider) providers.Interface {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, exists := s.live[provider]
+	if !exists {
+		return nil
+	}
+	delete(s.live, provider)
+	return p
+}
+
+// warmedProviderFactory wraps a launching factory so that its first call
+// consumes any instance that Meta.WarmProviders launched ahead of time,
+// falling back to the wrapped factory when nothing is warmed. This is the
+// outermost wrapper in the factory chain so that a warmed instance carries
+// whatever the inner wrappers produced.
+func warmedProviderFactory(set *warmedProviderSet, provider addrs.Provider, factory providers.Factory) providers.Factory {
+	return func() (providers.Interface, error) {
+		if p := set.take(provider); p != nil {
+			log.Printf("[DEBUG] using warmed-up instance of provider %s", provider)
+			return p, nil
+		}
+		return factory()
+	}
+}
+
+// warmedProviderSetInit returns the set that warmed-up instances for this
+// command are kept in, creating it on first use. Both providerFactories
+// and WarmProviders run on the command goroutine, so the lazy creation
+// itself needs no locking.
+func (m *Meta) warmedProviderSetInit() *warmedProviderSet {
+	if m.warmedProviders == nil {
+		m.warmedProviders = &warmedProviderSet{}
+	}
+	return m.warmedProviders
+}
+
+// WarmProviders launches the plugin processes for the given providers
+// concurrently, ahead of the graph walk that would otherwise launch each
+// one serially on first use. The factories must come from providerFactories
+// on the same Meta; each warmed instance is then handed to the first
+// factory call for its provider. A provider that fails to warm up is just
+// launched on demand as usual, so failures here are logged rather than
+// returned.
+//
+// The launch semaphore shared by the factories bounds how many warm-up
+// launches run at once, so ProviderParallelism applies here the same way
+// it does during a graph walk. Providers in the use list with no factory,
+// such as built-ins, are skipped.
+func (m *Meta) WarmProviders(factories map[addrs.Provider]providers.Factory, use []addrs.Provider) {
+	set := m.warmedProviderSetInit()
+	var wg sync.WaitGroup
+	for _, provider := range use {
+		factory, exists := factories[provider]
+		if !exists {
+			continue
+		}
+		wg.Add(1)
+		go func(provider addrs.Provider, factory providers.Factory) {
+			defer wg.Done()
+			p, err := factory()
+			if err != nil {
+				log.Printf("[WARN] failed to warm up provider %s, so it will be launched on demand instead: %s", provider, err)
+				return
+			}
+			set.put(provider, p)
+		}(provider, factory)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,64 @@
+package command
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/providers"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestWarmProviders(t *testing.T) {
+	m := &Meta{}
+	goodProvider := addrs.NewDefaultProvider("null")
+	badProvider := addrs.NewDefaultProvider("broken")
+	builtIn := addrs.NewBuiltInProvider("terraform")
+
+	mock := &terraform.MockProvider{}
+	var mu sync.Mutex
+	launches := 0
+	set := m.warmedProviderSetInit()
+	factories := map[addrs.Provider]providers.Factory{
+		goodProvider: warmedProviderFactory(set, goodProvider, func() (providers.Interface, error) {
+			mu.Lock()
+			launches++
+			mu.Unlock()
+			return mock, nil
+		}),
+		badProvider: warmedProviderFactory(set, badProvider, func() (providers.Interface, error) {
+			return nil, fmt.Errorf("no good")
+		}),
+	}
+
+	// The built-in provider has no factory and must just be skipped.
+	m.WarmProviders(factories, []addrs.Provider{goodProvider, badProvider, builtIn})
+
+	// The first factory call consumes the warmed instance rather than
+	// launching again.
+	got, err := factories[goodProvider]()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != mock {
+		t.Errorf("first call returned a fresh instance instead of the warmed one")
+	}
+	if got, want := launches, 1; got != want {
+		t.Errorf("wrong number of launches %d; want %d", got, want)
+	}
+
+	// With the warmed instance consumed, the next call launches on demand.
+	if _, err := factories[goodProvider](); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := launches, 2; got != want {
+		t.Errorf("wrong number of launches %d; want %d", got, want)
+	}
+
+	// A provider whose warm-up failed is also launched on demand, with the
+	// warm-up error swallowed.
+	if _, err := factories[badProvider](); err == nil {
+		t.Fatal("unexpected success from the broken provider; want launch error")
+	}
+}
@@ -1,9 +1,11 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
 	"path/filepath"
 
+	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/configs"
 	"github.com/hashicorp/terraform/internal/getproviders"
 	"github.com/hashicorp/terraform/tfdiags"
@@ -27,12 +29,30 @@ func (c *ProvidersCommand) Synopsis() string {
 func (c *ProvidersCommand) Run(args []string) int {
 	args = c.Meta.process(args)
 	cmdFlags := c.Meta.defaultFlagSet("providers")
+	var cleanupOrphans bool
+	var jsonOutput bool
+	cmdFlags.BoolVar(&cleanupOrphans, "cleanup-orphans", false, "terminate provider processes left behind by crashed runs")
+	cmdFlags.BoolVar(&jsonOutput, "json", false, "produce JSON output")
 	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := cmdFlags.Parse(args); err != nil {
 		c.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
 		return 1
 	}
 
+	if cleanupOrphans {
+		// This also happens automatically before providers are launched,
+		// but the explicit flag lets an operator clean up after a crashed
+		// run without starting another operation.
+		reaped := c.providerProcessStateFile().reapOrphans()
+		for _, rec := range reaped {
+			c.Ui.Output(fmt.Sprintf("- Terminated orphaned provider process %d (%s)", rec.Pid, rec.Executable))
+		}
+		if len(reaped) == 0 {
+			c.Ui.Output("No orphaned provider processes found.")
+		}
+		return 0
+	}
+
 	configPath, err := ModulePath(cmdFlags.Args())
 	if err != nil {
 		c.Ui.Error(err.Error())
@@ -106,8 +126,60 @@ func (c *ProvidersCommand) Run(args []string) int {
 		reqs = reqs.Merge(stateReqs)
 	}
 
+	// Providers being satisfied by reattachment to already-running server
+	// processes are annotated as such, because otherwise it's easy to
+	// wonder why the installed package's behavior isn't what's running.
+	unmanaged := c.unmanagedProviders()
+
+	if jsonOutput {
+		type providerJSON struct {
+			Constraints string `json:"constraints,omitempty"`
+			Source      string `json:"source"`
+			Pid         int    `json:"pid,omitempty"`
+			Transport   string `json:"transport,omitempty"`
+		}
+		out := make(map[string]providerJSON, len(reqs))
+		for fqn, dep := range reqs {
+			entry := providerJSON{
+				Constraints: getproviders.VersionConstraintsString(dep),
+				Source:      "installed",
+			}
+			switch {
+			case fqn.IsBuiltIn():
+				entry.Source = "builtin"
+			case unmanaged[fqn] != nil:
+				entry.Source = "unmanaged"
+				entry.Pid = unmanaged[fqn].Reattach.Pid
+				entry.Transport = unmanaged[fqn].Reattach.Addr.Network()
+			}
+			out[fqn.String()] = entry
+		}
+		buf, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to serialize provider information: %s", err))
+			return 1
+		}
+		c.Ui.Output(string(buf))
+		c.showDiagnostics(diags)
+		if diags.HasErrors() {
+			return 1
+		}
+		return 0
+	}
+
+	annotations := make(map[addrs.Provider]string)
+	for fqn := range reqs {
+		switch {
+		case fqn.IsBuiltIn():
+			annotations[fqn] = " (built-in)"
+		case unmanaged[fqn] != nil:
+			config := unmanaged[fqn]
+			annotations[fqn] = fmt.Sprintf(" (unmanaged, reattached to PID %d via %s)", config.Reattach.Pid, reattachTransportName(config.Reattach.Addr))
+		}
+	}
+
 	printRoot := treeprint.New()
-	providersCommandPopulateTreeNode(printRoot, reqs)
+	providersCommandPopulateTreeNode(printRoot, reqs, annotations)
 
 	c.Ui.Output(printRoot.String())
 
@@ -118,13 +190,13 @@ func (c *ProvidersCommand) Run(args []string) int {
 	return 0
 }
 
-func providersCommandPopulateTreeNode(node treeprint.Tree, deps getproviders.Requirements) {
+func providersCommandPopulateTreeNode(node treeprint.Tree, deps getproviders.Requirements, annotations map[addrs.Provider]string) {
 	for fqn, dep := range deps {
 		versionsStr := getproviders.VersionConstraintsString(dep)
 		if versionsStr != "" {
 			versionsStr = " " + versionsStr
 		}
-		node.AddNode(fmt.Sprintf("provider[%s]%s", fqn.String(), versionsStr))
+		node.AddNode(fmt.Sprintf("provider[%s]%s%s", fqn.String(), versionsStr, annotations[fqn]))
 	}
 }
 
@@ -136,4 +208,14 @@ Usage: terraform providers [dir]
   This provides an overview of all of the provider requirements as an aid to
   understanding why particular provider plugins are needed and why particular
   versions are selected.
+
+Options:
+
+  -cleanup-orphans  Instead of printing the provider tree, terminate any
+                    provider processes recorded by a previous run of
+                    Terraform that crashed before shutting them down.
+
+  -json            Produce the provider requirements as a JSON object,
+                   including whether each provider is installed, built in,
+                   or reattached to an unmanaged server process.
 `
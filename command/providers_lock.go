@@ -0,0 +1,165 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// ProvidersLockCommand is a Command implementation that records provider
+// package hashes for one or more target platforms in the lock data, so that
+// the same lock data can be used on machines of different platforms.
+type ProvidersLockCommand struct {
+	Meta
+}
+
+func (c *ProvidersLockCommand) Synopsis() string {
+	return "Records provider package hashes for additional platforms"
+}
+
+func (c *ProvidersLockCommand) Run(args []string) int {
+	args = c.Meta.process(args)
+	cmdFlags := c.Meta.defaultFlagSet("providers lock")
+	var platformNames FlagStringSlice
+	var fsMirror, netMirror string
+	cmdFlags.Var(&platformNames, "platform", "target platform, as os_arch")
+	cmdFlags.StringVar(&fsMirror, "fs-mirror", "", "use a filesystem mirror directory as the package source")
+	cmdFlags.StringVar(&netMirror, "net-mirror", "", "use a network mirror URL as the package source")
+	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := cmdFlags.Parse(args); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
+		return 1
+	}
+
+	var diags tfdiags.Diagnostics
+
+	if fsMirror != "" && netMirror != "" {
+		c.Ui.Error("The -fs-mirror and -net-mirror options are mutually exclusive.")
+		return 1
+	}
+
+	platforms := make([]getproviders.Platform, 0, len(platformNames)+1)
+	if len(platformNames) == 0 {
+		platforms = append(platforms, getproviders.CurrentPlatform)
+	}
+	for _, name := range platformNames {
+		platform, err := getproviders.ParsePlatform(name)
+		if err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid target platform",
+				fmt.Sprintf("The string %q given in the -platform option is not a valid target platform: %s.", name, err),
+			))
+			continue
+		}
+		platforms = append(platforms, platform)
+	}
+	if diags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+
+	configPath, err := ModulePath(cmdFlags.Args())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	// We derive the provider requirements from the configuration alone, so
+	// that this command can run in a directory that has never been
+	// initialized. (Configurations with external module calls do still need
+	// their modules installed first.)
+	earlyConfig, confDiags := c.loadConfigEarly(configPath)
+	diags = diags.Append(confDiags)
+	if confDiags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+	reqs, reqDiags := earlyConfig.ProviderRequirements()
+	diags = diags.Append(reqDiags)
+	if reqDiags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+
+	var inst *providercache.Installer
+	switch {
+	case fsMirror != "":
+		inst = c.providerInstallerCustomSource(getproviders.NewFilesystemMirrorSource(fsMirror))
+	case netMirror != "":
+		mirrorURL, err := url.Parse(netMirror)
+		if err != nil || mirrorURL.Scheme != "https" || mirrorURL.Host == "" {
+			c.Ui.Error(fmt.Sprintf("The -net-mirror option requires an https: base URL, but got %q.", netMirror))
+			return 1
+		}
+		inst = c.providerInstallerCustomSource(getproviders.NewHTTPMirrorSource(mirrorURL))
+	default:
+		inst = c.providerInstaller()
+	}
+
+	locked, err := inst.LockPlatformHashes(context.TODO(), reqs, platforms)
+	if instErr, ok := err.(providercache.InstallerError); ok {
+		failed := make([]addrs.Provider, 0, len(instErr.ProviderErrors))
+		for provider := range instErr.ProviderErrors {
+			failed = append(failed, provider)
+		}
+		sort.Slice(failed, func(i, j int) bool {
+			return failed[i].LessThan(failed[j])
+		})
+		for _, provider := range failed {
+			c.Ui.Error(fmt.Sprintf("- %s: %s", provider.ForDisplay(), instErr.ProviderErrors[provider]))
+		}
+	} else if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to lock provider hashes: %s", err))
+		return 1
+	}
+
+	okProviders := make([]addrs.Provider, 0, len(locked))
+	for provider := range locked {
+		okProviders = append(okProviders, provider)
+	}
+	sort.Slice(okProviders, func(i, j int) bool {
+		return okProviders[i].LessThan(okProviders[j])
+	})
+	for _, provider := range okProviders {
+		c.Ui.Output(fmt.Sprintf("- Locked %s v%s (%d platforms)", provider.ForDisplay(), locked[provider], len(platforms)))
+	}
+
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+func (c *ProvidersLockCommand) Help() string {
+	return `
+Usage: terraform providers lock [options] [DIR]
+
+  Queries the configured provider installation source for each provider
+  required by the configuration and records package hashes for one or more
+  target platforms in the lock data, without installing anything into the
+  working directory.
+
+  Use this when the lock data will be shared between machines of different
+  platforms, such as when committing it on macOS and then initializing on a
+  Linux CI worker.
+
+Options:
+
+  -platform=os_arch  Record hashes for the given platform, such as
+                     linux_amd64 or darwin_amd64. May be specified multiple
+                     times; defaults to the current platform.
+
+  -fs-mirror=dir     Query the given filesystem mirror directory instead of
+                     the configured installation source.
+
+  -net-mirror=url    Query the network mirror at the given https: base URL
+                     instead of the configured installation source.
+`
+}
@@ -0,0 +1,336 @@
+package command
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/httpclient"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// ProvidersMirrorCommand is a Command implementation that downloads the
+// providers required by the current configuration into a local filesystem
+// directory laid out so that it can later serve as a filesystem mirror or
+// as the document root for a network mirror server.
+type ProvidersMirrorCommand struct {
+	Meta
+}
+
+func (c *ProvidersMirrorCommand) Synopsis() string {
+	return "Mirrors the provider plugins needed for the current configuration"
+}
+
+func (c *ProvidersMirrorCommand) Run(args []string) int {
+	args = c.Meta.process(args)
+	cmdFlags := c.Meta.defaultFlagSet("providers mirror")
+	var optPlatforms FlagStringSlice
+	cmdFlags.Var(&optPlatforms, "platform", "target platform")
+	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := cmdFlags.Parse(args); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
+		return 1
+	}
+
+	var diags tfdiags.Diagnostics
+
+	args = cmdFlags.Args()
+	if len(args) != 1 {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"No output directory specified",
+			"The providers mirror command requires an output directory as a command-line argument.",
+		))
+		c.showDiagnostics(diags)
+		return 1
+	}
+	outputDir := args[0]
+
+	// Each -platform option can be given multiple times, and omitting it
+	// entirely mirrors only for the platform where this command is running.
+	var platforms []getproviders.Platform
+	if len(optPlatforms) == 0 {
+		platforms = []getproviders.Platform{getproviders.CurrentPlatform}
+	} else {
+		platforms = make([]getproviders.Platform, 0, len(optPlatforms))
+		for _, platformStr := range optPlatforms {
+			platform, err := getproviders.ParsePlatform(platformStr)
+			if err != nil {
+				diags = diags.Append(tfdiags.Sourceless(
+					tfdiags.Error,
+					"Invalid target platform",
+					fmt.Sprintf("The string %q given in the -platform option is not a valid target platform: %s.", platformStr, err),
+				))
+				continue
+			}
+			platforms = append(platforms, platform)
+		}
+	}
+
+	earlyConfig, confDiags := c.loadConfigEarly(".")
+	diags = diags.Append(confDiags)
+	reqs, moreDiags := earlyConfig.ProviderRequirements()
+	diags = diags.Append(moreDiags)
+	if diags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+
+	source := c.providerInstallSource()
+
+	// We'll sort the providers by address so that our output and any
+	// collected errors appear in a stable order between runs.
+	providers := make([]addrs.Provider, 0, len(reqs))
+	for provider := range reqs {
+		if provider.IsBuiltIn() {
+			// Built-in providers are part of Terraform itself, so there's
+			// nothing to mirror for them.
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].String() < providers[j].String()
+	})
+
+	// A failure to mirror one platform of one provider shouldn't block the
+	// others, so we collect errors as diagnostics and report them all at
+	// the end.
+	for _, provider := range providers {
+		constraints := reqs[provider]
+
+		avail, _, err := source.AvailableVersions(provider)
+		if err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Provider not available",
+				fmt.Sprintf("Failed to determine the available versions of %s: %s.", provider, err),
+			))
+			continue
+		}
+		candidates := avail.Filter(getproviders.MeetingConstraints(constraints))
+		if len(candidates) == 0 {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Provider not available",
+				fmt.Sprintf("There is no available version of %s matching the configured version constraint %s.", provider, getproviders.VersionConstraintsString(constraints)),
+			))
+			continue
+		}
+		version := candidates.Newest()
+
+		providerDir := filepath.Join(outputDir, provider.Hostname.ForDisplay(), provider.Namespace, provider.Type)
+		if err := os.MkdirAll(providerDir, 0755); err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Cannot create mirror directory",
+				fmt.Sprintf("Failed to create the output directory for %s: %s.", provider, err),
+			))
+			continue
+		}
+
+		for _, platform := range platforms {
+			c.Ui.Output(fmt.Sprintf("- Mirroring %s v%s for %s...", provider.ForDisplay(), version, platform))
+			meta, err := source.PackageMeta(provider, version, platform)
+			if err != nil {
+				diags = diags.Append(tfdiags.Sourceless(
+					tfdiags.Error,
+					"Provider package not available",
+					fmt.Sprintf("Failed to find a %s package for %s v%s: %s.", platform, provider, version, err),
+				))
+				continue
+			}
+			filename := fmt.Sprintf("terraform-provider-%s_%s_%s.zip", provider.Type, version, platform)
+			targetFile := filepath.Join(providerDir, filename)
+			if err := fetchPackageArchive(meta.Location, targetFile); err != nil {
+				diags = diags.Append(tfdiags.Sourceless(
+					tfdiags.Error,
+					"Cannot mirror provider package",
+					fmt.Sprintf("Failed to mirror the %s package for %s v%s: %s.", platform, provider, version, err),
+				))
+				continue
+			}
+		}
+
+		// The index documents are regenerated from whatever is now in the
+		// provider directory, so that repeated runs targeting different
+		// platforms accumulate rather than replace one another and a later
+		// "providers lock" run can work from the recorded hashes without
+		// any network access.
+		if err := writeMirrorIndexes(providerDir, provider.Type); err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Cannot write mirror index files",
+				fmt.Sprintf("Failed to generate the JSON index documents for %s: %s.", provider, err),
+			))
+		}
+	}
+
+	c.showDiagnostics(diags)
+	if diags.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+// fetchPackageArchive obtains the package zip archive from the given
+// location and writes it to the given target filename.
+func fetchPackageArchive(location getproviders.PackageLocation, targetFile string) error {
+	switch location := location.(type) {
+	case getproviders.PackageHTTPURL:
+		httpClient := httpclient.New()
+		resp, err := httpClient.Get(string(location))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected response %s from %s", resp.Status, location)
+		}
+		f, err := os.Create(targetFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(f, resp.Body)
+		return err
+	case getproviders.PackageLocalArchive:
+		src, err := os.Open(string(location))
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		f, err := os.Create(targetFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(f, src)
+		return err
+	default:
+		return fmt.Errorf("source location %s is not a package archive, so it cannot be mirrored", location)
+	}
+}
+
+// writeMirrorIndexes scans the zip archives in the given provider mirror
+// directory and (re)generates the index.json and per-version JSON documents
+// defined by the provider network mirror protocol, recording a "zh:" scheme
+// hash for every archive present.
+func writeMirrorIndexes(providerDir, typeName string) error {
+	entries, err := ioutil.ReadDir(providerDir)
+	if err != nil {
+		return err
+	}
+
+	type mirrorArchive struct {
+		URL    string   `json:"url"`
+		Hashes []string `json:"hashes"`
+	}
+	// version -> platform string -> archive info
+	archives := make(map[string]map[string]mirrorArchive)
+
+	prefix := "terraform-provider-" + typeName + "_"
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".zip") {
+			continue
+		}
+		// The remainder encodes the version and platform, as in
+		// terraform-provider-null_2.0.0_linux_amd64.zip .
+		parts := strings.SplitN(strings.TrimSuffix(name[len(prefix):], ".zip"), "_", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		versionStr, platformStr := parts[0], parts[1]
+		if _, err := getproviders.ParseVersion(versionStr); err != nil {
+			continue
+		}
+		if _, err := getproviders.ParsePlatform(platformStr); err != nil {
+			continue
+		}
+
+		hash, err := zipArchiveHash(filepath.Join(providerDir, name))
+		if err != nil {
+			return err
+		}
+		if archives[versionStr] == nil {
+			archives[versionStr] = make(map[string]mirrorArchive)
+		}
+		archives[versionStr][platformStr] = mirrorArchive{
+			URL:    name,
+			Hashes: []string{hash},
+		}
+	}
+
+	type mirrorVersion struct{}
+	index := struct {
+		Versions map[string]mirrorVersion `json:"versions"`
+	}{Versions: make(map[string]mirrorVersion)}
+	for versionStr, byPlatform := range archives {
+		index.Versions[versionStr] = mirrorVersion{}
+		versionDoc := struct {
+			Archives map[string]mirrorArchive `json:"archives"`
+		}{Archives: byPlatform}
+		buf, err := json.MarshalIndent(versionDoc, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(providerDir, versionStr+".json"), append(buf, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	buf, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(providerDir, "index.json"), append(buf, '\n'), 0644)
+}
+
+// zipArchiveHash returns the "zh:" scheme hash of the given zip archive,
+// which is just a SHA-256 checksum of the archive file itself, matching the
+// checksums published by provider registries for release archives.
+func zipArchiveHash(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("zh:%x", h.Sum(nil)), nil
+}
+
+func (c *ProvidersMirrorCommand) Help() string {
+	return `
+Usage: terraform providers mirror [options] <target-dir>
+
+  Populates a local directory with the provider plugins needed for the
+  current configuration, so that the directory can later be used either as
+  a filesystem mirror or as the document root for a provider network
+  mirror server.
+
+  The command also generates the JSON index documents required by the
+  provider network mirror protocol, recording the hashes of every mirrored
+  archive. Repeated runs against the same directory accumulate packages,
+  so a mirror can be built up for several platforms over multiple runs.
+
+Options:
+
+  -platform=os_arch  Choose which target platform to build a mirror for.
+                     By default Terraform will obtain plugin packages
+                     suitable for the platform where you run this command.
+                     Use this flag multiple times to include packages for
+                     multiple target platforms.
+`
+}
@@ -0,0 +1,84 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteMirrorIndexes(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "terraform-test-mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The index generator only looks at filenames and contents, so some
+	// placeholder archives are enough to exercise it.
+	archives := []string{
+		"terraform-provider-null_2.0.0_linux_amd64.zip",
+		"terraform-provider-null_2.0.0_darwin_arm64.zip",
+		"terraform-provider-null_2.1.0_linux_amd64.zip",
+	}
+	for _, name := range archives {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files that don't follow the archive naming scheme must be ignored.
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "README"), []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeMirrorIndexes(tmpDir, "null"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	indexBuf, err := ioutil.ReadFile(filepath.Join(tmpDir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index struct {
+		Versions map[string]struct{} `json:"versions"`
+	}
+	if err := json.Unmarshal(indexBuf, &index); err != nil {
+		t.Fatalf("invalid index.json: %s", err)
+	}
+	if len(index.Versions) != 2 {
+		t.Errorf("wrong number of versions %d; want 2", len(index.Versions))
+	}
+	for _, version := range []string{"2.0.0", "2.1.0"} {
+		if _, ok := index.Versions[version]; !ok {
+			t.Errorf("index.json is missing version %s", version)
+		}
+	}
+
+	versionBuf, err := ioutil.ReadFile(filepath.Join(tmpDir, "2.0.0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versionDoc struct {
+		Archives map[string]struct {
+			URL    string   `json:"url"`
+			Hashes []string `json:"hashes"`
+		} `json:"archives"`
+	}
+	if err := json.Unmarshal(versionBuf, &versionDoc); err != nil {
+		t.Fatalf("invalid 2.0.0.json: %s", err)
+	}
+	if len(versionDoc.Archives) != 2 {
+		t.Errorf("wrong number of archives %d; want 2", len(versionDoc.Archives))
+	}
+	archive, ok := versionDoc.Archives["linux_amd64"]
+	if !ok {
+		t.Fatal("2.0.0.json is missing the linux_amd64 archive")
+	}
+	if got, want := archive.URL, "terraform-provider-null_2.0.0_linux_amd64.zip"; got != want {
+		t.Errorf("wrong archive url %q; want %q", got, want)
+	}
+	if len(archive.Hashes) != 1 || len(archive.Hashes[0]) < 4 || archive.Hashes[0][:3] != "zh:" {
+		t.Errorf("archive hashes %#v do not contain a single zh: scheme hash", archive.Hashes)
+	}
+}
@@ -0,0 +1,117 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// ProvidersPruneCommand is a Command implementation that removes provider
+// packages from the shared global plugin cache directory when they are no
+// longer referenced by any of the given configurations.
+type ProvidersPruneCommand struct {
+	Meta
+}
+
+func (c *ProvidersPruneCommand) Synopsis() string {
+	return "Removes unused provider packages from the global plugin cache"
+}
+
+func (c *ProvidersPruneCommand) Run(args []string) int {
+	args = c.Meta.process(args)
+	cmdFlags := c.Meta.defaultFlagSet("providers prune")
+	var dryRun bool
+	cmdFlags.BoolVar(&dryRun, "dry-run", false, "only report what would be removed")
+	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := cmdFlags.Parse(args); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
+		return 1
+	}
+
+	var diags tfdiags.Diagnostics
+
+	cacheDir := c.providerGlobalCacheDir()
+	if cacheDir == nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"No global plugin cache configured",
+			"The providers prune command requires a global plugin cache directory, configured either with the plugin_cache_dir CLI configuration setting or the TF_PLUGIN_CACHE_DIR environment variable.",
+		))
+		c.showDiagnostics(diags)
+		return 1
+	}
+
+	// Each argument is a configuration directory whose selected provider
+	// versions must be retained. With no arguments we consider only the
+	// configuration in the current working directory.
+	configDirs := cmdFlags.Args()
+	if len(configDirs) == 0 {
+		configDirs = []string{"."}
+	}
+
+	var keep []getproviders.Selections
+	for _, configDir := range configDirs {
+		// Note that this is the default data directory location rather than
+		// m.DataDir, because TF_DATA_DIR describes only the configuration in
+		// the current working directory and cannot apply to others.
+		lockDir := filepath.Join(configDir, DefaultDataDir, "plugins")
+		selections, err := providercache.SelectedVersions(lockDir)
+		if err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Cannot read provider selections",
+				fmt.Sprintf("Failed to read the provider selections for the configuration at %s: %s.", configDir, err),
+			))
+			c.showDiagnostics(diags)
+			return 1
+		}
+		keep = append(keep, selections)
+	}
+
+	removed, err := cacheDir.Prune(keep, dryRun)
+	for _, cached := range removed {
+		if dryRun {
+			c.Ui.Output(fmt.Sprintf("- Would remove %s v%s", cached.Provider.ForDisplay(), cached.Version))
+		} else {
+			c.Ui.Output(fmt.Sprintf("- Removed %s v%s", cached.Provider.ForDisplay(), cached.Version))
+		}
+	}
+	if err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to prune the plugin cache",
+			fmt.Sprintf("Error while removing unused packages from the global plugin cache: %s.", err),
+		))
+		c.showDiagnostics(diags)
+		return 1
+	}
+	if len(removed) == 0 {
+		c.Ui.Output("No unused provider packages found in the global plugin cache.")
+	}
+
+	return 0
+}
+
+func (c *ProvidersPruneCommand) Help() string {
+	return `
+Usage: terraform providers prune [options] [config-dir...]
+
+  Removes provider packages from the shared global plugin cache directory
+  when no given configuration's provider selections reference them any
+  longer. This keeps long-lived cache directories, such as those on build
+  agents, from growing without bound.
+
+  Each config-dir argument names a configuration whose selected provider
+  versions must be retained. With no arguments, only the configuration in
+  the current working directory is considered, so be sure to list every
+  configuration that shares the cache before pruning.
+
+Options:
+
+  -dry-run  Report the packages that would be removed without actually
+            removing anything.
+`
+}
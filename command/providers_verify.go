@@ -0,0 +1,161 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/terraform/internal/providercache"
+)
+
+// ProvidersVerifyCommand is a Command implementation that checks the
+// integrity of the provider packages in the local and global plugin cache
+// directories, without launching any of them.
+type ProvidersVerifyCommand struct {
+	Meta
+}
+
+func (c *ProvidersVerifyCommand) Synopsis() string {
+	return "Checks the integrity of cached provider packages"
+}
+
+// providersVerifyJSONEntry is the -json representation of one verification
+// result.
+type providersVerifyJSONEntry struct {
+	Provider     string `json:"provider"`
+	Version      string `json:"version"`
+	Status       string `json:"status"`
+	PackageDir   string `json:"package_dir,omitempty"`
+	ExpectedHash string `json:"expected_hash,omitempty"`
+	ActualHash   string `json:"actual_hash,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+func (c *ProvidersVerifyCommand) Run(args []string) int {
+	args = c.Meta.process(args)
+	cmdFlags := c.Meta.defaultFlagSet("providers verify")
+	var jsonOutput bool
+	cmdFlags.BoolVar(&jsonOutput, "json", false, "produce JSON output")
+	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := cmdFlags.Parse(args); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
+		return 1
+	}
+
+	corrupt := false
+
+	// The local cache directory records the hash of each package that was
+	// selected by "terraform init", so verification here means recomputing
+	// those hashes and comparing, which VerifyPackages does concurrently
+	// without consulting any installation source.
+	inst := c.providerInstaller()
+	results, err := inst.VerifyPackages()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to read the provider selections: %s", err))
+		return 1
+	}
+
+	if jsonOutput {
+		entries := make([]providersVerifyJSONEntry, len(results))
+		for idx, result := range results {
+			entries[idx] = providersVerifyJSONEntry{
+				Provider:     result.Provider.String(),
+				Version:      result.Version.String(),
+				Status:       string(result.Status),
+				PackageDir:   result.PackageDir,
+				ExpectedHash: result.ExpectedHash,
+				ActualHash:   result.ActualHash,
+				Error:        result.Error,
+			}
+			if result.Status != providercache.PackageOK {
+				corrupt = true
+			}
+		}
+		j, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to marshal verification results: %s", err))
+			return 1
+		}
+		c.Ui.Output(string(j))
+		if corrupt {
+			return 1
+		}
+		return 0
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case providercache.PackageOK:
+			c.Ui.Output(fmt.Sprintf("- %s v%s: ok", result.Provider.ForDisplay(), result.Version))
+		case providercache.PackageMissing:
+			corrupt = true
+			c.Ui.Error(fmt.Sprintf("- %s v%s: missing: %s", result.Provider.ForDisplay(), result.Version, result.Error))
+		default:
+			corrupt = true
+			c.Ui.Error(fmt.Sprintf("- %s v%s: modified: %s\n    package:  %s\n    expected: %s\n    actual:   %s", result.Provider.ForDisplay(), result.Version, result.Error, result.PackageDir, result.ExpectedHash, result.ActualHash))
+		}
+	}
+
+	// The global cache has no recorded hashes of its own, so the checks
+	// there are that each package still has its executable and that its
+	// contents are readable enough to hash, which catches truncated or
+	// permission-damaged packages left by interrupted writes.
+	if globalDir := c.providerGlobalCacheDir(); globalDir != nil {
+		selected := make(map[string]providercache.PackageVerification, len(results))
+		for _, result := range results {
+			selected[result.Provider.String()+" "+result.Version.String()] = result
+		}
+		for provider, entries := range globalDir.AllAvailablePackages() {
+			for idx := range entries {
+				cached := &entries[idx]
+				if _, err := os.Stat(cached.ExecutableFile); err != nil {
+					corrupt = true
+					c.Ui.Error(fmt.Sprintf("- %s v%s (global cache): missing executable: %s", provider.ForDisplay(), cached.Version, err))
+					continue
+				}
+				hash, err := cached.Hash()
+				if err != nil {
+					corrupt = true
+					c.Ui.Error(fmt.Sprintf("- %s v%s (global cache): cannot hash package: %s", provider.ForDisplay(), cached.Version, err))
+					continue
+				}
+				// When the local selections include the same version, the
+				// two copies must agree; a disagreement means one of them
+				// was modified after installation.
+				if local, exists := selected[provider.String()+" "+cached.Version.String()]; exists && local.ActualHash != "" && local.ActualHash != hash {
+					corrupt = true
+					c.Ui.Error(fmt.Sprintf("- %s v%s (global cache): hash %s does not match the local cache copy %s", provider.ForDisplay(), cached.Version, hash, local.ActualHash))
+					continue
+				}
+				c.Ui.Output(fmt.Sprintf("- %s v%s (global cache): ok", provider.ForDisplay(), cached.Version))
+			}
+		}
+	}
+
+	if corrupt {
+		c.Ui.Error("\nCorrupt provider packages were found. Run \"terraform init\" to reinstall them, or remove the affected cache entries by hand.")
+		return 1
+	}
+	return 0
+}
+
+func (c *ProvidersVerifyCommand) Help() string {
+	return `
+Usage: terraform providers verify [options]
+
+  Checks the provider packages in the local cache directory against the
+  checksums recorded when they were installed, and checks that packages in
+  the global plugin cache (if configured) are complete and readable. No
+  provider processes are launched and no network requests are made.
+
+  The command exits with a non-zero status if any package is corrupt, so
+  it can be used as a gate in CI before running operations that would
+  otherwise fail confusingly partway through.
+
+Options:
+
+  -json  Report the local cache verification results as a JSON array, with
+         the expected and actual hash and the package path for each
+         provider.
+`
+}
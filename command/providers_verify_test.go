@@ -0,0 +1,110 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/internal/providercache"
+)
+
+func TestProvidersVerify(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "terraform-test-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dataDir := filepath.Join(tmpDir, ".terraform")
+	platform := getproviders.CurrentPlatform
+	pkgDir := filepath.Join(dataDir, "plugins", "registry.terraform.io", "hashicorp", "null", "2.0.0", platform.String())
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	exePath := filepath.Join(pkgDir, "terraform-provider-null")
+	if err := ioutil.WriteFile(exePath, []byte("executable"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cached := &providercache.CachedProvider{
+		Provider:       addrs.NewDefaultProvider("null"),
+		Version:        getproviders.MustParseVersion("2.0.0"),
+		PackageDir:     pkgDir,
+		ExecutableFile: exePath,
+	}
+	hash, err := cached.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockContent := `{"registry.terraform.io/hashicorp/null": {"version": "2.0.0", "hash": "` + hash + `"}}`
+	if err := ioutil.WriteFile(filepath.Join(dataDir, "plugins", "selections.json"), []byte(lockContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newCommand := func() (*ProvidersVerifyCommand, *cli.MockUi) {
+		ui := cli.NewMockUi()
+		c := &ProvidersVerifyCommand{
+			Meta: Meta{
+				Ui:              ui,
+				OverrideDataDir: dataDir,
+			},
+		}
+		return c, ui
+	}
+
+	// With an intact package the command succeeds and reports it as ok.
+	c, ui := newCommand()
+	if code := c.Run(nil); code != 0 {
+		t.Fatalf("wrong exit code %d; want 0\nstderr:\n%s", code, ui.ErrorWriter.String())
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "hashicorp/null v2.0.0: ok") {
+		t.Errorf("output does not report the package as ok:\n%s", ui.OutputWriter.String())
+	}
+
+	// Corrupting the executable must be detected and fail the command.
+	if err := ioutil.WriteFile(exePath, []byte("tampered"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c, ui = newCommand()
+	if code := c.Run(nil); code != 1 {
+		t.Fatalf("wrong exit code %d after corruption; want 1", code)
+	}
+	for _, want := range []string{"modified", "expected: " + hash, pkgDir} {
+		if !strings.Contains(ui.ErrorWriter.String(), want) {
+			t.Errorf("error output missing %q:\n%s", want, ui.ErrorWriter.String())
+		}
+	}
+
+	// The -json variant reports the same discrepancy in a structured way.
+	c, ui = newCommand()
+	if code := c.Run([]string{"-json"}); code != 1 {
+		t.Fatalf("wrong exit code %d for -json after corruption; want 1", code)
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(ui.OutputWriter.Bytes(), &entries); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, ui.OutputWriter.String())
+	}
+	if len(entries) != 1 {
+		t.Fatalf("wrong number of JSON entries %d; want 1", len(entries))
+	}
+	entry := entries[0]
+	if got, want := entry["status"], "modified"; got != want {
+		t.Errorf("wrong status %q; want %q", got, want)
+	}
+	if got, want := entry["expected_hash"], hash; got != want {
+		t.Errorf("wrong expected_hash %q; want %q", got, want)
+	}
+	if got, want := entry["package_dir"], pkgDir; got != want {
+		t.Errorf("wrong package_dir %q; want %q", got, want)
+	}
+	if entry["actual_hash"] == hash || entry["actual_hash"] == "" {
+		t.Errorf("actual_hash %q should differ from the recorded hash", entry["actual_hash"])
+	}
+}
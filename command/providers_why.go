@@ -0,0 +1,337 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/earlyconfig"
+	"github.com/hashicorp/terraform/internal/getproviders"
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+// ProvidersWhyCommand is a Command implementation that explains how the
+// version selection for one provider would be decided: which modules
+// constrain it, what each configured installation source offers, and what
+// the lock data already records.
+type ProvidersWhyCommand struct {
+	Meta
+}
+
+func (c *ProvidersWhyCommand) Synopsis() string {
+	return "Explains the version selection for one provider"
+}
+
+// providerWhyReport is the result of the analysis, which is either rendered
+// as human-oriented text or marshalled directly for the -json variant.
+type providerWhyReport struct {
+	Provider string `json:"provider"`
+
+	// Kind is "registry" for normally-installed providers, or "builtin" or
+	// "unmanaged" for providers that are not installed at all, in which
+	// case Reason says why.
+	Kind   string `json:"kind"`
+	Reason string `json:"reason,omitempty"`
+
+	ModuleConstraints   []providerWhyModuleConstraint `json:"module_constraints,omitempty"`
+	CombinedConstraints string                        `json:"combined_constraints,omitempty"`
+	LockedVersion       string                        `json:"locked_version,omitempty"`
+	Sources             []providerWhySource           `json:"sources,omitempty"`
+	SelectedVersion     string                        `json:"selected_version,omitempty"`
+	SelectionReason     string                        `json:"selection_reason,omitempty"`
+}
+
+type providerWhyModuleConstraint struct {
+	Module      string `json:"module"`
+	Constraints string `json:"constraints"`
+}
+
+type providerWhySource struct {
+	Source string `json:"source"`
+
+	// Excluded is true when this source's include/exclude patterns prevent
+	// it from handling the provider at all, in which case no versions were
+	// queried from it.
+	Excluded bool     `json:"excluded,omitempty"`
+	Versions []string `json:"versions,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (c *ProvidersWhyCommand) Run(args []string) int {
+	args = c.Meta.process(args)
+	cmdFlags := c.Meta.defaultFlagSet("providers why")
+	var jsonOutput bool
+	cmdFlags.BoolVar(&jsonOutput, "json", false, "produce JSON output")
+	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := cmdFlags.Parse(args); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
+		return 1
+	}
+	args = cmdFlags.Args()
+	if len(args) != 1 {
+		c.Ui.Error("The providers why command expects exactly one argument: a provider source address.")
+		cmdFlags.Usage()
+		return 1
+	}
+
+	provider, providerDiags := addrs.ParseProviderSourceString(args[0])
+	if providerDiags.HasErrors() {
+		c.showDiagnostics(providerDiags)
+		return 1
+	}
+
+	var diags tfdiags.Diagnostics
+	earlyConfig, confDiags := c.loadConfigEarly(".")
+	diags = diags.Append(confDiags)
+	if confDiags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+	reqs, reqDiags := earlyConfig.ProviderRequirements()
+	diags = diags.Append(reqDiags)
+	if reqDiags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+
+	report := c.buildProviderWhyReport(provider, earlyConfig, reqs)
+
+	if jsonOutput {
+		j, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to marshal explanation: %s", err))
+			return 1
+		}
+		c.Ui.Output(string(j))
+	} else {
+		c.renderProviderWhyReport(report)
+	}
+
+	c.showDiagnostics(diags)
+	return 0
+}
+
+func (c *ProvidersWhyCommand) buildProviderWhyReport(provider addrs.Provider, earlyConfig *earlyconfig.Config, reqs getproviders.Requirements) *providerWhyReport {
+	report := &providerWhyReport{
+		Provider: provider.String(),
+		Kind:     "registry",
+	}
+
+	// Built-in and unmanaged providers never reach the installer, so the
+	// explanation for them is simply why no installation occurs.
+	if provider.IsBuiltIn() {
+		report.Kind = "builtin"
+		report.Reason = "this provider is built in to Terraform, so no installation occurs and version constraints are not supported"
+		return report
+	}
+	if config, exists := c.unmanagedProviders()[provider]; exists {
+		report.Kind = "unmanaged"
+		report.Reason = fmt.Sprintf("this provider is satisfied by an unmanaged server process (pid %d) configured via TF_PROVIDER_REATTACH, so no installation occurs and version constraints are ignored", config.Reattach.Pid)
+		return report
+	}
+
+	report.ModuleConstraints = moduleConstraintsForProvider(earlyConfig, provider)
+	combined := reqs[provider]
+	report.CombinedConstraints = getproviders.VersionConstraintsString(combined)
+	acceptable := getproviders.MeetingConstraints(combined)
+
+	if selections, err := c.providerInstaller().SelectedVersions(); err == nil {
+		if locked, exists := selections[provider]; exists {
+			report.LockedVersion = locked.String()
+		}
+	}
+
+	// We consult each of the configured installation sources separately so
+	// that we can show which source offered (or was excluded from
+	// offering) each candidate.
+	source := c.providerInstallSource()
+	selectors, ok := source.(getproviders.MultiSource)
+	if !ok {
+		selectors = getproviders.MultiSource{{Source: source}}
+	}
+	var newest getproviders.Version
+	var haveNewest bool
+	for _, selector := range selectors {
+		entry := providerWhySource{
+			Source: providerSourceDisplayName(selector.Source),
+		}
+		if !selector.CanHandleProvider(provider) {
+			entry.Excluded = true
+			report.Sources = append(report.Sources, entry)
+			continue
+		}
+		available, _, err := selector.Source.AvailableVersions(provider)
+		if err != nil {
+			entry.Error = err.Error()
+			report.Sources = append(report.Sources, entry)
+			continue
+		}
+		available.Sort()
+		for _, version := range available {
+			desc := version.String()
+			switch {
+			case !acceptable.Has(version):
+				desc += " (rejected: does not match the combined constraints)"
+			default:
+				if _, err := selector.Source.PackageMeta(provider, version, getproviders.CurrentPlatform); err != nil {
+					if _, ok := err.(getproviders.ErrPlatformNotSupported); ok {
+						desc += fmt.Sprintf(" (rejected: no package for %s)", getproviders.CurrentPlatform)
+						entry.Versions = append(entry.Versions, desc)
+						continue
+					}
+				}
+				if !haveNewest || version.GreaterThan(newest) {
+					newest = version
+					haveNewest = true
+				}
+			}
+			entry.Versions = append(entry.Versions, desc)
+		}
+		report.Sources = append(report.Sources, entry)
+	}
+
+	switch {
+	case report.LockedVersion != "" && acceptable.Has(getproviders.MustParseVersion(report.LockedVersion)):
+		report.SelectedVersion = report.LockedVersion
+		report.SelectionReason = "the lock data records this version and it still matches the combined constraints, so init keeps it unless -upgrade is used"
+	case haveNewest:
+		report.SelectedVersion = newest.String()
+		report.SelectionReason = "newest version matching the combined constraints that has a package for the current platform"
+	default:
+		report.SelectionReason = "no available version matches the combined constraints"
+	}
+
+	return report
+}
+
+// moduleConstraintsForProvider walks the module tree collecting the version
+// constraints each module declares for the given provider.
+func moduleConstraintsForProvider(config *earlyconfig.Config, provider addrs.Provider) []providerWhyModuleConstraint {
+	var ret []providerWhyModuleConstraint
+	var walk func(*earlyconfig.Config)
+	walk = func(node *earlyconfig.Config) {
+		for localName, providerReqs := range node.Module.RequiredProviders {
+			var fqn addrs.Provider
+			if source := providerReqs.Source; source != "" {
+				addr, diags := addrs.ParseProviderSourceString(source)
+				if diags.HasErrors() {
+					continue
+				}
+				fqn = addr
+			}
+			if fqn.IsZero() {
+				fqn = addrs.ImpliedProviderForUnqualifiedType(localName)
+			}
+			if fqn != provider {
+				continue
+			}
+			moduleName := "(root)"
+			if len(node.Path) > 0 {
+				moduleName = node.Path.String()
+			}
+			constraints := strings.Join(providerReqs.VersionConstraints, ", ")
+			if constraints == "" {
+				constraints = "(any version)"
+			}
+			ret = append(ret, providerWhyModuleConstraint{
+				Module:      moduleName,
+				Constraints: constraints,
+			})
+		}
+		childNames := make([]string, 0, len(node.Children))
+		for name := range node.Children {
+			childNames = append(childNames, name)
+		}
+		sort.Strings(childNames)
+		for _, name := range childNames {
+			walk(node.Children[name])
+		}
+	}
+	walk(config)
+	return ret
+}
+
+// providerSourceDisplayName names an installation source for the report in
+// the same vocabulary as the provider_installation CLI config block.
+func providerSourceDisplayName(source getproviders.Source) string {
+	switch source := source.(type) {
+	case *getproviders.MemoizeSource:
+		return providerSourceDisplayName(source.Underlying())
+	case *getproviders.RegistrySource:
+		return "direct registry"
+	case *getproviders.FilesystemMirrorSource:
+		return "filesystem mirror"
+	case *getproviders.HTTPMirrorSource:
+		return "network mirror"
+	case *getproviders.OCISource:
+		return "OCI mirror"
+	case *getproviders.S3MirrorSource:
+		return "S3 mirror"
+	default:
+		return fmt.Sprintf("%T", source)
+	}
+}
+
+func (c *ProvidersWhyCommand) renderProviderWhyReport(report *providerWhyReport) {
+	c.Ui.Output(fmt.Sprintf("Provider %s:", report.Provider))
+	if report.Reason != "" {
+		c.Ui.Output(fmt.Sprintf("  %s.", report.Reason))
+		return
+	}
+
+	if len(report.ModuleConstraints) > 0 {
+		c.Ui.Output("  Constraints:")
+		for _, mc := range report.ModuleConstraints {
+			c.Ui.Output(fmt.Sprintf("    %s: %s", mc.Module, mc.Constraints))
+		}
+	} else {
+		c.Ui.Output("  No module declares version constraints for this provider.")
+	}
+	if report.CombinedConstraints != "" {
+		c.Ui.Output(fmt.Sprintf("  Combined constraints: %s", report.CombinedConstraints))
+	}
+	if report.LockedVersion != "" {
+		c.Ui.Output(fmt.Sprintf("  Lock data records version: %s", report.LockedVersion))
+	}
+
+	c.Ui.Output("  Sources:")
+	for _, src := range report.Sources {
+		switch {
+		case src.Excluded:
+			c.Ui.Output(fmt.Sprintf("    - %s: excluded by its include/exclude patterns", src.Source))
+		case src.Error != "":
+			c.Ui.Output(fmt.Sprintf("    - %s: error: %s", src.Source, src.Error))
+		case len(src.Versions) == 0:
+			c.Ui.Output(fmt.Sprintf("    - %s: no versions available", src.Source))
+		default:
+			c.Ui.Output(fmt.Sprintf("    - %s:", src.Source))
+			for _, version := range src.Versions {
+				c.Ui.Output(fmt.Sprintf("        %s", version))
+			}
+		}
+	}
+
+	if report.SelectedVersion != "" {
+		c.Ui.Output(fmt.Sprintf("  Selection: %s — %s.", report.SelectedVersion, report.SelectionReason))
+	} else {
+		c.Ui.Output(fmt.Sprintf("  Selection: none — %s.", report.SelectionReason))
+	}
+}
+
+func (c *ProvidersWhyCommand) Help() string {
+	return `
+Usage: terraform providers why [options] PROVIDER
+
+  Explains how the version selection for the given provider would be
+  decided: which modules constrain it, the combined constraints, the
+  candidate versions offered by each configured installation source, and
+  what the lock data already records. For built-in and unmanaged providers
+  it explains why no installation occurs.
+
+Options:
+
+  -json  Produce the explanation in a machine-readable JSON format.
+`
+}
@@ -0,0 +1,90 @@
+package command
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+func TestProvidersWhy(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(testFixturePath("providers-why")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+
+	provider := addrs.MustParseProviderSourceString("example.com/test/happycloud")
+	mock := getproviders.NewMockSource([]getproviders.PackageMeta{
+		getproviders.FakePackageMeta(provider, getproviders.MustParseVersion("1.0.0"), nil, getproviders.CurrentPlatform),
+		getproviders.FakePackageMeta(provider, getproviders.MustParseVersion("1.2.0"), nil, getproviders.CurrentPlatform),
+		getproviders.FakePackageMeta(provider, getproviders.MustParseVersion("2.0.0"), nil, getproviders.CurrentPlatform),
+	})
+	exclude, err := getproviders.ParseMultiSourceMatchingPatterns([]string{"example.com/*/*"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	source := getproviders.MultiSource{
+		{Source: mock},
+		{Source: getproviders.NewMockSource(nil), Exclude: exclude},
+	}
+
+	ui := new(cli.MockUi)
+	c := &ProvidersWhyCommand{
+		Meta: Meta{
+			Ui:             ui,
+			ProviderSource: source,
+		},
+	}
+
+	if code := c.Run([]string{"example.com/test/happycloud"}); code != 0 {
+		t.Fatalf("bad exit code: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	output := ui.OutputWriter.String()
+	wantOutput := []string{
+		"Provider example.com/test/happycloud:",
+		"(root): >= 1.0.0, < 2.0.0",
+		"Combined constraints: >= 1.0.0, < 2.0.0",
+		"2.0.0 (rejected: does not match the combined constraints)",
+		"excluded by its include/exclude patterns",
+		"Selection: 1.2.0",
+	}
+	for _, want := range wantOutput {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestProvidersWhy_builtin(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(testFixturePath("providers-why")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(cwd)
+
+	ui := new(cli.MockUi)
+	c := &ProvidersWhyCommand{
+		Meta: Meta{
+			Ui: ui,
+		},
+	}
+
+	if code := c.Run([]string{"terraform.io/builtin/terraform"}); code != 0 {
+		t.Fatalf("bad exit code: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if output := ui.OutputWriter.String(); !strings.Contains(output, "built in to Terraform") {
+		t.Errorf("output missing built-in explanation:\n%s", output)
+	}
+}
@@ -0,0 +1,15 @@
+// +build !windows
+
+package command
+
+import (
+	"fmt"
+	"net"
+)
+
+// resolvePipeAddr produces a net.Addr for a "pipe" address in reattach
+// configuration. Named pipes are a Windows-only transport, so on all other
+// platforms this always fails.
+func resolvePipeAddr(path string) (net.Addr, error) {
+	return nil, fmt.Errorf("named pipes are only supported on Windows")
+}
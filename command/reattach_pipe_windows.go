@@ -0,0 +1,21 @@
+package command
+
+import (
+	"net"
+)
+
+// pipeAddr is a net.Addr representing a Windows named pipe, using the
+// "pipe" network name that go-winio-based dialers understand.
+type pipeAddr struct {
+	path string
+}
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return a.path }
+
+// resolvePipeAddr produces a net.Addr for a "pipe" address in reattach
+// configuration, referring to a named pipe path such as
+// \\.\pipe\terraform-provider-example.
+func resolvePipeAddr(path string) (net.Addr, error) {
+	return pipeAddr{path: path}, nil
+}
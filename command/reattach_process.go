@@ -0,0 +1,21 @@
+// +build !windows
+
+package command
+
+import (
+	"os"
+	"syscall"
+)
+
+// processAlive returns nil if a process with the given pid currently exists,
+// or a non-nil error describing why it was determined not to.
+//
+// On Unix systems os.FindProcess always succeeds regardless of whether the
+// process exists, so we confirm liveness by sending the process signal zero.
+func processAlive(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.Signal(0))
+}
@@ -0,0 +1,19 @@
+package command
+
+import (
+	"os"
+)
+
+// processAlive returns nil if a process with the given pid currently exists,
+// or a non-nil error describing why it was determined not to.
+//
+// On Windows os.FindProcess opens a handle to the process, so it fails
+// directly if no such process exists.
+func processAlive(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	p.Release()
+	return nil
+}
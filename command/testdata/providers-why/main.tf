@@ -0,0 +1,8 @@
+terraform {
+  required_providers {
+    happycloud = {
+      source  = "example.com/test/happycloud"
+      version = ">= 1.0.0, < 2.0.0"
+    }
+  }
+}
@@ -38,7 +38,7 @@ const (
 	OutputPrefix = "o:"
 )
 
-func initCommands(config *cliconfig.Config, services *disco.Disco, providerSrc getproviders.Source) {
+func initCommands(config *cliconfig.Config, services *disco.Disco, providerSrc getproviders.Source, signingPolicy *getproviders.MirrorSigningPolicy) {
 	var inAutomation bool
 	if v := os.Getenv(runningInAutomationEnvName); v != "" {
 		inAutomation = true
@@ -67,14 +67,19 @@ func initCommands(config *cliconfig.Config, services *disco.Disco, providerSrc g
 		PluginOverrides:  &PluginOverrides,
 		Ui:               Ui,
 
-		Services:        services,
-		ProviderSource:  providerSrc,
-		BrowserLauncher: webbrowser.NewNativeLauncher(),
+		Services:              services,
+		ProviderSource:        providerSrc,
+		ProviderSigningPolicy: signingPolicy,
+		BrowserLauncher:       webbrowser.NewNativeLauncher(),
 
-		RunningInAutomation: inAutomation,
-		CLIConfigDir:        configDir,
-		PluginCacheDir:      config.PluginCacheDir,
-		OverrideDataDir:     dataDir,
+		RunningInAutomation:       inAutomation,
+		CLIConfigDir:              configDir,
+		PluginCacheDir:            config.PluginCacheDir,
+		PluginCacheMaxSizeMB:      config.PluginCacheMaxSizeMB,
+		PluginCacheMaxAgeDays:     config.PluginCacheMaxAgeDays,
+		ProviderCacheDirOverrides: config.ProviderCacheDirOverrides,
+		ProviderDevOverrides:      config.ProviderDevOverrides,
+		OverrideDataDir:           dataDir,
 
 		ShutdownCh: makeShutdownCh(),
 	}
@@ -215,6 +220,36 @@ func initCommands(config *cliconfig.Config, services *disco.Disco, providerSrc g
 			}, nil
 		},
 
+		"providers mirror": func() (cli.Command, error) {
+			return &command.ProvidersMirrorCommand{
+				Meta: meta,
+			}, nil
+		},
+
+		"providers prune": func() (cli.Command, error) {
+			return &command.ProvidersPruneCommand{
+				Meta: meta,
+			}, nil
+		},
+
+		"providers lock": func() (cli.Command, error) {
+			return &command.ProvidersLockCommand{
+				Meta: meta,
+			}, nil
+		},
+
+		"providers verify": func() (cli.Command, error) {
+			return &command.ProvidersVerifyCommand{
+				Meta: meta,
+			}, nil
+		},
+
+		"providers why": func() (cli.Command, error) {
+			return &command.ProvidersWhyCommand{
+				Meta: meta,
+			}, nil
+		},
+
 		"providers schema": func() (cli.Command, error) {
 			return &command.ProvidersSchemaCommand{
 				Meta: meta,
@@ -139,3 +139,10 @@ require (
 )
 
 go 1.14
+
+// go-plugin is carried as an in-tree fork that adds
+// ClientConfig.SkipHostEnv, which the provider launch path uses to stop a
+// filtered provider environment from being re-joined with the full host
+// environment. The fork lives in the main repository so that
+// "go mod vendor" preserves the change.
+replace github.com/hashicorp/go-plugin => ./internal/go-plugin
@@ -16,3 +16,15 @@ func New() *http.Client {
 	}
 	return cli
 }
+
+// NewWithTransport is like New but uses the given transport instead of the
+// cleanhttp default, for callers that need to customize TLS or proxy
+// behavior while still sending the Terraform User-Agent string.
+func NewWithTransport(inner http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: &userAgentRoundTripper{
+			userAgent: UserAgentString(),
+			inner:     inner,
+		},
+	}
+}
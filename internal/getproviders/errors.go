@@ -87,14 +87,23 @@ func (err ErrUnauthorized) Error() string {
 // user.
 type ErrProviderNotKnown struct {
 	Provider addrs.Provider
+
+	// MirrorHint is an optional extra sentence describing what a mirror
+	// source actually found at the location where it expected to find the
+	// provider, to help users spot misplaced or misnamed directories.
+	MirrorHint string
 }
 
 func (err ErrProviderNotKnown) Error() string {
-	return fmt.Sprintf(
+	msg := fmt.Sprintf(
 		"provider registry %s does not have a provider named %s",
 		err.Provider.Hostname.ForDisplay(),
 		err.Provider,
 	)
+	if err.MirrorHint != "" {
+		msg += "; " + err.MirrorHint
+	}
+	return msg
 }
 
 // ErrPlatformNotSupported is an error type used to indicate that a particular
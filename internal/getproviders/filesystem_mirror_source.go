@@ -1,6 +1,14 @@
 package getproviders
 
 import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
 	"github.com/hashicorp/terraform/addrs"
 )
 
@@ -9,6 +17,11 @@ import (
 type FilesystemMirrorSource struct {
 	baseDir string
 
+	// signingPolicy, when non-nil, makes PackageMeta attach signature
+	// verification against the mirror's detached SHA256SUMS documents to
+	// the packages it returns.
+	signingPolicy *MirrorSigningPolicy
+
 	// allPackages caches the result of scanning the baseDir for all available
 	// packages on the first call that needs package availability information,
 	// to avoid re-scanning the filesystem on subsequent operations.
@@ -25,14 +38,38 @@ func NewFilesystemMirrorSource(baseDir string) *FilesystemMirrorSource {
 	}
 }
 
+// BaseDir returns the base directory that this source reads packages from,
+// as passed to NewFilesystemMirrorSource.
+func (s *FilesystemMirrorSource) BaseDir() string {
+	return s.baseDir
+}
+
+// SetSigningPolicy tells the source to verify packages against the detached
+// SHA256SUMS and SHA256SUMS.sig documents the mirror ships alongside them,
+// using the trusted keys in the given policy.
+func (s *FilesystemMirrorSource) SetSigningPolicy(policy *MirrorSigningPolicy) {
+	s.signingPolicy = policy
+}
+
 // AvailableVersions scans the directory structure under the source's base
 // directory for locally-mirrored packages for the given provider, returning
 // a list of version numbers for the providers it found.
-func (s *FilesystemMirrorSource) AvailableVersions(provider addrs.Provider) (VersionList, error) {
+func (s *FilesystemMirrorSource) AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error) {
 	// s.allPackages is populated if scanAllVersions succeeds
 	err := s.scanAllVersions()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if len(s.allPackages[provider]) == 0 {
+		// Rather than just reporting the provider as unavailable we'll
+		// describe what is actually present at the expected location, since
+		// a misnamed directory level is the most common cause of a mirror
+		// unexpectedly finding nothing.
+		return nil, nil, ErrProviderNotKnown{
+			Provider:   provider,
+			MirrorHint: s.mirrorContentsHint(provider),
+		}
 	}
 
 	// There might be multiple packages for a given version in the filesystem,
@@ -47,7 +84,7 @@ func (s *FilesystemMirrorSource) AvailableVersions(provider addrs.Provider) (Ver
 		ret = append(ret, v)
 	}
 	ret.Sort()
-	return ret, nil
+	return ret, nil, nil
 }
 
 // PackageMeta checks to see if the source's base directory contains a
@@ -78,9 +115,62 @@ func (s *FilesystemMirrorSource) PackageMeta(provider addrs.Provider, version Ve
 
 	// It's possible that there could be multiple copies of the same package
 	// available in the filesystem, if e.g. there's both a packed and an
-	// unpacked variant. For now we assume that the decision between them
-	// is arbitrary and just take the first one in the result.
-	return relevantPkgs[0], nil
+	// unpacked variant. We prefer the unpacked variant because installing
+	// from it is just a link or copy, with no extraction step. Signature
+	// verification needs the packed archive though, so a signing policy
+	// reverses that preference.
+	preferPacked := s.signingPolicy != nil
+	ret := relevantPkgs[0]
+	for _, pkg := range relevantPkgs {
+		if _, ok := pkg.Location.(PackageLocalDir); ok != preferPacked {
+			ret = pkg
+			break
+		}
+	}
+	if s.signingPolicy != nil {
+		return s.authenticatedPackage(provider, ret)
+	}
+	return ret, nil
+}
+
+// authenticatedPackage attaches signature verification to the given package
+// according to the source's signing policy, reading the mirror's checksums
+// document and detached signature from the directory holding the package.
+func (s *FilesystemMirrorSource) authenticatedPackage(provider addrs.Provider, pkg PackageMeta) (PackageMeta, error) {
+	archiveLocation, ok := pkg.Location.(PackageLocalArchive)
+	if !ok {
+		// Only a packed archive can be checked against a checksums
+		// document, so an unpacked directory can't satisfy a policy that
+		// requires signatures.
+		if s.signingPolicy.RequireSignatures {
+			return PackageMeta{}, fmt.Errorf("the mirror has only an unpacked copy of %s v%s, whose signature cannot be verified; the CLI configuration requires signed mirror packages", provider.ForDisplay(), pkg.Version.String())
+		}
+		log.Printf("[WARN] The mirror package for %s v%s is unpacked, so its authenticity cannot be verified.", provider.ForDisplay(), pkg.Version.String())
+		return pkg, nil
+	}
+
+	dir := filepath.Dir(string(archiveLocation))
+	document := readFileIfExists(filepath.Join(dir, mirrorSumsFilename))
+	signature := readFileIfExists(filepath.Join(dir, mirrorSumsSignatureFilename))
+	auth, warning, err := s.signingPolicy.AuthenticationForPackage(provider, filepath.Base(string(archiveLocation)), document, signature)
+	if err != nil {
+		return PackageMeta{}, err
+	}
+	if warning != "" {
+		log.Printf("[WARN] %s", warning)
+	}
+	pkg.Authentication = auth
+	return pkg, nil
+}
+
+// readFileIfExists returns the content of the named file, or nil if the
+// file doesn't exist or can't be read.
+func readFileIfExists(filename string) []byte {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	return content
 }
 
 // AllAvailablePackages scans the directory structure under the source's base
@@ -98,6 +188,40 @@ func (s *FilesystemMirrorSource) AllAvailablePackages() (map[addrs.Provider]Pack
 	return s.allPackages, err
 }
 
+// mirrorContentsHint describes what actually exists at the deepest level of
+// the hostname/namespace/type directory chain where the given provider was
+// expected, for inclusion in a "provider not known" error. Path segments
+// are normalized during scanning, so a name listed here that looks right
+// but uses different letter casing is still worth reporting: it may be
+// masking the expected entry on a case-insensitive filesystem.
+func (s *FilesystemMirrorSource) mirrorContentsHint(provider addrs.Provider) string {
+	dir := s.baseDir
+	for _, segment := range []string{provider.Hostname.ForDisplay(), provider.Namespace, provider.Type} {
+		next := filepath.Join(dir, segment)
+		info, err := os.Stat(next)
+		if err != nil || !info.IsDir() {
+			entries, err := ioutil.ReadDir(dir)
+			if err != nil {
+				return fmt.Sprintf("the mirror directory %s could not be read: %s", dir, err)
+			}
+			if len(entries) == 0 {
+				return fmt.Sprintf("the mirror directory %s has no %q entry, and contains nothing else", dir, segment)
+			}
+			names := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			sort.Strings(names)
+			return fmt.Sprintf("the mirror directory %s has no %q entry; it contains: %s", dir, segment, strings.Join(names, ", "))
+		}
+		dir = next
+	}
+	// All three levels exist but the scan found no valid packages, so
+	// whatever is in the type directory doesn't match either supported
+	// layout.
+	return fmt.Sprintf("the mirror directory %s exists but contains no valid packed (.zip) or unpacked (version/platform) provider packages", dir)
+}
+
 func (s *FilesystemMirrorSource) scanAllVersions() error {
 	if s.allPackages != nil {
 		// we're distinguishing nil-ness from emptiness here so we can
@@ -1,6 +1,7 @@
 package getproviders
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/apparentlymart/go-versions/versions"
@@ -104,7 +105,7 @@ func TestFilesystemMirrorSourceAllAvailablePackages_invalid(t *testing.T) {
 
 func TestFilesystemMirrorSourceAvailableVersions(t *testing.T) {
 	source := NewFilesystemMirrorSource("testdata/filesystem-mirror")
-	got, err := source.AvailableVersions(nullProvider)
+	got, _, err := source.AvailableVersions(nullProvider)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -119,6 +120,28 @@ func TestFilesystemMirrorSourceAvailableVersions(t *testing.T) {
 	}
 }
 
+func TestFilesystemMirrorSourceAvailableVersions_notFound(t *testing.T) {
+	source := NewFilesystemMirrorSource("testdata/filesystem-mirror")
+	_, _, err := source.AvailableVersions(addrs.Provider{
+		Hostname:  svchost.Hostname("registry.terraform.io"),
+		Namespace: "hashicorp",
+		Type:      "nonexist",
+	})
+	if err == nil {
+		t.Fatalf("succeeded; want error")
+	}
+	if _, ok := err.(ErrProviderNotKnown); !ok {
+		t.Fatalf("wrong error type %T; want ErrProviderNotKnown", err)
+	}
+	// The error must describe what actually exists at the expected
+	// location, so a misnamed directory is easy to spot.
+	for _, want := range []string{`no "nonexist" entry`, "null", "random"} {
+		if got := err.Error(); !strings.Contains(got, want) {
+			t.Errorf("error message missing %q: %s", want, got)
+		}
+	}
+}
+
 func TestFilesystemMirrorSourcePackageMeta(t *testing.T) {
 	t.Run("available platform", func(t *testing.T) {
 		source := NewFilesystemMirrorSource("testdata/filesystem-mirror")
@@ -141,6 +164,19 @@ func TestFilesystemMirrorSourcePackageMeta(t *testing.T) {
 			t.Errorf("incorrect result\n%s", diff)
 		}
 	})
+	t.Run("both layouts prefers unpacked", func(t *testing.T) {
+		source := NewFilesystemMirrorSource("testdata/filesystem-mirror-both")
+		got, err := source.PackageMeta(
+			nullProvider, versions.MustParseVersion("2.0.0"), Platform{"linux", "amd64"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := PackageLocalDir("testdata/filesystem-mirror-both/registry.terraform.io/hashicorp/null/2.0.0/linux_amd64")
+		if diff := cmp.Diff(PackageLocation(want), got.Location); diff != "" {
+			t.Errorf("incorrect location\n%s", diff)
+		}
+	})
 	t.Run("unavailable platform", func(t *testing.T) {
 		source := NewFilesystemMirrorSource("testdata/filesystem-mirror")
 		// We'll request a version that does exist in the fixture directory,
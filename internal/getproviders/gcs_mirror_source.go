@@ -0,0 +1,191 @@
+package getproviders
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// GCSMirrorSource is a Source that reads provider metadata and packages from
+// a Google Cloud Storage bucket laid out using the same index and package
+// structure as the HTTP network mirror protocol. It is the Google Cloud
+// counterpart of S3MirrorSource, so an existing mirror bucket can be
+// consumed directly without fronting it with an HTTP server.
+//
+// The expected object layout under the configured prefix is:
+//
+//     <hostname>/<namespace>/<type>/index.json
+//     <hostname>/<namespace>/<type>/<version>.json
+//     <hostname>/<namespace>/<type>/terraform-provider-<type>_<version>_<os>_<arch>.zip
+//
+// Credentials come from the standard Google Application Default Credentials
+// chain: the GOOGLE_APPLICATION_CREDENTIALS environment variable, the
+// gcloud credentials file, or the metadata service when running inside
+// Google Cloud.
+type GCSMirrorSource struct {
+	bucket string
+	prefix string
+	client *storage.Client
+}
+
+var _ Source = (*GCSMirrorSource)(nil)
+
+// NewGCSMirrorSource constructs and returns a new GCS-backed mirror source
+// reading from the given bucket.
+//
+// prefix may be empty to read from the root of the bucket.
+func NewGCSMirrorSource(bucket, prefix string) (*GCSMirrorSource, error) {
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Google Cloud Storage client for GCS mirror: %s", err)
+	}
+	return &GCSMirrorSource{
+		bucket: bucket,
+		prefix: strings.Trim(prefix, "/"),
+		client: client,
+	}, nil
+}
+
+// objectKey returns the bucket key for the given mirror-relative path.
+func (s *GCSMirrorSource) objectKey(relPath string) string {
+	if s.prefix == "" {
+		return relPath
+	}
+	return s.prefix + "/" + relPath
+}
+
+// providerDir returns the mirror-relative directory holding the objects for
+// the given provider.
+func (s *GCSMirrorSource) providerDir(provider addrs.Provider) string {
+	return fmt.Sprintf("%s/%s/%s", provider.Hostname.ForDisplay(), provider.Namespace, provider.Type)
+}
+
+// AvailableVersions reads the provider's index.json object and returns the
+// versions it declares.
+func (s *GCSMirrorSource) AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error) {
+	var index struct {
+		Versions map[string]struct{} `json:"versions"`
+	}
+	key := s.objectKey(s.providerDir(provider) + "/index.json")
+	err := s.getJSONObject(key, &index)
+	if err != nil {
+		if err == errGCSNotFound {
+			return nil, nil, ErrProviderNotKnown{Provider: provider}
+		}
+		return nil, nil, err
+	}
+
+	ret := make(VersionList, 0, len(index.Versions))
+	for versionStr := range index.Versions {
+		v, err := ParseVersion(versionStr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("GCS mirror index for %s lists invalid version %q: %s", provider.ForDisplay(), versionStr, err)
+		}
+		ret = append(ret, v)
+	}
+	ret.Sort()
+	return ret, nil, nil
+}
+
+// PackageMeta reads the version's metadata object to find the archive for
+// the requested platform and then downloads that archive into a temporary
+// file.
+func (s *GCSMirrorSource) PackageMeta(provider addrs.Provider, version Version, target Platform) (PackageMeta, error) {
+	var meta struct {
+		Archives map[string]struct {
+			URL string `json:"url"`
+		} `json:"archives"`
+	}
+	dir := s.providerDir(provider)
+	key := s.objectKey(fmt.Sprintf("%s/%s.json", dir, version.String()))
+	err := s.getJSONObject(key, &meta)
+	if err != nil {
+		if err == errGCSNotFound {
+			return PackageMeta{}, fmt.Errorf("GCS mirror has no metadata for %s v%s", provider.ForDisplay(), version.String())
+		}
+		return PackageMeta{}, err
+	}
+
+	archive, exists := meta.Archives[target.String()]
+	if !exists {
+		return PackageMeta{}, ErrPlatformNotSupported{
+			Provider: provider,
+			Version:  version,
+			Platform: target,
+		}
+	}
+
+	// As in the HTTP mirror protocol, the archive URL is relative to the
+	// metadata object that named it.
+	archiveKey := s.objectKey(dir + "/" + archive.URL)
+	localFilename, err := s.fetchObject(archiveKey)
+	if err != nil {
+		return PackageMeta{}, fmt.Errorf("failed to download %s from GCS mirror: %s", archiveKey, err)
+	}
+
+	return PackageMeta{
+		Provider:       provider,
+		Version:        version,
+		TargetPlatform: target,
+		Filename:       archive.URL,
+		Location:       PackageLocalArchive(localFilename),
+	}, nil
+}
+
+// errGCSNotFound is an internal sentinel for a missing object, which the
+// calling methods translate into whichever error type suits what they were
+// looking up.
+var errGCSNotFound = fmt.Errorf("not found")
+
+// getJSONObject fetches the object with the given key and decodes its
+// content as JSON into target.
+func (s *GCSMirrorSource) getJSONObject(key string, target interface{}) error {
+	r, err := s.client.Bucket(s.bucket).Object(key).NewReader(context.TODO())
+	if err != nil {
+		if gcsObjectNotFound(err) {
+			return errGCSNotFound
+		}
+		return fmt.Errorf("failed to read gs://%s/%s: %s", s.bucket, key, err)
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(target); err != nil {
+		return fmt.Errorf("invalid content in gs://%s/%s: %s", s.bucket, key, err)
+	}
+	return nil
+}
+
+// fetchObject downloads the object with the given key into a temporary file
+// and returns the file's path.
+func (s *GCSMirrorSource) fetchObject(key string) (string, error) {
+	r, err := s.client.Bucket(s.bucket).Object(key).NewReader(context.TODO())
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	f, err := ioutil.TempFile("", "terraform-provider-gcs-mirror")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, r)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// gcsObjectNotFound recognizes the errors produced by NewReader for a
+// missing object or bucket.
+func gcsObjectNotFound(err error) bool {
+	return err == storage.ErrObjectNotExist || err == storage.ErrBucketNotExist
+}
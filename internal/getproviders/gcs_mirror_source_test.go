@@ -0,0 +1,151 @@
+package getproviders
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// testGCSMirror starts a fake GCS server containing a mirror for a single
+// provider, terraform.io/test/thing, and returns a GCSMirrorSource
+// configured to read from it.
+func testGCSMirror(t *testing.T) (*GCSMirrorSource, func()) {
+	t.Helper()
+
+	objects := map[string]string{
+		"mirror/terraform.io/test/thing/index.json": `{
+			"versions": {
+				"1.0.0": {},
+				"2.1.0": {}
+			}
+		}`,
+		"mirror/terraform.io/test/thing/2.1.0.json": `{
+			"archives": {
+				"linux_amd64": {"url": "terraform-provider-thing_2.1.0_linux_amd64.zip"}
+			}
+		}`,
+		"mirror/terraform.io/test/thing/terraform-provider-thing_2.1.0_linux_amd64.zip": "placeholder-zip-contents",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		// Object reads address the bucket as the first path segment, with
+		// the rest of the path being the object key.
+		const bucketPrefix = "/test-bucket/"
+		if !strings.HasPrefix(req.URL.Path, bucketPrefix) {
+			resp.WriteHeader(404)
+			return
+		}
+		content, exists := objects[req.URL.Path[len(bucketPrefix):]]
+		if !exists {
+			resp.WriteHeader(404)
+			return
+		}
+		resp.Write([]byte(content))
+	}))
+
+	// The storage client reads objects from the host in this environment
+	// variable, when set, instead of the real GCS API.
+	os.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+	client, err := storage.NewClient(context.Background(), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		os.Unsetenv("STORAGE_EMULATOR_HOST")
+		server.Close()
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	source := &GCSMirrorSource{
+		bucket: "test-bucket",
+		prefix: "mirror",
+		client: client,
+	}
+	return source, func() {
+		os.Unsetenv("STORAGE_EMULATOR_HOST")
+		server.Close()
+	}
+}
+
+func TestGCSMirrorSourceAvailableVersions(t *testing.T) {
+	source, close := testGCSMirror(t)
+	defer close()
+
+	got, _, err := source.AvailableVersions(addrs.MustParseProviderSourceString("terraform.io/test/thing"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := VersionList{
+		MustParseVersion("1.0.0"),
+		MustParseVersion("2.1.0"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong result\n%s", diff)
+	}
+}
+
+func TestGCSMirrorSourceAvailableVersions_unknownProvider(t *testing.T) {
+	source, close := testGCSMirror(t)
+	defer close()
+
+	provider := addrs.MustParseProviderSourceString("terraform.io/test/nonexist")
+	_, _, err := source.AvailableVersions(provider)
+	if err == nil {
+		t.Fatalf("succeeded; expected error")
+	}
+	if got, want := err.(ErrProviderNotKnown).Provider, provider; got != want {
+		t.Errorf("wrong provider in error %s; want %s", got, want)
+	}
+}
+
+func TestGCSMirrorSourcePackageMeta(t *testing.T) {
+	source, close := testGCSMirror(t)
+	defer close()
+
+	provider := addrs.MustParseProviderSourceString("terraform.io/test/thing")
+	version := MustParseVersion("2.1.0")
+
+	t.Run("available platform", func(t *testing.T) {
+		got, err := source.PackageMeta(provider, version, Platform{"linux", "amd64"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got.Provider != provider {
+			t.Errorf("wrong provider %s; want %s", got.Provider, provider)
+		}
+		if got.Filename != "terraform-provider-thing_2.1.0_linux_amd64.zip" {
+			t.Errorf("wrong filename %q", got.Filename)
+		}
+		localFilename, ok := got.Location.(PackageLocalArchive)
+		if !ok {
+			t.Fatalf("wrong location type %T; want PackageLocalArchive", got.Location)
+		}
+		defer os.Remove(string(localFilename))
+		content, err := ioutil.ReadFile(string(localFilename))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(content) != "placeholder-zip-contents" {
+			t.Errorf("wrong content %q in downloaded archive", string(content))
+		}
+	})
+
+	t.Run("unavailable platform", func(t *testing.T) {
+		_, err := source.PackageMeta(provider, version, Platform{"plan9", "mips"})
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if _, ok := err.(ErrPlatformNotSupported); !ok {
+			t.Fatalf("wrong error type %T; want ErrPlatformNotSupported", err)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package getproviders
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+
+	"github.com/hashicorp/terraform/httpclient"
+)
+
+// The TF_PROVIDER_CA_BUNDLE environment variable may name a PEM file of
+// additional CA certificates that provider installation requests should
+// trust, in addition to the system CA pool. This is intended for
+// environments where registry traffic traverses a TLS-intercepting proxy
+// signed by a private CA.
+const caBundleEnvName = "TF_PROVIDER_CA_BUNDLE"
+
+// InstallHTTPClient returns the HTTP client that provider installation
+// should use for registry discovery requests and package downloads.
+//
+// The returned client honors the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY
+// environment variables via the standard library proxy resolution, and
+// extends its trusted CA pool with the PEM file named by the
+// TF_PROVIDER_CA_BUNDLE environment variable if that is set. TLS failures
+// are annotated with the host being contacted and a description of the CA
+// pool in use, so that certificate problems behind intercepting proxies
+// are easier to diagnose.
+func InstallHTTPClient() *http.Client {
+	return installHTTPClient(nil)
+}
+
+// InstallHTTPClientWithTLSClientCert is like InstallHTTPClient except that
+// the returned client additionally presents the given TLS client certificate
+// when a server requests one, for mirrors behind proxies that require
+// mutual TLS. A nil certificate behaves exactly like InstallHTTPClient.
+func InstallHTTPClientWithTLSClientCert(clientCert *tls.Certificate) *http.Client {
+	return installHTTPClient(clientCert)
+}
+
+func installHTTPClient(clientCert *tls.Certificate) *http.Client {
+	caDesc := "the system CA pool"
+	var pool *x509.CertPool
+	if bundlePath := os.Getenv(caBundleEnvName); bundlePath != "" {
+		caDesc = fmt.Sprintf("the system CA pool extended with the bundle from %s (%s)", caBundleEnvName, bundlePath)
+		var err error
+		pool, err = caBundlePool(bundlePath)
+		if err != nil {
+			// A misconfigured CA bundle shouldn't silently fall back to the
+			// default pool, because that would just produce confusing TLS
+			// errors later, so instead every request fails with a message
+			// describing the real problem.
+			return &http.Client{
+				Transport: errorRoundTripper{err},
+			}
+		}
+	}
+
+	var client *http.Client
+	if pool == nil && clientCert == nil {
+		client = httpclient.New()
+	} else {
+		// The cleanhttp transport already consults the proxy-related
+		// environment variables, so we only need to adjust its TLS
+		// configuration.
+		transport := cleanhttp.DefaultPooledTransport()
+		tlsConfig := &tls.Config{
+			RootCAs: pool,
+		}
+		if clientCert != nil {
+			tlsConfig.Certificates = []tls.Certificate{*clientCert}
+		}
+		transport.TLSClientConfig = tlsConfig
+		client = httpclient.NewWithTransport(transport)
+	}
+	client.Transport = &tlsErrorRoundTripper{
+		inner:  client.Transport,
+		caDesc: caDesc,
+	}
+	return client
+}
+
+// caBundlePool builds a certificate pool from the system CA pool plus the
+// certificates in the given PEM file.
+func caBundlePool(bundlePath string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA bundle named by %s: %s", caBundleEnvName, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		// Some platforms don't expose a system pool, in which case we'll
+		// trust only the certificates from the bundle.
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("the CA bundle at %s (named by %s) contains no valid PEM certificates", bundlePath, caBundleEnvName)
+	}
+	return pool, nil
+}
+
+// tlsErrorRoundTripper passes requests through to an inner transport and
+// annotates any TLS-related failures with the target host and the CA pool
+// that was in use, since the bare crypto/x509 messages don't say which of
+// the possibly-many hosts involved in an installation run was at fault.
+type tlsErrorRoundTripper struct {
+	inner  http.RoundTripper
+	caDesc string
+}
+
+func (rt *tlsErrorRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.inner.RoundTrip(req)
+	if err != nil && errLooksLikeTLSFailure(err) {
+		return nil, fmt.Errorf("TLS handshake with %s failed while trusting %s: %s", req.URL.Host, rt.caDesc, err)
+	}
+	return resp, err
+}
+
+// errLooksLikeTLSFailure recognizes transport errors caused by certificate
+// verification or other TLS handshake problems.
+func errLooksLikeTLSFailure(err error) bool {
+	switch err := err.(type) {
+	case *x509.UnknownAuthorityError, x509.UnknownAuthorityError,
+		*x509.CertificateInvalidError, x509.CertificateInvalidError,
+		*x509.HostnameError, x509.HostnameError,
+		tls.RecordHeaderError:
+		return true
+	case interface{ Unwrap() error }:
+		return errLooksLikeTLSFailure(err.Unwrap())
+	default:
+		return false
+	}
+}
+
+// errorRoundTripper fails every request with a fixed error, used to report
+// configuration problems detected while constructing a client.
+type errorRoundTripper struct {
+	err error
+}
+
+func (rt errorRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, rt.err
+}
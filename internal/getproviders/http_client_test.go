@@ -0,0 +1,94 @@
+package getproviders
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInstallHTTPClient_caBundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	// The test server's certificate stands in for a throwaway private CA,
+	// which we'll write out as a PEM bundle for the client to trust.
+	f, err := ioutil.TempFile("", "terraform-test-cabundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	err = pem.Encode(f, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	defer os.Unsetenv(caBundleEnvName)
+	os.Setenv(caBundleEnvName, f.Name())
+
+	client := InstallHTTPClient()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("wrong status %s; want 200 OK", resp.Status)
+	}
+}
+
+func TestInstallHTTPClient_tlsFailureMessage(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	// Without the bundle configured, the server's self-signed certificate
+	// must be rejected with an error naming the host and the CA pool.
+	os.Unsetenv(caBundleEnvName)
+
+	client := InstallHTTPClient()
+	_, err := client.Get(server.URL)
+	if err == nil {
+		t.Fatal("unexpected success; want TLS verification error")
+	}
+	if !strings.Contains(err.Error(), "TLS handshake with") {
+		t.Errorf("error %q does not name the host being contacted", err)
+	}
+	if !strings.Contains(err.Error(), "the system CA pool") {
+		t.Errorf("error %q does not describe the CA pool in use", err)
+	}
+}
+
+func TestInstallHTTPClient_invalidBundle(t *testing.T) {
+	f, err := ioutil.TempFile("", "terraform-test-cabundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("not a certificate"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	defer os.Unsetenv(caBundleEnvName)
+	os.Setenv(caBundleEnvName, f.Name())
+
+	client := InstallHTTPClient()
+	_, err = client.Get("https://registry.terraform.io/")
+	if err == nil {
+		t.Fatal("unexpected success; want error about the CA bundle")
+	}
+	if !strings.Contains(err.Error(), "no valid PEM certificates") {
+		t.Errorf("error %q does not describe the invalid bundle", err)
+	}
+}
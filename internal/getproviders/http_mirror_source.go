@@ -1,16 +1,64 @@
 package getproviders
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
 	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	svchost "github.com/hashicorp/terraform-svchost"
+	svcauth "github.com/hashicorp/terraform-svchost/auth"
 
 	"github.com/hashicorp/terraform/addrs"
 )
 
 // HTTPMirrorSource is a source that reads provider metadata from a provider
 // mirror that is accessible over the HTTP provider mirror protocol.
+//
+// The protocol layout, relative to the mirror's base URL, is:
+//
+//     <hostname>/<namespace>/<type>/index.json
+//     <hostname>/<namespace>/<type>/<version>.json
+//
+// where the version-specific document names an archive URL for each
+// supported platform, resolved relative to the document itself.
 type HTTPMirrorSource struct {
 	baseURL *url.URL
+
+	// creds provides optional per-host credentials. When nil, or when it
+	// has no credentials for a particular host, requests to that host are
+	// made unauthenticated.
+	creds svcauth.CredentialsSource
+
+	// signingPolicy, when non-nil, makes PackageMeta attach signature
+	// verification against the mirror's detached SHA256SUMS documents to
+	// the packages it returns.
+	signingPolicy *MirrorSigningPolicy
+
+	// The HTTP client is built lazily on first use, because loading a TLS
+	// client certificate configured for the mirror's host can fail and the
+	// constructors have no error result to report that through.
+	httpClientOnce sync.Once
+	httpClient     *http.Client
+	httpClientErr  error
+}
+
+// HostTLSClientCredentialsSource is an optional extension interface that a
+// svcauth.CredentialsSource may implement to additionally supply a TLS
+// client certificate for hosts that demand mutual TLS, such as a provider
+// mirror behind an authenticating reverse proxy.
+type HostTLSClientCredentialsSource interface {
+	// TLSClientCertFilesForHost returns the paths of the PEM certificate
+	// and key files to present to the given host, or ok=false if the host
+	// has no client certificate configured.
+	TLSClientCertFilesForHost(host svchost.Hostname) (certFile, keyFile string, ok bool)
 }
 
 var _ Source = (*HTTPMirrorSource)(nil)
@@ -19,19 +67,325 @@ var _ Source = (*HTTPMirrorSource)(nil)
 // the given base URL. The relative URL offsets defined by the HTTP mirror
 // protocol will be resolve relative to the given URL.
 func NewHTTPMirrorSource(baseURL *url.URL) *HTTPMirrorSource {
+	return NewAuthenticatedHTTPMirrorSource(baseURL, nil)
+}
+
+// NewAuthenticatedHTTPMirrorSource is like NewHTTPMirrorSource but the
+// returned source will additionally consult the given credentials source
+// for each request, so that mirrors behind an authenticating proxy can be
+// used without embedding credentials in the mirror URL.
+//
+// Credentials are selected by the hostname of each request URL, so an
+// archive served from a different host than the index (a CDN, for example)
+// uses that host's credentials rather than the mirror's.
+func NewAuthenticatedHTTPMirrorSource(baseURL *url.URL, creds svcauth.CredentialsSource) *HTTPMirrorSource {
 	return &HTTPMirrorSource{
 		baseURL: baseURL,
+		creds:   creds,
 	}
 }
 
+// client returns the HTTP client to use for mirror requests, constructing
+// it on first use. If the credentials source supplies a TLS client
+// certificate for the mirror's host then the client presents it during the
+// TLS handshake; a certificate that is configured but can't be loaded is an
+// error, rather than quietly connecting without it and getting a confusing
+// rejection from the server.
+func (s *HTTPMirrorSource) client() (*http.Client, error) {
+	s.httpClientOnce.Do(func() {
+		var clientCert *tls.Certificate
+		if tlsCreds, ok := s.creds.(HostTLSClientCredentialsSource); ok {
+			if hostname, err := svchost.ForComparison(s.baseURL.Host); err == nil {
+				if certFile, keyFile, ok := tlsCreds.TLSClientCertFilesForHost(hostname); ok {
+					cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+					if err != nil {
+						s.httpClientErr = fmt.Errorf("failed to load the TLS client certificate configured for %s: %s", hostname.ForDisplay(), err)
+						return
+					}
+					clientCert = &cert
+				}
+			}
+		}
+		client := InstallHTTPClientWithTLSClientCert(clientCert)
+
+		// Credentials are attached per-host, so a redirect to a different
+		// host must not carry the original host's Authorization header
+		// with it. Same-host redirects keep it, so a mirror that moves its
+		// documents around within itself keeps working.
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			if req.URL.Host != via[0].URL.Host {
+				req.Header.Del("Authorization")
+			}
+			return nil
+		}
+		s.httpClient = client
+	})
+	return s.httpClient, s.httpClientErr
+}
+
 // AvailableVersions retrieves the available versions for the given provider
 // from the object's underlying HTTP mirror service.
-func (s *HTTPMirrorSource) AvailableVersions(provider addrs.Provider) (VersionList, error) {
-	return nil, fmt.Errorf("Network-based provider mirrors are not supported in this version of Terraform")
+func (s *HTTPMirrorSource) AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error) {
+	var index struct {
+		Versions map[string]struct{} `json:"versions"`
+	}
+	indexURL := s.urlForPath(s.providerDir(provider) + "/index.json")
+	err := s.getJSON(indexURL, &index)
+	if err != nil {
+		if err == errHTTPMirrorNotFound {
+			return nil, nil, ErrProviderNotKnown{Provider: provider}
+		}
+		return nil, nil, err
+	}
+
+	ret := make(VersionList, 0, len(index.Versions))
+	for versionStr := range index.Versions {
+		v, err := ParseVersion(versionStr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("mirror index for %s lists invalid version %q: %s", provider.ForDisplay(), versionStr, err)
+		}
+		ret = append(ret, v)
+	}
+	ret.Sort()
+	return ret, nil, nil
 }
 
 // PackageMeta retrieves metadata for the requested provider package
 // from the object's underlying HTTP mirror service.
 func (s *HTTPMirrorSource) PackageMeta(provider addrs.Provider, version Version, target Platform) (PackageMeta, error) {
-	return PackageMeta{}, fmt.Errorf("Network-based provider mirrors are not supported in this version of Terraform")
+	var meta struct {
+		Archives map[string]struct {
+			URL string `json:"url"`
+		} `json:"archives"`
+	}
+	metaURL := s.urlForPath(fmt.Sprintf("%s/%s.json", s.providerDir(provider), version.String()))
+	err := s.getJSON(metaURL, &meta)
+	if err != nil {
+		if err == errHTTPMirrorNotFound {
+			return PackageMeta{}, fmt.Errorf("mirror has no metadata for %s v%s", provider.ForDisplay(), version.String())
+		}
+		return PackageMeta{}, err
+	}
+
+	archive, exists := meta.Archives[target.String()]
+	if !exists {
+		return PackageMeta{}, ErrPlatformNotSupported{
+			Provider: provider,
+			Version:  version,
+			Platform: target,
+		}
+	}
+
+	relURL, err := url.Parse(archive.URL)
+	if err != nil {
+		return PackageMeta{}, fmt.Errorf("mirror metadata for %s v%s has invalid archive URL %q: %s", provider.ForDisplay(), version.String(), archive.URL, err)
+	}
+	archiveURL := metaURL.ResolveReference(relURL)
+	if archiveURL.Scheme != "http" && archiveURL.Scheme != "https" {
+		return PackageMeta{}, fmt.Errorf("mirror metadata for %s v%s has unsupported archive URL %q: must be an http or https URL", provider.ForDisplay(), version.String(), archiveURL.String())
+	}
+
+	// We download the archive ourselves, rather than returning a
+	// PackageHTTPURL for the installer to fetch, so that the request can
+	// carry any credentials configured for the archive's host.
+	localFilename, err := s.fetchArchive(archiveURL)
+	if err != nil {
+		return PackageMeta{}, fmt.Errorf("failed to download %s from the mirror: %s", archiveURL.String(), err)
+	}
+
+	ret := PackageMeta{
+		Provider:       provider,
+		Version:        version,
+		TargetPlatform: target,
+		Filename:       lastURLPathPart(archiveURL),
+		Location:       PackageLocalArchive(localFilename),
+	}
+	if s.signingPolicy != nil {
+		document := s.fetchDocumentIfExists(archiveURL.ResolveReference(&url.URL{Path: mirrorSumsFilename}))
+		signature := s.fetchDocumentIfExists(archiveURL.ResolveReference(&url.URL{Path: mirrorSumsSignatureFilename}))
+		auth, warning, err := s.signingPolicy.AuthenticationForPackage(provider, ret.Filename, document, signature)
+		if err != nil {
+			return PackageMeta{}, err
+		}
+		if warning != "" {
+			log.Printf("[WARN] %s", warning)
+		}
+		ret.Authentication = auth
+	}
+	return ret, nil
+}
+
+// SetSigningPolicy tells the source to verify packages against the detached
+// SHA256SUMS and SHA256SUMS.sig documents published next to the package
+// archives, using the trusted keys in the given policy.
+func (s *HTTPMirrorSource) SetSigningPolicy(policy *MirrorSigningPolicy) {
+	s.signingPolicy = policy
+}
+
+// fetchDocumentIfExists returns the content at the given URL, or nil if the
+// mirror doesn't have it or it can't be retrieved.
+func (s *HTTPMirrorSource) fetchDocumentIfExists(docURL *url.URL) []byte {
+	resp, err := s.get(docURL)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil
+	}
+	return content
+}
+
+// providerDir returns the mirror-relative directory for the given provider's
+// documents.
+func (s *HTTPMirrorSource) providerDir(provider addrs.Provider) string {
+	return fmt.Sprintf("%s/%s/%s", provider.Hostname.ForDisplay(), provider.Namespace, provider.Type)
+}
+
+// urlForPath resolves the given mirror-relative path against the base URL.
+func (s *HTTPMirrorSource) urlForPath(relPath string) *url.URL {
+	relURL := &url.URL{Path: relPath}
+	return s.baseURL.ResolveReference(relURL)
+}
+
+// errHTTPMirrorNotFound is an internal sentinel for a 404 response, which
+// the calling methods translate into whichever error type suits what they
+// were requesting.
+var errHTTPMirrorNotFound = fmt.Errorf("not found")
+
+// ErrHTTPMirrorAccessDenied is the error type returned when a mirror
+// responds with 401 or 403, meaning that the configured credentials (or
+// lack of them) were rejected. Unlike a transport-level error, repeating
+// the request cannot succeed, so callers should treat this as a
+// configuration problem rather than retrying.
+type ErrHTTPMirrorAccessDenied struct {
+	URL        *url.URL
+	StatusCode int
+}
+
+func (err ErrHTTPMirrorAccessDenied) Error() string {
+	return fmt.Sprintf("the provider mirror at %s rejected the request with status %d; check the credentials configured for %s", err.URL.String(), err.StatusCode, err.URL.Host)
+}
+
+// get issues an authenticated (where credentials are available) GET request
+// for the given URL. It returns errHTTPMirrorNotFound for a 404 response.
+func (s *HTTPMirrorSource) get(reqURL *url.URL) (*http.Response, error) {
+	req, err := http.NewRequest("GET", reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.prepareRequest(req); err != nil {
+		return nil, err
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, errHTTPMirrorNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		resp.Body.Close()
+		return nil, ErrHTTPMirrorAccessDenied{
+			URL:        reqURL,
+			StatusCode: resp.StatusCode,
+		}
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response %s from %s", resp.Status, reqURL.String())
+	}
+}
+
+// prepareRequest attaches any credentials configured for the request URL's
+// hostname. A token containing a colon is interpreted as a basic auth
+// "username:password" pair; any other token is sent as a bearer token.
+//
+// This function intentionally never logs the credential itself, only the
+// hostname it was (or wasn't) found for.
+func (s *HTTPMirrorSource) prepareRequest(req *http.Request) error {
+	if s.creds == nil {
+		return nil
+	}
+	hostname, err := svchost.ForComparison(req.URL.Host)
+	if err != nil {
+		// A hostname we can't normalize can't have credentials configured
+		// for it, so we just proceed unauthenticated.
+		log.Printf("[WARN] Can't determine credentials for invalid mirror hostname %q", req.URL.Host)
+		return nil
+	}
+	creds, err := s.creds.ForHost(hostname)
+	if err != nil {
+		return fmt.Errorf("failed to resolve credentials for %s: %s", hostname.ForDisplay(), err)
+	}
+	if creds == nil {
+		log.Printf("[TRACE] No credentials configured for provider mirror host %s; proceeding unauthenticated", hostname.ForDisplay())
+		return nil
+	}
+
+	if tokenCreds, ok := creds.(svcauth.HostCredentialsToken); ok {
+		if colon := strings.Index(string(tokenCreds), ":"); colon >= 0 {
+			req.SetBasicAuth(string(tokenCreds)[:colon], string(tokenCreds)[colon+1:])
+			return nil
+		}
+	}
+	creds.PrepareRequest(req)
+	return nil
+}
+
+// getJSON fetches the document at the given URL and decodes it as JSON
+// into target.
+func (s *HTTPMirrorSource) getJSON(reqURL *url.URL, target interface{}) error {
+	resp, err := s.get(reqURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("invalid content at %s: %s", reqURL.String(), err)
+	}
+	return nil
+}
+
+// fetchArchive downloads the archive at the given URL into a temporary file
+// and returns the file's path.
+func (s *HTTPMirrorSource) fetchArchive(archiveURL *url.URL) (string, error) {
+	resp, err := s.get(archiveURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	f, err := ioutil.TempFile("", "terraform-provider-mirror")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, resp.Body)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// lastURLPathPart returns the final segment of the given URL's path, for
+// use as a package filename.
+func lastURLPathPart(u *url.URL) string {
+	path := u.Path
+	if slash := strings.LastIndex(path, "/"); slash >= 0 {
+		path = path[slash+1:]
+	}
+	return path
 }
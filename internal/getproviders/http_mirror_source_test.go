@@ -0,0 +1,374 @@
+package getproviders
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	svchost "github.com/hashicorp/terraform-svchost"
+	svcauth "github.com/hashicorp/terraform-svchost/auth"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// testHTTPMirror starts a fake mirror server containing documents for a
+// single provider, terraform.io/test/thing. If checkAuth is non-nil then
+// every request must satisfy it or the server responds 401.
+func testHTTPMirror(t *testing.T, checkAuth func(req *http.Request) bool) *httptest.Server {
+	t.Helper()
+
+	documents := map[string]string{
+		"/terraform.io/test/thing/index.json": `{
+			"versions": {
+				"1.0.0": {},
+				"2.1.0": {}
+			}
+		}`,
+		"/terraform.io/test/thing/2.1.0.json": `{
+			"archives": {
+				"linux_amd64": {"url": "terraform-provider-thing_2.1.0_linux_amd64.zip"}
+			}
+		}`,
+		"/terraform.io/test/thing/terraform-provider-thing_2.1.0_linux_amd64.zip": "placeholder-zip-contents",
+	}
+
+	return httptest.NewServer(testHTTPMirrorHandler(documents, checkAuth))
+}
+
+func testHTTPMirrorHandler(documents map[string]string, checkAuth func(req *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if checkAuth != nil && !checkAuth(req) {
+			resp.WriteHeader(401)
+			return
+		}
+		content, exists := documents[req.URL.Path]
+		if !exists {
+			resp.WriteHeader(404)
+			return
+		}
+		resp.Write([]byte(content))
+	})
+}
+
+// testHTTPMirrorTLS is like testHTTPMirror except that the server talks TLS
+// and requires a client certificate signed by one of the given CAs, like a
+// reverse proxy enforcing mutual TLS would.
+func testHTTPMirrorTLS(t *testing.T, clientCAs *x509.CertPool) *httptest.Server {
+	t.Helper()
+
+	documents := map[string]string{
+		"/terraform.io/test/thing/index.json": `{
+			"versions": {
+				"1.0.0": {}
+			}
+		}`,
+	}
+	server := httptest.NewUnstartedServer(testHTTPMirrorHandler(documents, nil))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	return server
+}
+
+// testTLSClientCertFiles generates a self-signed client certificate, writes
+// it and its key to PEM files, and returns their paths along with a CA pool
+// that a test server can use to verify the certificate.
+func testTLSClientCertFiles(t *testing.T) (certFile, keyFile string, clientCAs *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "terraform-test-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	dir, err := ioutil.TempDir("", "terraform-test-mirror-mtls")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	clientCAs = x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(certPEM)
+	return certFile, keyFile, clientCAs
+}
+
+// testTLSCredentialsSource is a credentials source with no tokens but with
+// a TLS client certificate for every host.
+type testTLSCredentialsSource struct {
+	certFile string
+	keyFile  string
+}
+
+var _ HostTLSClientCredentialsSource = testTLSCredentialsSource{}
+
+func (s testTLSCredentialsSource) ForHost(host svchost.Hostname) (svcauth.HostCredentials, error) {
+	return nil, nil
+}
+
+func (s testTLSCredentialsSource) StoreForHost(host svchost.Hostname, credentials svcauth.HostCredentialsWritable) error {
+	return nil
+}
+
+func (s testTLSCredentialsSource) ForgetForHost(host svchost.Hostname) error {
+	return nil
+}
+
+func (s testTLSCredentialsSource) TLSClientCertFilesForHost(host svchost.Hostname) (string, string, bool) {
+	return s.certFile, s.keyFile, true
+}
+
+// testHTTPMirrorSource wraps the given server in an HTTPMirrorSource, with
+// credentials for the server's host when token is non-empty.
+func testHTTPMirrorSource(t *testing.T, server *httptest.Server, token string) *HTTPMirrorSource {
+	t.Helper()
+
+	baseURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var creds svcauth.CredentialsSource
+	if token != "" {
+		hostname, err := svchost.ForComparison(baseURL.Host)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		creds = svcauth.StaticCredentialsSource(map[svchost.Hostname]map[string]interface{}{
+			hostname: {"token": token},
+		})
+	}
+	return NewAuthenticatedHTTPMirrorSource(baseURL, creds)
+}
+
+func TestHTTPMirrorSourceAvailableVersions(t *testing.T) {
+	server := testHTTPMirror(t, nil)
+	defer server.Close()
+	source := testHTTPMirrorSource(t, server, "")
+
+	got, _, err := source.AvailableVersions(addrs.MustParseProviderSourceString("terraform.io/test/thing"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := VersionList{
+		MustParseVersion("1.0.0"),
+		MustParseVersion("2.1.0"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong result\n%s", diff)
+	}
+
+	provider := addrs.MustParseProviderSourceString("terraform.io/test/nonexist")
+	_, _, err = source.AvailableVersions(provider)
+	if err == nil {
+		t.Fatalf("succeeded for unknown provider; expected error")
+	}
+	if got, want := err.(ErrProviderNotKnown).Provider, provider; got != want {
+		t.Errorf("wrong provider in error %s; want %s", got, want)
+	}
+}
+
+func TestHTTPMirrorSourcePackageMeta(t *testing.T) {
+	server := testHTTPMirror(t, nil)
+	defer server.Close()
+	source := testHTTPMirrorSource(t, server, "")
+
+	provider := addrs.MustParseProviderSourceString("terraform.io/test/thing")
+	version := MustParseVersion("2.1.0")
+
+	t.Run("available platform", func(t *testing.T) {
+		got, err := source.PackageMeta(provider, version, Platform{"linux", "amd64"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got.Filename != "terraform-provider-thing_2.1.0_linux_amd64.zip" {
+			t.Errorf("wrong filename %q", got.Filename)
+		}
+		localFilename, ok := got.Location.(PackageLocalArchive)
+		if !ok {
+			t.Fatalf("wrong location type %T; want PackageLocalArchive", got.Location)
+		}
+		defer os.Remove(string(localFilename))
+		content, err := ioutil.ReadFile(string(localFilename))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(content) != "placeholder-zip-contents" {
+			t.Errorf("wrong content %q in downloaded archive", string(content))
+		}
+	})
+
+	t.Run("unavailable platform", func(t *testing.T) {
+		_, err := source.PackageMeta(provider, version, Platform{"plan9", "mips"})
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if _, ok := err.(ErrPlatformNotSupported); !ok {
+			t.Fatalf("wrong error type %T; want ErrPlatformNotSupported", err)
+		}
+	})
+}
+
+func TestHTTPMirrorSourceAuthentication(t *testing.T) {
+	provider := addrs.MustParseProviderSourceString("terraform.io/test/thing")
+
+	t.Run("bearer token", func(t *testing.T) {
+		server := testHTTPMirror(t, func(req *http.Request) bool {
+			return req.Header.Get("Authorization") == "Bearer mirror-token"
+		})
+		defer server.Close()
+
+		source := testHTTPMirrorSource(t, server, "mirror-token")
+		if _, _, err := source.AvailableVersions(provider); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("basic auth", func(t *testing.T) {
+		server := testHTTPMirror(t, func(req *http.Request) bool {
+			user, pass, ok := req.BasicAuth()
+			return ok && user == "mirroruser" && pass == "mirrorpass"
+		})
+		defer server.Close()
+
+		// A token containing a colon is treated as a username/password
+		// pair for HTTP basic auth.
+		source := testHTTPMirrorSource(t, server, "mirroruser:mirrorpass")
+		if _, _, err := source.AvailableVersions(provider); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("no credentials configured", func(t *testing.T) {
+		server := testHTTPMirror(t, func(req *http.Request) bool {
+			return req.Header.Get("Authorization") == ""
+		})
+		defer server.Close()
+
+		// With no credentials for the host the request must still be sent,
+		// just without an Authorization header.
+		source := testHTTPMirrorSource(t, server, "")
+		if _, _, err := source.AvailableVersions(provider); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("wrong credentials", func(t *testing.T) {
+		server := testHTTPMirror(t, func(req *http.Request) bool {
+			return req.Header.Get("Authorization") == "Bearer mirror-token"
+		})
+		defer server.Close()
+
+		source := testHTTPMirrorSource(t, server, "wrong-token")
+		_, _, err := source.AvailableVersions(provider)
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		// A 401 means the credentials were rejected, which retrying can't
+		// fix, so it must be distinguishable from a transport error.
+		if _, ok := err.(ErrHTTPMirrorAccessDenied); !ok {
+			t.Fatalf("wrong error type %T; want ErrHTTPMirrorAccessDenied", err)
+		}
+	})
+
+	t.Run("client certificate", func(t *testing.T) {
+		certFile, keyFile, clientCAs := testTLSClientCertFiles(t)
+		server := testHTTPMirrorTLS(t, clientCAs)
+		defer server.Close()
+
+		// The source must also trust the test server's own self-signed
+		// certificate, which we arrange through the CA bundle environment
+		// variable that InstallHTTPClient honors.
+		serverCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		caFile := filepath.Join(filepath.Dir(certFile), "server-ca.crt")
+		if err := ioutil.WriteFile(caFile, serverCertPEM, 0600); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		os.Setenv(caBundleEnvName, caFile)
+		defer os.Unsetenv(caBundleEnvName)
+
+		baseURL, err := url.Parse(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		source := NewAuthenticatedHTTPMirrorSource(baseURL, testTLSCredentialsSource{
+			certFile: certFile,
+			keyFile:  keyFile,
+		})
+		if _, _, err := source.AvailableVersions(provider); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("client certificate required but not configured", func(t *testing.T) {
+		_, _, clientCAs := testTLSClientCertFiles(t)
+		server := testHTTPMirrorTLS(t, clientCAs)
+		defer server.Close()
+
+		serverCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		caDir, err := ioutil.TempDir("", "terraform-test-mirror-ca")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		t.Cleanup(func() { os.RemoveAll(caDir) })
+		caFile := filepath.Join(caDir, "server-ca.crt")
+		if err := ioutil.WriteFile(caFile, serverCertPEM, 0600); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		os.Setenv(caBundleEnvName, caFile)
+		defer os.Unsetenv(caBundleEnvName)
+
+		baseURL, err := url.Parse(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		source := NewHTTPMirrorSource(baseURL)
+		if _, _, err := source.AvailableVersions(provider); err == nil {
+			t.Fatalf("succeeded; expected TLS handshake error")
+		}
+	})
+}
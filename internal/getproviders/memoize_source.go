@@ -26,6 +26,7 @@ type MemoizeSource struct {
 
 type memoizeAvailableVersionsRet struct {
 	VersionList VersionList
+	Warnings    Warnings
 	Err         error
 }
 
@@ -52,23 +53,31 @@ func NewMemoizeSource(underlying Source) *MemoizeSource {
 	}
 }
 
+// Underlying returns the source that the receiver is memoizing results
+// from, for callers that want to report on the source itself rather than
+// query it.
+func (s *MemoizeSource) Underlying() Source {
+	return s.underlying
+}
+
 // AvailableVersions requests the available versions from the underlying source
 // and caches them before returning them, or on subsequent calls returns the
 // result directly from the cache.
-func (s *MemoizeSource) AvailableVersions(provider addrs.Provider) (VersionList, error) {
+func (s *MemoizeSource) AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if existing, exists := s.availableVersions[provider]; exists {
-		return existing.VersionList, existing.Err
+		return existing.VersionList, existing.Warnings, existing.Err
 	}
 
-	ret, err := s.underlying.AvailableVersions(provider)
+	ret, warnings, err := s.underlying.AvailableVersions(provider)
 	s.availableVersions[provider] = memoizeAvailableVersionsRet{
 		VersionList: ret,
+		Warnings:    warnings,
 		Err:         err,
 	}
-	return ret, err
+	return ret, warnings, err
 }
 
 // PackageMeta requests package metadata from the underlying source and caches
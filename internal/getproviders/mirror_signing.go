@@ -0,0 +1,170 @@
+package getproviders
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	openpgpErrors "golang.org/x/crypto/openpgp/errors"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// MirrorSigningPolicy describes how packages served by a filesystem or
+// network mirror should have their detached signatures verified.
+//
+// A mirror that participates ships a SHA256SUMS document and a detached
+// SHA256SUMS.sig signature alongside its package archives, in the same
+// style as official provider releases. The policy supplies the GPG keys
+// trusted to produce those signatures, per provider namespace.
+type MirrorSigningPolicy struct {
+	// RequireSignatures makes a missing or unverifiable signature an
+	// installation error. When false, packages without signatures install
+	// with a warning instead, so a mirror can be migrated gradually.
+	RequireSignatures bool
+
+	// Keys maps provider namespaces to the keys trusted to sign packages
+	// in that namespace. The special namespace "*" applies to any
+	// namespace that has no entry of its own.
+	Keys map[string][]SigningKey
+}
+
+// KeysForNamespace returns the signing keys trusted for the given provider
+// namespace, falling back to the wildcard namespace "*" if the namespace
+// has no keys of its own.
+func (p *MirrorSigningPolicy) KeysForNamespace(namespace string) []SigningKey {
+	if keys, exists := p.Keys[namespace]; exists {
+		return keys
+	}
+	return p.Keys["*"]
+}
+
+// mirrorSumsFilename is the name of the checksums document a mirror ships
+// alongside its package archives, and mirrorSumsSignatureFilename is the
+// detached signature over that document.
+const mirrorSumsFilename = "SHA256SUMS"
+const mirrorSumsSignatureFilename = "SHA256SUMS.sig"
+
+// AuthenticationForPackage produces the package authentication to apply to
+// a mirror package for the given provider, from the contents of the
+// mirror's checksums document and its detached signature. Either document
+// being nil means the mirror didn't have it, which is an error when
+// signatures are required and otherwise produces a warning for the caller
+// to report while returning no authentication at all.
+func (p *MirrorSigningPolicy) AuthenticationForPackage(provider addrs.Provider, filename string, document, signature []byte) (PackageAuthentication, string, error) {
+	if document == nil || signature == nil {
+		if p.RequireSignatures {
+			return nil, "", fmt.Errorf("the mirror has no %s and %s for %s, but the CLI configuration requires signed mirror packages", mirrorSumsFilename, mirrorSumsSignatureFilename, provider.ForDisplay())
+		}
+		warning := fmt.Sprintf("The mirror package for %s is not signed, so its authenticity cannot be verified.", provider.ForDisplay())
+		return nil, warning, nil
+	}
+	keys := p.KeysForNamespace(provider.Namespace)
+	if len(keys) == 0 {
+		if p.RequireSignatures {
+			return nil, "", fmt.Errorf("the CLI configuration requires signed mirror packages but has no trusted signing keys for namespace %q", provider.Namespace)
+		}
+		warning := fmt.Sprintf("The mirror package for %s is signed, but no trusted signing keys are configured for namespace %q.", provider.ForDisplay(), provider.Namespace)
+		return nil, warning, nil
+	}
+	return mirrorSignatureAuthentication{
+		document:  document,
+		signature: signature,
+		filename:  filename,
+		keys:      keys,
+	}, "", nil
+}
+
+// mirrorSignatureAuthentication verifies that a mirror's checksums document
+// carries a valid signature from one of the trusted keys and that the
+// package archive matches the checksum the document records for it.
+type mirrorSignatureAuthentication struct {
+	document  []byte
+	signature []byte
+	filename  string
+	keys      []SigningKey
+}
+
+var _ PackageAuthentication = mirrorSignatureAuthentication{}
+
+func (m mirrorSignatureAuthentication) AuthenticatePackage(location PackageLocation) (*PackageAuthenticationResult, error) {
+	archiveLocation, ok := location.(PackageLocalArchive)
+	if !ok {
+		// A mirror signature covers the packed archive, so this check can't
+		// apply to any other location type.
+		return nil, fmt.Errorf("cannot verify mirror signature for %s", location)
+	}
+
+	// First the signature itself: one of the trusted keys must have signed
+	// the checksums document. A failure here names the keys that were
+	// tried, so a configuration with the wrong key is diagnosable.
+	var triedKeyIDs []string
+	verified := false
+	for _, key := range m.keys {
+		keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.ASCIIArmor))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding trusted signing key: %s", err)
+		}
+		for _, entity := range keyring {
+			if entity.PrimaryKey != nil {
+				triedKeyIDs = append(triedKeyIDs, entity.PrimaryKey.KeyIdString())
+			}
+		}
+		entity, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(m.document), bytes.NewReader(m.signature))
+		if err == openpgpErrors.ErrUnknownIssuer {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error checking mirror signature: %s", err)
+		}
+		log.Printf("[DEBUG] Mirror package signed by %s", entityString(entity))
+		verified = true
+		break
+	}
+	if !verified {
+		return nil, fmt.Errorf("the %s signature was not made by any of the trusted keys (tried %s)", mirrorSumsFilename, strings.Join(triedKeyIDs, ", "))
+	}
+
+	// Then the checksum: the signed document must record the hash of this
+	// package, and the archive must actually have that hash.
+	wantSum, err := m.documentSum()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(string(archiveLocation))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	if gotSum := h.Sum(nil); !bytes.Equal(gotSum, wantSum) {
+		return nil, fmt.Errorf("archive has incorrect checksum %x (expected %x)", gotSum, wantSum)
+	}
+
+	return &PackageAuthenticationResult{result: signedMirrorPackage}, nil
+}
+
+// documentSum finds the checksum that the signed document records for the
+// package filename this authentication was constructed for.
+func (m mirrorSignatureAuthentication) documentSum() ([]byte, error) {
+	for _, line := range strings.Split(string(m.document), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 2 && parts[1] == m.filename {
+			sum, err := hex.DecodeString(parts[0])
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("the %s document has an invalid checksum for %q", mirrorSumsFilename, m.filename)
+			}
+			return sum, nil
+		}
+	}
+	return nil, fmt.Errorf("the signed %s document has no checksum for %q", mirrorSumsFilename, m.filename)
+}
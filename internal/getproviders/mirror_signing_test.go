@@ -0,0 +1,260 @@
+package getproviders
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	openpgpArmor "golang.org/x/crypto/openpgp/armor"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// testMirrorSigningKey generates a fresh GPG key for signing test mirror
+// documents, returning the trusted-key representation of its public half
+// and a function that produces a detached signature over a document.
+func testMirrorSigningKey(t *testing.T) (SigningKey, func(document []byte) []byte) {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("Terraform Test Mirror", "", "mirror@example.com", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var armored bytes.Buffer
+	armorWriter, err := openpgpArmor.Encode(&armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := entity.Serialize(armorWriter); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	armorWriter.Close()
+
+	sign := func(document []byte) []byte {
+		var sig bytes.Buffer
+		if err := openpgp.DetachSign(&sig, entity, bytes.NewReader(document), nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return sig.Bytes()
+	}
+	return SigningKey{ASCIIArmor: armored.String()}, sign
+}
+
+// testMirrorPackage writes a placeholder package archive into a temporary
+// directory and returns its path along with a checksums document covering
+// it.
+func testMirrorPackage(t *testing.T) (string, []byte) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "terraform-test-mirror-signing")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	content := []byte("placeholder-zip-contents")
+	archivePath := filepath.Join(dir, "terraform-provider-thing_2.1.0_linux_amd64.zip")
+	if err := ioutil.WriteFile(archivePath, content, 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	document := []byte(fmt.Sprintf("%x  terraform-provider-thing_2.1.0_linux_amd64.zip\n", sha256.Sum256(content)))
+	return archivePath, document
+}
+
+func TestMirrorSignatureAuthentication(t *testing.T) {
+	key, sign := testMirrorSigningKey(t)
+	archivePath, document := testMirrorPackage(t)
+	signature := sign(document)
+
+	t.Run("valid signature", func(t *testing.T) {
+		auth := mirrorSignatureAuthentication{
+			document:  document,
+			signature: signature,
+			filename:  filepath.Base(archivePath),
+			keys:      []SigningKey{key},
+		}
+		result, err := auth.AuthenticatePackage(PackageLocalArchive(archivePath))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got, want := result.String(), "signed by a trusted mirror key"; got != want {
+			t.Errorf("wrong result %q; want %q", got, want)
+		}
+	})
+
+	t.Run("untrusted signing key", func(t *testing.T) {
+		otherKey, _ := testMirrorSigningKey(t)
+		auth := mirrorSignatureAuthentication{
+			document:  document,
+			signature: signature,
+			filename:  filepath.Base(archivePath),
+			keys:      []SigningKey{otherKey},
+		}
+		_, err := auth.AuthenticatePackage(PackageLocalArchive(archivePath))
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if !strings.Contains(err.Error(), "tried") {
+			t.Errorf("error does not name the keys that were tried: %s", err)
+		}
+	})
+
+	t.Run("tampered archive", func(t *testing.T) {
+		tamperedPath := archivePath + ".tampered"
+		if err := ioutil.WriteFile(tamperedPath, []byte("something else"), 0644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer os.Remove(tamperedPath)
+		auth := mirrorSignatureAuthentication{
+			document:  document,
+			signature: signature,
+			filename:  filepath.Base(archivePath),
+			keys:      []SigningKey{key},
+		}
+		_, err := auth.AuthenticatePackage(PackageLocalArchive(tamperedPath))
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if !strings.Contains(err.Error(), "incorrect checksum") {
+			t.Errorf("wrong error %q; want one about the checksum", err)
+		}
+	})
+
+	t.Run("filename missing from document", func(t *testing.T) {
+		auth := mirrorSignatureAuthentication{
+			document:  document,
+			signature: signature,
+			filename:  "terraform-provider-other_1.0.0_linux_amd64.zip",
+			keys:      []SigningKey{key},
+		}
+		_, err := auth.AuthenticatePackage(PackageLocalArchive(archivePath))
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if !strings.Contains(err.Error(), "no checksum for") {
+			t.Errorf("wrong error %q; want one about the missing checksum entry", err)
+		}
+	})
+}
+
+func TestMirrorSigningPolicyAuthenticationForPackage(t *testing.T) {
+	key, sign := testMirrorSigningKey(t)
+	_, document := testMirrorPackage(t)
+	signature := sign(document)
+	provider := addrs.MustParseProviderSourceString("registry.terraform.io/examplecorp/thing")
+
+	t.Run("signed package", func(t *testing.T) {
+		policy := &MirrorSigningPolicy{
+			Keys: map[string][]SigningKey{"examplecorp": {key}},
+		}
+		auth, warning, err := policy.AuthenticationForPackage(provider, "x.zip", document, signature)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if warning != "" {
+			t.Errorf("unexpected warning %q", warning)
+		}
+		if auth == nil {
+			t.Fatal("no authentication produced")
+		}
+	})
+
+	t.Run("wildcard namespace", func(t *testing.T) {
+		policy := &MirrorSigningPolicy{
+			Keys: map[string][]SigningKey{"*": {key}},
+		}
+		auth, _, err := policy.AuthenticationForPackage(provider, "x.zip", document, signature)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if auth == nil {
+			t.Fatal("no authentication produced")
+		}
+	})
+
+	t.Run("unsigned package allowed with warning", func(t *testing.T) {
+		policy := &MirrorSigningPolicy{
+			Keys: map[string][]SigningKey{"examplecorp": {key}},
+		}
+		auth, warning, err := policy.AuthenticationForPackage(provider, "x.zip", nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if auth != nil {
+			t.Errorf("unexpected authentication for unsigned package")
+		}
+		if warning == "" {
+			t.Error("no warning for unsigned package")
+		}
+	})
+
+	t.Run("unsigned package rejected when required", func(t *testing.T) {
+		policy := &MirrorSigningPolicy{
+			RequireSignatures: true,
+			Keys:              map[string][]SigningKey{"examplecorp": {key}},
+		}
+		_, _, err := policy.AuthenticationForPackage(provider, "x.zip", nil, nil)
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if !strings.Contains(err.Error(), "requires signed mirror packages") {
+			t.Errorf("wrong error %q", err)
+		}
+	})
+}
+
+func TestFilesystemMirrorSourceSigning(t *testing.T) {
+	key, sign := testMirrorSigningKey(t)
+
+	baseDir, err := ioutil.TempDir("", "terraform-test-mirror-signing-fs")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	pkgDir := filepath.Join(baseDir, "registry.terraform.io", "examplecorp", "thing")
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content := []byte("placeholder-zip-contents")
+	filename := "terraform-provider-thing_2.1.0_linux_amd64.zip"
+	if err := ioutil.WriteFile(filepath.Join(pkgDir, filename), content, 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	document := []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256(content), filename))
+	if err := ioutil.WriteFile(filepath.Join(pkgDir, mirrorSumsFilename), document, 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkgDir, mirrorSumsSignatureFilename), sign(document), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	source := NewFilesystemMirrorSource(baseDir)
+	source.SetSigningPolicy(&MirrorSigningPolicy{
+		RequireSignatures: true,
+		Keys:              map[string][]SigningKey{"examplecorp": {key}},
+	})
+
+	provider := addrs.MustParseProviderSourceString("registry.terraform.io/examplecorp/thing")
+	meta, err := source.PackageMeta(provider, MustParseVersion("2.1.0"), Platform{"linux", "amd64"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if meta.Authentication == nil {
+		t.Fatal("package has no authentication attached")
+	}
+	result, err := meta.Authentication.AuthenticatePackage(meta.Location)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := result.String(), "signed by a trusted mirror key"; got != want {
+		t.Errorf("wrong result %q; want %q", got, want)
+	}
+}
@@ -20,6 +20,7 @@ import (
 // This should not be used outside of unit test code.
 type MockSource struct {
 	packages []PackageMeta
+	warnings map[addrs.Provider]Warnings
 	calls    [][]interface{}
 }
 
@@ -37,10 +38,20 @@ func NewMockSource(packages []PackageMeta) *MockSource {
 	}
 }
 
+// SetWarnings arranges for future AvailableVersions calls for the given
+// provider to include the given warnings in their result, as a real registry
+// would for a deprecated provider.
+func (s *MockSource) SetWarnings(provider addrs.Provider, warnings Warnings) {
+	if s.warnings == nil {
+		s.warnings = make(map[addrs.Provider]Warnings)
+	}
+	s.warnings[provider] = warnings
+}
+
 // AvailableVersions returns all of the versions of the given provider that
 // are available in the fixed set of packages that were passed to
 // NewMockSource when creating the receiving source.
-func (s *MockSource) AvailableVersions(provider addrs.Provider) (VersionList, error) {
+func (s *MockSource) AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error) {
 	s.calls = append(s.calls, []interface{}{"AvailableVersions", provider})
 	var ret VersionList
 	for _, pkg := range s.packages {
@@ -51,10 +62,10 @@ func (s *MockSource) AvailableVersions(provider addrs.Provider) (VersionList, er
 	if len(ret) == 0 {
 		// In this case, we'll behave like a registry that doesn't know about
 		// this provider at all, rather than just returning an empty result.
-		return nil, ErrProviderNotKnown{provider}
+		return nil, nil, ErrProviderNotKnown{Provider: provider}
 	}
 	ret.Sort()
-	return ret, nil
+	return ret, s.warnings[provider], nil
 }
 
 // PackageMeta returns the first package from the list given to NewMockSource
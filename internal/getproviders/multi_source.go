@@ -2,7 +2,9 @@ package getproviders
 
 import (
 	"fmt"
+	"log"
 	"strings"
+	"sync"
 
 	svchost "github.com/hashicorp/terraform-svchost"
 
@@ -25,37 +27,91 @@ type MultiSource []MultiSourceSelector
 
 var _ Source = MultiSource(nil)
 
+// multiSourceQueryConcurrency is the maximum number of underlying sources
+// that a MultiSource will query at the same time during AvailableVersions.
+const multiSourceQueryConcurrency = 4
+
 // AvailableVersions retrieves all of the versions of the given provider
 // that are available across all of the underlying selectors, while respecting
 // each selector's matching patterns.
-func (s MultiSource) AvailableVersions(provider addrs.Provider) (VersionList, error) {
+//
+// The underlying sources are queried concurrently, since with several slow
+// network mirrors configured the sequential round trips otherwise dominate
+// dependency resolution time. An error from one source is fatal only if no
+// other source has the provider available; a source that fails while another
+// succeeds is just logged, because the successful source can satisfy the
+// request on its own.
+func (s MultiSource) AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error) {
 	if len(s) == 0 { // Easy case: there can be no available versions
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// We will return the union of all versions reported by the nested
 	// sources that have matching patterns that accept the given provider.
-	vs := make(map[Version]struct{})
-	for _, selector := range s {
+	type queryResult struct {
+		queried  bool
+		versions VersionList
+		warnings Warnings
+		err      error
+	}
+	results := make([]queryResult, len(s))
+	var wg sync.WaitGroup
+	tokens := make(chan struct{}, multiSourceQueryConcurrency)
+	for idx, selector := range s {
 		if !selector.CanHandleProvider(provider) {
 			continue // doesn't match the given patterns
 		}
-		thisSourceVersions, err := selector.Source.AvailableVersions(provider)
-		switch err.(type) {
+		results[idx].queried = true
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func(result *queryResult, source Source) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			result.versions, result.warnings, result.err = source.AvailableVersions(provider)
+		}(&results[idx], selector.Source)
+	}
+	wg.Wait()
+
+	vs := make(map[Version]struct{})
+	var warnings Warnings
+	var errs []error
+	for _, result := range results {
+		if !result.queried {
+			continue
+		}
+		switch result.err.(type) {
 		case nil:
 			// okay
 		case ErrProviderNotKnown:
 			continue // ignore, then
 		default:
-			return nil, err
+			errs = append(errs, result.err)
+			continue
 		}
-		for _, v := range thisSourceVersions {
+		for _, v := range result.versions {
 			vs[v] = struct{}{}
 		}
+		warnings = append(warnings, result.warnings...)
 	}
 
 	if len(vs) == 0 {
-		return nil, ErrProviderNotKnown{provider}
+		switch len(errs) {
+		case 0:
+			return nil, nil, ErrProviderNotKnown{Provider: provider}
+		case 1:
+			return nil, nil, errs[0]
+		default:
+			msgs := make([]string, len(errs))
+			for i, err := range errs {
+				msgs[i] = err.Error()
+			}
+			return nil, nil, fmt.Errorf("could not query any of the configured sources: %s", strings.Join(msgs, "; "))
+		}
+	}
+	for _, err := range errs {
+		log.Printf("[WARN] failed to query one of the sources for %s, but another source can still satisfy it: %s", provider, err)
 	}
 	ret := make(VersionList, 0, len(vs))
 	for v := range vs {
@@ -63,14 +119,14 @@ func (s MultiSource) AvailableVersions(provider addrs.Provider) (VersionList, er
 	}
 	ret.Sort()
 
-	return ret, nil
+	return ret, warnings, nil
 }
 
 // PackageMeta retrieves the package metadata for the requested provider package
 // from the first selector that indicates availability of it.
 func (s MultiSource) PackageMeta(provider addrs.Provider, version Version, target Platform) (PackageMeta, error) {
 	if len(s) == 0 { // Easy case: no providers exist at all
-		return PackageMeta{}, ErrProviderNotKnown{provider}
+		return PackageMeta{}, ErrProviderNotKnown{Provider: provider}
 	}
 
 	for _, selector := range s {
@@ -182,30 +238,62 @@ func ParseMultiSourceMatchingPatterns(strs []string) (MultiSourceMatchingPattern
 // by its exclude patterns.
 //
 // The absense of any include patterns is treated the same as a pattern
-// that matches all addresses. Exclusions take priority over inclusions.
+// that matches all addresses. When both an include and an exclude pattern
+// match the same address the most specific matching pattern decides, where
+// specificity is the number of non-wildcard segments in the pattern; ties
+// resolve in favor of exclusion.
 func (s MultiSourceSelector) CanHandleProvider(addr addrs.Provider) bool {
-	switch {
-	case s.Exclude.MatchesProvider(addr):
+	excludeSpecificity, excluded := s.Exclude.MatchSpecificity(addr)
+	if len(s.Include) == 0 {
+		return !excluded
+	}
+	includeSpecificity, included := s.Include.MatchSpecificity(addr)
+	if !included {
 		return false
-	case len(s.Include) > 0:
-		return s.Include.MatchesProvider(addr)
-	default:
-		return true
 	}
+	if excluded {
+		return includeSpecificity > excludeSpecificity
+	}
+	return true
 }
 
 // MatchesProvider tests whether the receiving matching patterns match with
 // the given concrete provider address.
 func (ps MultiSourceMatchingPatterns) MatchesProvider(addr addrs.Provider) bool {
+	_, match := ps.MatchSpecificity(addr)
+	return match
+}
+
+// MatchSpecificity is like MatchesProvider but additionally reports the
+// specificity of the most specific pattern that matched, which is the number
+// of non-wildcard segments in that pattern. The specificity is zero, and
+// meaningless, when no pattern matches.
+func (ps MultiSourceMatchingPatterns) MatchSpecificity(addr addrs.Provider) (int, bool) {
+	best := 0
+	match := false
 	for _, pattern := range ps {
 		hostMatch := (pattern.Hostname == svchost.Hostname(Wildcard) || pattern.Hostname == addr.Hostname)
 		namespaceMatch := (pattern.Namespace == Wildcard || pattern.Namespace == addr.Namespace)
 		typeMatch := (pattern.Type == Wildcard || pattern.Type == addr.Type)
-		if hostMatch && namespaceMatch && typeMatch {
-			return true
+		if !(hostMatch && namespaceMatch && typeMatch) {
+			continue
+		}
+		specificity := 0
+		if pattern.Hostname != svchost.Hostname(Wildcard) {
+			specificity++
+		}
+		if pattern.Namespace != Wildcard {
+			specificity++
+		}
+		if pattern.Type != Wildcard {
+			specificity++
+		}
+		if !match || specificity > best {
+			best = specificity
 		}
+		match = true
 	}
-	return false
+	return best, match
 }
 
 // Wildcard is a string value representing a wildcard element in the Include
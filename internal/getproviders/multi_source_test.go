@@ -1,6 +1,8 @@
 package getproviders
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -59,7 +61,7 @@ func TestMultiSourceAvailableVersions(t *testing.T) {
 
 		// AvailableVersions produces the union of all versions available
 		// across all of the sources.
-		got, err := multi.AvailableVersions(addrs.NewDefaultProvider("foo"))
+		got, _, err := multi.AvailableVersions(addrs.NewDefaultProvider("foo"))
 		if err != nil {
 			t.Fatalf("unexpected error: %s", err)
 		}
@@ -72,7 +74,7 @@ func TestMultiSourceAvailableVersions(t *testing.T) {
 			t.Errorf("wrong result\n%s", diff)
 		}
 
-		_, err = multi.AvailableVersions(addrs.NewDefaultProvider("baz"))
+		_, _, err = multi.AvailableVersions(addrs.NewDefaultProvider("baz"))
 		if want, ok := err.(ErrProviderNotKnown); !ok {
 			t.Fatalf("wrong error type:\ngot:  %T\nwant: %T", err, want)
 		}
@@ -122,7 +124,7 @@ func TestMultiSourceAvailableVersions(t *testing.T) {
 			},
 		}
 
-		got, err := multi.AvailableVersions(addrs.NewDefaultProvider("foo"))
+		got, _, err := multi.AvailableVersions(addrs.NewDefaultProvider("foo"))
 		if err != nil {
 			t.Fatalf("unexpected error: %s", err)
 		}
@@ -134,7 +136,7 @@ func TestMultiSourceAvailableVersions(t *testing.T) {
 			t.Errorf("wrong result\n%s", diff)
 		}
 
-		got, err = multi.AvailableVersions(addrs.NewDefaultProvider("bar"))
+		got, _, err = multi.AvailableVersions(addrs.NewDefaultProvider("bar"))
 		if err != nil {
 			t.Fatalf("unexpected error: %s", err)
 		}
@@ -146,11 +148,68 @@ func TestMultiSourceAvailableVersions(t *testing.T) {
 			t.Errorf("wrong result\n%s", diff)
 		}
 
-		_, err = multi.AvailableVersions(addrs.NewDefaultProvider("baz"))
+		_, _, err = multi.AvailableVersions(addrs.NewDefaultProvider("baz"))
 		if want, ok := err.(ErrProviderNotKnown); !ok {
 			t.Fatalf("wrong error type:\ngot:  %T\nwant: %T", err, want)
 		}
 	})
+
+	t.Run("failing sources", func(t *testing.T) {
+		working := NewMockSource([]PackageMeta{
+			FakePackageMeta(
+				addrs.NewDefaultProvider("foo"),
+				MustParseVersion("1.0.0"),
+				VersionList{MustParseVersion("5.0")},
+				platform1,
+			),
+		})
+
+		// As long as one source can answer, failures elsewhere are not
+		// fatal, since the working source can satisfy the provider alone.
+		multi := MultiSource{
+			{Source: failingSource{}},
+			{Source: working},
+		}
+		got, _, err := multi.AvailableVersions(addrs.NewDefaultProvider("foo"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := VersionList{
+			MustParseVersion("1.0.0"),
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("wrong result\n%s", diff)
+		}
+
+		// With no working source at all, the individual failures combine
+		// into one fatal error.
+		multi = MultiSource{
+			{Source: failingSource{}},
+			{Source: failingSource{}},
+		}
+		_, _, err = multi.AvailableVersions(addrs.NewDefaultProvider("foo"))
+		if err == nil {
+			t.Fatalf("succeeded; want error")
+		}
+		if got, want := err.Error(), "could not query any of the configured sources"; !strings.Contains(got, want) {
+			t.Errorf("wrong error %q; want it to contain %q", got, want)
+		}
+	})
+}
+
+// failingSource is a Source implementation whose queries always fail with
+// an error other than ErrProviderNotKnown, standing in for e.g. an
+// unreachable network mirror.
+type failingSource struct{}
+
+var _ Source = failingSource{}
+
+func (s failingSource) AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error) {
+	return nil, nil, fmt.Errorf("source is broken")
+}
+
+func (s failingSource) PackageMeta(provider addrs.Provider, version Version, target Platform) (PackageMeta, error) {
+	return PackageMeta{}, fmt.Errorf("source is broken")
 }
 
 func TestMultiSourcePackageMeta(t *testing.T) {
@@ -401,12 +460,24 @@ func TestMultiSourceSelector(t *testing.T) {
 		},
 
 		// Both include and exclude in a single selector
-		"default provider with exclude wildcard overriding include exact": {
+		"default provider with include exact overriding exclude wildcard": {
 			MultiSourceSelector{
 				Source:  emptySource,
 				Include: mustParseMultiSourceMatchingPatterns("hashicorp/foo"),
 				Exclude: mustParseMultiSourceMatchingPatterns("hashicorp/*"),
 			},
+			// The include pattern is more specific than the exclude
+			// pattern, so it wins.
+			addrs.NewDefaultProvider("foo"),
+			true,
+		},
+		"default provider with exclude exact overriding equally-exact include": {
+			MultiSourceSelector{
+				Source:  emptySource,
+				Include: mustParseMultiSourceMatchingPatterns("hashicorp/foo"),
+				Exclude: mustParseMultiSourceMatchingPatterns("hashicorp/foo"),
+			},
+			// Ties between equally-specific patterns resolve to exclusion.
 			addrs.NewDefaultProvider("foo"),
 			false,
 		},
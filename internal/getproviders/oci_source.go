@@ -0,0 +1,436 @@
+package getproviders
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// OCISource is a Source that reads provider packages stored as artifacts in
+// an OCI-compatible registry, such as ECR, GAR, or Harbor.
+//
+// Each provider maps to a repository named after its source address under a
+// configurable prefix, so the provider registry.terraform.io/hashicorp/null
+// with the prefix "terraform-providers" lives in the repository
+// "terraform-providers/registry.terraform.io/hashicorp/null". The available
+// versions are the repository's tags, and each tagged manifest carries the
+// official release zip for each supported platform as a layer, identified
+// by the standard release filename in its title annotation.
+type OCISource struct {
+	// baseURL is the scheme and host of the registry's distribution API,
+	// such as "https://registry.example.com".
+	baseURL string
+
+	// repositoryPrefix is the path prefix under which provider repositories
+	// live, without leading or trailing slashes. It may be empty for
+	// registries that allow deeply-nested repositories at the root.
+	repositoryPrefix string
+
+	client *http.Client
+
+	// tokens caches the bearer token issued for each repository scope, so
+	// that listing versions and then fetching a package performs the token
+	// exchange only once.
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+var _ Source = (*OCISource)(nil)
+
+// ociManifestTitleAnnotation is the standard OCI annotation that carries a
+// human-readable file name for a layer, which we use to recognize which
+// layer holds the release archive for each platform.
+const ociManifestTitleAnnotation = "org.opencontainers.image.title"
+
+// NewOCISource constructs and returns a new source that reads provider
+// packages from the given OCI registry host, looking for the provider
+// repositories under the given prefix.
+func NewOCISource(registryHost, repositoryPrefix string) *OCISource {
+	return &OCISource{
+		baseURL:          "https://" + registryHost,
+		repositoryPrefix: strings.Trim(repositoryPrefix, "/"),
+		client:           InstallHTTPClient(),
+		tokens:           make(map[string]string),
+	}
+}
+
+// repositoryName returns the registry repository that holds the packages for
+// the given provider.
+func (s *OCISource) repositoryName(provider addrs.Provider) string {
+	name := fmt.Sprintf("%s/%s/%s", provider.Hostname.ForDisplay(), provider.Namespace, provider.Type)
+	if s.repositoryPrefix != "" {
+		name = s.repositoryPrefix + "/" + name
+	}
+	return name
+}
+
+// AvailableVersions lists the tags of the provider's repository and returns
+// those that parse as version numbers, ignoring any other tags so that
+// repositories can also carry auxiliary tags like "latest".
+func (s *OCISource) AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error) {
+	repo := s.repositoryName(provider)
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	endpoint := fmt.Sprintf("%s/v2/%s/tags/list", s.baseURL, repo)
+	if err := s.getJSON(repo, endpoint, "", &body); err != nil {
+		if err == errOCINotFound {
+			return nil, nil, ErrProviderNotKnown{Provider: provider}
+		}
+		return nil, nil, err
+	}
+
+	ret := make(VersionList, 0, len(body.Tags))
+	for _, tag := range body.Tags {
+		v, err := ParseVersion(tag)
+		if err != nil {
+			continue // not a version tag
+		}
+		ret = append(ret, v)
+	}
+	ret.Sort()
+	return ret, nil, nil
+}
+
+// PackageMeta fetches the manifest tagged with the requested version, finds
+// the layer holding the release archive for the requested platform, and
+// downloads that layer into a temporary file, verifying it against the
+// digest declared in the manifest.
+func (s *OCISource) PackageMeta(provider addrs.Provider, version Version, target Platform) (PackageMeta, error) {
+	repo := s.repositoryName(provider)
+
+	var manifest struct {
+		Layers []struct {
+			MediaType   string            `json:"mediaType"`
+			Digest      string            `json:"digest"`
+			Size        int64             `json:"size"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	endpoint := fmt.Sprintf("%s/v2/%s/manifests/%s", s.baseURL, repo, version.String())
+	accept := "application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json"
+	if err := s.getJSON(repo, endpoint, accept, &manifest); err != nil {
+		if err == errOCINotFound {
+			return PackageMeta{}, fmt.Errorf("OCI repository %s has no manifest tagged %s", repo, version.String())
+		}
+		return PackageMeta{}, err
+	}
+
+	wantFilename := fmt.Sprintf("terraform-provider-%s_%s_%s.zip", provider.Type, version.String(), target.String())
+	for _, layer := range manifest.Layers {
+		if layer.Annotations[ociManifestTitleAnnotation] != wantFilename {
+			continue
+		}
+		localFilename, err := s.fetchBlob(repo, layer.Digest, wantFilename)
+		if err != nil {
+			return PackageMeta{}, err
+		}
+		return PackageMeta{
+			Provider:       provider,
+			Version:        version,
+			TargetPlatform: target,
+			Filename:       wantFilename,
+			Location:       PackageLocalArchive(localFilename),
+		}, nil
+	}
+	return PackageMeta{}, ErrPlatformNotSupported{
+		Provider: provider,
+		Version:  version,
+		Platform: target,
+	}
+}
+
+// fetchBlob downloads the blob with the given digest into a temporary file
+// and returns the file's path, verifying the content against the digest so
+// that a tampered-with or truncated blob is rejected before installation.
+func (s *OCISource) fetchBlob(repo, digest, filename string) (string, error) {
+	endpoint := fmt.Sprintf("%s/v2/%s/blobs/%s", s.baseURL, repo, digest)
+	resp, err := s.get(repo, endpoint, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s from OCI repository %s: %s", digest, repo, resp.Status)
+	}
+
+	f, err := ioutil.TempFile("", "terraform-provider-oci")
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), resp.Body)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to download %s from OCI repository %s: %s", digest, repo, err)
+	}
+
+	if got := "sha256:" + hex.EncodeToString(hash.Sum(nil)); got != digest {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("blob for %s from OCI repository %s does not match its declared digest %s", filename, repo, digest)
+	}
+
+	// Renaming to include the release filename gives the installer's own
+	// logging and error messages something recognizable to show.
+	localFilename := filepath.Join(filepath.Dir(f.Name()), filepath.Base(f.Name())+"-"+filename)
+	if err := os.Rename(f.Name(), localFilename); err != nil {
+		return f.Name(), nil // the original name works too; it's just less readable
+	}
+	return localFilename, nil
+}
+
+// errOCINotFound is an internal sentinel for a 404 response, which the
+// calling methods translate into whichever error type suits what they were
+// looking up.
+var errOCINotFound = fmt.Errorf("not found")
+
+// getJSON issues an authenticated GET for the given endpoint and decodes the
+// response body as JSON into target.
+func (s *OCISource) getJSON(repo, endpoint, accept string, target interface{}) error {
+	resp, err := s.get(repo, endpoint, accept)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// proceed below
+	case http.StatusNotFound:
+		return errOCINotFound
+	default:
+		return fmt.Errorf("request to OCI registry at %s failed: %s", endpoint, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("invalid response from OCI registry at %s: %s", endpoint, err)
+	}
+	return nil
+}
+
+// get issues a GET request for the given endpoint, handling the registry's
+// token authentication: a cached bearer token for the repository is attached
+// when available, and a 401 challenge triggers a token exchange using the
+// credentials from the local docker configuration followed by one retry.
+func (s *OCISource) get(repo, endpoint, accept string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	s.mu.Lock()
+	token := s.tokens[repo]
+	s.mu.Unlock()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to OCI registry at %s failed: %s", endpoint, err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	token, err = s.fetchToken(repo, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate to OCI registry at %s: %s", endpoint, err)
+	}
+	s.mu.Lock()
+	s.tokens[repo] = token
+	s.mu.Unlock()
+
+	req, err = http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to OCI registry at %s failed: %s", endpoint, err)
+	}
+	return resp, nil
+}
+
+// fetchToken performs the distribution token exchange described by the
+// given WWW-Authenticate challenge, requesting pull access to the given
+// repository with the credentials (if any) that the local docker
+// configuration holds for the registry host.
+func (s *OCISource) fetchToken(repo, challenge string) (string, error) {
+	params := parseAuthChallenge(challenge)
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry requires authentication but sent no bearer challenge")
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid token realm %q: %s", realm, err)
+	}
+	query := tokenURL.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", repo))
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username, password, ok := dockerCredentialsForHost(strings.TrimPrefix(strings.TrimPrefix(s.baseURL, "https://"), "http://")); ok {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response: %s", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("token response contains no token")
+}
+
+// parseAuthChallenge extracts the parameters from a WWW-Authenticate Bearer
+// challenge header value, such as the realm and service that the token
+// exchange must be performed against.
+func parseAuthChallenge(header string) map[string]string {
+	ret := make(map[string]string)
+	header = strings.TrimPrefix(header, "Bearer ")
+	for _, part := range strings.Split(header, ",") {
+		eq := strings.Index(part, "=")
+		if eq < 0 {
+			continue
+		}
+		key := strings.TrimSpace(part[:eq])
+		value := strings.Trim(strings.TrimSpace(part[eq+1:]), `"`)
+		ret[key] = value
+	}
+	return ret
+}
+
+// dockerCredentialsForHost reads the credentials for the given registry
+// host from the local docker configuration, which is how users already
+// authenticate to the same registries for container images. The third
+// result is false if no credentials are configured for the host.
+//
+// A credential helper named for the host in "credHelpers" takes precedence,
+// then static entries in "auths", then the default "credsStore" helper,
+// matching the order docker itself resolves them in.
+func dockerCredentialsForHost(host string) (string, string, bool) {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return "", "", false
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+		CredHelpers map[string]string `json:"credHelpers"`
+		CredsStore  string            `json:"credsStore"`
+	}
+	if err := json.Unmarshal(buf, &config); err != nil {
+		return "", "", false
+	}
+
+	if helper := config.CredHelpers[host]; helper != "" {
+		return dockerCredentialsFromHelper(helper, host)
+	}
+
+	if entry, exists := config.Auths[host]; exists {
+		if entry.Username != "" || entry.Password != "" {
+			return entry.Username, entry.Password, true
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return "", "", false
+		}
+		colon := strings.Index(string(decoded), ":")
+		if colon < 0 {
+			return "", "", false
+		}
+		return string(decoded[:colon]), string(decoded[colon+1:]), true
+	}
+
+	if config.CredsStore != "" {
+		return dockerCredentialsFromHelper(config.CredsStore, host)
+	}
+	return "", "", false
+}
+
+// dockerCredentialsFromHelper asks the docker credential helper with the
+// given suffix name for the host's credentials, using the same protocol as
+// docker itself: the host is written to the standard input of
+// "docker-credential-<name> get" and the response is a JSON object with
+// Username and Secret properties.
+//
+// A helper that is missing, fails, or has no credentials for the host just
+// means no credentials, since the token exchange can still request an
+// anonymous pull token.
+func dockerCredentialsFromHelper(name, host string) (string, string, bool) {
+	cmd := exec.Command("docker-credential-"+name, "get")
+	cmd.Stdin = strings.NewReader(host)
+	out, err := cmd.Output()
+	if err != nil {
+		log.Printf("[WARN] docker credential helper %q failed for %s: %s", name, host, err)
+		return "", "", false
+	}
+	var body struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &body); err != nil {
+		log.Printf("[WARN] docker credential helper %q returned an invalid response for %s: %s", name, host, err)
+		return "", "", false
+	}
+	if body.Username == "" && body.Secret == "" {
+		return "", "", false
+	}
+	return body.Username, body.Secret, true
+}
@@ -0,0 +1,240 @@
+package getproviders
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// testOCIRegistry serves a minimal subset of the OCI distribution API with
+// one provider repository, protected by the bearer token exchange.
+func testOCIRegistry(t *testing.T) (*httptest.Server, []byte) {
+	t.Helper()
+	blob := []byte("fake provider zip")
+	digest := "sha256:" + hex.EncodeToString(func() []byte { h := sha256.Sum256(blob); return h[:] }())
+
+	mux := http.NewServeMux()
+	var server *httptest.Server
+
+	const repo = "mirror/registry.terraform.io/hashicorp/null"
+	const token = "opensesame"
+
+	requireToken := func(resp http.ResponseWriter, req *http.Request) bool {
+		if req.Header.Get("Authorization") == "Bearer "+token {
+			return true
+		}
+		resp.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q,service="test-registry"`, server.URL+"/token"))
+		resp.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+
+	mux.HandleFunc("/token", func(resp http.ResponseWriter, req *http.Request) {
+		if got, want := req.URL.Query().Get("scope"), "repository:"+repo+":pull"; got != want {
+			t.Errorf("wrong token scope %q; want %q", got, want)
+		}
+		json.NewEncoder(resp).Encode(map[string]string{"token": token})
+	})
+	mux.HandleFunc("/v2/"+repo+"/tags/list", func(resp http.ResponseWriter, req *http.Request) {
+		if !requireToken(resp, req) {
+			return
+		}
+		json.NewEncoder(resp).Encode(map[string]interface{}{
+			"name": repo,
+			"tags": []string{"2.0.0", "2.1.0", "latest"},
+		})
+	})
+	mux.HandleFunc("/v2/"+repo+"/manifests/2.1.0", func(resp http.ResponseWriter, req *http.Request) {
+		if !requireToken(resp, req) {
+			return
+		}
+		if accept := req.Header.Get("Accept"); !strings.Contains(accept, "application/vnd.oci.image.manifest.v1+json") {
+			t.Errorf("manifest request does not accept the OCI manifest media type: %q", accept)
+		}
+		json.NewEncoder(resp).Encode(map[string]interface{}{
+			"schemaVersion": 2,
+			"layers": []map[string]interface{}{
+				{
+					"mediaType": "archive/zip",
+					"digest":    digest,
+					"size":      len(blob),
+					"annotations": map[string]string{
+						ociManifestTitleAnnotation: "terraform-provider-null_2.1.0_linux_amd64.zip",
+					},
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/v2/"+repo+"/blobs/"+digest, func(resp http.ResponseWriter, req *http.Request) {
+		if !requireToken(resp, req) {
+			return
+		}
+		resp.Write(blob)
+	})
+
+	server = httptest.NewServer(mux)
+	return server, blob
+}
+
+func testOCISource(server *httptest.Server) *OCISource {
+	source := NewOCISource(strings.TrimPrefix(server.URL, "http://"), "mirror")
+	source.baseURL = server.URL // the test server is plain http
+	source.client = server.Client()
+	return source
+}
+
+func TestOCISourceAvailableVersions(t *testing.T) {
+	server, _ := testOCIRegistry(t)
+	defer server.Close()
+	source := testOCISource(server)
+
+	got, _, err := source.AvailableVersions(addrs.NewDefaultProvider("null"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// The "latest" tag is not a version number and so is ignored.
+	if len(got) != 2 {
+		t.Fatalf("wrong number of versions %d; want 2", len(got))
+	}
+	if got[0].String() != "2.0.0" || got[1].String() != "2.1.0" {
+		t.Errorf("wrong versions %s, %s; want 2.0.0, 2.1.0", got[0], got[1])
+	}
+}
+
+func TestOCISourceAvailableVersions_unknownProvider(t *testing.T) {
+	server, _ := testOCIRegistry(t)
+	defer server.Close()
+	source := testOCISource(server)
+
+	_, _, err := source.AvailableVersions(addrs.NewDefaultProvider("nonexist"))
+	if _, ok := err.(ErrProviderNotKnown); !ok {
+		t.Fatalf("wrong error type %T (%v); want ErrProviderNotKnown", err, err)
+	}
+}
+
+func TestOCISourcePackageMeta(t *testing.T) {
+	server, blob := testOCIRegistry(t)
+	defer server.Close()
+	source := testOCISource(server)
+
+	provider := addrs.NewDefaultProvider("null")
+	version := MustParseVersion("2.1.0")
+
+	got, err := source.PackageMeta(provider, version, Platform{OS: "linux", Arch: "amd64"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.Filename != "terraform-provider-null_2.1.0_linux_amd64.zip" {
+		t.Errorf("wrong filename %q", got.Filename)
+	}
+	localArchive, ok := got.Location.(PackageLocalArchive)
+	if !ok {
+		t.Fatalf("wrong location type %T; want PackageLocalArchive", got.Location)
+	}
+	defer os.Remove(string(localArchive))
+	content, err := ioutil.ReadFile(string(localArchive))
+	if err != nil {
+		t.Fatalf("failed to read the downloaded package: %s", err)
+	}
+	if string(content) != string(blob) {
+		t.Errorf("downloaded package content does not match the registry blob")
+	}
+
+	// A platform with no matching layer is reported as unsupported.
+	_, err = source.PackageMeta(provider, version, Platform{OS: "plan9", Arch: "mips"})
+	if _, ok := err.(ErrPlatformNotSupported); !ok {
+		t.Fatalf("wrong error type %T (%v); want ErrPlatformNotSupported", err, err)
+	}
+}
+
+func TestDockerCredentialsForHost(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test helper script requires a unix shell")
+	}
+
+	dir, err := ioutil.TempDir("", "terraform-test-docker-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A fake credential helper that knows one host, speaking the same
+	// protocol docker itself uses: host on stdin, JSON on stdout.
+	helper := filepath.Join(dir, "docker-credential-testhelper")
+	helperScript := `#!/bin/sh
+host=$(cat)
+if [ "$host" = "helper.example.com" ] || [ "$host" = "store.example.com" ]; then
+  echo "{\"Username\":\"helper-user\",\"Secret\":\"helper-secret\"}"
+else
+  echo "credentials not found" >&2
+  exit 1
+fi
+`
+	if err := ioutil.WriteFile(helper, []byte(helperScript), 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	config := `{
+		"auths": {
+			"static.example.com": {"auth": "c3RhdGljLXVzZXI6c3RhdGljLXBhc3M="}
+		},
+		"credHelpers": {
+			"helper.example.com": "testhelper"
+		},
+		"credsStore": "testhelper"
+	}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	t.Run("static auth entry", func(t *testing.T) {
+		username, password, ok := dockerCredentialsForHost("static.example.com")
+		if !ok {
+			t.Fatalf("no credentials found; expected some")
+		}
+		if got, want := username, "static-user"; got != want {
+			t.Errorf("wrong username %q; want %q", got, want)
+		}
+		if got, want := password, "static-pass"; got != want {
+			t.Errorf("wrong password %q; want %q", got, want)
+		}
+	})
+
+	t.Run("per-host credential helper", func(t *testing.T) {
+		username, password, ok := dockerCredentialsForHost("helper.example.com")
+		if !ok {
+			t.Fatalf("no credentials found; expected some")
+		}
+		if got, want := username, "helper-user"; got != want {
+			t.Errorf("wrong username %q; want %q", got, want)
+		}
+		if got, want := password, "helper-secret"; got != want {
+			t.Errorf("wrong password %q; want %q", got, want)
+		}
+	})
+
+	t.Run("default credsStore helper", func(t *testing.T) {
+		if _, _, ok := dockerCredentialsForHost("store.example.com"); !ok {
+			t.Fatalf("no credentials found; expected some from the credsStore helper")
+		}
+	})
+
+	t.Run("helper has no credentials", func(t *testing.T) {
+		if _, _, ok := dockerCredentialsForHost("unknown.example.com"); ok {
+			t.Fatalf("credentials found; expected none")
+		}
+	})
+}
@@ -22,6 +22,7 @@ const (
 	officialProvider
 	partnerProvider
 	communityProvider
+	signedMirrorPackage
 )
 
 // PackageAuthenticationResult is returned from a PackageAuthentication
@@ -44,6 +45,7 @@ func (t *PackageAuthenticationResult) String() string {
 		"official provider",
 		"partner provider",
 		"community provider",
+		"signed by a trusted mirror key",
 	}[t.result]
 }
 
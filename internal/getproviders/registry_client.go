@@ -21,7 +21,6 @@ import (
 
 	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/helper/logging"
-	"github.com/hashicorp/terraform/httpclient"
 	"github.com/hashicorp/terraform/version"
 )
 
@@ -67,7 +66,7 @@ type registryClient struct {
 }
 
 func newRegistryClient(baseURL *url.URL, creds svcauth.HostCredentials) *registryClient {
-	httpClient := httpclient.New()
+	httpClient := InstallHTTPClient()
 	httpClient.Timeout = requestTimeout
 
 	retryableClient := retryablehttp.NewClient()
@@ -91,30 +90,32 @@ func newRegistryClient(baseURL *url.URL, creds svcauth.HostCredentials) *registr
 }
 
 // ProviderVersions returns the raw version and protocol strings produced by the
-// registry for the given provider.
+// registry for the given provider, along with any advisory warnings the
+// registry attached to the response, such as a notice that the provider has
+// been deprecated.
 //
 // The returned error will be ErrProviderNotKnown if the registry responds with
 // 404 Not Found to indicate that the namespace or provider type are not known,
 // ErrUnauthorized if the registry responds with 401 or 403 status codes, or
 // ErrQueryFailed for any other protocol or operational problem.
-func (c *registryClient) ProviderVersions(addr addrs.Provider) (map[string][]string, error) {
+func (c *registryClient) ProviderVersions(addr addrs.Provider) (map[string][]string, []string, error) {
 	endpointPath, err := url.Parse(path.Join(addr.Namespace, addr.Type, "versions"))
 	if err != nil {
 		// Should never happen because we're constructing this from
 		// already-validated components.
-		return nil, err
+		return nil, nil, err
 	}
 	endpointURL := c.baseURL.ResolveReference(endpointPath)
 
 	req, err := retryablehttp.NewRequest("GET", endpointURL.String(), nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	c.addHeadersToRequest(req.Request)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, c.errQueryFailed(addr, err)
+		return nil, nil, c.errQueryFailed(addr, err)
 	}
 	defer resp.Body.Close()
 
@@ -122,13 +123,13 @@ func (c *registryClient) ProviderVersions(addr addrs.Provider) (map[string][]str
 	case http.StatusOK:
 		// Great!
 	case http.StatusNotFound:
-		return nil, ErrProviderNotKnown{
+		return nil, nil, ErrProviderNotKnown{
 			Provider: addr,
 		}
 	case http.StatusUnauthorized, http.StatusForbidden:
-		return nil, c.errUnauthorized(addr.Hostname)
+		return nil, nil, c.errUnauthorized(addr.Hostname)
 	default:
-		return nil, c.errQueryFailed(addr, errors.New(resp.Status))
+		return nil, nil, c.errQueryFailed(addr, errors.New(resp.Status))
 	}
 
 	// We ignore the platforms portion of the response body, because the
@@ -138,24 +139,33 @@ func (c *registryClient) ProviderVersions(addr addrs.Provider) (map[string][]str
 		Versions []struct {
 			Version   string   `json:"version"`
 			Protocols []string `json:"protocols"`
+			Warnings  []string `json:"warnings"`
 		} `json:"versions"`
+		Warnings []string `json:"warnings"`
 	}
 	var body ResponseBody
 
 	dec := json.NewDecoder(resp.Body)
 	if err := dec.Decode(&body); err != nil {
-		return nil, c.errQueryFailed(addr, err)
+		return nil, nil, c.errQueryFailed(addr, err)
 	}
 
 	if len(body.Versions) == 0 {
-		return nil, nil
+		return nil, body.Warnings, nil
 	}
 
+	// Response-level warnings apply to the provider as a whole, while a
+	// warning attached to a particular version entry gets that version
+	// prepended so the user can tell which release it is about.
+	warnings := body.Warnings
 	ret := make(map[string][]string, len(body.Versions))
 	for _, v := range body.Versions {
 		ret[v.Version] = v.Protocols
+		for _, warning := range v.Warnings {
+			warnings = append(warnings, fmt.Sprintf("%s %s", v.Version, warning))
+		}
 	}
-	return ret, nil
+	return ret, warnings, nil
 }
 
 // PackageMeta returns metadata about a distribution package for a provider.
@@ -361,7 +371,7 @@ func (c *registryClient) PackageMeta(provider addrs.Provider, version Version, t
 // findClosestProtocolCompatibleVersion searches for the provider version with the closest protocol match.
 func (c *registryClient) findClosestProtocolCompatibleVersion(provider addrs.Provider, version Version) (Version, error) {
 	var match Version
-	available, err := c.ProviderVersions(provider)
+	available, _, err := c.ProviderVersions(provider)
 	if err != nil {
 		return UnspecifiedVersion, err
 	}
@@ -217,6 +217,12 @@ func fakeRegistryHandler(resp http.ResponseWriter, req *http.Request) {
 			resp.Header().Set("Content-Type", "application/json")
 			resp.WriteHeader(200)
 			resp.Write([]byte(`{"versions":[{"version":"1.0.0","protocols":["0.1"]}]}`))
+		case "weaksauce/deprecated":
+			resp.Header().Set("Content-Type", "application/json")
+			resp.WriteHeader(200)
+			// A response-level warning applies to the provider as a whole,
+			// while a warning on a version entry is about that release only.
+			resp.Write([]byte(`{"versions":[{"version":"1.0.0","protocols":["5.0"],"warnings":["is deprecated: use the happycloud provider instead"]}],"warnings":["this provider is no longer maintained"]}`))
 		case "weaksauce/no-versions":
 			resp.Header().Set("Content-Type", "application/json")
 			resp.WriteHeader(200)
@@ -335,7 +341,7 @@ func TestProviderVersions(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			gotVersions, err := client.ProviderVersions(test.provider)
+			gotVersions, _, err := client.ProviderVersions(test.provider)
 
 			if err != nil {
 				if test.wantErr == "" {
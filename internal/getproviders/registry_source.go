@@ -28,23 +28,27 @@ func NewRegistrySource(services *disco.Disco) *RegistrySource {
 // AvailableVersions returns all of the versions available for the provider
 // with the given address, or an error if that result cannot be determined.
 //
+// The warnings in the result carry any advisory messages the registry
+// attached to its response, such as a notice that the provider has been
+// deprecated. They never cause the query to fail.
+//
 // If the request fails, the returned error might be an value of
 // ErrHostNoProviders, ErrHostUnreachable, ErrUnauthenticated,
 // ErrProviderNotKnown, or ErrQueryFailed. Callers must be defensive and
 // expect errors of other types too, to allow for future expansion.
-func (s *RegistrySource) AvailableVersions(provider addrs.Provider) (VersionList, error) {
+func (s *RegistrySource) AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error) {
 	client, err := s.registryClient(provider.Hostname)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	versionProtosMap, err := client.ProviderVersions(provider)
+	versionProtosMap, warnings, err := client.ProviderVersions(provider)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if len(versionProtosMap) == 0 {
-		return nil, nil
+		return nil, warnings, nil
 	}
 
 	// We ignore everything except the version numbers here because our goal
@@ -65,7 +69,7 @@ func (s *RegistrySource) AvailableVersions(provider addrs.Provider) (VersionList
 	for str := range versionProtosMap {
 		v, err := ParseVersion(str)
 		if err != nil {
-			return nil, ErrQueryFailed{
+			return nil, nil, ErrQueryFailed{
 				Provider: provider,
 				Wrapped:  fmt.Errorf("registry response includes invalid version string %q: %s", str, err),
 			}
@@ -73,7 +77,7 @@ func (s *RegistrySource) AvailableVersions(provider addrs.Provider) (VersionList
 		ret = append(ret, v)
 	}
 	ret.Sort() // lowest precedence first, preserving order when equal precedence
-	return ret, nil
+	return ret, warnings, nil
 }
 
 // PackageMeta returns metadata about the location and capabilities of
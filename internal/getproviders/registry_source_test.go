@@ -67,7 +67,7 @@ func TestSourceAvailableVersions(t *testing.T) {
 				Type:      parts[2],
 			}
 
-			gotVersions, err := source.AvailableVersions(providerAddr)
+			gotVersions, _, err := source.AvailableVersions(providerAddr)
 
 			if err != nil {
 				if test.wantErr == "" {
@@ -99,6 +99,31 @@ func TestSourceAvailableVersions(t *testing.T) {
 
 }
 
+func TestSourceAvailableVersionsWarnings(t *testing.T) {
+	source, _, close := testRegistrySource(t)
+	defer close()
+
+	provider := addrs.Provider{
+		Hostname:  svchost.Hostname("example.com"),
+		Namespace: "weaksauce",
+		Type:      "deprecated",
+	}
+	gotVersions, gotWarnings, err := source.AvailableVersions(provider)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := len(gotVersions), 1; got != want {
+		t.Fatalf("wrong number of versions %d; want %d", got, want)
+	}
+	wantWarnings := Warnings{
+		"this provider is no longer maintained",
+		"1.0.0 is deprecated: use the happycloud provider instead",
+	}
+	if diff := cmp.Diff(wantWarnings, gotWarnings); diff != "" {
+		t.Errorf("wrong warnings\n%s", diff)
+	}
+}
+
 func TestSourcePackageMeta(t *testing.T) {
 	source, baseURL, close := testRegistrySource(t)
 	defer close()
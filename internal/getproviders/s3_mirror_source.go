@@ -0,0 +1,221 @@
+package getproviders
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// S3MirrorSource is a Source that reads provider metadata and packages from
+// an S3 bucket (or an S3-compatible store such as MinIO) laid out using the
+// same index and package structure as the HTTP network mirror protocol, so
+// that an existing mirror bucket can be consumed directly without fronting
+// it with an HTTP server.
+//
+// The expected object layout under the configured prefix is:
+//
+//     <hostname>/<namespace>/<type>/index.json
+//     <hostname>/<namespace>/<type>/<version>.json
+//     <hostname>/<namespace>/<type>/terraform-provider-<type>_<version>_<os>_<arch>.zip
+//
+// Credentials come from the standard AWS credential chain: environment
+// variables, shared credentials files, and instance or task roles.
+type S3MirrorSource struct {
+	bucket string
+	prefix string
+	client *s3.S3
+}
+
+var _ Source = (*S3MirrorSource)(nil)
+
+// NewS3MirrorSource constructs and returns a new S3-backed mirror source
+// reading from the given bucket.
+//
+// prefix may be empty to read from the root of the bucket. region selects
+// the bucket's AWS region, and endpoint may name an alternative
+// S3-compatible API endpoint, in which case path-style addressing is used
+// because virtual-hosted addressing rarely works outside AWS itself.
+func NewS3MirrorSource(bucket, prefix, region, endpoint string) (*S3MirrorSource, error) {
+	config := aws.NewConfig()
+	if region != "" {
+		config = config.WithRegion(region)
+	}
+	if endpoint != "" {
+		config = config.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure AWS session for S3 mirror: %s", err)
+	}
+	return &S3MirrorSource{
+		bucket: bucket,
+		prefix: strings.Trim(prefix, "/"),
+		client: s3.New(sess),
+	}, nil
+}
+
+// objectKey returns the bucket key for the given mirror-relative path.
+func (s *S3MirrorSource) objectKey(relPath string) string {
+	if s.prefix == "" {
+		return relPath
+	}
+	return s.prefix + "/" + relPath
+}
+
+// providerDir returns the mirror-relative directory holding the objects for
+// the given provider.
+func (s *S3MirrorSource) providerDir(provider addrs.Provider) string {
+	return fmt.Sprintf("%s/%s/%s", provider.Hostname.ForDisplay(), provider.Namespace, provider.Type)
+}
+
+// AvailableVersions reads the provider's index.json object and returns the
+// versions it declares.
+func (s *S3MirrorSource) AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error) {
+	var index struct {
+		Versions map[string]struct{} `json:"versions"`
+	}
+	key := s.objectKey(s.providerDir(provider) + "/index.json")
+	err := s.getJSONObject(key, &index)
+	if err != nil {
+		if err == errS3NotFound {
+			return nil, nil, ErrProviderNotKnown{Provider: provider}
+		}
+		return nil, nil, err
+	}
+
+	ret := make(VersionList, 0, len(index.Versions))
+	for versionStr := range index.Versions {
+		v, err := ParseVersion(versionStr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("S3 mirror index for %s lists invalid version %q: %s", provider.ForDisplay(), versionStr, err)
+		}
+		ret = append(ret, v)
+	}
+	ret.Sort()
+	return ret, nil, nil
+}
+
+// PackageMeta reads the version's metadata object to find the archive for
+// the requested platform and then downloads that archive into a temporary
+// file.
+func (s *S3MirrorSource) PackageMeta(provider addrs.Provider, version Version, target Platform) (PackageMeta, error) {
+	var meta struct {
+		Archives map[string]struct {
+			URL string `json:"url"`
+		} `json:"archives"`
+	}
+	dir := s.providerDir(provider)
+	key := s.objectKey(fmt.Sprintf("%s/%s.json", dir, version.String()))
+	err := s.getJSONObject(key, &meta)
+	if err != nil {
+		if err == errS3NotFound {
+			return PackageMeta{}, fmt.Errorf("S3 mirror has no metadata for %s v%s", provider.ForDisplay(), version.String())
+		}
+		return PackageMeta{}, err
+	}
+
+	archive, exists := meta.Archives[target.String()]
+	if !exists {
+		return PackageMeta{}, ErrPlatformNotSupported{
+			Provider: provider,
+			Version:  version,
+			Platform: target,
+		}
+	}
+
+	// As in the HTTP mirror protocol, the archive URL is relative to the
+	// metadata object that named it.
+	archiveKey := s.objectKey(dir + "/" + archive.URL)
+	localFilename, err := s.fetchObject(archiveKey)
+	if err != nil {
+		return PackageMeta{}, fmt.Errorf("failed to download %s from S3 mirror: %s", archiveKey, err)
+	}
+
+	return PackageMeta{
+		Provider:       provider,
+		Version:        version,
+		TargetPlatform: target,
+		Filename:       archive.URL,
+		Location:       PackageLocalArchive(localFilename),
+	}, nil
+}
+
+// errS3NotFound is an internal sentinel for a missing object, which the
+// calling methods translate into whichever error type suits what they were
+// looking up.
+var errS3NotFound = fmt.Errorf("not found")
+
+// getJSONObject fetches the object with the given key and decodes its
+// content as JSON into target.
+func (s *S3MirrorSource) getJSONObject(key string, target interface{}) error {
+	resp, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if s3ObjectNotFound(err) {
+			return errS3NotFound
+		}
+		return fmt.Errorf("failed to read s3://%s/%s: %s", s.bucket, key, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("invalid content in s3://%s/%s: %s", s.bucket, key, err)
+	}
+	return nil
+}
+
+// fetchObject downloads the object with the given key into a temporary file
+// and returns the file's path.
+func (s *S3MirrorSource) fetchObject(key string) (string, error) {
+	resp, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	f, err := ioutil.TempFile("", "terraform-provider-s3-mirror")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, resp.Body)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// s3ObjectNotFound recognizes the error chain produced by GetObject for a
+// missing object or bucket.
+func s3ObjectNotFound(err error) bool {
+	for err != nil {
+		if awsErr, ok := err.(awserr.Error); ok {
+			switch awsErr.Code() {
+			case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, "NotFound":
+				return true
+			}
+			err = awsErr.OrigErr()
+			continue
+		}
+		break
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package getproviders
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// testS3Mirror starts a fake path-style S3 server containing a mirror for
+// a single provider, terraform.io/test/thing, and returns an S3MirrorSource
+// configured to read from it.
+func testS3Mirror(t *testing.T) (*S3MirrorSource, func()) {
+	t.Helper()
+
+	objects := map[string]string{
+		"mirror/terraform.io/test/thing/index.json": `{
+			"versions": {
+				"1.0.0": {},
+				"2.1.0": {}
+			}
+		}`,
+		"mirror/terraform.io/test/thing/2.1.0.json": `{
+			"archives": {
+				"linux_amd64": {"url": "terraform-provider-thing_2.1.0_linux_amd64.zip"}
+			}
+		}`,
+		"mirror/terraform.io/test/thing/terraform-provider-thing_2.1.0_linux_amd64.zip": "placeholder-zip-contents",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		// With path-style addressing the first path segment is the bucket
+		// name and the rest is the object key.
+		const bucketPrefix = "/test-bucket/"
+		if len(req.URL.Path) < len(bucketPrefix) || req.URL.Path[:len(bucketPrefix)] != bucketPrefix {
+			resp.WriteHeader(404)
+			return
+		}
+		content, exists := objects[req.URL.Path[len(bucketPrefix):]]
+		if !exists {
+			resp.WriteHeader(404)
+			return
+		}
+		resp.Write([]byte(content))
+	}))
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("placeholder", "placeholder", ""),
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	if err != nil {
+		server.Close()
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	source := &S3MirrorSource{
+		bucket: "test-bucket",
+		prefix: "mirror",
+		client: s3.New(sess),
+	}
+	return source, server.Close
+}
+
+func TestS3MirrorSourceAvailableVersions(t *testing.T) {
+	source, close := testS3Mirror(t)
+	defer close()
+
+	got, _, err := source.AvailableVersions(addrs.MustParseProviderSourceString("terraform.io/test/thing"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := VersionList{
+		MustParseVersion("1.0.0"),
+		MustParseVersion("2.1.0"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong result\n%s", diff)
+	}
+}
+
+func TestS3MirrorSourceAvailableVersions_unknownProvider(t *testing.T) {
+	source, close := testS3Mirror(t)
+	defer close()
+
+	provider := addrs.MustParseProviderSourceString("terraform.io/test/nonexist")
+	_, _, err := source.AvailableVersions(provider)
+	if err == nil {
+		t.Fatalf("succeeded; expected error")
+	}
+	if got, want := err.(ErrProviderNotKnown).Provider, provider; got != want {
+		t.Errorf("wrong provider in error %s; want %s", got, want)
+	}
+}
+
+func TestS3MirrorSourcePackageMeta(t *testing.T) {
+	source, close := testS3Mirror(t)
+	defer close()
+
+	provider := addrs.MustParseProviderSourceString("terraform.io/test/thing")
+	version := MustParseVersion("2.1.0")
+
+	t.Run("available platform", func(t *testing.T) {
+		got, err := source.PackageMeta(provider, version, Platform{"linux", "amd64"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got.Provider != provider {
+			t.Errorf("wrong provider %s; want %s", got.Provider, provider)
+		}
+		if got.Filename != "terraform-provider-thing_2.1.0_linux_amd64.zip" {
+			t.Errorf("wrong filename %q", got.Filename)
+		}
+		localFilename, ok := got.Location.(PackageLocalArchive)
+		if !ok {
+			t.Fatalf("wrong location type %T; want PackageLocalArchive", got.Location)
+		}
+		defer os.Remove(string(localFilename))
+		content, err := ioutil.ReadFile(string(localFilename))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(content) != "placeholder-zip-contents" {
+			t.Errorf("wrong content %q in downloaded archive", string(content))
+		}
+	})
+
+	t.Run("unavailable platform", func(t *testing.T) {
+		_, err := source.PackageMeta(provider, version, Platform{"plan9", "mips"})
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		if _, ok := err.(ErrPlatformNotSupported); !ok {
+			t.Fatalf("wrong error type %T; want ErrPlatformNotSupported", err)
+		}
+	})
+}
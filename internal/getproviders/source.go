@@ -7,6 +7,12 @@ import (
 // A Source can query a particular source for information about providers
 // that are available to install.
 type Source interface {
-	AvailableVersions(provider addrs.Provider) (VersionList, error)
+	AvailableVersions(provider addrs.Provider) (VersionList, Warnings, error)
 	PackageMeta(provider addrs.Provider, version Version, target Platform) (PackageMeta, error)
 }
+
+// Warnings is a list of advisory messages that a source can attach to a
+// successful AvailableVersions result, such as a registry reporting that a
+// provider is deprecated. Warnings never make an operation fail; they exist
+// only to be shown to the user.
+type Warnings = []string
@@ -0,0 +1,144 @@
+package providercache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+// The global cache directory carries two sidecar files alongside its
+// packages. The access file records when each package was last linked into
+// a working directory, because filesystem atime is commonly disabled and
+// mtime reflects only installation. The users file records the local cache
+// directories that have linked packages out of this cache, so that eviction
+// can consult their lock files and never remove a package that one of them
+// still references.
+const (
+	cacheAccessFilename = ".terraform-cache-access.json"
+	cacheUsersFilename  = ".terraform-cache-users.json"
+)
+
+// cachePackageKey produces the key under which a package's last access time
+// is recorded in the access sidecar file.
+func cachePackageKey(cached *CachedProvider) string {
+	return cached.Provider.String() + "/" + cached.Version.String()
+}
+
+// markCacheUse records that the given package was just used by the local
+// cache directory at userBaseDir, taking the cache directory lock for the
+// duration. Failures here are logged only, because losing an access record
+// merely makes the package a slightly earlier eviction candidate.
+func (d *Dir) markCacheUse(cached *CachedProvider, userBaseDir string) {
+	unlock, err := lockCacheDir(d.baseDir)
+	if err != nil {
+		log.Printf("[WARN] providercache: cannot lock cache %s to record package use: %s", d.baseDir, err)
+		return
+	}
+	defer unlock()
+	d.markCacheUseLocked(cached, userBaseDir)
+}
+
+// markCacheUseLocked is the body of markCacheUse, for callers that already
+// hold the cache directory lock.
+func (d *Dir) markCacheUseLocked(cached *CachedProvider, userBaseDir string) {
+	access := readCacheAccessTimes(d.baseDir)
+	if access == nil {
+		access = make(map[string]time.Time)
+	}
+	access[cachePackageKey(cached)] = time.Now()
+	writeCacheSidecar(d.baseDir, cacheAccessFilename, access)
+
+	if userBaseDir == "" {
+		return
+	}
+	absUser, err := filepath.Abs(userBaseDir)
+	if err != nil {
+		return
+	}
+	users := readCacheUsers(d.baseDir)
+	for _, existing := range users {
+		if existing == absUser {
+			return
+		}
+	}
+	writeCacheSidecar(d.baseDir, cacheUsersFilename, append(users, absUser))
+}
+
+// readCacheAccessTimes returns the recorded last-access times for packages
+// in the given cache directory. A missing or damaged sidecar file yields an
+// empty result, in which case eviction falls back to installation times.
+func readCacheAccessTimes(baseDir string) map[string]time.Time {
+	var access map[string]time.Time
+	readCacheSidecar(baseDir, cacheAccessFilename, &access)
+	return access
+}
+
+// readCacheUsers returns the local cache directories recorded as having
+// linked packages out of the given cache directory.
+func readCacheUsers(baseDir string) []string {
+	var users []string
+	readCacheSidecar(baseDir, cacheUsersFilename, &users)
+	return users
+}
+
+func readCacheSidecar(baseDir, filename string, into interface{}) {
+	buf, err := ioutil.ReadFile(filepath.Join(baseDir, filename))
+	if err != nil {
+		return // no sidecar yet
+	}
+	if err := json.Unmarshal(buf, into); err != nil {
+		log.Printf("[WARN] providercache: ignoring invalid sidecar file %s in %s: %s", filename, baseDir, err)
+	}
+}
+
+func writeCacheSidecar(baseDir, filename string, content interface{}) {
+	buf, err := json.Marshal(content)
+	if err != nil {
+		return
+	}
+	path := filepath.Join(baseDir, filename)
+	if err := ioutil.WriteFile(path, buf, 0644); err != nil {
+		log.Printf("[WARN] providercache: failed to write sidecar file %s: %s", path, err)
+	}
+}
+
+// lockedSelections gathers the provider versions referenced by the lock
+// files of all of the recorded users of the given cache directory. Users
+// whose lock file no longer exists are dropped from the users sidecar,
+// since their working directory has evidently been cleaned up or moved.
+//
+// The ok result is false if any lock file exists but cannot be read, in
+// which case we cannot know what it references and the caller must not
+// evict anything at all.
+func lockedSelections(baseDir string) (ret []getproviders.Selections, ok bool) {
+	users := readCacheUsers(baseDir)
+	if len(users) == 0 {
+		return nil, true
+	}
+
+	ok = true
+	active := users[:0]
+	for _, userDir := range users {
+		if _, err := os.Stat(filepath.Join(userDir, "selections.json")); err != nil {
+			continue // this working directory is gone
+		}
+		selections, err := SelectedVersions(userDir)
+		if err != nil {
+			log.Printf("[WARN] providercache: cannot read lock file in %s: %s", userDir, err)
+			active = append(active, userDir)
+			ok = false
+			continue
+		}
+		active = append(active, userDir)
+		ret = append(ret, selections)
+	}
+	if len(active) != len(users) {
+		writeCacheSidecar(baseDir, cacheUsersFilename, active)
+	}
+	return ret, ok
+}
@@ -0,0 +1,149 @@
+package providercache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+func TestEvictFromGlobalCache_sidecars(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	cacheDirPath := filepath.Join(tmpDirPath, "cache")
+	platform := getproviders.Platform{OS: "linux", Arch: "amd64"}
+
+	makePackage := func(name, version string, lastUsed time.Time) string {
+		pkgDir := filepath.Join(cacheDirPath, "registry.terraform.io", "hashicorp", name, version, "linux_amd64")
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := ioutil.WriteFile(filepath.Join(pkgDir, "terraform-provider-"+name), []byte("exe"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(pkgDir, lastUsed, lastUsed); err != nil {
+			t.Fatal(err)
+		}
+		return pkgDir
+	}
+
+	now := time.Now()
+	old := now.Add(-90 * 24 * time.Hour)
+	unprotected := makePackage("null", "2.0.0", old)
+	recentlyAccessed := makePackage("template", "2.1.0", old)
+	lockedElsewhere := makePackage("random", "1.2.0", old)
+
+	// The template package's directory mtime is ancient, but the access
+	// sidecar records a recent use, which must take precedence over mtime.
+	access := map[string]time.Time{
+		"registry.terraform.io/hashicorp/template/2.1.0": now,
+	}
+	buf, err := json.Marshal(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cacheDirPath, cacheAccessFilename), buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The random package is referenced by the lock file of another working
+	// directory recorded as a user of this cache.
+	userDir := filepath.Join(tmpDirPath, "other", ".terraform", "plugins")
+	if err := os.MkdirAll(userDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	lockContent := []byte(`{"registry.terraform.io/hashicorp/random": {"version": "1.2.0", "hash": "h1:placeholder"}}`)
+	if err := ioutil.WriteFile(filepath.Join(userDir, "selections.json"), lockContent, 0644); err != nil {
+		t.Fatal(err)
+	}
+	users, err := json.Marshal([]string{userDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cacheDirPath, cacheUsersFilename), users, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	targetDir := NewDirWithPlatform(filepath.Join(tmpDirPath, "target"), platform)
+	installer := NewInstaller(targetDir, getproviders.MultiSource(nil))
+	installer.SetGlobalCacheDir(NewDirWithPlatform(cacheDirPath, platform))
+	installer.SetGlobalCacheEvictionPolicy(CacheEvictionPolicy{
+		MaxAge: 30 * 24 * time.Hour,
+	})
+
+	installer.evictFromGlobalCache(nil)
+
+	if _, err := os.Stat(unprotected); !os.IsNotExist(err) {
+		t.Errorf("unprotected old package %s was not evicted", unprotected)
+	}
+	if _, err := os.Stat(recentlyAccessed); err != nil {
+		t.Errorf("recently-accessed package %s was wrongly evicted", recentlyAccessed)
+	}
+	if _, err := os.Stat(lockedElsewhere); err != nil {
+		t.Errorf("package %s referenced by another lock file was wrongly evicted", lockedElsewhere)
+	}
+
+	// The evicted package's access record is gone too, so the sidecar file
+	// can't grow without bound as packages come and go.
+	remaining := readCacheAccessTimes(cacheDirPath)
+	if _, exists := remaining["registry.terraform.io/hashicorp/null/2.0.0"]; exists {
+		t.Errorf("access record for the evicted package was not removed")
+	}
+}
+
+func TestMarkCacheUse(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	cacheDirPath := filepath.Join(tmpDirPath, "cache")
+	if err := os.MkdirAll(cacheDirPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cacheDir := NewDir(cacheDirPath)
+
+	cached := &CachedProvider{
+		Provider:   addrs.NewDefaultProvider("null"),
+		Version:    getproviders.MustParseVersion("2.0.0"),
+		PackageDir: filepath.Join(cacheDirPath, "registry.terraform.io/hashicorp/null/2.0.0/linux_amd64"),
+	}
+	userDir := filepath.Join(tmpDirPath, "work", ".terraform", "plugins")
+
+	before := time.Now()
+	cacheDir.markCacheUse(cached, userDir)
+	// Recording the same user twice must not duplicate the entry.
+	cacheDir.markCacheUse(cached, userDir)
+
+	access := readCacheAccessTimes(cacheDirPath)
+	when, exists := access["registry.terraform.io/hashicorp/null/2.0.0"]
+	if !exists {
+		t.Fatalf("no access record for the used package; have %#v", access)
+	}
+	if when.Before(before.Add(-time.Second)) {
+		t.Errorf("access time %s is implausibly old", when)
+	}
+
+	users := readCacheUsers(cacheDirPath)
+	if got, want := len(users), 1; got != want {
+		t.Fatalf("wrong number of recorded users %d; want %d", got, want)
+	}
+	absUser, err := filepath.Abs(userDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users[0] != absUser {
+		t.Errorf("wrong recorded user %q; want %q", users[0], absUser)
+	}
+}
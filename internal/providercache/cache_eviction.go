@@ -0,0 +1,170 @@
+package providercache
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+// CacheEvictionPolicy describes limits to apply to the global plugin cache
+// directory after a successful installation operation.
+//
+// A zero value for either limit means that the corresponding limit is not
+// enforced, and a wholly-zero policy disables eviction entirely.
+type CacheEvictionPolicy struct {
+	// MaxSize is the maximum total size in bytes of all of the packages in
+	// the cache directory. When the cache exceeds this size, the least
+	// recently used packages are removed until it fits.
+	MaxSize int64
+
+	// MaxAge is the maximum time since a package in the cache was last
+	// used. Packages unused for longer than this are always removed,
+	// regardless of the total cache size.
+	MaxAge time.Duration
+}
+
+// Enabled returns true if the policy calls for any eviction at all.
+func (p CacheEvictionPolicy) Enabled() bool {
+	return p.MaxSize > 0 || p.MaxAge > 0
+}
+
+// SetGlobalCacheEvictionPolicy enables eviction from the installer's global
+// cache directory, applied after each successful call to
+// EnsureProviderVersions. It has no effect unless a global cache directory
+// is also configured with SetGlobalCacheDir.
+func (i *Installer) SetGlobalCacheEvictionPolicy(policy CacheEvictionPolicy) {
+	i.globalCacheEviction = policy
+}
+
+// evictFromGlobalCache applies the installer's eviction policy to its global
+// cache directory, never removing packages that are among the given current
+// selections since those were possibly just linked into the target
+// directory.
+//
+// The cache directory is locked against other Terraform processes for the
+// duration, so that eviction cannot remove a package that a concurrent
+// installation in another working directory is in the middle of using.
+// Failures here are reported only in logs, because a full installation has
+// already succeeded by the time eviction runs and failing the whole
+// operation over cache housekeeping would be disproportionate.
+func (i *Installer) evictFromGlobalCache(selections getproviders.Selections) {
+	if i.globalCacheDir == nil || !i.globalCacheEviction.Enabled() {
+		return
+	}
+	baseDir := i.globalCacheDir.baseDir
+
+	unlock, err := lockCacheDir(baseDir)
+	if err != nil {
+		log.Printf("[WARN] providercache: cannot lock global cache %s for eviction: %s", baseDir, err)
+		return
+	}
+	defer unlock()
+
+	// Beyond the current operation's selections, every lock file recorded
+	// as a user of this cache protects the packages it references. If any
+	// of those lock files cannot be read then we don't know what is safe
+	// to remove, so we evict nothing this time around.
+	locked, ok := lockedSelections(baseDir)
+	if !ok {
+		log.Printf("[WARN] providercache: skipping eviction from %s because not all lock files of its users could be read", baseDir)
+		return
+	}
+	protected := func(provider addrs.Provider, version getproviders.Version) bool {
+		if selections[provider] == version {
+			return true
+		}
+		for _, sels := range locked {
+			if sels[provider] == version {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Last-access times come from the sidecar file where available, falling
+	// back to the package's installation time for packages that predate
+	// access tracking.
+	accessTimes := readCacheAccessTimes(baseDir)
+
+	type cacheEntry struct {
+		cached   *CachedProvider
+		lastUsed time.Time
+		size     int64
+	}
+	var entries []cacheEntry
+	var totalSize int64
+	for provider, cps := range i.globalCacheDir.AllAvailablePackages() {
+		for idx := range cps {
+			cached := &cps[idx]
+			if protected(provider, cached.Version) {
+				continue
+			}
+			info, err := os.Stat(cached.PackageDir)
+			if err != nil {
+				continue
+			}
+			size, err := packageDirSize(cached.PackageDir)
+			if err != nil {
+				continue
+			}
+			lastUsed := info.ModTime()
+			if accessed, exists := accessTimes[cachePackageKey(cached)]; exists && accessed.After(lastUsed) {
+				lastUsed = accessed
+			}
+			entries = append(entries, cacheEntry{
+				cached:   cached,
+				lastUsed: lastUsed,
+				size:     size,
+			})
+			totalSize += size
+		}
+	}
+
+	// Least recently used first, so both limits can evict from the front.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+
+	evicted := false
+	now := time.Now()
+	for _, entry := range entries {
+		tooOld := i.globalCacheEviction.MaxAge > 0 && now.Sub(entry.lastUsed) > i.globalCacheEviction.MaxAge
+		tooBig := i.globalCacheEviction.MaxSize > 0 && totalSize > i.globalCacheEviction.MaxSize
+		if !tooOld && !tooBig {
+			continue
+		}
+		if err := os.RemoveAll(entry.cached.PackageDir); err != nil {
+			log.Printf("[WARN] providercache: failed to evict %s v%s from global cache: %s", entry.cached.Provider, entry.cached.Version, err)
+			continue
+		}
+		totalSize -= entry.size
+		delete(accessTimes, cachePackageKey(entry.cached))
+		evicted = true
+		log.Printf("[TRACE] providercache: evicted %s v%s from global cache %s (last used %s, %d bytes)", entry.cached.Provider, entry.cached.Version, baseDir, entry.lastUsed.Format(time.RFC3339), entry.size)
+	}
+	if evicted {
+		writeCacheSidecar(baseDir, cacheAccessFilename, accessTimes)
+		i.globalCacheDir.invalidateMetaCache()
+	}
+}
+
+// packageDirSize returns the total size in bytes of all of the files in the
+// given package directory.
+func packageDirSize(packageDir string) (int64, error) {
+	var total int64
+	err := filepath.Walk(packageDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,115 @@
+package providercache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+func TestEvictFromGlobalCache(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	cacheDirPath := filepath.Join(tmpDirPath, "cache")
+	platform := getproviders.Platform{OS: "linux", Arch: "amd64"}
+
+	makePackage := func(name, version string, lastUsed time.Time) string {
+		pkgDir := filepath.Join(cacheDirPath, "registry.terraform.io", "hashicorp", name, version, "linux_amd64")
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := ioutil.WriteFile(filepath.Join(pkgDir, "terraform-provider-"+name), []byte("exe"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(pkgDir, lastUsed, lastUsed); err != nil {
+			t.Fatal(err)
+		}
+		return pkgDir
+	}
+
+	now := time.Now()
+	oldUnused := makePackage("null", "2.0.0", now.Add(-90*24*time.Hour))
+	oldSelected := makePackage("random", "1.2.0", now.Add(-90*24*time.Hour))
+	fresh := makePackage("template", "2.1.0", now)
+
+	targetDir := NewDirWithPlatform(filepath.Join(tmpDirPath, "target"), platform)
+	installer := NewInstaller(targetDir, getproviders.MultiSource(nil))
+	installer.SetGlobalCacheDir(NewDirWithPlatform(cacheDirPath, platform))
+	installer.SetGlobalCacheEvictionPolicy(CacheEvictionPolicy{
+		MaxAge: 30 * 24 * time.Hour,
+	})
+
+	// The "random" provider is part of the current selections, so it must
+	// survive eviction even though it exceeds the age limit.
+	selections := getproviders.Selections{
+		addrs.NewDefaultProvider("random"): getproviders.MustParseVersion("1.2.0"),
+	}
+	installer.evictFromGlobalCache(selections)
+
+	if _, err := os.Stat(oldUnused); !os.IsNotExist(err) {
+		t.Errorf("old unused package %s was not evicted", oldUnused)
+	}
+	if _, err := os.Stat(oldSelected); err != nil {
+		t.Errorf("currently-selected package %s was wrongly evicted", oldSelected)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("recently-used package %s was wrongly evicted", fresh)
+	}
+}
+
+func TestEvictFromGlobalCache_maxSize(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	cacheDirPath := filepath.Join(tmpDirPath, "cache")
+	platform := getproviders.Platform{OS: "linux", Arch: "amd64"}
+
+	makePackage := func(name, version string, size int, lastUsed time.Time) string {
+		pkgDir := filepath.Join(cacheDirPath, "registry.terraform.io", "hashicorp", name, version, "linux_amd64")
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := ioutil.WriteFile(filepath.Join(pkgDir, "terraform-provider-"+name), make([]byte, size), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(pkgDir, lastUsed, lastUsed); err != nil {
+			t.Fatal(err)
+		}
+		return pkgDir
+	}
+
+	now := time.Now()
+	oldest := makePackage("null", "2.0.0", 600, now.Add(-2*time.Hour))
+	newest := makePackage("template", "2.1.0", 600, now)
+
+	targetDir := NewDirWithPlatform(filepath.Join(tmpDirPath, "target"), platform)
+	installer := NewInstaller(targetDir, getproviders.MultiSource(nil))
+	installer.SetGlobalCacheDir(NewDirWithPlatform(cacheDirPath, platform))
+	installer.SetGlobalCacheEvictionPolicy(CacheEvictionPolicy{
+		MaxSize: 1000,
+	})
+
+	installer.evictFromGlobalCache(nil)
+
+	// Only the least recently used package needs to go to bring the total
+	// under the limit.
+	if _, err := os.Stat(oldest); !os.IsNotExist(err) {
+		t.Errorf("least recently used package %s was not evicted", oldest)
+	}
+	if _, err := os.Stat(newest); err != nil {
+		t.Errorf("most recently used package %s was wrongly evicted", newest)
+	}
+}
@@ -0,0 +1,76 @@
+package providercache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockCacheDirTimeout is a variant of lockCacheDir that gives up and
+// returns an error if the lock cannot be acquired within the given
+// duration. A timeout of zero or less waits indefinitely, matching
+// lockCacheDir itself.
+func lockCacheDirTimeout(baseDir string, timeout time.Duration) (func(), error) {
+	if timeout <= 0 {
+		return lockCacheDir(baseDir)
+	}
+
+	type lockResult struct {
+		unlock func()
+		err    error
+	}
+	result := make(chan lockResult, 1)
+	go func() {
+		unlock, err := lockCacheDir(baseDir)
+		result <- lockResult{unlock, err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.unlock, r.err
+	case <-time.After(timeout):
+		// The goroutine above is still blocked on the lock; if it does
+		// eventually acquire it then nobody is left to use it, so it must
+		// be released again immediately.
+		go func() {
+			if r := <-result; r.err == nil {
+				r.unlock()
+			}
+		}()
+		holder := ""
+		if pid, ok := readLockFilePid(filepath.Join(baseDir, ".terraform-cache.lock")); ok {
+			holder = fmt.Sprintf(", which is held by process %d", pid)
+		}
+		return nil, fmt.Errorf("timed out after %s waiting for the lock on cache directory %s%s", timeout, baseDir, holder)
+	}
+}
+
+// readLockFilePid returns the pid recorded in the given lock file, if any.
+func readLockFilePid(lockFilename string) (int, bool) {
+	content, err := ioutil.ReadFile(lockFilename)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, true
+}
+
+// writeLockFilePid records our own pid in the lock file we've just locked,
+// for the benefit of other processes waiting on it.
+func writeLockFilePid(f *os.File) {
+	if err := f.Truncate(0); err != nil {
+		return
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return
+	}
+	f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	f.Sync()
+}
@@ -0,0 +1,43 @@
+package providercache
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockCacheDirTimeout(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	// With nobody holding the lock, acquisition should succeed well within
+	// the timeout.
+	unlock, err := lockCacheDirTimeout(baseDir, 5*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// While we're holding the lock, a second acquisition attempt should
+	// time out rather than wait forever. (Locks held on separate file
+	// descriptors conflict even within a single process.)
+	_, err = lockCacheDirTimeout(baseDir, 100*time.Millisecond)
+	if err == nil {
+		t.Fatal("second lock acquisition succeeded; want timeout error")
+	}
+	if !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("wrong error %q; want a mention of timing out", err)
+	}
+
+	// Once the lock is released it should be acquirable again.
+	unlock()
+	unlock2, err := lockCacheDirTimeout(baseDir, 5*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error after unlock: %s", err)
+	}
+	unlock2()
+}
@@ -0,0 +1,72 @@
+// +build !windows
+
+package providercache
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockCacheDir acquires an exclusive advisory lock on the given cache
+// directory, blocking until the lock is available, and returns a function
+// that releases the lock again.
+//
+// The lock is held on a well-known file in the cache root so that separate
+// Terraform processes sharing the same cache directory can coordinate
+// modifications to it. The holder's pid is recorded in the lock file for
+// diagnostic purposes; the operating system releases advisory locks
+// automatically when the holding process exits, so a crashed process
+// cannot leave the cache permanently locked, but we still detect and
+// report a stale pid so the situation is visible in logs.
+func lockCacheDir(baseDir string) (func(), error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, err
+	}
+	lockFilename := filepath.Join(baseDir, ".terraform-cache.lock")
+	f, err := os.OpenFile(lockFilename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try without blocking first so that we can tell the user who we're
+	// waiting on if the lock is contended.
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		if holderPid, ok := readLockFilePid(lockFilename); ok {
+			if cacheLockProcessAlive(holderPid) {
+				log.Printf("[INFO] providercache: waiting for lock on %s held by pid %d", baseDir, holderPid)
+			} else {
+				// The OS has already released the crashed holder's lock,
+				// so the blocking acquisition below will succeed at once;
+				// this just makes the recovery visible.
+				log.Printf("[WARN] providercache: breaking stale lock on %s held by pid %d, which is no longer running", baseDir, holderPid)
+			}
+		}
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	writeLockFilePid(f)
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// cacheLockProcessAlive returns true if the process with the given pid
+// appears to still be running.
+func cacheLockProcessAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// On Unix FindProcess always succeeds, so we probe with signal 0,
+	// which performs the permission and existence checks without
+	// actually delivering a signal.
+	return p.Signal(syscall.Signal(0)) == nil
+}
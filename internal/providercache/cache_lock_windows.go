@@ -0,0 +1,108 @@
+// +build windows
+
+package providercache
+
+import (
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32    = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx = modkernel32.NewProc("LockFileEx")
+)
+
+const (
+	// dwFlags defined for LockFileEx
+	// https://msdn.microsoft.com/en-us/library/windows/desktop/aa365203(v=vs.85).aspx
+	_LOCKFILE_FAIL_IMMEDIATELY = 1
+	_LOCKFILE_EXCLUSIVE_LOCK   = 2
+
+	// dwDesiredAccess for OpenProcess
+	_PROCESS_QUERY_LIMITED_INFORMATION = 0x1000
+)
+
+// lockCacheDir acquires an exclusive lock on the given cache directory,
+// blocking until the lock is available, and returns a function that
+// releases the lock again.
+//
+// The lock is held on a well-known file in the cache root so that separate
+// Terraform processes sharing the same cache directory can coordinate
+// modifications to it. The holder's pid is recorded in the lock file for
+// diagnostic purposes; the operating system releases the lock if the
+// holding process exits, so a crashed process cannot leave the cache
+// permanently locked, but we still detect and report a stale pid so the
+// situation is visible in logs.
+func lockCacheDir(baseDir string) (func(), error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, err
+	}
+	lockFilename := filepath.Join(baseDir, ".terraform-cache.lock")
+	f, err := os.OpenFile(lockFilename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try without blocking first so that we can tell the user who we're
+	// waiting on if the lock is contended.
+	err = lockFileEx(f, _LOCKFILE_EXCLUSIVE_LOCK|_LOCKFILE_FAIL_IMMEDIATELY)
+	if err != nil {
+		if holderPid, ok := readLockFilePid(lockFilename); ok {
+			if cacheLockProcessAlive(holderPid) {
+				log.Printf("[INFO] providercache: waiting for lock on %s held by pid %d", baseDir, holderPid)
+			} else {
+				// The OS has already released the crashed holder's lock,
+				// so the blocking acquisition below will succeed at once;
+				// this just makes the recovery visible.
+				log.Printf("[WARN] providercache: breaking stale lock on %s held by pid %d, which is no longer running", baseDir, holderPid)
+			}
+		}
+		err = lockFileEx(f, _LOCKFILE_EXCLUSIVE_LOCK)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	writeLockFilePid(f)
+	return func() {
+		// Closing the file handle releases the lock.
+		f.Close()
+	}, nil
+}
+
+func lockFileEx(f *os.File, flags uint32) error {
+	ol := new(syscall.Overlapped)
+	r1, _, e1 := syscall.Syscall6(
+		procLockFileEx.Addr(),
+		6,
+		f.Fd(),
+		uintptr(flags),
+		0,              // reserved
+		0,              // bytes low
+		math.MaxUint32, // bytes high
+		uintptr(unsafe.Pointer(ol)),
+	)
+	if r1 == 0 {
+		if e1 != 0 {
+			return error(e1)
+		}
+		return syscall.EINVAL
+	}
+	return nil
+}
+
+// cacheLockProcessAlive returns true if the process with the given pid
+// appears to still be running.
+func cacheLockProcessAlive(pid int) bool {
+	h, err := syscall.OpenProcess(_PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	syscall.CloseHandle(h)
+	return true
+}
@@ -0,0 +1,95 @@
+package providercache
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+// SelectedVersions reads the selections lock file from the given local cache
+// directory base path and returns the provider versions it records.
+//
+// This is for callers that need to know which packages a configuration
+// depends on without constructing a full Installer, such as when deciding
+// which packages in a shared cache are still referenced. If the lock file
+// does not exist, the result is an empty set of selections with no error.
+func SelectedVersions(cacheDirBase string) (getproviders.Selections, error) {
+	lf := &lockFile{
+		filename: filepath.Join(cacheDirBase, "selections.json"),
+	}
+	entries, err := lf.Read()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(getproviders.Selections, len(entries))
+	for provider, entry := range entries {
+		ret[provider] = entry.SelectedVersion
+	}
+	return ret, nil
+}
+
+// Prune removes from the directory any cached packages that are not among
+// the given selections, which would typically be gathered from the lock
+// files of all of the configurations that share the directory as a cache.
+//
+// If dryRun is set then nothing is removed and the result instead describes
+// what a real run would remove. Either way, the removal candidates are
+// returned sorted by provider address and then by version so that reports
+// based on them are deterministic.
+//
+// The directory is locked against concurrent Terraform processes for the
+// duration, so that pruning cannot race with an installation that is in
+// the middle of linking a package out of the cache.
+func (d *Dir) Prune(keep []getproviders.Selections, dryRun bool) ([]CachedProvider, error) {
+	unlock, err := lockCacheDir(d.baseDir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	keptVersion := func(cached *CachedProvider) bool {
+		for _, selections := range keep {
+			if selections[cached.Provider] == cached.Version {
+				return true
+			}
+		}
+		return false
+	}
+
+	var candidates []CachedProvider
+	for _, cps := range d.AllAvailablePackages() {
+		for _, cached := range cps {
+			if keptVersion(&cached) {
+				continue
+			}
+			candidates = append(candidates, cached)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Provider != candidates[j].Provider {
+			return candidates[i].Provider.LessThan(candidates[j].Provider)
+		}
+		return candidates[i].Version.LessThan(candidates[j].Version)
+	})
+
+	if dryRun {
+		return candidates, nil
+	}
+
+	removed := candidates[:0]
+	for _, cached := range candidates {
+		if err := os.RemoveAll(cached.PackageDir); err != nil {
+			d.invalidateMetaCache()
+			return removed, err
+		}
+		log.Printf("[TRACE] providercache: pruned %s v%s from cache %s", cached.Provider, cached.Version, d.baseDir)
+		removed = append(removed, cached)
+	}
+	if len(removed) > 0 {
+		d.invalidateMetaCache()
+	}
+	return removed, nil
+}
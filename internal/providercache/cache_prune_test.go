@@ -0,0 +1,125 @@
+package providercache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+func TestDirPrune(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	cacheDirPath := filepath.Join(tmpDirPath, "cache")
+	platform := getproviders.Platform{OS: "linux", Arch: "amd64"}
+
+	makePackage := func(name, version string) string {
+		pkgDir := filepath.Join(cacheDirPath, "registry.terraform.io", "hashicorp", name, version, "linux_amd64")
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := ioutil.WriteFile(filepath.Join(pkgDir, "terraform-provider-"+name), []byte("exe"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pkgDir
+	}
+
+	selectedPkg := makePackage("null", "2.0.0")
+	unusedOld := makePackage("null", "1.0.0")
+	unusedOther := makePackage("random", "1.2.0")
+
+	keep := []getproviders.Selections{
+		{
+			addrs.NewDefaultProvider("null"): getproviders.MustParseVersion("2.0.0"),
+		},
+	}
+
+	cacheDir := NewDirWithPlatform(cacheDirPath, platform)
+
+	// A dry run reports what would be removed without removing anything.
+	wouldRemove, err := cacheDir.Prune(keep, true)
+	if err != nil {
+		t.Fatalf("dry-run Prune failed: %s", err)
+	}
+	if got, want := len(wouldRemove), 2; got != want {
+		t.Fatalf("wrong number of dry-run candidates %d; want %d", got, want)
+	}
+	// Candidates are sorted by provider address, so null comes before random.
+	if got, want := wouldRemove[0].Provider, addrs.NewDefaultProvider("null"); got != want {
+		t.Errorf("wrong first candidate %s; want %s", got, want)
+	}
+	if got, want := wouldRemove[1].Provider, addrs.NewDefaultProvider("random"); got != want {
+		t.Errorf("wrong second candidate %s; want %s", got, want)
+	}
+	for _, pkgDir := range []string{selectedPkg, unusedOld, unusedOther} {
+		if _, err := os.Stat(pkgDir); err != nil {
+			t.Errorf("dry run removed %s", pkgDir)
+		}
+	}
+
+	// A real run removes exactly the dry-run candidates.
+	removed, err := cacheDir.Prune(keep, false)
+	if err != nil {
+		t.Fatalf("Prune failed: %s", err)
+	}
+	if got, want := len(removed), 2; got != want {
+		t.Fatalf("wrong number of removed packages %d; want %d", got, want)
+	}
+	if _, err := os.Stat(selectedPkg); err != nil {
+		t.Errorf("selected package %s was wrongly removed", selectedPkg)
+	}
+	for _, pkgDir := range []string{unusedOld, unusedOther} {
+		if _, err := os.Stat(pkgDir); !os.IsNotExist(err) {
+			t.Errorf("unused package %s was not removed", pkgDir)
+		}
+	}
+}
+
+func TestSelectedVersions(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// A missing lock file is an empty set of selections, not an error.
+	selections, err := SelectedVersions(tmpDirPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(selections) != 0 {
+		t.Errorf("wrong selections %#v with no lock file; want none", selections)
+	}
+
+	raw := map[string]map[string]interface{}{
+		"registry.terraform.io/hashicorp/null": {
+			"version": "2.0.0",
+			"hash":    "h1:placeholder",
+		},
+	}
+	buf, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDirPath, "selections.json"), buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	selections, err = SelectedVersions(tmpDirPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := getproviders.MustParseVersion("2.0.0")
+	if got := selections[addrs.NewDefaultProvider("null")]; got != want {
+		t.Errorf("wrong selected version %s; want %s", got, want)
+	}
+}
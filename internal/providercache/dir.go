@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/internal/getproviders"
@@ -30,6 +31,11 @@ type Dir struct {
 	baseDir        string
 	targetPlatform getproviders.Platform
 
+	// mu protects metaCache, because the installer may read from and write
+	// to a particular Dir from several goroutines at once when it is
+	// installing multiple provider packages concurrently.
+	mu sync.Mutex
+
 	// metaCache is a cache of the metadata of relevant packages available in
 	// the cache directory last time we scanned it. This can be nil to indicate
 	// that the cache is cold. The cache will be invalidated (set back to nil)
@@ -40,6 +46,11 @@ type Dir struct {
 	// explicitly defines using the same directory for multiple purposes
 	// as undefined behavior.
 	metaCache map[addrs.Provider][]CachedProvider
+
+	// forceCopy makes installations into this directory always deep-copy
+	// package contents rather than symlinking or hard-linking them from
+	// their source, for filesystems where links cause problems.
+	forceCopy bool
 }
 
 // NewDir creates and returns a new Dir object that will read and write
@@ -68,6 +79,13 @@ func NewDirWithPlatform(baseDir string, platform getproviders.Platform) *Dir {
 	}
 }
 
+// SetForceCopy makes future installations into this directory always
+// deep-copy package contents instead of preferring symlinks or hard links
+// from the source directory.
+func (d *Dir) SetForceCopy(force bool) {
+	d.forceCopy = force
+}
+
 // AllAvailablePackages returns a description of all of the packages already
 // present in the directory. The cache entries are grouped by the provider
 // they relate to and then sorted by version precedence, with highest
@@ -79,6 +97,8 @@ func NewDirWithPlatform(baseDir string, platform getproviders.Platform) *Dir {
 // The caller is forbidden from modifying the returned data structure in any
 // way, even though the Go type system permits it.
 func (d *Dir) AllAvailablePackages() map[addrs.Provider][]CachedProvider {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if err := d.fillMetaCache(); err != nil {
 		log.Printf("[WARN] Failed to scan provider cache directory %s: %s", d.baseDir, err)
 		return nil
@@ -90,6 +110,8 @@ func (d *Dir) AllAvailablePackages() map[addrs.Provider][]CachedProvider {
 // ProviderVersion returns the cache entry for the requested provider version,
 // or nil if the requested provider version isn't present in the cache.
 func (d *Dir) ProviderVersion(provider addrs.Provider, version getproviders.Version) *CachedProvider {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if err := d.fillMetaCache(); err != nil {
 		return nil
 	}
@@ -112,6 +134,8 @@ func (d *Dir) ProviderVersion(provider addrs.Provider, version getproviders.Vers
 // version of the requested provider already available in the cache, or nil if
 // there are no versions of that provider available.
 func (d *Dir) ProviderLatestVersion(provider addrs.Provider) *CachedProvider {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if err := d.fillMetaCache(); err != nil {
 		return nil
 	}
@@ -124,6 +148,17 @@ func (d *Dir) ProviderLatestVersion(provider addrs.Provider) *CachedProvider {
 	return &entries[0]
 }
 
+// invalidateMetaCache throws away any cached scan results, forcing the
+// next read call to re-scan the directory contents. It is safe to call
+// concurrently with the read methods.
+func (d *Dir) invalidateMetaCache() {
+	d.mu.Lock()
+	d.metaCache = nil
+	d.mu.Unlock()
+}
+
+// fillMetaCache scans the directory contents if no previous scan result is
+// cached. It must be called with d.mu already held.
 func (d *Dir) fillMetaCache() error {
 	// For d.metaCache we consider nil to be different than a non-nil empty
 	// map, so we can distinguish between having scanned and got an empty
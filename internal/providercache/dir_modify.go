@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/hashicorp/terraform/internal/getproviders"
 )
@@ -19,18 +22,31 @@ func (d *Dir) InstallPackage(ctx context.Context, meta getproviders.PackageMeta)
 		d.baseDir, meta.Provider, meta.Version, d.targetPlatform,
 	)
 
-	// Invalidate our metaCache so that subsequent read calls will re-scan to
-	// incorporate any changes we make here.
-	d.metaCache = nil
+	// Invalidate our metaCache both now and after the installation finishes,
+	// so that read calls made while we're working and afterwards will
+	// re-scan to incorporate any changes we make here.
+	d.invalidateMetaCache()
+	defer d.invalidateMetaCache()
+
+	// An interrupted earlier run can leave staging directories behind, so
+	// we'll discard any we find before installing anything new.
+	cleanStagingDirs(filepath.Dir(newPath))
 
 	log.Printf("[TRACE] providercache.Dir.InstallPackage: installing %s v%s from %s", meta.Provider, meta.Version, meta.Location)
 	switch meta.Location.(type) {
 	case getproviders.PackageHTTPURL:
-		return installFromHTTPURL(ctx, meta, newPath)
+		// Archive extraction goes via a staging directory so that an
+		// interrupted run can never leave a partially-extracted package
+		// at the final path.
+		return installArchiveStaged(newPath, func(stagingPath string) (*getproviders.PackageAuthenticationResult, error) {
+			return installFromHTTPURL(ctx, meta, stagingPath)
+		})
 	case getproviders.PackageLocalArchive:
-		return installFromLocalArchive(ctx, meta, newPath)
+		return installArchiveStaged(newPath, func(stagingPath string) (*getproviders.PackageAuthenticationResult, error) {
+			return installFromLocalArchive(ctx, meta, stagingPath)
+		})
 	case getproviders.PackageLocalDir:
-		return installFromLocalDir(ctx, meta, newPath)
+		return installFromLocalDir(ctx, meta, newPath, d.forceCopy)
 	default:
 		// Should not get here, because the above should be exhaustive for
 		// all implementations of getproviders.Location.
@@ -55,9 +71,19 @@ func (d *Dir) LinkFromOtherCache(entry *CachedProvider) error {
 	currentPath := entry.PackageDir
 	log.Printf("[TRACE] providercache.Dir.LinkFromOtherCache: linking %s v%s from existing cache %s to %s", entry.Provider, entry.Version, currentPath, newPath)
 
-	// Invalidate our metaCache so that subsequent read calls will re-scan to
-	// incorporate any changes we make here.
-	d.metaCache = nil
+	// Invalidate our metaCache both now and after the linking finishes, so
+	// that read calls made while we're working and afterwards will re-scan
+	// to incorporate any changes we make here.
+	d.invalidateMetaCache()
+	defer d.invalidateMetaCache()
+
+	// Mark the source package as recently used, so that a least-recently-used
+	// eviction policy on the other cache won't remove a package that is
+	// still being linked into configurations. This is best-effort only.
+	now := time.Now()
+	if err := os.Chtimes(currentPath, now, now); err != nil {
+		log.Printf("[TRACE] providercache.Dir.LinkFromOtherCache: failed to update timestamp on %s: %s", currentPath, err)
+	}
 
 	// We re-use the process of installing from a local directory here, because
 	// the two operations are fundamentally the same: symlink if possible,
@@ -76,6 +102,6 @@ func (d *Dir) LinkFromOtherCache(entry *CachedProvider) error {
 			entry.Provider.Type, entry.Version, d.targetPlatform),
 		Location: getproviders.PackageLocalDir(currentPath),
 	}
-	_, err := installFromLocalDir(context.TODO(), meta, newPath)
+	_, err := installFromLocalDir(context.TODO(), meta, newPath, d.forceCopy)
 	return err
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/apparentlymart/go-versions/versions"
@@ -68,6 +69,77 @@ func TestInstallPackage(t *testing.T) {
 	}
 }
 
+func TestInstallPackage_interrupted(t *testing.T) {
+	// This test simulates a re-run after an installation that was killed
+	// partway through extraction, which leaves behind both a staging
+	// directory and (for older versions of Terraform that extracted
+	// directly into place) a partial package at the final path.
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	linuxPlatform := getproviders.Platform{
+		OS:   "linux",
+		Arch: "amd64",
+	}
+	nullProvider := addrs.NewProvider(
+		addrs.DefaultRegistryHost, "hashicorp", "null",
+	)
+
+	versionDir := filepath.Join(tmpDirPath, "registry.terraform.io", "hashicorp", "null", "2.1.0")
+	stagingDir := filepath.Join(versionDir, stagingDirPrefix+"12345678")
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(stagingDir, "terraform-provider-null"), []byte("partial"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	partialDir := filepath.Join(versionDir, "linux_amd64")
+	if err := os.MkdirAll(partialDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(partialDir, "terraform-provider-null"), []byte("partial"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir := NewDirWithPlatform(tmpDirPath, linuxPlatform)
+	meta := getproviders.PackageMeta{
+		Provider: nullProvider,
+		Version:  versions.MustParseVersion("2.1.0"),
+
+		ProtocolVersions: getproviders.VersionList{versions.MustParseVersion("5.0.0")},
+		TargetPlatform:   linuxPlatform,
+
+		Filename: "terraform-provider-null_2.1.0_linux_amd64.zip",
+		Location: getproviders.PackageLocalArchive("testdata/terraform-provider-null_2.1.0_linux_amd64.zip"),
+	}
+	if _, err := tmpDir.InstallPackage(context.TODO(), meta); err != nil {
+		t.Fatalf("InstallPackage failed: %s", err)
+	}
+
+	// The reinstall must have replaced the partial package with the real
+	// one and discarded the leftover staging directory.
+	content, err := ioutil.ReadFile(filepath.Join(partialDir, "terraform-provider-null"))
+	if err != nil {
+		t.Fatalf("failed to read installed executable: %s", err)
+	}
+	if string(content) == "partial" {
+		t.Error("partial package content is still present after reinstall")
+	}
+	if _, err := os.Stat(stagingDir); !os.IsNotExist(err) {
+		t.Errorf("leftover staging directory %s still exists after reinstall", stagingDir)
+	}
+	leftovers, err := filepath.Glob(filepath.Join(versionDir, stagingDirPrefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) != 0 {
+		t.Errorf("staging directories %q remain after a successful install", leftovers)
+	}
+}
+
 func TestLinkFromOtherCache(t *testing.T) {
 	srcDirPath := "testdata/cachedir"
 	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
@@ -147,3 +219,58 @@ func TestLinkFromOtherCache(t *testing.T) {
 		t.Errorf("wrong cache contents after link\n%s", diff)
 	}
 }
+
+func TestLinkFromOtherCache_forceCopy(t *testing.T) {
+	srcDirPath := "testdata/cachedir"
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	windowsPlatform := getproviders.Platform{
+		OS:   "windows",
+		Arch: "amd64",
+	}
+	nullProvider := addrs.NewProvider(
+		addrs.DefaultRegistryHost, "hashicorp", "null",
+	)
+
+	srcDir := NewDirWithPlatform(srcDirPath, windowsPlatform)
+	tmpDir := NewDirWithPlatform(tmpDirPath, windowsPlatform)
+	tmpDir.SetForceCopy(true)
+
+	cacheEntry := srcDir.ProviderLatestVersion(nullProvider)
+	if cacheEntry == nil {
+		t.Fatalf("null provider has no latest version in source directory")
+	}
+
+	if err := tmpDir.LinkFromOtherCache(cacheEntry); err != nil {
+		t.Fatalf("LinkFromOtherCache failed: %s", err)
+	}
+
+	// With force-copy enabled the package directory must be a real directory
+	// rather than a symlink, and its files must not share storage with the
+	// source cache.
+	pkgDir := filepath.Join(tmpDirPath, "registry.terraform.io", "hashicorp", "null", "2.0.0", "windows_amd64")
+	info, err := os.Lstat(pkgDir)
+	if err != nil {
+		t.Fatalf("package was not installed: %s", err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Fatalf("package directory is a symlink; want a deep copy")
+	}
+
+	exeName := "terraform-provider-null.exe"
+	srcInfo, err := os.Stat(filepath.Join(srcDirPath, "registry.terraform.io", "hashicorp", "null", "2.0.0", "windows_amd64", exeName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstInfo, err := os.Stat(filepath.Join(pkgDir, exeName))
+	if err != nil {
+		t.Fatalf("executable was not copied: %s", err)
+	}
+	if os.SameFile(srcInfo, dstInfo) {
+		t.Errorf("executable is hard-linked to the source; want a copy")
+	}
+}
@@ -0,0 +1,111 @@
+package providercache
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// downloadRateLimiter is a token bucket limiting the aggregate number of
+// bytes per second that the package downloads sharing it may consume, so
+// that a "terraform init" on a metered or shared link doesn't starve other
+// traffic.
+//
+// One limiter is shared between all of the concurrent downloads of an
+// installation operation, so the configured rate is a ceiling on the total
+// throughput rather than a per-package one. It is safe for concurrent use.
+type downloadRateLimiter struct {
+	mu sync.Mutex
+
+	// bytesPerSecond is the rate at which tokens are replenished, and also
+	// the capacity of the bucket: an idle limiter can serve at most one
+	// second's worth of bytes in a single burst.
+	bytesPerSecond float64
+
+	tokens     float64
+	lastRefill time.Time
+}
+
+// newDownloadRateLimiter produces a limiter allowing the given number of
+// bytes per second in aggregate. The bucket starts full, so a small download
+// that fits within one second's allowance is not delayed at all.
+func newDownloadRateLimiter(bytesPerSecond int64) *downloadRateLimiter {
+	return &downloadRateLimiter{
+		bytesPerSecond: float64(bytesPerSecond),
+		tokens:         float64(bytesPerSecond),
+		lastRefill:     time.Now(),
+	}
+}
+
+// take blocks until n tokens are available and then consumes them, or
+// returns early with the context's error if the context is cancelled while
+// waiting.
+//
+// A request larger than the bucket capacity is served anyway, by letting
+// the token count go negative; the debt delays subsequent requests, which
+// preserves the configured average rate.
+func (l *downloadRateLimiter) take(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.lastRefill).Seconds() * l.bytesPerSecond
+	if l.tokens > l.bytesPerSecond {
+		l.tokens = l.bytesPerSecond
+	}
+	l.lastRefill = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.bytesPerSecond * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reader wraps the given reader so that reads are charged against the
+// limiter, blocking once the configured rate has been exceeded.
+func (l *downloadRateLimiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	return &rateLimitedReader{ctx: ctx, r: r, limiter: l}
+}
+
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *downloadRateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.take(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+type ctxDownloadLimiterType int
+
+const ctxDownloadLimiter = ctxDownloadLimiterType(0)
+
+// downloadLimiterForContext looks on the given context for a registered
+// download rate limiter and returns it, or nil if the downloads on this
+// context are unthrottled.
+func downloadLimiterForContext(ctx context.Context) *downloadRateLimiter {
+	v := ctx.Value(ctxDownloadLimiter)
+	if v != nil {
+		return v.(*downloadRateLimiter)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package providercache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestDownloadRateLimiterReader(t *testing.T) {
+	// A payload that fits within one second's allowance must pass through
+	// unchanged and without any throttling delay.
+	payload := bytes.Repeat([]byte("terraform"), 100)
+	limiter := newDownloadRateLimiter(int64(len(payload)))
+	r := limiter.reader(context.Background(), bytes.NewReader(payload))
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("read %d bytes; want %d unchanged bytes", len(got), len(payload))
+	}
+}
+
+func TestDownloadRateLimiterThrottles(t *testing.T) {
+	// A payload larger than one second's allowance must be held back by the
+	// limiter. The bucket starts full, so reading three seconds' worth of
+	// data should take at least two seconds' worth of waiting; we allow some
+	// slack because timers can fire a little early or late.
+	rate := int64(2000)
+	payload := bytes.Repeat([]byte("x"), int(rate)*3)
+	limiter := newDownloadRateLimiter(rate)
+	r := limiter.reader(context.Background(), bytes.NewReader(payload))
+	start := time.Now()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("read %d bytes; want %d unchanged bytes", len(got), len(payload))
+	}
+	if elapsed, min := time.Since(start), 1500*time.Millisecond; elapsed < min {
+		t.Errorf("download took %s; want at least %s under the rate limit", elapsed, min)
+	}
+}
+
+func TestDownloadRateLimiterCancel(t *testing.T) {
+	// Exhaust the bucket so the next request has to wait, and then make
+	// sure a cancelled context interrupts that wait instead of blocking.
+	limiter := newDownloadRateLimiter(10)
+	if err := limiter.take(context.Background(), 10); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := limiter.take(ctx, 100)
+	if err == nil {
+		t.Fatalf("succeeded; expected context cancellation error")
+	}
+	if err != context.Canceled {
+		t.Fatalf("wrong error %q; want %q", err, context.Canceled)
+	}
+}
@@ -3,9 +3,13 @@ package providercache
 import (
 	"context"
 	"fmt"
+	"log"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/apparentlymart/go-versions/versions"
 
@@ -41,8 +45,42 @@ type Installer struct {
 	// namespace, which we use for providers that are built in to Terraform
 	// and thus do not need any separate installation step.
 	builtInProviderTypes []string
+
+	// concurrency is the maximum number of provider packages to fetch and
+	// verify at the same time during an installation operation. If it is
+	// less than one then defaultInstallConcurrency is used instead.
+	concurrency int
+
+	// sourceMu serializes the PackageMeta calls that the concurrent
+	// installation workers make against the installer's source, because
+	// sources are not required to be safe for concurrent use.
+	sourceMu sync.Mutex
+
+	// globalCacheEviction describes the size and age limits to apply to
+	// globalCacheDir after a successful installation operation. The zero
+	// value disables eviction.
+	globalCacheEviction CacheEvictionPolicy
+
+	// lockfileReadOnly is whether EnsureProviderVersions must verify the
+	// requirements against the recorded selections without changing them.
+	// See SetLockfileReadOnly.
+	lockfileReadOnly bool
+
+	// lockTimeout is how long EnsureProviderVersions will wait to acquire
+	// the exclusive lock on the target directory before giving up with an
+	// error. Zero or less means to wait indefinitely.
+	lockTimeout time.Duration
+
+	// downloadLimiter, if non-nil, throttles the aggregate throughput of
+	// the package downloads made during EnsureProviderVersions. See
+	// SetDownloadRateLimit.
+	downloadLimiter *downloadRateLimiter
 }
 
+// defaultInstallConcurrency is the number of provider packages that an
+// Installer will fetch concurrently unless overridden using SetConcurrency.
+const defaultInstallConcurrency = 4
+
 // NewInstaller constructs and returns a new installer with the given target
 // directory and provider source.
 //
@@ -94,6 +132,54 @@ func (i *Installer) SetBuiltInProviderTypes(types []string) {
 	i.builtInProviderTypes = types
 }
 
+// SetConcurrency customizes the maximum number of provider packages that
+// the receiving installer will fetch and verify at the same time during
+// EnsureProviderVersions.
+//
+// Values less than one select the default concurrency instead.
+func (i *Installer) SetConcurrency(n int) {
+	i.concurrency = n
+}
+
+// SetDownloadRateLimit caps the aggregate throughput of the package
+// downloads made during EnsureProviderVersions at the given number of bytes
+// per second, shared across however many downloads run concurrently. This
+// is for operations on metered or shared links where an unthrottled
+// installation would starve other traffic.
+//
+// Values less than one disable throttling, which is also the default.
+func (i *Installer) SetDownloadRateLimit(bytesPerSecond int64) {
+	if bytesPerSecond < 1 {
+		i.downloadLimiter = nil
+		return
+	}
+	i.downloadLimiter = newDownloadRateLimiter(bytesPerSecond)
+}
+
+// SetLockTimeout customizes how long EnsureProviderVersions will wait for
+// the exclusive lock on the target cache directory before failing, when
+// another process (such as a concurrent "terraform init" for the same
+// configuration) is holding it.
+//
+// A duration of zero or less, which is also the default, means to wait
+// indefinitely.
+func (i *Installer) SetLockTimeout(timeout time.Duration) {
+	i.lockTimeout = timeout
+}
+
+// SetLockfileReadOnly makes EnsureProviderVersions treat the recorded
+// selections as authoritative: every requirement must be satisfiable by
+// exactly its locked version and recorded hashes, and the lock data is
+// never rewritten. Any provider whose selection or hash set would change is
+// reported as an error instead.
+//
+// This is for callers like "terraform init -lockfile=readonly", where a
+// change to the lock data should fail the run rather than be adopted
+// quietly.
+func (i *Installer) SetLockfileReadOnly(readOnly bool) {
+	i.lockfileReadOnly = readOnly
+}
+
 // EnsureProviderVersions compares the given provider requirements with what
 // is already available in the installer's target directory and then takes
 // appropriate installation actions to ensure that suitable packages
@@ -119,13 +205,80 @@ func (i *Installer) EnsureProviderVersions(ctx context.Context, reqs getprovider
 	// Anything that could be making network requests here should take a
 	// context and ideally respond to the cancellation of that context.
 
+	// Only the installer is allowed to modify the target directory, but
+	// several Terraform processes may be running installers against the
+	// same directory at the same time, so we hold an exclusive advisory
+	// lock on it for the duration of the operation. Read-only consumers of
+	// the directory, such as SelectedPackages, deliberately do not take
+	// this lock. (The OS releases the lock automatically if we crash, so
+	// we can't leave the directory permanently locked.)
+	unlock, err := lockCacheDirTimeout(i.targetDir.baseDir, i.lockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock the provider cache directory %s: %s", i.targetDir.baseDir, err)
+	}
+	defer unlock()
+
 	errs := map[addrs.Provider]error{}
-	evts := installerEventsForContext(ctx)
+
+	// We deliver events through a synchronizing wrapper so that callers
+	// don't need their callbacks to be safe for concurrent use, even though
+	// we install packages concurrently below. We also re-attach the wrapped
+	// events to the context so that codepaths further down, like the
+	// package download in Dir.InstallPackage, report through the same
+	// wrapper.
+	evts := synchronizedEvents(installerEventsForContext(ctx))
+	ctx = evts.OnContext(ctx)
+
+	// If a download rate limit is configured then we attach the shared
+	// limiter to the context too, so that the package downloads in
+	// Dir.InstallPackage throttle themselves against it.
+	if i.downloadLimiter != nil {
+		ctx = context.WithValue(ctx, ctxDownloadLimiter, i.downloadLimiter)
+	}
 
 	if cb := evts.PendingProviders; cb != nil {
 		cb(reqs)
 	}
 
+	// In read-only lockfile mode the recorded selections are authoritative,
+	// so before considering anything else we check that every requirement
+	// can be satisfied by exactly its locked version, and then pin the
+	// effective constraints to those versions so that the selection steps
+	// below cannot drift from them.
+	var lockedEntries map[addrs.Provider]lockFileEntry
+	if i.lockfileReadOnly {
+		lockedEntries, err = i.lockFile().Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read selections file: %s", err)
+		}
+		effectiveReqs := make(getproviders.Requirements, len(reqs))
+		for provider, versionConstraints := range reqs {
+			if provider.IsBuiltIn() {
+				// Built-in providers are never recorded in the lock file.
+				effectiveReqs[provider] = versionConstraints
+				continue
+			}
+			entry, exists := lockedEntries[provider]
+			if !exists {
+				errs[provider] = fmt.Errorf("provider is not yet recorded in the lock file, and the read-only lockfile mode prevents recording a new selection; run \"terraform init\" without -lockfile=readonly to add it")
+				continue
+			}
+			if !versions.MeetingConstraints(versionConstraints).Has(entry.SelectedVersion) {
+				errs[provider] = fmt.Errorf("locked version %s no longer satisfies the version constraints %s; run \"terraform init -upgrade\" without -lockfile=readonly to select a new version", entry.SelectedVersion, getproviders.VersionConstraintsString(versionConstraints))
+				continue
+			}
+			pinned, err := getproviders.ParseVersionConstraints(entry.SelectedVersion.String())
+			if err != nil {
+				// Should never happen: a valid version number is always a
+				// valid exact-version constraint.
+				errs[provider] = err
+				continue
+			}
+			effectiveReqs[provider] = pinned
+		}
+		reqs = effectiveReqs
+	}
+
 	// Here we'll keep track of which exact version we've selected for each
 	// provider in the requirements.
 	selected := map[addrs.Provider]getproviders.Version{}
@@ -212,12 +365,13 @@ MightNeedProvider:
 	//
 	// This produces a set of packages to install to our cache in the next step.
 	need := map[addrs.Provider]getproviders.Version{}
+	queryWarnings := map[addrs.Provider][]string{}
 NeedProvider:
 	for provider, acceptableVersions := range mightNeed {
 		if cb := evts.QueryPackagesBegin; cb != nil {
 			cb(provider, reqs[provider])
 		}
-		available, err := i.source.AvailableVersions(provider)
+		available, warnings, err := i.source.AvailableVersions(provider)
 		if err != nil {
 			// TODO: Consider retrying a few times for certain types of
 			// source errors that seem likely to be transient.
@@ -228,6 +382,15 @@ NeedProvider:
 			// We will take no further actions for this provider.
 			continue
 		}
+		if len(warnings) > 0 {
+			// Warnings are advisory only: the registry wants the user to
+			// know something about this provider, such as a deprecation,
+			// but installation proceeds regardless.
+			queryWarnings[provider] = warnings
+			if cb := evts.QueryPackagesWarning; cb != nil {
+				cb(provider, warnings)
+			}
+		}
 		available.Sort()                           // put the versions in increasing order of precedence
 		for i := len(available) - 1; i >= 0; i-- { // walk backwards to consider newer versions first
 			if acceptableVersions.Has(available[i]) {
@@ -249,110 +412,40 @@ NeedProvider:
 
 	// Step 3: For each provider version we've decided we need to install,
 	// install its package into our target cache (possibly via the global cache).
+	//
+	// We fetch and verify the needed packages concurrently, because package
+	// retrieval tends to be I/O-bound. Each provider is handled entirely by
+	// a single worker, so the events for any particular provider are still
+	// delivered in their usual order even though events for different
+	// providers may interleave.
 	targetPlatform := i.targetDir.targetPlatform // we inherit this to behave correctly in unit tests
+	concurrency := i.concurrency
+	if concurrency < 1 {
+		concurrency = defaultInstallConcurrency
+	}
+	var (
+		installMu sync.Mutex // protects selected and errs while workers are running
+		wg        sync.WaitGroup
+		tokens    = make(chan struct{}, concurrency)
+	)
 	for provider, version := range need {
-		if i.globalCacheDir != nil {
-			// Step 3a: If our global cache already has this version available then
-			// we'll just link it in.
-			if cached := i.globalCacheDir.ProviderVersion(provider, version); cached != nil {
-				if cb := evts.LinkFromCacheBegin; cb != nil {
-					cb(provider, version, i.globalCacheDir.baseDir)
-				}
-				err := i.targetDir.LinkFromOtherCache(cached)
-				if err != nil {
-					errs[provider] = err
-					if cb := evts.LinkFromCacheFailure; cb != nil {
-						cb(provider, version, err)
-					}
-					continue
-				}
-				// We'll fetch what we just linked to make sure it actually
-				// did show up there.
-				new := i.targetDir.ProviderVersion(provider, version)
-				if new == nil {
-					err := fmt.Errorf("after linking %s from provider cache at %s it is still not detected in the target directory; this is a bug in Terraform", provider, i.globalCacheDir.baseDir)
-					if cb := evts.LinkFromCacheFailure; cb != nil {
-						cb(provider, version, err)
-					}
-					continue
-				}
-				selected[provider] = version
-				if cb := evts.LinkFromCacheSuccess; cb != nil {
-					cb(provider, version, new.PackageDir)
-				}
-				continue // Don't need to do full install, then.
-			}
-		}
-
-		// Step 3b: Get the package metadata for the selected version from our
-		// provider source.
-		//
-		// This is the step where we might detect and report that the provider
-		// isn't available for the current platform.
-		if cb := evts.FetchPackageMeta; cb != nil {
-			cb(provider, version)
-		}
-		meta, err := i.source.PackageMeta(provider, version, targetPlatform)
-		if err != nil {
-			errs[provider] = err
-			if cb := evts.FetchPackageFailure; cb != nil {
-				cb(provider, version, err)
-			}
-			continue
-		}
-
-		// Step 3c: Retrieve the package indicated by the metadata we received,
-		// either directly into our target directory or via the global cache
-		// directory.
-		if cb := evts.FetchPackageBegin; cb != nil {
-			cb(provider, version, meta.Location)
-		}
-		var installTo, linkTo *Dir
-		if i.globalCacheDir != nil {
-			installTo = i.globalCacheDir
-			linkTo = i.targetDir
-		} else {
-			installTo = i.targetDir
-			linkTo = nil // no linking needed
-		}
-		authResult, err := installTo.InstallPackage(ctx, meta)
-		if err != nil {
-			// TODO: Consider retrying for certain kinds of error that seem
-			// likely to be transient. For now, we just treat all errors equally.
-			errs[provider] = err
-			if cb := evts.FetchPackageFailure; cb != nil {
-				cb(provider, version, err)
-			}
-			continue
-		}
-		new := installTo.ProviderVersion(provider, version)
-		if new == nil {
-			err := fmt.Errorf("after installing %s it is still not detected in the target directory; this is a bug in Terraform", provider)
-			errs[provider] = err
-			if cb := evts.FetchPackageFailure; cb != nil {
-				cb(provider, version, err)
-			}
-			continue
-		}
-		if linkTo != nil {
-			// We skip emitting the "LinkFromCache..." events here because
-			// it's simpler for the caller to treat them as mutually exclusive.
-			// We can just subsume the linking step under the "FetchPackage..."
-			// series here (and that's why we use FetchPackageFailure below).
-			err := linkTo.LinkFromOtherCache(new)
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func(provider addrs.Provider, version getproviders.Version) {
+			defer wg.Done()
+			defer func() { <-tokens }()
+			ok, err := i.installPackage(ctx, provider, version, targetPlatform, evts)
+			installMu.Lock()
+			defer installMu.Unlock()
 			if err != nil {
 				errs[provider] = err
-				if cb := evts.FetchPackageFailure; cb != nil {
-					cb(provider, version, err)
-				}
-				continue
 			}
-		}
-		selected[provider] = version
-		if cb := evts.FetchPackageSuccess; cb != nil {
-			cb(provider, version, new.PackageDir, authResult)
-		}
+			if ok {
+				selected[provider] = version
+			}
+		}(provider, version)
 	}
+	wg.Wait()
 
 	// We'll remember our selections in a lock file inside the target directory,
 	// so callers can recover those exact selections later by calling
@@ -379,14 +472,44 @@ NeedProvider:
 		lockEntries[provider] = lockFileEntry{
 			SelectedVersion: version,
 			PackageHash:     hash,
+			VersionWarnings: queryWarnings[provider],
 		}
 	}
-	err := i.lockFile().Write(lockEntries)
-	if err != nil {
-		// This is one of few cases where this function does _not_ return an
-		// InstallerError, because failure to write the lock file is a more
-		// general problem, not specific to a certain provider.
-		return selected, fmt.Errorf("failed to record a manifest of selected providers: %s", err)
+	if i.lockfileReadOnly {
+		// Rather than writing anything, we verify that the packages we
+		// ended up with match the hashes already on record. The versions
+		// are already pinned above, so a hash that isn't recorded means
+		// the lock file has no hash for this platform yet.
+		for provider, entry := range lockEntries {
+			locked := lockedEntries[provider]
+			if !locked.hashIsAllowed(entry.PackageHash) {
+				errs[provider] = fmt.Errorf("the package for locked version %s has hash %s, which is not recorded in the lock file for this platform; run \"terraform providers lock\" to record it", entry.SelectedVersion, entry.PackageHash)
+			}
+		}
+	} else {
+		// Hashes recorded for other platforms by "terraform providers lock"
+		// are carried forward as long as the selected version is unchanged.
+		if prevEntries, err := i.lockFile().Read(); err == nil {
+			for provider, prev := range prevEntries {
+				if entry, exists := lockEntries[provider]; exists && entry.SelectedVersion == prev.SelectedVersion {
+					entry.AdditionalHashes = prev.AdditionalHashes
+					if len(entry.VersionWarnings) == 0 {
+						// A provider that didn't need a fresh query this time
+						// keeps whatever warnings its original selection
+						// recorded, so later runs can still repeat them.
+						entry.VersionWarnings = prev.VersionWarnings
+					}
+					lockEntries[provider] = entry
+				}
+			}
+		}
+		err = i.lockFile().Write(lockEntries)
+		if err != nil {
+			// This is one of few cases where this function does _not_ return
+			// an InstallerError, because failure to write the lock file is a
+			// more general problem, not specific to a certain provider.
+			return selected, fmt.Errorf("failed to record a manifest of selected providers: %s", err)
+		}
 	}
 
 	if len(errs) > 0 {
@@ -394,15 +517,241 @@ NeedProvider:
 			ProviderErrors: errs,
 		}
 	}
+
+	// Now that everything needed by the current configuration is in place,
+	// we can apply any configured eviction policy to the global cache.
+	i.evictFromGlobalCache(selected)
+
 	return selected, nil
 }
 
+// installPackage ensures that the given exact provider version is installed
+// into the target directory, either by linking it from the global cache
+// directory or by fetching it from the installer's source.
+//
+// The boolean result is true if and only if the package is ready for use in
+// the target directory, in which case the caller is responsible for
+// recording the version as selected. A false result with a nil error
+// indicates a problem that was reported only via the event callbacks.
+//
+// installPackage may be called concurrently for different providers, but
+// must not be called concurrently for the same provider.
+func (i *Installer) installPackage(ctx context.Context, provider addrs.Provider, version getproviders.Version, targetPlatform getproviders.Platform, evts *InstallerEvents) (bool, error) {
+	if i.globalCacheDir != nil {
+		// Step 3a: If our global cache already has this version available then
+		// we'll just link it in.
+		if cached := i.globalCacheDir.ProviderVersion(provider, version); cached != nil && i.cachedPackageReady(cached) {
+			if cb := evts.LinkFromCacheBegin; cb != nil {
+				cb(provider, version, i.globalCacheDir.baseDir)
+			}
+			err := i.targetDir.LinkFromOtherCache(cached)
+			if err != nil {
+				if cb := evts.LinkFromCacheFailure; cb != nil {
+					cb(provider, version, err)
+				}
+				return false, err
+			}
+			// We'll fetch what we just linked to make sure it actually
+			// did show up there.
+			new := i.targetDir.ProviderVersion(provider, version)
+			if new == nil {
+				err := fmt.Errorf("after linking %s from provider cache at %s it is still not detected in the target directory; this is a bug in Terraform", provider, i.globalCacheDir.baseDir)
+				if cb := evts.LinkFromCacheFailure; cb != nil {
+					cb(provider, version, err)
+				}
+				return false, nil
+			}
+			if cb := evts.LinkFromCacheSuccess; cb != nil {
+				cb(provider, version, new.PackageDir)
+			}
+			i.globalCacheDir.markCacheUse(cached, i.targetDir.baseDir)
+			return true, nil // Don't need to do full install, then.
+		}
+	}
+
+	// Step 3b: Get the package metadata for the selected version from our
+	// provider source.
+	//
+	// This is the step where we might detect and report that the provider
+	// isn't available for the current platform.
+	if cb := evts.FetchPackageMeta; cb != nil {
+		cb(provider, version)
+	}
+	i.sourceMu.Lock()
+	meta, err := i.source.PackageMeta(provider, version, targetPlatform)
+	i.sourceMu.Unlock()
+	if err != nil {
+		if cb := evts.FetchPackageFailure; cb != nil {
+			cb(provider, version, err)
+		}
+		return false, err
+	}
+
+	// Step 3c: Retrieve the package indicated by the metadata we received,
+	// either directly into our target directory or via the global cache
+	// directory.
+	if cb := evts.FetchPackageBegin; cb != nil {
+		cb(provider, version, meta.Location)
+	}
+	var installTo, linkTo *Dir
+	if i.globalCacheDir != nil {
+		installTo = i.globalCacheDir
+		linkTo = i.targetDir
+
+		// The global cache directory may be shared with other Terraform
+		// processes, so we hold an advisory lock on it while we write into
+		// it. (The OS releases the lock automatically if we crash, so we
+		// can't leave the cache permanently locked.)
+		unlock, err := lockCacheDir(i.globalCacheDir.baseDir)
+		if err != nil {
+			err = fmt.Errorf("failed to lock provider cache directory %s: %s", i.globalCacheDir.baseDir, err)
+			if cb := evts.FetchPackageFailure; cb != nil {
+				cb(provider, version, err)
+			}
+			return false, err
+		}
+		defer unlock()
+
+		// Another process holding the lock before us may have installed
+		// the package already, in which case we can just link it.
+		i.globalCacheDir.invalidateMetaCache()
+		if cached := i.globalCacheDir.ProviderVersion(provider, version); cached != nil {
+			err := i.targetDir.LinkFromOtherCache(cached)
+			if err != nil {
+				if cb := evts.FetchPackageFailure; cb != nil {
+					cb(provider, version, err)
+				}
+				return false, err
+			}
+			if new := i.targetDir.ProviderVersion(provider, version); new != nil {
+				if cb := evts.FetchPackageSuccess; cb != nil {
+					cb(provider, version, new.PackageDir, nil)
+				}
+				i.globalCacheDir.markCacheUseLocked(cached, i.targetDir.baseDir)
+				return true, nil
+			}
+			// If linking somehow failed to produce the package then we'll
+			// just fall through and do a full install into the cache again.
+		}
+	} else {
+		installTo = i.targetDir
+		linkTo = nil // no linking needed
+	}
+	authResult, err := installTo.InstallPackage(ctx, meta)
+	if err != nil {
+		// TODO: Consider retrying for certain kinds of error that seem
+		// likely to be transient. For now, we just treat all errors equally.
+		if cb := evts.FetchPackageFailure; cb != nil {
+			cb(provider, version, err)
+		}
+		return false, err
+	}
+	new := installTo.ProviderVersion(provider, version)
+	if new == nil {
+		err := fmt.Errorf("after installing %s it is still not detected in the target directory; this is a bug in Terraform", provider)
+		if cb := evts.FetchPackageFailure; cb != nil {
+			cb(provider, version, err)
+		}
+		return false, err
+	}
+	if linkTo != nil {
+		// We skip emitting the "LinkFromCache..." events here because
+		// it's simpler for the caller to treat them as mutually exclusive.
+		// We can just subsume the linking step under the "FetchPackage..."
+		// series here (and that's why we use FetchPackageFailure below).
+		err := linkTo.LinkFromOtherCache(new)
+		if err != nil {
+			if cb := evts.FetchPackageFailure; cb != nil {
+				cb(provider, version, err)
+			}
+			return false, err
+		}
+		// We still hold the cache directory lock here, taken above before
+		// installing into the cache.
+		installTo.markCacheUseLocked(new, linkTo.baseDir)
+	}
+	if cb := evts.FetchPackageSuccess; cb != nil {
+		cb(provider, version, new.PackageDir, authResult)
+	}
+	return true, nil
+}
+
+// cachedPackageReady returns true if the given package from the global cache
+// directory appears to be fully installed and ready to link.
+//
+// Another process sharing the cache may be part-way through writing the
+// package when we scan it, in which case its executable won't exist yet, so
+// we retry briefly before giving up and treating the package as absent;
+// the caller will then fall through to a full install, which waits on the
+// cache directory lock held by the writer.
+func (i *Installer) cachedPackageReady(cached *CachedProvider) bool {
+	const retries = 5
+	for attempt := 0; ; attempt++ {
+		if _, err := os.Stat(cached.ExecutableFile); err == nil {
+			return true
+		}
+		if attempt >= retries {
+			log.Printf("[WARN] providercache: package for %s v%s in the cache at %s has no executable; ignoring it", cached.Provider, cached.Version, cached.PackageDir)
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+		i.globalCacheDir.invalidateMetaCache()
+	}
+}
+
 func (i *Installer) lockFile() *lockFile {
 	return &lockFile{
 		filename: filepath.Join(i.targetDir.baseDir, "selections.json"),
 	}
 }
 
+// RequirementsSatisfied reports whether every one of the given requirements
+// is already satisfied by the recorded selections: the locked version meets
+// its constraints, its package is present in the target directory, and the
+// package still matches a recorded checksum. A true result means a caller
+// that isn't looking for upgrades can skip EnsureProviderVersions entirely,
+// and with it any network queries against the provider source.
+//
+// A requirement for a built-in provider always makes this function report
+// the requirements as unsatisfied: built-in providers need the full path's
+// validation against the known built-in types, and its report that the
+// provider is available, neither of which this quick check reproduces.
+//
+// The returned selections describe the already-installed versions and are
+// meaningful only when the second result is true.
+func (i *Installer) RequirementsSatisfied(reqs getproviders.Requirements) (getproviders.Selections, bool) {
+	entries, err := i.lockFile().Read()
+	if err != nil {
+		return nil, false
+	}
+	selected := make(getproviders.Selections, len(reqs))
+	for provider, versionConstraints := range reqs {
+		if provider.IsBuiltIn() {
+			return nil, false
+		}
+		entry, exists := entries[provider]
+		if !exists {
+			return nil, false
+		}
+		if !versions.MeetingConstraints(versionConstraints).Has(entry.SelectedVersion) {
+			return nil, false
+		}
+		cached := i.targetDir.ProviderVersion(provider, entry.SelectedVersion)
+		if cached == nil {
+			return nil, false
+		}
+		if !entry.hashIsAllowed(verifiedPackageHash(cached.PackageDir)) {
+			actualHash, err := cached.Hash()
+			if err != nil || !entry.hashIsAllowed(actualHash) {
+				return nil, false
+			}
+			recordVerifiedPackageHash(cached.PackageDir, actualHash)
+		}
+		selected[provider] = entry.SelectedVersion
+	}
+	return selected, true
+}
+
 // SelectedPackages returns the metadata about the packages chosen by the
 // most recent call to EnsureProviderVersions, which are recorded in a lock
 // file in the installer's target directory.
@@ -427,19 +776,32 @@ func (i *Installer) SelectedPackages() (map[addrs.Provider]*CachedProvider, erro
 	for provider, entry := range entries {
 		cached := i.targetDir.ProviderVersion(provider, entry.SelectedVersion)
 		if cached == nil {
-			errs[provider] = fmt.Errorf("package for selected version %s is no longer available in the local cache directory", entry.SelectedVersion)
+			wantDir := getproviders.UnpackedDirectoryPathForPackage(
+				i.targetDir.baseDir, provider, entry.SelectedVersion, i.targetDir.targetPlatform,
+			)
+			errs[provider] = fmt.Errorf("package for selected version %s is no longer available in the local cache directory (expected at %s)", entry.SelectedVersion, wantDir)
+			continue
+		}
+
+		// Hashing a large package directory is not free, and callers tend
+		// to recall the selections several times during a single run, so
+		// we skip re-verifying a package that already passed verification
+		// against the same recorded hash earlier in this process.
+		if entry.hashIsAllowed(verifiedPackageHash(cached.PackageDir)) {
+			ret[provider] = cached
 			continue
 		}
 
-		ok, err := cached.MatchesHash(entry.PackageHash)
+		actualHash, err := cached.Hash()
 		if err != nil {
 			errs[provider] = fmt.Errorf("failed to verify checksum for v%s package: %s", entry.SelectedVersion, err)
 			continue
 		}
-		if !ok {
-			errs[provider] = fmt.Errorf("checksum mismatch for v%s package", entry.SelectedVersion)
+		if !entry.hashIsAllowed(actualHash) {
+			errs[provider] = fmt.Errorf("checksum mismatch for v%s package: the recorded hash is %s, but the package in the cache directory now has hash %s; this suggests that the package was modified since it was installed", entry.SelectedVersion, entry.PackageHash, actualHash)
 			continue
 		}
+		recordVerifiedPackageHash(cached.PackageDir, actualHash)
 		ret[provider] = cached
 	}
 
@@ -451,6 +813,95 @@ func (i *Installer) SelectedPackages() (map[addrs.Provider]*CachedProvider, erro
 	return ret, nil
 }
 
+// SelectedPackageHashes returns the package checksum that was recorded for
+// each selected provider by the most recent installation run, without
+// re-verifying any of the packages against them.
+//
+// This is for callers that want to perform their own verification at a
+// later point than SelectedPackages, such as immediately before launching
+// a provider's plugin executable.
+func (i *Installer) SelectedPackageHashes() (map[addrs.Provider]string, error) {
+	entries, err := i.lockFile().Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read selections file: %s", err)
+	}
+	ret := make(map[addrs.Provider]string, len(entries))
+	for provider, entry := range entries {
+		ret[provider] = entry.PackageHash
+	}
+	return ret, nil
+}
+
+// SelectedPackageWarnings returns the advisory warnings, such as deprecation
+// notices, that the provider source attached when each selected provider's
+// version was chosen. Providers whose selection carried no warnings are
+// omitted from the result.
+func (i *Installer) SelectedPackageWarnings() (map[addrs.Provider][]string, error) {
+	entries, err := i.lockFile().Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read selections file: %s", err)
+	}
+	ret := make(map[addrs.Provider][]string)
+	for provider, entry := range entries {
+		if len(entry.VersionWarnings) > 0 {
+			ret[provider] = entry.VersionWarnings
+		}
+	}
+	return ret, nil
+}
+
+// SelectedVersions returns just the version that was selected for each
+// provider by the most recent installation run, without verifying any of
+// the installed packages.
+func (i *Installer) SelectedVersions() (map[addrs.Provider]getproviders.Version, error) {
+	entries, err := i.lockFile().Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read selections file: %s", err)
+	}
+	ret := make(map[addrs.Provider]getproviders.Version, len(entries))
+	for provider, entry := range entries {
+		ret[provider] = entry.SelectedVersion
+	}
+	return ret, nil
+}
+
+// verifiedPackageHashes remembers, for the duration of the current process,
+// the hash that each package directory was most recently verified to have.
+// This lets us verify each package at most once per run even though the
+// selections may be recalled several times.
+//
+// Packages that legitimately have no recorded hash -- such as unmanaged
+// providers, which are never present in a cache directory at all -- simply
+// never appear here.
+var verifiedPackageHashes sync.Map // package dir string => hash string
+
+func verifiedPackageHash(packageDir string) string {
+	if hash, ok := verifiedPackageHashes.Load(packageDir); ok {
+		return hash.(string)
+	}
+	return ""
+}
+
+func recordVerifiedPackageHash(packageDir, hash string) {
+	verifiedPackageHashes.Store(packageDir, hash)
+}
+
+func forgetVerifiedPackageHash(packageDir string) {
+	verifiedPackageHashes.Delete(packageDir)
+}
+
+// ForgetVerifiedPackages discards the process-wide memory of already-verified
+// packages, forcing the next call to SelectedPackages to recompute every
+// hash from the files on disk. This is for callers whose whole purpose is
+// integrity checking, for whom the verify-once optimization would defeat
+// the point.
+func ForgetVerifiedPackages() {
+	verifiedPackageHashes.Range(func(key, _ interface{}) bool {
+		verifiedPackageHashes.Delete(key)
+		return true
+	})
+}
+
 // InstallMode customizes the details of how an install operation treats
 // providers that have versions already cached in the target directory.
 type InstallMode rune
@@ -0,0 +1,154 @@
+package providercache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+// PlannedInstall describes one provider package that an installation
+// operation would fetch, as reported by InstallDryRun.
+type PlannedInstall struct {
+	Provider addrs.Provider
+	Version  getproviders.Version
+
+	// Location is where the package would be fetched from: a URL for
+	// registry and network sources, or a local path for mirror directories.
+	Location string
+
+	// Checksum is the hash recorded for this package in the dependency
+	// lock file, or an empty string when the package has never been
+	// installed before and so its checksum isn't known yet.
+	Checksum string
+
+	// InGlobalCache is true when the system-wide shared plugin cache
+	// already holds this package, in which case installation would link it
+	// from there instead of fetching it.
+	InGlobalCache bool
+
+	// SizeBytes is the number of bytes that fetching this package would
+	// transfer: zero for packages that are already local directories, and
+	// -1 when the size can't be determined without downloading.
+	SizeBytes int64
+}
+
+// InstallDryRun resolves the given provider requirements against the
+// installer's source in the same way that EnsureProviderVersions would, but
+// without modifying the target directory, the global cache, or the lock
+// file: it just reports which packages an installation would fetch, so that
+// they can be pre-staged for an air-gapped environment.
+//
+// Built-in providers are omitted from the result because they need no
+// installation step. The results are sorted by provider address.
+func (i *Installer) InstallDryRun(ctx context.Context, reqs getproviders.Requirements) ([]PlannedInstall, error) {
+	locked, err := i.lockFile().Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read selections file: %s", err)
+	}
+
+	providers := make([]addrs.Provider, 0, len(reqs))
+	for provider := range reqs {
+		if provider.IsBuiltIn() {
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(a, b int) bool {
+		return providers[a].String() < providers[b].String()
+	})
+
+	targetPlatform := i.targetDir.targetPlatform
+
+	var ret []PlannedInstall
+	for _, provider := range providers {
+		acceptableVersions := getproviders.MeetingConstraints(reqs[provider])
+		available, _, err := i.source.AvailableVersions(provider)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query available versions for %s: %s", provider.ForDisplay(), err)
+		}
+		available.Sort()
+
+		// An installation would keep a previously-selected version that is
+		// still acceptable and still available, so the dry run prefers it
+		// for the same reason.
+		var selected getproviders.Version
+		var found bool
+		if entry, exists := locked[provider]; exists && acceptableVersions.Has(entry.SelectedVersion) {
+			for _, v := range available {
+				if v == entry.SelectedVersion {
+					selected = entry.SelectedVersion
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			for idx := len(available) - 1; idx >= 0; idx-- { // newer versions first
+				if acceptableVersions.Has(available[idx]) {
+					selected = available[idx]
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no available releases of %s match the given constraints %s", provider.ForDisplay(), getproviders.VersionConstraintsString(reqs[provider]))
+		}
+
+		meta, err := i.source.PackageMeta(provider, selected, targetPlatform)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find a %s package for %s v%s: %s", targetPlatform.String(), provider.ForDisplay(), selected.String(), err)
+		}
+
+		var checksum string
+		if entry, exists := locked[provider]; exists && entry.SelectedVersion == selected {
+			checksum = entry.PackageHash
+		}
+
+		inGlobalCache := false
+		if i.globalCacheDir != nil {
+			if cached := i.globalCacheDir.ProviderVersion(provider, selected); cached != nil && i.cachedPackageReady(cached) {
+				inGlobalCache = true
+			}
+		}
+
+		ret = append(ret, PlannedInstall{
+			Provider:      provider,
+			Version:       selected,
+			Location:      meta.Location.String(),
+			Checksum:      checksum,
+			InGlobalCache: inGlobalCache,
+			SizeBytes:     plannedFetchSize(meta.Location),
+		})
+	}
+	return ret, nil
+}
+
+// plannedFetchSize determines how many bytes fetching the package at the
+// given location would transfer, without actually downloading anything. The
+// result is zero for packages that are already local directories, and -1
+// when the size can't be determined cheaply, such as a mirror whose server
+// doesn't answer HEAD requests.
+func plannedFetchSize(location getproviders.PackageLocation) int64 {
+	switch loc := location.(type) {
+	case getproviders.PackageLocalDir:
+		return 0
+	case getproviders.PackageLocalArchive:
+		if info, err := os.Stat(string(loc)); err == nil {
+			return info.Size()
+		}
+	case getproviders.PackageHTTPURL:
+		if resp, err := http.Head(string(loc)); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK && resp.ContentLength > 0 {
+				return resp.ContentLength
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,100 @@
+package providercache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+func TestInstallDryRun(t *testing.T) {
+	provider := addrs.MustParseProviderSourceString("example.com/awesomesauce/happycloud")
+	version := getproviders.MustParseVersion("1.2.0")
+	platform := getproviders.Platform{OS: "amigaos", Arch: "m68k"}
+
+	meta, close, err := fakePlatformPackageMeta(provider, version, platform)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer close()
+	source := getproviders.NewMockSource([]getproviders.PackageMeta{meta})
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	tmpDirPath, err = filepath.EvalSymlinks(tmpDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetDirPath := filepath.Join(tmpDirPath, "target")
+	globalDirPath := filepath.Join(tmpDirPath, "global")
+
+	dir := NewDirWithPlatform(targetDirPath, platform)
+	installer := NewInstaller(dir, source)
+	installer.SetGlobalCacheDir(NewDirWithPlatform(globalDirPath, platform))
+
+	reqs := getproviders.Requirements{
+		provider: getproviders.MustParseVersionConstraints(">= 1.0.0"),
+	}
+	ctx := context.Background()
+
+	archiveInfo, err := os.Stat(string(meta.Location.(getproviders.PackageLocalArchive)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	planned, err := installer.InstallDryRun(ctx, reqs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := len(planned), 1; got != want {
+		t.Fatalf("wrong number of planned installs %d; want %d", got, want)
+	}
+	plan := planned[0]
+	if got, want := plan.Version.String(), "1.2.0"; got != want {
+		t.Errorf("wrong planned version %q; want %q", got, want)
+	}
+	if plan.InGlobalCache {
+		t.Errorf("package reported as cached before anything was installed")
+	}
+	if got, want := plan.SizeBytes, archiveInfo.Size(); got != want {
+		t.Errorf("wrong planned download size %d; want %d", got, want)
+	}
+	if got, want := plan.Checksum, ""; got != want {
+		t.Errorf("wrong checksum %q for a package that was never installed; want %q", got, want)
+	}
+
+	// The dry run must not have created either cache directory.
+	if _, err := os.Stat(targetDirPath); !os.IsNotExist(err) {
+		t.Errorf("dry run created the target directory")
+	}
+	if _, err := os.Stat(globalDirPath); !os.IsNotExist(err) {
+		t.Errorf("dry run created the global cache directory")
+	}
+
+	// After a real installation the same dry run reports the package as
+	// available from the shared cache, with its recorded checksum.
+	if _, err := installer.EnsureProviderVersions(ctx, reqs, InstallNewProvidersOnly); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	planned, err = installer.InstallDryRun(ctx, reqs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := len(planned), 1; got != want {
+		t.Fatalf("wrong number of planned installs %d; want %d", got, want)
+	}
+	plan = planned[0]
+	if !plan.InGlobalCache {
+		t.Errorf("package not reported as cached after installation")
+	}
+	if plan.Checksum == "" {
+		t.Errorf("no checksum reported after the selection was recorded")
+	}
+}
@@ -2,6 +2,7 @@ package providercache
 
 import (
 	"context"
+	"sync"
 
 	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/internal/getproviders"
@@ -68,6 +69,13 @@ type InstallerEvents struct {
 	QueryPackagesSuccess func(provider addrs.Provider, selectedVersion getproviders.Version)
 	QueryPackagesFailure func(provider addrs.Provider, err error)
 
+	// QueryPackagesWarning is called when the query succeeded but the source
+	// attached advisory warnings to its response, such as a registry marking
+	// the provider as deprecated. It occurs at most once per distinct
+	// provider, between the Begin event and the Success or Failure event,
+	// and never causes installation of that provider to fail.
+	QueryPackagesWarning func(provider addrs.Provider, warnings []string)
+
 	// The LinkFromCache... family of events delimit the operation of linking
 	// a selected provider package from the system-wide shared cache into the
 	// current configuration's local cache.
@@ -103,6 +111,18 @@ type InstallerEvents struct {
 	FetchPackageSuccess func(provider addrs.Provider, version getproviders.Version, localDir string, authResult *getproviders.PackageAuthenticationResult)
 	FetchPackageFailure func(provider addrs.Provider, version getproviders.Version, err error)
 
+	// FetchPackageProgress is called periodically while a remote package is
+	// being downloaded, reporting the number of bytes fetched so far and,
+	// if the server declared it, the total size of the package. bytesTotal
+	// is negative when the total size is unknown, in which case recipients
+	// should report only the bytes fetched so far.
+	//
+	// Reports arrive at most roughly every 500ms for each package, plus
+	// once more when a download completes. This event occurs only between
+	// the FetchPackageBegin and FetchPackageSuccess/Failure events for the
+	// same provider.
+	FetchPackageProgress func(provider addrs.Provider, version getproviders.Version, bytesFetched, bytesTotal int64)
+
 	// HashPackageFailure is called if the installer is unable to determine
 	// the hash of the contents of an installed package after installation.
 	// In that case, the selection will not be recorded in the target cache
@@ -110,6 +130,139 @@ type InstallerEvents struct {
 	HashPackageFailure func(provider addrs.Provider, version getproviders.Version, err error)
 }
 
+// synchronizedEvents returns an InstallerEvents equivalent to the given one
+// except that all of its callbacks are guarded by a shared mutex, so that
+// the installer can deliver events from several installation goroutines at
+// once without requiring the original callbacks to be safe for concurrent
+// use.
+//
+// Callbacks that are nil in the given events remain nil in the result, so
+// the installer can still skip work for events nobody is subscribed to.
+func synchronizedEvents(evts *InstallerEvents) *InstallerEvents {
+	var mu sync.Mutex
+	ret := &InstallerEvents{}
+	if cb := evts.PendingProviders; cb != nil {
+		ret.PendingProviders = func(reqs map[addrs.Provider]getproviders.VersionConstraints) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(reqs)
+		}
+	}
+	if cb := evts.ProviderAlreadyInstalled; cb != nil {
+		ret.ProviderAlreadyInstalled = func(provider addrs.Provider, selectedVersion getproviders.Version) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, selectedVersion)
+		}
+	}
+	if cb := evts.BuiltInProviderAvailable; cb != nil {
+		ret.BuiltInProviderAvailable = func(provider addrs.Provider) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider)
+		}
+	}
+	if cb := evts.BuiltInProviderFailure; cb != nil {
+		ret.BuiltInProviderFailure = func(provider addrs.Provider, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, err)
+		}
+	}
+	if cb := evts.QueryPackagesBegin; cb != nil {
+		ret.QueryPackagesBegin = func(provider addrs.Provider, versionConstraints getproviders.VersionConstraints) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, versionConstraints)
+		}
+	}
+	if cb := evts.QueryPackagesSuccess; cb != nil {
+		ret.QueryPackagesSuccess = func(provider addrs.Provider, selectedVersion getproviders.Version) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, selectedVersion)
+		}
+	}
+	if cb := evts.QueryPackagesFailure; cb != nil {
+		ret.QueryPackagesFailure = func(provider addrs.Provider, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, err)
+		}
+	}
+	if cb := evts.QueryPackagesWarning; cb != nil {
+		ret.QueryPackagesWarning = func(provider addrs.Provider, warnings []string) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, warnings)
+		}
+	}
+	if cb := evts.LinkFromCacheBegin; cb != nil {
+		ret.LinkFromCacheBegin = func(provider addrs.Provider, version getproviders.Version, cacheRoot string) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, version, cacheRoot)
+		}
+	}
+	if cb := evts.LinkFromCacheSuccess; cb != nil {
+		ret.LinkFromCacheSuccess = func(provider addrs.Provider, version getproviders.Version, localDir string) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, version, localDir)
+		}
+	}
+	if cb := evts.LinkFromCacheFailure; cb != nil {
+		ret.LinkFromCacheFailure = func(provider addrs.Provider, version getproviders.Version, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, version, err)
+		}
+	}
+	if cb := evts.FetchPackageMeta; cb != nil {
+		ret.FetchPackageMeta = func(provider addrs.Provider, version getproviders.Version) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, version)
+		}
+	}
+	if cb := evts.FetchPackageBegin; cb != nil {
+		ret.FetchPackageBegin = func(provider addrs.Provider, version getproviders.Version, location getproviders.PackageLocation) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, version, location)
+		}
+	}
+	if cb := evts.FetchPackageSuccess; cb != nil {
+		ret.FetchPackageSuccess = func(provider addrs.Provider, version getproviders.Version, localDir string, authResult *getproviders.PackageAuthenticationResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, version, localDir, authResult)
+		}
+	}
+	if cb := evts.FetchPackageFailure; cb != nil {
+		ret.FetchPackageFailure = func(provider addrs.Provider, version getproviders.Version, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, version, err)
+		}
+	}
+	if cb := evts.FetchPackageProgress; cb != nil {
+		ret.FetchPackageProgress = func(provider addrs.Provider, version getproviders.Version, bytesFetched, bytesTotal int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, version, bytesFetched, bytesTotal)
+		}
+	}
+	if cb := evts.HashPackageFailure; cb != nil {
+		ret.HashPackageFailure = func(provider addrs.Provider, version getproviders.Version, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			cb(provider, version, err)
+		}
+	}
+	return ret
+}
+
 // OnContext produces a context with all of the same behaviors as the given
 // context except that it will additionally carry the receiving
 // InstallerEvents.
@@ -0,0 +1,176 @@
+package providercache
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/apparentlymart/go-versions/versions"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+// LockPlatformHashes queries the installer's source for each of the given
+// requirements and records package hashes for every one of the given
+// platforms in the lock file, without installing anything into the cache
+// directory itself.
+//
+// This is the backing operation for "terraform providers lock": a lock file
+// produced on one platform can then be used on others without verification
+// failures.
+//
+// For providers that already have a lock entry, the locked version is kept
+// as long as it still satisfies the constraints, and any hash conflict with
+// what the source delivers is reported as an error for that provider rather
+// than overwritten. The result describes the version that was locked for
+// each provider; the error, if non-nil, is an InstallerError describing any
+// per-provider problems.
+func (i *Installer) LockPlatformHashes(ctx context.Context, reqs getproviders.Requirements, platforms []getproviders.Platform) (map[addrs.Provider]getproviders.Version, error) {
+	unlock, err := lockCacheDirTimeout(i.targetDir.baseDir, i.lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	prevEntries, err := i.lockFile().Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read selections file: %s", err)
+	}
+
+	locked := map[addrs.Provider]getproviders.Version{}
+	newEntries := map[addrs.Provider]lockFileEntry{}
+	errs := map[addrs.Provider]error{}
+
+	// Entries for providers no longer in the requirements are carried over
+	// untouched, matching how an ordinary install would not disturb them.
+	for provider, entry := range prevEntries {
+		newEntries[provider] = entry
+	}
+
+Providers:
+	for provider, versionConstraints := range reqs {
+		if provider.IsBuiltIn() {
+			// Built-in providers have no packages and therefore nothing
+			// to lock.
+			continue
+		}
+
+		acceptableVersions := versions.MeetingConstraints(versionConstraints)
+		prev, hasPrev := prevEntries[provider]
+
+		var version getproviders.Version
+		switch {
+		case hasPrev && acceptableVersions.Has(prev.SelectedVersion):
+			// Keep the locked selection; this command records hashes, it
+			// doesn't upgrade.
+			version = prev.SelectedVersion
+		default:
+			available, _, err := i.source.AvailableVersions(provider)
+			if err != nil {
+				errs[provider] = err
+				continue
+			}
+			available.Sort()
+			found := false
+			for idx := len(available) - 1; idx >= 0; idx-- { // walk backwards to consider newer versions first
+				if acceptableVersions.Has(available[idx]) {
+					version = available[idx]
+					found = true
+					break
+				}
+			}
+			if !found {
+				errs[provider] = fmt.Errorf("no available releases match the given constraints %s", getproviders.VersionConstraintsString(versionConstraints))
+				continue
+			}
+		}
+
+		entry := lockFileEntry{
+			SelectedVersion: version,
+		}
+		if hasPrev && prev.SelectedVersion == version {
+			// Keep whatever was already recorded; we only add to it below.
+			entry = prev
+		}
+
+		for _, platform := range platforms {
+			meta, err := i.source.PackageMeta(provider, version, platform)
+			if err != nil {
+				errs[provider] = fmt.Errorf("can't get package for %s on %s: %s", version, platform, err)
+				continue Providers
+			}
+			hash, err := packageHashForMeta(ctx, meta)
+			if err != nil {
+				errs[provider] = fmt.Errorf("failed to calculate checksum for %s package on %s: %s", version, platform, err)
+				continue Providers
+			}
+
+			if platform == i.targetDir.targetPlatform && entry.PackageHash != "" && entry.PackageHash != hash {
+				// The recorded hash for our own platform disagreeing with
+				// what the source delivered means either the mirror or the
+				// installed package was tampered with, so this is never
+				// something to fix up silently.
+				errs[provider] = fmt.Errorf("the source has hash %s for the %s package of v%s, but the lock file already records %s; verify the configured installation source before re-locking this provider", hash, platform, version, entry.PackageHash)
+				continue Providers
+			}
+			if entry.PackageHash == "" && platform == i.targetDir.targetPlatform {
+				entry.PackageHash = hash
+			} else if !entry.hashIsAllowed(hash) {
+				entry.AdditionalHashes = append(entry.AdditionalHashes, hash)
+			}
+		}
+
+		newEntries[provider] = entry
+		locked[provider] = version
+	}
+
+	err = i.lockFile().Write(newEntries)
+	if err != nil {
+		return locked, fmt.Errorf("failed to record the locked provider hashes: %s", err)
+	}
+
+	if len(errs) > 0 {
+		return locked, InstallerError{
+			ProviderErrors: errs,
+		}
+	}
+	return locked, nil
+}
+
+// packageHashForMeta retrieves the package described by the given metadata
+// into a temporary directory and computes its hash, without touching any
+// cache directory.
+func packageHashForMeta(ctx context.Context, meta getproviders.PackageMeta) (string, error) {
+	tmpDir, err := ioutil.TempDir("", "terraform-providers-lock")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	packageDir := filepath.Join(tmpDir, "package")
+
+	switch meta.Location.(type) {
+	case getproviders.PackageHTTPURL:
+		_, err = installFromHTTPURL(ctx, meta, packageDir)
+	case getproviders.PackageLocalArchive:
+		_, err = installFromLocalArchive(ctx, meta, packageDir)
+	case getproviders.PackageLocalDir:
+		// Force a copy so that we hash real file contents even if the
+		// source would normally be linked in.
+		_, err = installFromLocalDir(ctx, meta, packageDir, true)
+	default:
+		return "", fmt.Errorf("don't know how to install from a %T location", meta.Location)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	cached := &CachedProvider{
+		Provider:   meta.Provider,
+		Version:    meta.Version,
+		PackageDir: packageDir,
+	}
+	return cached.Hash()
+}
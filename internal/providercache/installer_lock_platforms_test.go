@@ -0,0 +1,156 @@
+package providercache
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+// fakePlatformPackageMeta returns an installable package whose archive
+// contents mention the target platform, so that packages for different
+// platforms hash differently.
+func fakePlatformPackageMeta(provider addrs.Provider, version getproviders.Version, target getproviders.Platform) (getproviders.PackageMeta, func(), error) {
+	f, err := ioutil.TempFile("", "terraform-providercache-fake-package-")
+	if err != nil {
+		return getproviders.PackageMeta{}, func() {}, err
+	}
+	close := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	zw := zip.NewWriter(f)
+	fw, err := zw.Create(fmt.Sprintf("terraform-provider-%s_%s", provider.Type, version.String()))
+	if err != nil {
+		return getproviders.PackageMeta{}, close, err
+	}
+	fmt.Fprintf(fw, "This is a fake provider package for %s %s on %s.\n", provider, version, target)
+	if err := zw.Close(); err != nil {
+		return getproviders.PackageMeta{}, close, err
+	}
+
+	return getproviders.PackageMeta{
+		Provider:       provider,
+		Version:        version,
+		TargetPlatform: target,
+		Filename:       fmt.Sprintf("terraform-provider-%s_%s_%s.zip", provider.Type, version.String(), target.String()),
+		Location:       getproviders.PackageLocalArchive(f.Name()),
+	}, close, nil
+}
+
+func TestLockPlatformHashes(t *testing.T) {
+	provider := addrs.MustParseProviderSourceString("example.com/awesomesauce/happycloud")
+	version := getproviders.MustParseVersion("1.2.0")
+	platformA := getproviders.Platform{OS: "amigaos", Arch: "m68k"}
+	platformB := getproviders.Platform{OS: "tros", Arch: "z80"}
+
+	// FakeInstallablePackageMeta produces identical archive contents for
+	// every platform, which would defeat the point of this test, so we
+	// build archives whose contents differ per platform as real provider
+	// releases do.
+	metaA, closeA, err := fakePlatformPackageMeta(provider, version, platformA)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer closeA()
+	metaB, closeB, err := fakePlatformPackageMeta(provider, version, platformB)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer closeB()
+	source := getproviders.NewMockSource([]getproviders.PackageMeta{metaA, metaB})
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	tmpDirPath, err = filepath.EvalSymlinks(tmpDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := NewDirWithPlatform(tmpDirPath, platformA)
+	installer := NewInstaller(dir, source)
+
+	reqs := getproviders.Requirements{
+		provider: getproviders.MustParseVersionConstraints(">= 1.0.0"),
+	}
+	locked, err := installer.LockPlatformHashes(context.Background(), reqs, []getproviders.Platform{platformA, platformB})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := locked[provider], version; got != want {
+		t.Errorf("wrong locked version %s; want %s", got, want)
+	}
+
+	entries, err := installer.lockFile().Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	entry, exists := entries[provider]
+	if !exists {
+		t.Fatalf("no lock entry for %s", provider)
+	}
+	if entry.SelectedVersion != version {
+		t.Errorf("wrong selected version %s; want %s", entry.SelectedVersion, version)
+	}
+	if entry.PackageHash == "" {
+		t.Errorf("no package hash recorded for the installer's own platform")
+	}
+	if len(entry.AdditionalHashes) != 1 {
+		t.Fatalf("wrong number of additional hashes %d; want 1", len(entry.AdditionalHashes))
+	}
+	if entry.AdditionalHashes[0] == entry.PackageHash {
+		t.Errorf("additional hash duplicates the package hash; the two platforms' packages should hash differently")
+	}
+
+	// Locking again must be a no-op rather than growing the hash list.
+	_, err = installer.LockPlatformHashes(context.Background(), reqs, []getproviders.Platform{platformA, platformB})
+	if err != nil {
+		t.Fatalf("unexpected error on relock: %s", err)
+	}
+	entries, err = installer.lockFile().Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := len(entries[provider].AdditionalHashes); got != 1 {
+		t.Errorf("wrong number of additional hashes after relock %d; want 1", got)
+	}
+
+	// A conflicting recorded hash for our own platform must be reported,
+	// not overwritten.
+	entry = entries[provider]
+	goodHash := entry.PackageHash
+	entry.PackageHash = "h1:0000000000000000000000000000000000000000000="
+	entries[provider] = entry
+	if err := installer.lockFile().Write(entries); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = installer.LockPlatformHashes(context.Background(), reqs, []getproviders.Platform{platformA})
+	if err == nil {
+		t.Fatalf("succeeded with conflicting hash; expected error")
+	}
+	instErr, ok := err.(InstallerError)
+	if !ok {
+		t.Fatalf("wrong error type %T; want InstallerError", err)
+	}
+	if providerErr := instErr.ProviderErrors[provider]; providerErr == nil || !strings.Contains(providerErr.Error(), "already records") {
+		t.Errorf("wrong error for %s: %s", provider, providerErr)
+	}
+	entries, err = installer.lockFile().Read()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if entries[provider].PackageHash == goodHash {
+		t.Errorf("conflicting hash was silently overwritten")
+	}
+}
@@ -0,0 +1,121 @@
+package providercache
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// PurgeProviders discards the installed packages and recorded selections for
+// the given providers, so that the next installation run reinstalls them
+// from the configured source. This is the recovery path for a cache whose
+// contents have been corrupted, such as by disk problems or an overzealous
+// antivirus tool. A nil or empty provider list means every provider.
+//
+// The result lists the packages that were removed from the local cache
+// directory, sorted by provider address and then by version.
+//
+// If a global cache directory is configured then its copy of each purged
+// provider's selected version is verified against the recorded checksum and
+// deleted when it no longer matches, so that reinstallation re-downloads
+// the package rather than re-linking a corrupted copy. Copies that still
+// verify are kept and may be linked again as usual.
+func (i *Installer) PurgeProviders(providers []addrs.Provider) ([]CachedProvider, error) {
+	unlock, err := lockCacheDirTimeout(i.targetDir.baseDir, i.lockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock the provider cache directory %s: %s", i.targetDir.baseDir, err)
+	}
+	defer unlock()
+
+	entries, err := i.lockFile().Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read selections file: %s", err)
+	}
+
+	match := func(provider addrs.Provider) bool {
+		if len(providers) == 0 {
+			return true
+		}
+		for _, p := range providers {
+			if p == provider {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Every version of a matching provider goes, not just the selected one,
+	// so that the re-selection below can't quietly adopt another corrupted
+	// package that happens to be lying around.
+	var purged []CachedProvider
+	for _, cps := range i.targetDir.AllAvailablePackages() {
+		for _, cached := range cps {
+			if !match(cached.Provider) {
+				continue
+			}
+			if err := os.RemoveAll(cached.PackageDir); err != nil {
+				i.targetDir.invalidateMetaCache()
+				return purged, fmt.Errorf("failed to remove the package for %s v%s from %s: %s", cached.Provider.ForDisplay(), cached.Version, cached.PackageDir, err)
+			}
+			// The next package installed at this path must be verified
+			// afresh, rather than inheriting this one's verification.
+			forgetVerifiedPackageHash(cached.PackageDir)
+			purged = append(purged, cached)
+		}
+	}
+	if len(purged) > 0 {
+		i.targetDir.invalidateMetaCache()
+	}
+	sort.Slice(purged, func(a, b int) bool {
+		if purged[a].Provider != purged[b].Provider {
+			return purged[a].Provider.LessThan(purged[b].Provider)
+		}
+		return purged[a].Version.LessThan(purged[b].Version)
+	})
+
+	if i.globalCacheDir != nil {
+		unlockGlobal, err := lockCacheDir(i.globalCacheDir.baseDir)
+		if err != nil {
+			return purged, fmt.Errorf("failed to lock provider cache directory %s: %s", i.globalCacheDir.baseDir, err)
+		}
+		defer unlockGlobal()
+		for provider, entry := range entries {
+			if !match(provider) {
+				continue
+			}
+			cached := i.globalCacheDir.ProviderVersion(provider, entry.SelectedVersion)
+			if cached == nil {
+				continue
+			}
+			if hash, err := cached.Hash(); err == nil && entry.hashIsAllowed(hash) {
+				continue // the shared copy is intact, so re-linking it is fine
+			}
+			if err := os.RemoveAll(cached.PackageDir); err != nil {
+				i.globalCacheDir.invalidateMetaCache()
+				return purged, fmt.Errorf("failed to remove the corrupted package for %s v%s from the shared cache at %s: %s", provider.ForDisplay(), entry.SelectedVersion, cached.PackageDir, err)
+			}
+			forgetVerifiedPackageHash(cached.PackageDir)
+			i.globalCacheDir.invalidateMetaCache()
+			log.Printf("[WARN] providercache: the shared cache copy of %s v%s failed checksum verification, so it was deleted to force a fresh download", provider, entry.SelectedVersion)
+		}
+	}
+
+	// Finally we drop the recorded selections for the purged providers, so
+	// that the next installation run re-selects and re-records them.
+	changed := false
+	for provider := range entries {
+		if match(provider) {
+			delete(entries, provider)
+			changed = true
+		}
+	}
+	if changed {
+		if err := i.lockFile().Write(entries); err != nil {
+			return purged, fmt.Errorf("failed to record a manifest of selected providers: %s", err)
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,125 @@
+package providercache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+func TestPurgeProviders(t *testing.T) {
+	provider := addrs.MustParseProviderSourceString("example.com/awesomesauce/happycloud")
+	otherProvider := addrs.MustParseProviderSourceString("example.com/awesomesauce/saddlecloud")
+	version := getproviders.MustParseVersion("1.2.0")
+	platform := getproviders.Platform{OS: "amigaos", Arch: "m68k"}
+
+	meta, close1, err := fakePlatformPackageMeta(provider, version, platform)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer close1()
+	otherMeta, close2, err := fakePlatformPackageMeta(otherProvider, version, platform)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer close2()
+	source := getproviders.NewMockSource([]getproviders.PackageMeta{meta, otherMeta})
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	dir := NewDirWithPlatform(filepath.Join(tmpDirPath, "target"), platform)
+	globalDir := NewDirWithPlatform(filepath.Join(tmpDirPath, "global"), platform)
+	installer := NewInstaller(dir, source)
+	installer.SetGlobalCacheDir(globalDir)
+
+	reqs := getproviders.Requirements{
+		provider:      getproviders.MustParseVersionConstraints(">= 1.0.0"),
+		otherProvider: getproviders.MustParseVersionConstraints(">= 1.0.0"),
+	}
+	ctx := context.Background()
+	if _, err := installer.EnsureProviderVersions(ctx, reqs, InstallNewProvidersOnly); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Corrupt the shared cache copy of the first provider, so that the purge
+	// has to delete it rather than leave it to be re-linked.
+	globalCached := globalDir.ProviderVersion(provider, version)
+	if globalCached == nil {
+		t.Fatal("first provider not present in the global cache")
+	}
+	if err := ioutil.WriteFile(filepath.Join(globalCached.PackageDir, "extra-file"), []byte("tampered"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ForgetVerifiedPackages()
+
+	purged, err := installer.PurgeProviders([]addrs.Provider{provider})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := len(purged), 1; got != want {
+		t.Fatalf("wrong number of purged packages %d; want %d", got, want)
+	}
+	if got, want := purged[0].Provider, provider; got != want {
+		t.Errorf("wrong purged provider %s; want %s", got, want)
+	}
+
+	// The purged provider must be gone from the target directory, from the
+	// recorded selections, and (because its copy was corrupted) from the
+	// shared cache, while the other provider is untouched everywhere.
+	dir.invalidateMetaCache()
+	if dir.ProviderVersion(provider, version) != nil {
+		t.Errorf("purged provider still present in the target directory")
+	}
+	if dir.ProviderVersion(otherProvider, version) == nil {
+		t.Errorf("other provider missing from the target directory after purge")
+	}
+	if globalDir.ProviderVersion(provider, version) != nil {
+		t.Errorf("corrupted shared cache copy still present after purge")
+	}
+	if globalDir.ProviderVersion(otherProvider, version) == nil {
+		t.Errorf("intact shared cache copy of the other provider was deleted")
+	}
+	selections, err := installer.SelectedVersions()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, exists := selections[provider]; exists {
+		t.Errorf("purged provider still has a recorded selection")
+	}
+	if _, exists := selections[otherProvider]; !exists {
+		t.Errorf("other provider lost its recorded selection")
+	}
+
+	// A fresh installation run replaces the purged provider and records a
+	// new selection for it.
+	if _, err := installer.EnsureProviderVersions(ctx, reqs, InstallNewProvidersOnly); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if dir.ProviderVersion(provider, version) == nil {
+		t.Errorf("purged provider not reinstalled")
+	}
+
+	// An empty provider list purges everything.
+	purged, err = installer.PurgeProviders(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := len(purged), 2; got != want {
+		t.Fatalf("wrong number of purged packages %d; want %d", got, want)
+	}
+	selections, err = installer.SelectedVersions()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := len(selections), 0; got != want {
+		t.Errorf("wrong number of remaining selections %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package providercache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+func TestEnsureProviderVersions_lockfileReadOnly(t *testing.T) {
+	provider := addrs.MustParseProviderSourceString("example.com/awesomesauce/happycloud")
+	version := getproviders.MustParseVersion("1.2.0")
+	platform := getproviders.Platform{OS: "amigaos", Arch: "m68k"}
+
+	meta, close, err := fakePlatformPackageMeta(provider, version, platform)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer close()
+	source := getproviders.NewMockSource([]getproviders.PackageMeta{meta})
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	tmpDirPath, err = filepath.EvalSymlinks(tmpDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := NewDirWithPlatform(tmpDirPath, platform)
+	installer := NewInstaller(dir, source)
+
+	reqs := getproviders.Requirements{
+		provider: getproviders.MustParseVersionConstraints(">= 1.0.0"),
+	}
+	ctx := context.Background()
+
+	t.Run("new provider not in lock file", func(t *testing.T) {
+		installer.SetLockfileReadOnly(true)
+		defer installer.SetLockfileReadOnly(false)
+
+		_, err := installer.EnsureProviderVersions(ctx, reqs, InstallNewProvidersOnly)
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		instErr, ok := err.(InstallerError)
+		if !ok {
+			t.Fatalf("wrong error type %T; want InstallerError", err)
+		}
+		if providerErr := instErr.ProviderErrors[provider]; providerErr == nil || !strings.Contains(providerErr.Error(), "not yet recorded in the lock file") {
+			t.Errorf("wrong error for %s: %s", provider, providerErr)
+		}
+	})
+
+	// A normal install establishes the lock data that the remaining
+	// subtests verify against.
+	if _, err := installer.EnsureProviderVersions(ctx, reqs, InstallNewProvidersOnly); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lockFilename := installer.lockFile().filename
+	lockBefore, err := ioutil.ReadFile(lockFilename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	t.Run("happy path makes no writes", func(t *testing.T) {
+		installer.SetLockfileReadOnly(true)
+		defer installer.SetLockfileReadOnly(false)
+
+		// Making the file unwritable proves that nothing even attempts
+		// to rewrite it with identical content.
+		if err := os.Chmod(lockFilename, 0444); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer os.Chmod(lockFilename, 0664)
+
+		selected, err := installer.EnsureProviderVersions(ctx, reqs, InstallNewProvidersOnly)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got, want := selected[provider], version; got != want {
+			t.Errorf("wrong selected version %s; want %s", got, want)
+		}
+		lockAfter, err := ioutil.ReadFile(lockFilename)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(lockAfter) != string(lockBefore) {
+			t.Errorf("lock data changed during a read-only run")
+		}
+	})
+
+	t.Run("constraints no longer satisfiable", func(t *testing.T) {
+		installer.SetLockfileReadOnly(true)
+		defer installer.SetLockfileReadOnly(false)
+
+		newReqs := getproviders.Requirements{
+			provider: getproviders.MustParseVersionConstraints(">= 2.0.0"),
+		}
+		_, err := installer.EnsureProviderVersions(ctx, newReqs, InstallNewProvidersOnly)
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		instErr, ok := err.(InstallerError)
+		if !ok {
+			t.Fatalf("wrong error type %T; want InstallerError", err)
+		}
+		if providerErr := instErr.ProviderErrors[provider]; providerErr == nil || !strings.Contains(providerErr.Error(), "no longer satisfies the version constraints") {
+			t.Errorf("wrong error for %s: %s", provider, providerErr)
+		}
+	})
+
+	t.Run("hash for this platform missing", func(t *testing.T) {
+		installer.SetLockfileReadOnly(true)
+		defer installer.SetLockfileReadOnly(false)
+
+		entries, err := installer.lockFile().Read()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		entry := entries[provider]
+		entry.PackageHash = "h1:0000000000000000000000000000000000000000000="
+		entries[provider] = entry
+		if err := installer.lockFile().Write(entries); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer func() {
+			if err := ioutil.WriteFile(lockFilename, lockBefore, 0664); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}()
+
+		_, err = installer.EnsureProviderVersions(ctx, reqs, InstallNewProvidersOnly)
+		if err == nil {
+			t.Fatalf("succeeded; expected error")
+		}
+		instErr, ok := err.(InstallerError)
+		if !ok {
+			t.Fatalf("wrong error type %T; want InstallerError", err)
+		}
+		if providerErr := instErr.ProviderErrors[provider]; providerErr == nil || !strings.Contains(providerErr.Error(), "not recorded in the lock file for this platform") {
+			t.Errorf("wrong error for %s: %s", provider, providerErr)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package providercache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+func TestRequirementsSatisfied(t *testing.T) {
+	provider := addrs.MustParseProviderSourceString("example.com/awesomesauce/happycloud")
+	version := getproviders.MustParseVersion("1.2.0")
+	platform := getproviders.Platform{OS: "amigaos", Arch: "m68k"}
+
+	meta, close, err := fakePlatformPackageMeta(provider, version, platform)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer close()
+	source := getproviders.NewMockSource([]getproviders.PackageMeta{meta})
+
+	dirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dirPath)
+
+	dir := NewDirWithPlatform(dirPath, platform)
+	installer := NewInstaller(dir, source)
+	installer.SetBuiltInProviderTypes([]string{"terraform"})
+
+	reqs := getproviders.Requirements{
+		provider: getproviders.MustParseVersionConstraints(">= 1.0.0"),
+	}
+
+	// Before anything is installed there is no recorded selection, so the
+	// requirements can't be satisfied yet.
+	if _, ok := installer.RequirementsSatisfied(reqs); ok {
+		t.Fatal("requirements reported as satisfied before installation")
+	}
+
+	if _, err := installer.EnsureProviderVersions(context.Background(), reqs, InstallNewProvidersOnly); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	selected, ok := installer.RequirementsSatisfied(reqs)
+	if !ok {
+		t.Fatal("requirements not reported as satisfied after installation")
+	}
+	if got, want := selected[provider].String(), "1.2.0"; got != want {
+		t.Errorf("wrong selected version %q; want %q", got, want)
+	}
+
+	// A constraint the locked version can't meet must disqualify the
+	// short-circuit so that the full path selects a new version.
+	strictReqs := getproviders.Requirements{
+		provider: getproviders.MustParseVersionConstraints(">= 2.0.0"),
+	}
+	if _, ok := installer.RequirementsSatisfied(strictReqs); ok {
+		t.Error("requirements reported as satisfied despite an unmet constraint")
+	}
+
+	// Built-in providers always need the full path, which validates them
+	// and reports their availability.
+	builtInReqs := getproviders.Requirements{
+		provider:                              getproviders.MustParseVersionConstraints(">= 1.0.0"),
+		addrs.NewBuiltInProvider("terraform"): nil,
+	}
+	if _, ok := installer.RequirementsSatisfied(builtInReqs); ok {
+		t.Error("requirements reported as satisfied despite a built-in provider")
+	}
+
+	// Corrupting the installed package must disqualify the short-circuit,
+	// because only a checksum-verified package counts as satisfying.
+	ForgetVerifiedPackages()
+	cached := dir.ProviderVersion(provider, version)
+	if cached == nil {
+		t.Fatal("installed package not found in the target directory")
+	}
+	if err := ioutil.WriteFile(filepath.Join(cached.PackageDir, "extra-file"), []byte("tampered"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := installer.RequirementsSatisfied(reqs); ok {
+		t.Error("requirements reported as satisfied despite a corrupted package")
+	}
+}
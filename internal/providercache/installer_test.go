@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	svchost "github.com/hashicorp/terraform-svchost"
@@ -94,6 +96,366 @@ func TestEnsureProviderVersions_protocol_errors(t *testing.T) {
 	}
 }
 
+func TestEnsureProviderVersions_concurrent(t *testing.T) {
+	// This test installs two providers from a local filesystem mirror with
+	// the install concurrency turned up, to exercise the concurrent
+	// installation path end-to-end.
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	platform := getproviders.Platform{OS: "linux", Arch: "amd64"}
+	source := getproviders.NewFilesystemMirrorSource("testdata/cachedir")
+	dir := NewDirWithPlatform(tmpDirPath, platform)
+	installer := NewInstaller(dir, source)
+	installer.SetConcurrency(2)
+
+	nullProvider := addrs.MustParseProviderSourceString("registry.terraform.io/hashicorp/null")
+	randomProvider := addrs.MustParseProviderSourceString("registry.terraform.io/hashicorp/random")
+	reqs := getproviders.Requirements{
+		nullProvider:   getproviders.MustParseVersionConstraints("2.0.0"),
+		randomProvider: getproviders.MustParseVersionConstraints("1.2.0"),
+	}
+
+	ctx := context.TODO()
+	selected, err := installer.EnsureProviderVersions(ctx, reqs, InstallNewProvidersOnly)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := len(selected), 2; got != want {
+		t.Fatalf("wrong number of selections %d; want %d", got, want)
+	}
+	if got, want := selected[nullProvider].String(), "2.0.0"; got != want {
+		t.Errorf("wrong selected version for null provider %q; want %q", got, want)
+	}
+	if got, want := selected[randomProvider].String(), "1.2.0"; got != want {
+		t.Errorf("wrong selected version for random provider %q; want %q", got, want)
+	}
+	for provider, version := range selected {
+		if dir.ProviderVersion(provider, version) == nil {
+			t.Errorf("%s v%s is not present in the target directory after installation", provider, version)
+		}
+	}
+}
+
+func TestEnsureProviderVersions_versionWarnings(t *testing.T) {
+	provider := addrs.MustParseProviderSourceString("example.com/weaksauce/deprecated")
+	version := getproviders.MustParseVersion("1.0.0")
+	platform := getproviders.Platform{OS: "amigaos", Arch: "m68k"}
+
+	meta, close, err := fakePlatformPackageMeta(provider, version, platform)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer close()
+	source := getproviders.NewMockSource([]getproviders.PackageMeta{meta})
+	wantWarnings := getproviders.Warnings{"1.0.0 is deprecated: use something else instead"}
+	source.SetWarnings(provider, wantWarnings)
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	tmpDirPath, err = filepath.EvalSymlinks(tmpDirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := NewDirWithPlatform(tmpDirPath, platform)
+	installer := NewInstaller(dir, source)
+
+	var gotWarnings getproviders.Warnings
+	evts := &InstallerEvents{
+		QueryPackagesWarning: func(warnedProvider addrs.Provider, warnings []string) {
+			if warnedProvider != provider {
+				t.Errorf("warning reported for wrong provider %s", warnedProvider)
+			}
+			gotWarnings = append(gotWarnings, warnings...)
+		},
+	}
+	ctx := evts.OnContext(context.Background())
+
+	reqs := getproviders.Requirements{
+		provider: getproviders.MustParseVersionConstraints(">= 1.0.0"),
+	}
+	selected, err := installer.EnsureProviderVersions(ctx, reqs, InstallNewProvidersOnly)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := selected[provider].String(), "1.0.0"; got != want {
+		t.Errorf("wrong selected version %q; want %q", got, want)
+	}
+	if got, want := strings.Join(gotWarnings, "; "), strings.Join(wantWarnings, "; "); got != want {
+		t.Errorf("wrong warnings from events %q; want %q", got, want)
+	}
+
+	stored, err := installer.SelectedPackageWarnings()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := strings.Join(stored[provider], "; "), strings.Join(wantWarnings, "; "); got != want {
+		t.Errorf("wrong warnings recorded with the selection %q; want %q", got, want)
+	}
+
+	// A second run that reuses the existing installation doesn't query the
+	// source again, but the recorded warnings must survive the rewrite of
+	// the selections file.
+	if _, err := installer.EnsureProviderVersions(context.Background(), reqs, InstallNewProvidersOnly); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	stored, err = installer.SelectedPackageWarnings()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := strings.Join(stored[provider], "; "), strings.Join(wantWarnings, "; "); got != want {
+		t.Errorf("warnings were lost on the second run: got %q; want %q", got, want)
+	}
+}
+
+func TestEnsureProviderVersions_sharedGlobalCache(t *testing.T) {
+	// This test runs two installers concurrently against the same global
+	// cache directory, as two separate "terraform init" processes sharing
+	// a plugin cache would, to exercise the cache directory locking.
+	cacheDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDirPath)
+
+	platform := getproviders.Platform{OS: "linux", Arch: "amd64"}
+	nullProvider := addrs.MustParseProviderSourceString("registry.terraform.io/hashicorp/null")
+	randomProvider := addrs.MustParseProviderSourceString("registry.terraform.io/hashicorp/random")
+	reqs := getproviders.Requirements{
+		nullProvider:   getproviders.MustParseVersionConstraints("2.0.0"),
+		randomProvider: getproviders.MustParseVersionConstraints("1.2.0"),
+	}
+
+	targetDirs := make([]*Dir, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for n := 0; n < 2; n++ {
+		targetDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(targetDirPath)
+		targetDirs[n] = NewDirWithPlatform(targetDirPath, platform)
+
+		// Each installer gets its own source and target directory, but they
+		// all share the global cache directory.
+		installer := NewInstaller(targetDirs[n], getproviders.NewFilesystemMirrorSource("testdata/cachedir"))
+		installer.SetGlobalCacheDir(NewDirWithPlatform(cacheDirPath, platform))
+
+		wg.Add(1)
+		go func(n int, installer *Installer) {
+			defer wg.Done()
+			_, errs[n] = installer.EnsureProviderVersions(context.TODO(), reqs, InstallNewProvidersOnly)
+		}(n, installer)
+	}
+	wg.Wait()
+
+	for n, err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error from installer %d: %s", n, err)
+		}
+	}
+	wantVersions := map[addrs.Provider]getproviders.Version{
+		nullProvider:   getproviders.MustParseVersion("2.0.0"),
+		randomProvider: getproviders.MustParseVersion("1.2.0"),
+	}
+	cacheDir := NewDirWithPlatform(cacheDirPath, platform)
+	for _, dir := range append(targetDirs, cacheDir) {
+		for provider, version := range wantVersions {
+			if dir.ProviderVersion(provider, version) == nil {
+				t.Errorf("%s v%s is not present in %s after installation", provider, version, dir.baseDir)
+			}
+		}
+	}
+}
+
+func TestSelectedPackages_checksumMismatch(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// Construct a plausible-looking cached package whose content hash
+	// cannot possibly match the hash we record in the lock file below.
+	pkgDir := filepath.Join(tmpDirPath, "registry.terraform.io", "hashicorp", "null", "2.0.0", "linux_amd64")
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkgDir, "terraform-provider-null"), []byte("tampered!"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	platform := getproviders.Platform{OS: "linux", Arch: "amd64"}
+	dir := NewDirWithPlatform(tmpDirPath, platform)
+	installer := NewInstaller(dir, getproviders.MultiSource(nil))
+
+	provider := addrs.MustParseProviderSourceString("registry.terraform.io/hashicorp/null")
+	wantHash := "h1:000000000000000000000000000000000000000000000="
+	err = installer.lockFile().Write(map[addrs.Provider]lockFileEntry{
+		provider: {
+			SelectedVersion: getproviders.MustParseVersion("2.0.0"),
+			PackageHash:     wantHash,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = installer.SelectedPackages()
+	if err == nil {
+		t.Fatal("unexpected success; want checksum mismatch error")
+	}
+	instErr, ok := err.(InstallerError)
+	if !ok {
+		t.Fatalf("wrong error type %T; want InstallerError", err)
+	}
+	providerErr := instErr.ProviderErrors[provider]
+	if providerErr == nil {
+		t.Fatalf("no error recorded for %s", provider)
+	}
+	if !strings.Contains(providerErr.Error(), "checksum mismatch") {
+		t.Errorf("error %q does not mention the checksum mismatch", providerErr)
+	}
+	if !strings.Contains(providerErr.Error(), wantHash) {
+		t.Errorf("error %q does not include the recorded hash", providerErr)
+	}
+	if !strings.Contains(providerErr.Error(), "h1:") {
+		t.Errorf("error %q does not include the actual hash", providerErr)
+	}
+}
+
+func TestSelectedPackages_missingPackages(t *testing.T) {
+	// When several selected packages have been removed from the cache we
+	// want a problem reported for each of them, along with the successful
+	// recall of any packages that are still intact.
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	platform := getproviders.Platform{OS: "linux", Arch: "amd64"}
+	dir := NewDirWithPlatform(tmpDirPath, platform)
+	installer := NewInstaller(dir, getproviders.MultiSource(nil))
+
+	nullProvider := addrs.MustParseProviderSourceString("registry.terraform.io/hashicorp/null")
+	randomProvider := addrs.MustParseProviderSourceString("registry.terraform.io/hashicorp/random")
+	err = installer.lockFile().Write(map[addrs.Provider]lockFileEntry{
+		nullProvider: {
+			SelectedVersion: getproviders.MustParseVersion("2.0.0"),
+			PackageHash:     "h1:000000000000000000000000000000000000000000000=",
+		},
+		randomProvider: {
+			SelectedVersion: getproviders.MustParseVersion("1.2.0"),
+			PackageHash:     "h1:000000000000000000000000000000000000000000000=",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = installer.SelectedPackages()
+	if err == nil {
+		t.Fatal("unexpected success; want errors for both missing packages")
+	}
+	instErr, ok := err.(InstallerError)
+	if !ok {
+		t.Fatalf("wrong error type %T; want InstallerError", err)
+	}
+	if got, want := len(instErr.ProviderErrors), 2; got != want {
+		t.Fatalf("wrong number of provider errors %d; want %d", got, want)
+	}
+	for provider, version := range map[addrs.Provider]string{
+		nullProvider:   "2.0.0",
+		randomProvider: "1.2.0",
+	} {
+		providerErr := instErr.ProviderErrors[provider]
+		if providerErr == nil {
+			t.Fatalf("no error recorded for %s", provider)
+		}
+		if !strings.Contains(providerErr.Error(), "no longer available") {
+			t.Errorf("error %q for %s does not report the package as missing", providerErr, provider)
+		}
+		wantDir := getproviders.UnpackedDirectoryPathForPackage(
+			tmpDirPath, provider, getproviders.MustParseVersion(version), platform,
+		)
+		if !strings.Contains(providerErr.Error(), wantDir) {
+			t.Errorf("error %q for %s does not include the expected path %s", providerErr, provider, wantDir)
+		}
+	}
+}
+
+func TestInstallPackage_progressEvents(t *testing.T) {
+	// Serve a real provider zip over HTTP so that the download path emits
+	// progress events.
+	archive, err := ioutil.ReadFile("testdata/terraform-provider-null_2.1.0_linux_amd64.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	platform := getproviders.Platform{OS: "linux", Arch: "amd64"}
+	dir := NewDirWithPlatform(tmpDirPath, platform)
+
+	provider := addrs.MustParseProviderSourceString("registry.terraform.io/hashicorp/null")
+	version := getproviders.MustParseVersion("2.1.0")
+	meta := getproviders.PackageMeta{
+		Provider:       provider,
+		Version:        version,
+		TargetPlatform: platform,
+		Filename:       "terraform-provider-null_2.1.0_linux_amd64.zip",
+		Location:       getproviders.PackageHTTPURL(server.URL + "/terraform-provider-null_2.1.0_linux_amd64.zip"),
+	}
+
+	var gotFetched, gotTotal int64
+	reports := 0
+	evts := &InstallerEvents{
+		FetchPackageProgress: func(gotProvider addrs.Provider, gotVersion getproviders.Version, bytesFetched, bytesTotal int64) {
+			if gotProvider != provider {
+				t.Errorf("progress event for wrong provider %s", gotProvider)
+			}
+			if gotVersion != version {
+				t.Errorf("progress event for wrong version %s", gotVersion)
+			}
+			gotFetched = bytesFetched
+			gotTotal = bytesTotal
+			reports++
+		},
+	}
+	ctx := evts.OnContext(context.TODO())
+
+	if _, err := dir.InstallPackage(ctx, meta); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if reports == 0 {
+		t.Fatal("no progress events were delivered")
+	}
+	if got, want := gotFetched, int64(len(archive)); got != want {
+		t.Errorf("wrong final fetched byte count %d; want %d", got, want)
+	}
+	if got, want := gotTotal, int64(len(archive)); got != want {
+		t.Errorf("wrong total byte count %d; want %d", got, want)
+	}
+}
+
 // testServices starts up a local HTTP server running a fake provider registry
 // service and returns a service discovery object pre-configured to consider
 // the host "example.com" to be served by the fake registry service.
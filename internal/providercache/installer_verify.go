@@ -0,0 +1,122 @@
+package providercache
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+// PackageVerificationStatus is the outcome of verifying one provider package
+// against the hash recorded when it was installed.
+type PackageVerificationStatus string
+
+const (
+	// PackageOK means the package is present and its hash matches one of
+	// the hashes recorded at installation time.
+	PackageOK PackageVerificationStatus = "ok"
+
+	// PackageModified means the package is present but hashes differently
+	// than recorded, so its contents were changed after installation.
+	PackageModified PackageVerificationStatus = "modified"
+
+	// PackageMissing means no package for the selected version is present
+	// in the cache directory at all.
+	PackageMissing PackageVerificationStatus = "missing"
+)
+
+// PackageVerification describes the outcome of verifying one selected
+// provider package.
+type PackageVerification struct {
+	Provider addrs.Provider
+	Version  getproviders.Version
+
+	// PackageDir is the location of the package in the cache directory,
+	// or empty when the status is PackageMissing.
+	PackageDir string
+
+	// ExpectedHash is the hash recorded at installation time. ActualHash
+	// is the hash of what is in the cache directory now, and is empty when
+	// the package is missing or unreadable.
+	ExpectedHash string
+	ActualHash   string
+
+	Status PackageVerificationStatus
+
+	// Error is a non-empty description of the problem for any status other
+	// than PackageOK.
+	Error string
+}
+
+// VerifyPackages re-hashes each provider package previously selected by an
+// installation run and compares the result against the hashes recorded at
+// installation time, returning one result per selected provider.
+//
+// Unlike SelectedPackages this consults only the local cache directory, so
+// it never makes network requests, and it reports each discrepancy in a
+// structured way instead of failing on the first one. Packages are hashed
+// concurrently, subject to the same concurrency limit as installation.
+func (i *Installer) VerifyPackages() ([]PackageVerification, error) {
+	entries, err := i.lockFile().Read()
+	if err != nil {
+		return nil, err
+	}
+
+	providers := make([]addrs.Provider, 0, len(entries))
+	for provider := range entries {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].LessThan(providers[j])
+	})
+
+	concurrency := i.concurrency
+	if concurrency < 1 {
+		concurrency = defaultInstallConcurrency
+	}
+
+	ret := make([]PackageVerification, len(providers))
+	var wg sync.WaitGroup
+	tokens := make(chan struct{}, concurrency)
+	for idx, provider := range providers {
+		entry := entries[provider]
+		result := &ret[idx]
+		result.Provider = provider
+		result.Version = entry.SelectedVersion
+		result.ExpectedHash = entry.PackageHash
+
+		cached := i.targetDir.ProviderVersion(provider, entry.SelectedVersion)
+		if cached == nil {
+			result.Status = PackageMissing
+			result.Error = "selected package is no longer present in the cache directory"
+			continue
+		}
+		result.PackageDir = cached.PackageDir
+
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func(entry lockFileEntry) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			hash, err := cached.Hash()
+			if err != nil {
+				result.Status = PackageModified
+				result.Error = err.Error()
+				return
+			}
+			result.ActualHash = hash
+			if !entry.hashIsAllowed(hash) {
+				result.Status = PackageModified
+				result.Error = "package contents have changed since installation"
+				return
+			}
+			result.Status = PackageOK
+		}(entry)
+	}
+	wg.Wait()
+
+	return ret, nil
+}
@@ -26,7 +26,38 @@ type lockFile struct {
 // LockFileEntry represents an entry for a specific provider in a LockFile.
 type lockFileEntry struct {
 	SelectedVersion getproviders.Version
-	PackageHash     string
+
+	// PackageHash is the hash of the package as installed into the local
+	// cache directory, on the platform where installation ran.
+	PackageHash string
+
+	// AdditionalHashes records hashes of the same package built for other
+	// platforms, as captured by "terraform providers lock", so that the
+	// lock data can be shared between machines of different platforms.
+	AdditionalHashes []string
+
+	// VersionWarnings records any advisory warnings the provider source
+	// attached when this version was selected, such as a registry marking
+	// the provider as deprecated, so that later runs can repeat them
+	// without querying the source again.
+	VersionWarnings []string
+}
+
+// hashIsAllowed returns true if the given non-empty hash matches any of the
+// hashes recorded in the entry.
+func (lfe *lockFileEntry) hashIsAllowed(got string) bool {
+	if got == "" {
+		return false
+	}
+	if got == lfe.PackageHash {
+		return true
+	}
+	for _, hash := range lfe.AdditionalHashes {
+		if got == hash {
+			return true
+		}
+	}
+	return false
 }
 
 var _ json.Marshaler = (*lockFileEntry)(nil)
@@ -89,8 +120,10 @@ func (lf *lockFile) Write(new map[addrs.Provider]lockFileEntry) error {
 
 func (lfe *lockFileEntry) UnmarshalJSON(src []byte) error {
 	type Raw struct {
-		VersionStr string `json:"version"`
-		Hash       string `json:"hash"`
+		VersionStr string   `json:"version"`
+		Hash       string   `json:"hash"`
+		Hashes     []string `json:"hashes"`
+		Warnings   []string `json:"warnings"`
 	}
 	var raw Raw
 	err := json.Unmarshal(src, &raw)
@@ -103,12 +136,21 @@ func (lfe *lockFileEntry) UnmarshalJSON(src []byte) error {
 	}
 	lfe.SelectedVersion = version
 	lfe.PackageHash = raw.Hash
+	lfe.AdditionalHashes = raw.Hashes
+	lfe.VersionWarnings = raw.Warnings
 	return nil
 }
 
 func (lfe *lockFileEntry) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]interface{}{
+	raw := map[string]interface{}{
 		"version": lfe.SelectedVersion.String(),
 		"hash":    lfe.PackageHash,
-	})
+	}
+	if len(lfe.AdditionalHashes) > 0 {
+		raw["hashes"] = lfe.AdditionalHashes
+	}
+	if len(lfe.VersionWarnings) > 0 {
+		raw["warnings"] = lfe.VersionWarnings
+	}
+	return json.Marshal(raw)
 }
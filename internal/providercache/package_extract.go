@@ -0,0 +1,178 @@
+package providercache
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// packageMaxSizeEnvName is the name of the environment variable that can be
+// set to customize the maximum total uncompressed size, in bytes, that a
+// provider package archive is allowed to expand to.
+const packageMaxSizeEnvName = "TF_PROVIDER_MAX_UNCOMPRESSED_SIZE"
+
+// defaultPackageMaxSize is the maximum total uncompressed size of a provider
+// package unless overridden via packageMaxSizeEnvName. The largest real
+// provider packages are a few hundred megabytes, so this is generous while
+// still ruling out a zip bomb expanding to terabytes.
+const defaultPackageMaxSize = 4 * 1024 * 1024 * 1024 // 4 GiB
+
+// packageMaxSize returns the effective maximum total uncompressed size for
+// a provider package archive.
+func packageMaxSize() int64 {
+	raw := os.Getenv(packageMaxSizeEnvName)
+	if raw == "" {
+		return defaultPackageMaxSize
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 1 {
+		log.Printf("[WARN] invalid %s %q: must be a positive number of bytes; using the default of %d", packageMaxSizeEnvName, raw, int64(defaultPackageMaxSize))
+		return defaultPackageMaxSize
+	}
+	return n
+}
+
+// extractPackageZip unpacks the provider package archive at the given
+// filename into targetDir.
+//
+// Provider packages come from configurable mirrors that aren't necessarily
+// trustworthy, so rather than borrowing a general-purpose unzip
+// implementation this one rejects anything a well-formed provider package
+// has no business containing: entries whose paths would land outside the
+// target directory, symlinks pointing outside the package, entries with
+// device or setuid/setgid modes, and archives whose total uncompressed size
+// exceeds packageMaxSize.
+func extractPackageZip(targetDir, filename string) error {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	maxSize := packageMaxSize()
+	var totalSize int64
+	for _, f := range r.File {
+		totalSize += int64(f.UncompressedSize64)
+	}
+	if totalSize > maxSize {
+		return fmt.Errorf("invalid package archive: uncompressed size %d exceeds the maximum of %d bytes", totalSize, maxSize)
+	}
+
+	// remaining enforces the size limit during extraction too, because the
+	// sizes declared in the archive's directory aren't trustworthy either.
+	remaining := maxSize
+	for _, f := range r.File {
+		relPath, err := packageEntryPath(f.Name)
+		if err != nil {
+			return err
+		}
+		absPath := filepath.Join(targetDir, relPath)
+		mode := f.Mode()
+
+		switch {
+		case mode&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket) != 0:
+			return fmt.Errorf("invalid package archive: entry %q is a special file, not a regular file", f.Name)
+		case mode&(os.ModeSetuid|os.ModeSetgid) != 0:
+			return fmt.Errorf("invalid package archive: entry %q has setuid or setgid permissions", f.Name)
+		case mode.IsDir():
+			if err := os.MkdirAll(absPath, 0755); err != nil {
+				return fmt.Errorf("failed to extract %q: %s", f.Name, err)
+			}
+		case mode&os.ModeSymlink != 0:
+			target, err := packageEntrySymlinkTarget(f)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+				return fmt.Errorf("failed to extract %q: %s", f.Name, err)
+			}
+			if err := os.Symlink(target, absPath); err != nil {
+				return fmt.Errorf("failed to extract %q: %s", f.Name, err)
+			}
+		default:
+			if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+				return fmt.Errorf("failed to extract %q: %s", f.Name, err)
+			}
+			n, err := extractPackageFile(f, absPath, remaining)
+			remaining -= n
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// packageEntryPath validates the path of the given archive entry and returns
+// it as a cleaned path relative to the extraction target directory.
+func packageEntryPath(name string) (string, error) {
+	// Zip paths are always slash-separated, but a malicious archive might
+	// use native separators in the hope of confusing the cleaning below.
+	relPath := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(relPath) || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("invalid package archive: entry %q has an absolute path", name)
+	}
+	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid package archive: entry %q would be extracted outside of the target directory", name)
+	}
+	return relPath, nil
+}
+
+// packageEntrySymlinkTarget reads and validates the target of a symlink
+// entry, ensuring that it can't refer to anything outside of the package
+// directory.
+func packageEntrySymlinkTarget(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to extract %q: %s", f.Name, err)
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
+	rc.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to extract %q: %s", f.Name, err)
+	}
+	target := string(raw)
+	if filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+		return "", fmt.Errorf("invalid package archive: symlink %q has an absolute target %q", f.Name, target)
+	}
+	// The link target is resolved relative to the directory containing the
+	// link, so the combination of the two must still be inside the package.
+	resolved := filepath.Clean(filepath.Join(filepath.Dir(filepath.FromSlash(f.Name)), filepath.FromSlash(target)))
+	if resolved == ".." || strings.HasPrefix(resolved, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid package archive: symlink %q points to %q, outside of the target directory", f.Name, target)
+	}
+	return filepath.FromSlash(target), nil
+}
+
+// extractPackageFile writes the content of a regular file entry to absPath,
+// refusing to write more than limit bytes in total. It returns the number
+// of bytes written.
+func extractPackageFile(f *zip.File, absPath string, limit int64) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, fmt.Errorf("failed to extract %q: %s", f.Name, err)
+	}
+	defer rc.Close()
+
+	w, err := os.OpenFile(absPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode().Perm())
+	if err != nil {
+		return 0, fmt.Errorf("failed to extract %q: %s", f.Name, err)
+	}
+	// Read one byte past the limit so that an entry lying about its
+	// uncompressed size is caught rather than silently truncated.
+	n, err := io.Copy(w, io.LimitReader(rc, limit+1))
+	w.Close()
+	if err != nil {
+		return n, fmt.Errorf("failed to extract %q: %s", f.Name, err)
+	}
+	if n > limit {
+		return n, fmt.Errorf("invalid package archive: uncompressed size exceeds the maximum of %d bytes", packageMaxSize())
+	}
+	return n, nil
+}
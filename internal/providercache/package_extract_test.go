@@ -0,0 +1,187 @@
+package providercache
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type testZipEntry struct {
+	name    string
+	mode    os.FileMode
+	content string
+}
+
+// testZipFile writes a zip file containing the given entries into a
+// temporary directory and returns its path.
+func testZipFile(t *testing.T, entries []testZipEntry) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "terraform-test-package-extract")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	filename := filepath.Join(dir, "package.zip")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	zw := zip.NewWriter(f)
+	for _, entry := range entries {
+		hdr := &zip.FileHeader{
+			Name:   entry.name,
+			Method: zip.Deflate,
+		}
+		hdr.SetMode(entry.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := w.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return filename
+}
+
+func TestExtractPackageZip(t *testing.T) {
+	filename := testZipFile(t, []testZipEntry{
+		{"terraform-provider-thing", 0755, "executable"},
+		{"docs/index.md", 0644, "documentation"},
+		{"docs-link", os.ModeSymlink | 0777, "docs/index.md"},
+	})
+
+	targetDir, err := ioutil.TempDir("", "terraform-test-package-extract-target")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(targetDir)
+
+	if err := extractPackageZip(targetDir, filename); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(targetDir, "terraform-provider-thing"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(content) != "executable" {
+		t.Errorf("wrong content %q in extracted file", string(content))
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(targetDir, "terraform-provider-thing"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if info.Mode().Perm()&0100 == 0 {
+			t.Errorf("extracted provider executable is not executable: mode %s", info.Mode())
+		}
+		// A symlink staying inside the package is legitimate and must
+		// still resolve after extraction.
+		content, err := ioutil.ReadFile(filepath.Join(targetDir, "docs-link"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(content) != "documentation" {
+			t.Errorf("wrong content %q through extracted symlink", string(content))
+		}
+	}
+}
+
+func TestExtractPackageZip_invalid(t *testing.T) {
+	tests := map[string]struct {
+		entries []testZipEntry
+		wantErr string
+	}{
+		"path traversal": {
+			[]testZipEntry{
+				{"../../evil", 0644, "outside"},
+			},
+			`entry "../../evil" would be extracted outside of the target directory`,
+		},
+		"absolute path": {
+			[]testZipEntry{
+				{"/evil", 0644, "outside"},
+			},
+			`entry "/evil" has an absolute path`,
+		},
+		"symlink with absolute target": {
+			[]testZipEntry{
+				{"evil-link", os.ModeSymlink | 0777, "/etc/passwd"},
+			},
+			`symlink "evil-link" has an absolute target "/etc/passwd"`,
+		},
+		"symlink escaping the package": {
+			[]testZipEntry{
+				{"evil-link", os.ModeSymlink | 0777, "../outside"},
+			},
+			`symlink "evil-link" points to "../outside", outside of the target directory`,
+		},
+		"device entry": {
+			[]testZipEntry{
+				{"evil-device", os.ModeDevice | 0644, ""},
+			},
+			`entry "evil-device" is a special file`,
+		},
+		"setuid entry": {
+			[]testZipEntry{
+				{"evil-setuid", os.ModeSetuid | 0755, "executable"},
+			},
+			`entry "evil-setuid" has setuid or setgid permissions`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			filename := testZipFile(t, test.entries)
+			targetDir, err := ioutil.TempDir("", "terraform-test-package-extract-target")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer os.RemoveAll(targetDir)
+
+			err = extractPackageZip(targetDir, filename)
+			if err == nil {
+				t.Fatalf("succeeded; expected error containing %q", test.wantErr)
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("wrong error %q; want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractPackageZip_tooLarge(t *testing.T) {
+	filename := testZipFile(t, []testZipEntry{
+		{"terraform-provider-thing", 0755, strings.Repeat("x", 1024)},
+	})
+
+	os.Setenv(packageMaxSizeEnvName, "512")
+	defer os.Unsetenv(packageMaxSizeEnvName)
+
+	targetDir, err := ioutil.TempDir("", "terraform-test-package-extract-target")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(targetDir)
+
+	err = extractPackageZip(targetDir, filename)
+	if err == nil {
+		t.Fatalf("succeeded; expected error")
+	}
+	if !strings.Contains(err.Error(), "exceeds the maximum") {
+		t.Errorf("wrong error %q; want one about the maximum uncompressed size", err)
+	}
+}
@@ -2,25 +2,130 @@ package providercache
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	getter "github.com/hashicorp/go-getter"
+	"github.com/hashicorp/go-retryablehttp"
 
-	"github.com/hashicorp/terraform/httpclient"
+	"github.com/hashicorp/terraform/helper/logging"
 	"github.com/hashicorp/terraform/internal/copydir"
 	"github.com/hashicorp/terraform/internal/getproviders"
 )
 
-// We borrow the "unpack a zip file into a target directory" logic from
-// go-getter, even though we're not otherwise using go-getter here.
-// (We don't need the same flexibility as we have for modules, because
-// providers _always_ come from provider registries, which have a very
-// specific protocol and set of expectations.)
-var unzip = getter.ZipDecompressor{}
+// providerDownloadRetryEnvName is the name of the environment variable that
+// can be set to customize the number of times a failed provider package
+// download will be retried.
+const providerDownloadRetryEnvName = "TF_PROVIDER_DOWNLOAD_RETRIES"
+
+// defaultDownloadRetries is the number of retries for a failed package
+// download unless overridden via providerDownloadRetryEnvName, making for
+// three attempts in total.
+const defaultDownloadRetries = 2
+
+func downloadRetryCount() int {
+	if v := os.Getenv(providerDownloadRetryEnvName); v != "" {
+		retries, err := strconv.Atoi(v)
+		if err == nil && retries >= 0 {
+			return retries
+		}
+	}
+	return defaultDownloadRetries
+}
+
+// downloadRetryPolicy decides whether a failed package download request
+// should be retried. We retry connection-level errors, 5xx responses, and
+// 429 responses; any other 4xx response reflects a request that will not
+// succeed no matter how many times we repeat it.
+func downloadRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if err != nil {
+		return true, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true, nil
+	}
+	if resp.StatusCode == 0 || (resp.StatusCode >= 500 && resp.StatusCode != 501) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// downloadBackoff implements exponential backoff between download attempts,
+// except that a 429 response carrying a Retry-After header is honored as
+// the wait time instead.
+func downloadBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		if s := resp.Header.Get("Retry-After"); s != "" {
+			if seconds, err := strconv.Atoi(s); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return retryablehttp.DefaultBackoff(min, max, attemptNum, resp)
+}
+
+// downloadErrorHandler produces the final error once all download attempts
+// have been exhausted, making sure the message says how many attempts were
+// made.
+func downloadErrorHandler(resp *http.Response, err error, numTries int) (*http.Response, error) {
+	// Close the body per library instructions
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	var errMsg string
+	if resp != nil {
+		errMsg = fmt.Sprintf(": %s", resp.Status)
+	} else if err != nil {
+		errMsg = fmt.Sprintf(": %s", err)
+	}
+
+	if numTries > 1 {
+		return resp, fmt.Errorf("the download failed after %d attempts, please try again later%s", numTries, errMsg)
+	}
+	return resp, fmt.Errorf("the download failed, please try again later%s", errMsg)
+}
+
+// progressReportInterval is the minimum time between successive progress
+// reports for a single package download.
+const progressReportInterval = 500 * time.Millisecond
+
+// progressWriter passes writes through to another writer while reporting
+// the cumulative number of bytes written via a callback, at most once per
+// progressReportInterval. Call finish once writing is complete to deliver
+// a final report.
+type progressWriter struct {
+	w       io.Writer
+	written int64
+	last    time.Time
+	report  func(bytesFetched int64)
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.written += int64(n)
+	if now := time.Now(); now.Sub(pw.last) >= progressReportInterval {
+		pw.last = now
+		pw.report(pw.written)
+	}
+	return n, err
+}
+
+func (pw *progressWriter) finish() {
+	pw.report(pw.written)
+}
 
 func installFromHTTPURL(ctx context.Context, meta getproviders.PackageMeta, targetDir string) (*getproviders.PackageAuthenticationResult, error) {
 	url := meta.Location.String()
@@ -32,35 +137,138 @@ func installFromHTTPURL(ctx context.Context, meta getproviders.PackageMeta, targ
 	// of extraneous functionality we don't need or want, like indirection
 	// through X-Terraform-Get header, attempting partial fetches for
 	// files that already exist, etc.)
+	//
+	// We retry transient failures -- connection problems, timeouts, and
+	// 5xx or 429 responses -- with exponential backoff, so that a single
+	// dropped connection doesn't fail a whole installation operation.
 
-	httpClient := httpclient.New()
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	retryableClient := retryablehttp.NewClient()
+	retryableClient.HTTPClient = getproviders.InstallHTTPClient()
+	retryableClient.RetryMax = downloadRetryCount()
+	retryableClient.RetryWaitMin = 1 * time.Second
+	retryableClient.RetryWaitMax = 16 * time.Second
+	retryableClient.CheckRetry = downloadRetryPolicy
+	retryableClient.Backoff = downloadBackoff
+	retryableClient.ErrorHandler = downloadErrorHandler
+
+	logOutput, err := logging.LogOutput()
 	if err != nil {
-		return nil, fmt.Errorf("invalid provider download request: %s", err)
+		log.Printf("[WARN] Failed to set up provider download logger, "+
+			"continuing without client logging: %s", err)
 	}
-	resp, err := httpClient.Do(req)
+	retryableClient.Logger = log.New(logOutput, "", log.Flags())
+
+	// The download is staged in a file whose name is derived from the URL,
+	// so that if it is interrupted partway through then the next attempt
+	// can find the partial file and resume where it left off rather than
+	// starting again from zero. The file lives in the cache directory the
+	// package is destined for, which is per-user and whose lock the caller
+	// already holds, rather than in the shared system temporary directory
+	// where another user could plant a symlink or a poisoned prefix at the
+	// predictable name, and where concurrent Terraform processes fetching
+	// the same URL would corrupt each other's staging.
+	partFilename := downloadPartFilename(filepath.Dir(targetDir), url)
+	f, err := openDownloadPartFile(partFilename)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to open temporary file to download from %s: %s", url, err)
+	}
+	defer f.Close()
+	resumeOffset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open temporary file to download from %s: %s", url, err)
+	}
+
+	var resp *http.Response
+	for {
+		req, err := retryablehttp.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid provider download request: %s", err)
+		}
+		if resumeOffset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", resumeOffset))
+		}
+		resp, err = retryableClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && resumeOffset > 0 {
+			// The partial file no longer lines up with what the server
+			// has, so we discard it and download the whole package.
+			resp.Body.Close()
+			if err := truncateDownloadFile(f); err != nil {
+				return nil, fmt.Errorf("failed to restart download from %s: %s", url, err)
+			}
+			resumeOffset = 0
+			continue
+		}
+		break
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Either we requested the whole package, or the server ignored our
+		// Range header because it doesn't support partial requests; either
+		// way we're receiving the package from the beginning.
+		if resumeOffset > 0 {
+			log.Printf("[TRACE] providercache: server for %s doesn't support range requests; restarting download", url)
+			if err := truncateDownloadFile(f); err != nil {
+				return nil, fmt.Errorf("failed to restart download from %s: %s", url, err)
+			}
+			resumeOffset = 0
+		}
+	case http.StatusPartialContent:
+		log.Printf("[INFO] providercache: resuming interrupted download of %s at offset %d", url, resumeOffset)
+	default:
 		return nil, fmt.Errorf("unsuccessful request to %s: %s", url, resp.Status)
 	}
 
-	f, err := ioutil.TempFile("", "terraform-provider")
-	if err != nil {
-		return nil, fmt.Errorf("failed to open temporary file to download from %s", url)
+	// The expected total size of the package, for both the short-read
+	// check below and progress reporting. Negative if the server didn't
+	// say how big the package is.
+	totalSize := resp.ContentLength
+	if totalSize >= 0 {
+		totalSize += resumeOffset
+	}
+
+	// If the caller is interested in progress reports then we'll send them
+	// periodically as the download proceeds. The already-resumed portion
+	// counts as fetched, so a resumed download doesn't appear to restart.
+	var w io.Writer = f
+	if cb := installerEventsForContext(ctx).FetchPackageProgress; cb != nil {
+		pw := &progressWriter{
+			w:       f,
+			written: resumeOffset,
+			report: func(bytesFetched int64) {
+				cb(meta.Provider, meta.Version, bytesFetched, totalSize)
+			},
+		}
+		defer pw.finish()
+		w = pw
+	}
+
+	// If the installer has a download rate limit configured then we read
+	// the body through its shared token bucket, throttling the aggregate
+	// throughput of all of the concurrent downloads together.
+	var body io.Reader = resp.Body
+	if limiter := downloadLimiterForContext(ctx); limiter != nil {
+		body = limiter.reader(ctx, body)
 	}
-	defer f.Close()
 
 	// We'll borrow go-getter's "cancelable copy" implementation here so that
-	// the download can potentially be interrupted partway through.
-	n, err := getter.Copy(ctx, f, resp.Body)
+	// the download can potentially be interrupted partway through, leaving
+	// the partial file in place for a later attempt to resume from.
+	n, err := getter.Copy(ctx, w, body)
 	if err == nil && n < resp.ContentLength {
 		err = fmt.Errorf("incorrect response size: expected %d bytes, but got %d bytes", resp.ContentLength, n)
 	}
 	if err != nil {
+		// The partial file is only useful to a later attempt if the server
+		// can actually serve the remainder of it; otherwise the next attempt
+		// would just truncate it and start over anyway.
+		if !serverSupportsRanges(resp) {
+			os.Remove(f.Name())
+		}
 		return nil, err
 	}
 
@@ -70,6 +278,10 @@ func installFromHTTPURL(ctx context.Context, meta getproviders.PackageMeta, targ
 	var authResult *getproviders.PackageAuthenticationResult
 	if meta.Authentication != nil {
 		if authResult, err = meta.Authentication.AuthenticatePackage(localLocation); err != nil {
+			// A complete download that fails authentication would fail the
+			// same way again if a later attempt resumed from it, so it
+			// must not survive as a partial file.
+			os.Remove(archiveFilename)
 			return authResult, err
 		}
 	}
@@ -87,11 +299,121 @@ func installFromHTTPURL(ctx context.Context, meta getproviders.PackageMeta, targ
 		Authentication:   nil,
 	}
 	if _, err := installFromLocalArchive(ctx, localMeta, targetDir); err != nil {
+		// The archive is complete, so a corrupt or unreadable zip file
+		// can't be fixed by resuming it later.
+		os.Remove(archiveFilename)
+		return nil, err
+	}
+	os.Remove(archiveFilename)
+	return authResult, nil
+}
+
+// downloadPartFilename returns the filename used to stage the download of
+// the package at the given URL, inside the given cache directory. The name
+// is derived from the URL alone so that a later installation attempt for
+// the same package can find an interrupted download and resume it; the
+// leading dot keeps it out of the way of the normal platform directory
+// naming scheme, like the staging directories.
+func downloadPartFilename(parentDir, url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return filepath.Join(parentDir, fmt.Sprintf(".terraform-provider-%x.part", hash[:8]))
+}
+
+// openDownloadPartFile opens the staging file for a package download,
+// creating it if necessary. A pre-existing file is reused for resumption
+// only when it is a regular file owned by the current user; anything else
+// -- a symlink, or a file planted by someone else -- is rejected rather
+// than trusted as the prefix of a provider package.
+func openDownloadPartFile(partFilename string) (*os.File, error) {
+	if info, err := os.Lstat(partFilename); err == nil {
+		if info.Mode()&os.ModeType != 0 {
+			return nil, fmt.Errorf("existing partial download %s is not a regular file", partFilename)
+		}
+		if !downloadPartFileOwned(info) {
+			return nil, fmt.Errorf("existing partial download %s is owned by another user", partFilename)
+		}
+	} else if !os.IsNotExist(err) {
 		return nil, err
 	}
+	return os.OpenFile(partFilename, os.O_CREATE|os.O_RDWR, 0600)
+}
+
+// serverSupportsRanges decides whether the server that produced the given
+// response could resume an interrupted download of it with a Range request,
+// either because it already answered one or because it advertises support
+// via the Accept-Ranges header.
+func serverSupportsRanges(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusPartialContent {
+		return true
+	}
+	return strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes")
+}
+
+// truncateDownloadFile discards the contents of a partial download file so
+// that the download can restart from the beginning.
+func truncateDownloadFile(f *os.File) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return f.Truncate(0)
+}
+
+// stagingDirPrefix is the name prefix for the temporary sibling directories
+// that archive extraction writes into before renaming them into their final
+// location. The leading dot keeps them out of the way of the normal
+// platform directory naming scheme.
+const stagingDirPrefix = ".staging-"
+
+// installArchiveStaged runs the given installation function against a
+// temporary staging directory alongside targetPath and then renames the
+// result into place once it has completed successfully, so that readers of
+// the cache directory can never observe a partially-extracted package.
+func installArchiveStaged(targetPath string, install func(stagingPath string) (*getproviders.PackageAuthenticationResult, error)) (*getproviders.PackageAuthenticationResult, error) {
+	parentDir := filepath.Dir(targetPath)
+	if err := os.MkdirAll(parentDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create parent directories leading to %s: %s", targetPath, err)
+	}
+	stagingPath, err := ioutil.TempDir(parentDir, stagingDirPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory in %s: %s", parentDir, err)
+	}
+	// If we don't reach the rename below -- including if the whole process
+	// is interrupted partway through extraction -- then whatever is left
+	// here will be discarded by cleanStagingDirs on the next attempt.
+	defer os.RemoveAll(stagingPath)
+
+	authResult, err := install(stagingPath)
+	if err != nil {
+		return authResult, err
+	}
+
+	// Replace anything that might already be at the final path, such as a
+	// partially-written package from a version of Terraform that didn't
+	// stage its extractions, and then move the complete package into place.
+	if err := os.RemoveAll(targetPath); err != nil && !os.IsNotExist(err) {
+		return authResult, fmt.Errorf("failed to remove existing package directory %s: %s", targetPath, err)
+	}
+	if err := os.Rename(stagingPath, targetPath); err != nil {
+		return authResult, fmt.Errorf("failed to move extracted package into %s: %s", targetPath, err)
+	}
 	return authResult, nil
 }
 
+// cleanStagingDirs deletes any staging directories left in the given
+// directory by interrupted earlier installations.
+func cleanStagingDirs(parentDir string) {
+	leftovers, err := filepath.Glob(filepath.Join(parentDir, stagingDirPrefix+"*"))
+	if err != nil {
+		// The only error Glob can return is for an invalid pattern, which
+		// would be a bug in Terraform rather than a user-actionable problem.
+		return
+	}
+	for _, path := range leftovers {
+		log.Printf("[TRACE] providercache: discarding leftover staging directory %s", path)
+		os.RemoveAll(path)
+	}
+}
+
 func installFromLocalArchive(ctx context.Context, meta getproviders.PackageMeta, targetDir string) (*getproviders.PackageAuthenticationResult, error) {
 	var authResult *getproviders.PackageAuthenticationResult
 	if meta.Authentication != nil {
@@ -102,19 +424,49 @@ func installFromLocalArchive(ctx context.Context, meta getproviders.PackageMeta,
 	}
 	filename := meta.Location.String()
 
-	err := unzip.Decompress(targetDir, filename, true)
-	if err != nil {
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return authResult, err
+	}
+	if err := extractPackageZip(targetDir, filename); err != nil {
 		return authResult, err
 	}
 
 	return authResult, nil
 }
 
+// hardLinkDir recreates the directory structure of src at dst with each
+// regular file hard-linked rather than copied. Any failure -- most commonly
+// the two directories living on different filesystems -- is returned so the
+// caller can fall back to a deep copy.
+func hardLinkDir(dst, src string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("cannot hard-link non-regular file %s", path)
+		}
+		return os.Link(path, target)
+	})
+}
+
 // installFromLocalDir is the implementation of both installing a package from
 // a local directory source _and_ of linking a package from another cache
 // in LinkFromOtherCache, because they both do fundamentally the same
-// operation: symlink if possible, or deep-copy otherwise.
-func installFromLocalDir(ctx context.Context, meta getproviders.PackageMeta, targetDir string) (*getproviders.PackageAuthenticationResult, error) {
+// operation: symlink if possible, hard-link if the two directories share a
+// filesystem, or deep-copy otherwise.
+//
+// forceCopy skips both link forms and always deep-copies, for callers on
+// filesystems where links cause problems.
+func installFromLocalDir(ctx context.Context, meta getproviders.PackageMeta, targetDir string, forceCopy bool) (*getproviders.PackageAuthenticationResult, error) {
 	sourceDir := meta.Location.String()
 
 	absNew, err := filepath.Abs(targetDir)
@@ -161,14 +513,33 @@ func installFromLocalDir(ctx context.Context, meta getproviders.PackageMeta, tar
 		return nil, fmt.Errorf("failed to create parent directories leading to %s: %s", targetDir, err)
 	}
 
-	err = os.Symlink(linkTarget, absNew)
-	if err == nil {
-		// Success, then!
-		return nil, nil
+	if !forceCopy {
+		err = os.Symlink(linkTarget, absNew)
+		if err == nil {
+			// Success, then!
+			return nil, nil
+		}
+
+		// Symlinking failed, but if the source and target are on the same
+		// filesystem we can still avoid duplicating the package contents by
+		// hard-linking the individual files, which many workspaces sharing
+		// one global cache benefit from considerably.
+		if err := hardLinkDir(absNew, absCurrent); err == nil {
+			return nil, nil
+		} else {
+			log.Printf("[TRACE] installFromLocalDir: failed to hard-link %s to %s: %s", absCurrent, absNew, err)
+			// A partially-created tree must not survive into the copy
+			// fallback.
+			os.RemoveAll(absNew)
+		}
 	}
 
-	// If we get down here then symlinking failed and we need a deep copy
-	// instead.
+	// If we get down here then linking failed (or was disallowed) and we
+	// need a deep copy instead. CopyDir expects the destination directory
+	// to already exist.
+	if err := os.MkdirAll(absNew, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %s", absNew, err)
+	}
 	err = copydir.CopyDir(absNew, absCurrent)
 	if err != nil {
 		return nil, fmt.Errorf("failed to either symlink or copy %s to %s: %s", absCurrent, absNew, err)
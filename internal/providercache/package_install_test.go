@@ -0,0 +1,262 @@
+package providercache
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+func testHTTPURLPackageMeta(url string) getproviders.PackageMeta {
+	return getproviders.PackageMeta{
+		Provider:       addrs.MustParseProviderSourceString("registry.terraform.io/hashicorp/null"),
+		Version:        getproviders.MustParseVersion("2.1.0"),
+		TargetPlatform: getproviders.Platform{OS: "linux", Arch: "amd64"},
+		Filename:       "terraform-provider-null_2.1.0_linux_amd64.zip",
+		Location:       getproviders.PackageHTTPURL(url),
+	}
+}
+
+func TestInstallFromHTTPURL_retryTransientFailures(t *testing.T) {
+	archive, err := ioutil.ReadFile("testdata/terraform-provider-null_2.1.0_linux_amd64.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first two requests fail with a transient error, so a successful
+	// installation proves that the download was retried.
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt64(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	meta := testHTTPURLPackageMeta(server.URL + "/terraform-provider-null_2.1.0_linux_amd64.zip")
+	targetDir := filepath.Join(tmpDirPath, "targetdir")
+	if _, err := installFromHTTPURL(context.TODO(), meta, targetDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := atomic.LoadInt64(&requests), int64(3); got != want {
+		t.Errorf("wrong number of requests %d; want %d", got, want)
+	}
+}
+
+func TestInstallFromHTTPURL_noRetryOnNotFound(t *testing.T) {
+	// A 404 response reflects a request that can never succeed, so it must
+	// fail immediately without any retries.
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	meta := testHTTPURLPackageMeta(server.URL + "/terraform-provider-null_2.1.0_linux_amd64.zip")
+	targetDir := filepath.Join(tmpDirPath, "targetdir")
+	_, err = installFromHTTPURL(context.TODO(), meta, targetDir)
+	if err == nil {
+		t.Fatal("unexpected success; want error about unsuccessful request")
+	}
+	if !strings.Contains(err.Error(), "404") {
+		t.Fatalf("wrong error %q; want mention of the 404 status", err)
+	}
+	if got, want := atomic.LoadInt64(&requests), int64(1); got != want {
+		t.Errorf("wrong number of requests %d; want %d", got, want)
+	}
+}
+
+func TestInstallFromHTTPURL_resume(t *testing.T) {
+	archive, err := ioutil.ReadFile("testdata/terraform-provider-null_2.1.0_linux_amd64.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server supports range requests, recording the Range header of
+	// each request so that we can prove the download was resumed.
+	var gotRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotRange = req.Header.Get("Range")
+		var offset int
+		if _, err := fmt.Sscanf(gotRange, "bytes=%d-", &offset); err == nil && offset > 0 && offset < len(archive) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(archive)-1, len(archive)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(archive[offset:])
+			return
+		}
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// A previous download attempt was interrupted halfway through.
+	url := server.URL + "/terraform-provider-null_2.1.0_linux_amd64.zip"
+	half := len(archive) / 2
+	partFilename := downloadPartFilename(tmpDirPath, url)
+	if err := ioutil.WriteFile(partFilename, archive[:half], 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(partFilename)
+
+	meta := testHTTPURLPackageMeta(url)
+	targetDir := filepath.Join(tmpDirPath, "targetdir")
+	if _, err := installFromHTTPURL(context.TODO(), meta, targetDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := fmt.Sprintf("bytes=%d-", half); gotRange != want {
+		t.Errorf("wrong Range header %q; want %q", gotRange, want)
+	}
+	if _, err := os.Stat(partFilename); !os.IsNotExist(err) {
+		t.Errorf("partial download file still exists after a successful installation")
+	}
+}
+
+func TestInstallFromHTTPURL_resumeUnsupported(t *testing.T) {
+	archive, err := ioutil.ReadFile("testdata/terraform-provider-null_2.1.0_linux_amd64.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server ignores Range headers and always sends the whole package,
+	// so the resumption attempt must fall back to a full download.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	url := server.URL + "/terraform-provider-null_2.1.0_linux_amd64.zip"
+	partFilename := downloadPartFilename(tmpDirPath, url)
+	if err := ioutil.WriteFile(partFilename, archive[:len(archive)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(partFilename)
+
+	meta := testHTTPURLPackageMeta(url)
+	targetDir := filepath.Join(tmpDirPath, "targetdir")
+	if _, err := installFromHTTPURL(context.TODO(), meta, targetDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestInstallFromHTTPURL_partFileNotRegular(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// Someone has planted a symlink at the staging filename, pointing the
+	// download at a file of their choosing; it must be rejected rather than
+	// followed.
+	url := "https://example.com/terraform-provider-null_2.1.0_linux_amd64.zip"
+	partFilename := downloadPartFilename(tmpDirPath, url)
+	victim := filepath.Join(tmpDirPath, "victim")
+	if err := ioutil.WriteFile(victim, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(victim, partFilename); err != nil {
+		t.Skipf("cannot create symlinks here: %s", err)
+	}
+
+	meta := testHTTPURLPackageMeta(url)
+	targetDir := filepath.Join(tmpDirPath, "targetdir")
+	_, err = installFromHTTPURL(context.TODO(), meta, targetDir)
+	if err == nil {
+		t.Fatal("unexpected success; want an error about the existing part file")
+	}
+	if !strings.Contains(err.Error(), "not a regular file") {
+		t.Fatalf("wrong error %q; want mention of the irregular part file", err)
+	}
+}
+
+func TestDownloadErrorHandler_attemptCount(t *testing.T) {
+	_, err := downloadErrorHandler(nil, context.DeadlineExceeded, 3)
+	if err == nil {
+		t.Fatal("unexpected nil error")
+	}
+	if !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Fatalf("wrong error %q; want mention of the attempt count", err)
+	}
+}
+
+func TestHardLinkDir(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "terraform-test-providercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	srcDir := filepath.Join(tmpDirPath, "src")
+	if err := os.MkdirAll(filepath.Join(srcDir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(srcDir, "terraform-provider-null"), []byte("executable"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(srcDir, "subdir", "extra"), []byte("extra"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dstDir := filepath.Join(tmpDirPath, "dst")
+	if err := hardLinkDir(dstDir, srcDir); err != nil {
+		t.Fatalf("hardLinkDir failed: %s", err)
+	}
+
+	for _, rel := range []string{"terraform-provider-null", "subdir/extra"} {
+		srcInfo, err := os.Stat(filepath.Join(srcDir, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstInfo, err := os.Stat(filepath.Join(dstDir, rel))
+		if err != nil {
+			t.Fatalf("%s was not linked: %s", rel, err)
+		}
+		if !os.SameFile(srcInfo, dstInfo) {
+			t.Errorf("%s is a distinct file; want a hard link to the source", rel)
+		}
+	}
+
+	// A non-regular file in the source must fail rather than being silently
+	// skipped, so the caller falls back to a deep copy of the whole package.
+	if err := os.Symlink(filepath.Join(srcDir, "terraform-provider-null"), filepath.Join(srcDir, "symlink")); err != nil {
+		t.Fatal(err)
+	}
+	if err := hardLinkDir(filepath.Join(tmpDirPath, "dst2"), srcDir); err == nil {
+		t.Error("unexpected success with a symlink in the source; want error")
+	}
+}
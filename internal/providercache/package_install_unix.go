@@ -0,0 +1,20 @@
+// +build !windows
+
+package providercache
+
+import (
+	"os"
+	"syscall"
+)
+
+// downloadPartFileOwned reports whether an existing partial download file
+// belongs to the current user. A file owned by anyone else in the cache
+// directory was not left there by one of our own interrupted downloads, so
+// it must not be trusted as a prefix to resume from.
+func downloadPartFileOwned(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	return int(st.Uid) == os.Getuid()
+}
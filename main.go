@@ -165,7 +165,24 @@ func wrappedMain() int {
 	services := disco.NewWithCredentialsSource(credsSrc)
 	services.SetUserAgent(httpclient.TerraformUserAgent(version.String()))
 
-	providerSrc, diags := providerSource(config.ProviderInstallation, services)
+	signingPolicy, signingDiags := mirrorSigningPolicy(config.ProviderSigning)
+	if signingDiags.HasErrors() {
+		Ui.Error("There are some problems with the provider_signing configuration:")
+		for _, diag := range signingDiags {
+			earlyColor := &colorstring.Colorize{
+				Colors:  colorstring.DefaultColors,
+				Disable: true, // Disable color to be conservative until we know better
+				Reset:   true,
+			}
+			Ui.Error(format.Diagnostic(diag, nil, earlyColor, 78))
+		}
+		// We continue without verification configured rather than guessing
+		// at a partial policy, because most commands don't do provider
+		// installation at all.
+		signingPolicy = nil
+	}
+
+	providerSrc, diags := providerSource(config.ProviderInstallation, signingPolicy, services)
 	if len(diags) > 0 {
 		Ui.Error("There are some problems with the provider_installation configuration:")
 		for _, diag := range diags {
@@ -187,7 +204,7 @@ func wrappedMain() int {
 
 	// In tests, Commands may already be set to provide mock commands
 	if Commands == nil {
-		initCommands(config, services, providerSrc)
+		initCommands(config, services, providerSrc, signingPolicy)
 	}
 
 	// Run checkpoint
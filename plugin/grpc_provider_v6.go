@@ -0,0 +1,408 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	plugin "github.com/hashicorp/go-plugin"
+	proto "github.com/hashicorp/terraform/internal/tfplugin5"
+	"google.golang.org/grpc"
+)
+
+// Provider protocol version 6 serves the same RPCs as version 5 under the
+// "tfplugin6.Provider" service name, with several of the methods renamed.
+// The request and response messages shared by the two versions kept their
+// field numbering when the protocol was forked, so rather than maintaining
+// a second generated protocol package we reuse the tfplugin5 message types
+// and rewrite the method paths on the way through.
+//
+// The one schema feature exclusive to protocol 6, object-typed nested
+// attributes, has no tfplugin5 representation and is not translated.
+// Silently dropping it would give Terraform a wrong picture of the
+// provider's schema, so GetSchema checks the decoded messages for fields
+// we don't recognize and refuses the provider outright when it finds any.
+const providerV6ServiceName = "tfplugin6.Provider"
+
+// GRPCProviderV6Plugin implements plugin.GRPCPlugin for providers speaking
+// protocol version 6.
+type GRPCProviderV6Plugin struct {
+	plugin.Plugin
+	GRPCProvider func() proto.ProviderServer
+}
+
+func (p *GRPCProviderV6Plugin) GRPCClient(ctx context.Context, broker *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &GRPCProvider{
+		client: &providerV6Client{cc: c},
+		ctx:    ctx,
+	}, nil
+}
+
+func (p *GRPCProviderV6Plugin) GRPCServer(broker *plugin.GRPCBroker, s *grpc.Server) error {
+	s.RegisterService(&providerV6ServiceDesc, p.GRPCProvider())
+	return nil
+}
+
+// providerV6Client implements the tfplugin5 ProviderClient interface against
+// a protocol 6 server, so that GRPCProvider can be used unchanged for both
+// protocol versions.
+type providerV6Client struct {
+	cc *grpc.ClientConn
+}
+
+func (c *providerV6Client) GetSchema(ctx context.Context, in *proto.GetProviderSchema_Request, opts ...grpc.CallOption) (*proto.GetProviderSchema_Response, error) {
+	out := new(proto.GetProviderSchema_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/GetProviderSchema", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkV6SchemaRepresentable(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// checkV6SchemaRepresentable verifies that a schema response decoded into
+// the tfplugin5 message types did not carry any protocol 6 fields those
+// types don't define, which the decoder would otherwise retain silently as
+// unrecognized bytes while Terraform proceeded with a wrong idea of the
+// provider's schema. An explicit error here is far easier to act on than
+// the baffling downstream errors that a schema missing attributes causes.
+func checkV6SchemaRepresentable(resp *proto.GetProviderSchema_Response) error {
+	schemas := map[string]*proto.Schema{
+		"the provider configuration": resp.Provider,
+		"the provider metadata":      resp.ProviderMeta,
+	}
+	for name, schema := range resp.ResourceSchemas {
+		schemas[fmt.Sprintf("resource type %q", name)] = schema
+	}
+	for name, schema := range resp.DataSourceSchemas {
+		schemas[fmt.Sprintf("data source %q", name)] = schema
+	}
+	for where, schema := range schemas {
+		if schema == nil {
+			continue
+		}
+		if attr := findV6UnrepresentableAttr(schema.Block); attr != "" {
+			return fmt.Errorf("attribute %q in the schema for %s uses protocol version 6 features, such as object-typed nested attributes, that this version of Terraform cannot represent; a newer version of Terraform is required to use this provider", attr, where)
+		}
+	}
+	return nil
+}
+
+// findV6UnrepresentableAttr returns the name of the first attribute in the
+// given block, or any block nested within it, that was decoded with
+// leftover unrecognized protobuf fields, or an empty string if there are
+// none. The protocol 6 additions are all on the attribute message, so the
+// attributes are where any untranslatable schema would show up.
+func findV6UnrepresentableAttr(block *proto.Schema_Block) string {
+	if block == nil {
+		return ""
+	}
+	for _, attr := range block.Attributes {
+		if len(attr.XXX_unrecognized) != 0 {
+			return attr.Name
+		}
+	}
+	for _, nested := range block.BlockTypes {
+		if attr := findV6UnrepresentableAttr(nested.Block); attr != "" {
+			return attr
+		}
+	}
+	return ""
+}
+
+func (c *providerV6Client) PrepareProviderConfig(ctx context.Context, in *proto.PrepareProviderConfig_Request, opts ...grpc.CallOption) (*proto.PrepareProviderConfig_Response, error) {
+	out := new(proto.PrepareProviderConfig_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/ValidateProviderConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// Protocol 6 dropped the prepared config from the response: validation
+	// may no longer alter the configuration. The caller still expects a
+	// config back, so we echo the one from the request.
+	if out.PreparedConfig == nil {
+		out.PreparedConfig = in.Config
+	}
+	return out, nil
+}
+
+func (c *providerV6Client) ValidateResourceTypeConfig(ctx context.Context, in *proto.ValidateResourceTypeConfig_Request, opts ...grpc.CallOption) (*proto.ValidateResourceTypeConfig_Response, error) {
+	out := new(proto.ValidateResourceTypeConfig_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/ValidateResourceConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *providerV6Client) ValidateDataSourceConfig(ctx context.Context, in *proto.ValidateDataSourceConfig_Request, opts ...grpc.CallOption) (*proto.ValidateDataSourceConfig_Response, error) {
+	out := new(proto.ValidateDataSourceConfig_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/ValidateDataResourceConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *providerV6Client) UpgradeResourceState(ctx context.Context, in *proto.UpgradeResourceState_Request, opts ...grpc.CallOption) (*proto.UpgradeResourceState_Response, error) {
+	out := new(proto.UpgradeResourceState_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/UpgradeResourceState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *providerV6Client) Configure(ctx context.Context, in *proto.Configure_Request, opts ...grpc.CallOption) (*proto.Configure_Response, error) {
+	out := new(proto.Configure_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/ConfigureProvider", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *providerV6Client) ReadResource(ctx context.Context, in *proto.ReadResource_Request, opts ...grpc.CallOption) (*proto.ReadResource_Response, error) {
+	out := new(proto.ReadResource_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/ReadResource", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *providerV6Client) PlanResourceChange(ctx context.Context, in *proto.PlanResourceChange_Request, opts ...grpc.CallOption) (*proto.PlanResourceChange_Response, error) {
+	out := new(proto.PlanResourceChange_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/PlanResourceChange", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *providerV6Client) ApplyResourceChange(ctx context.Context, in *proto.ApplyResourceChange_Request, opts ...grpc.CallOption) (*proto.ApplyResourceChange_Response, error) {
+	out := new(proto.ApplyResourceChange_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/ApplyResourceChange", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *providerV6Client) ImportResourceState(ctx context.Context, in *proto.ImportResourceState_Request, opts ...grpc.CallOption) (*proto.ImportResourceState_Response, error) {
+	out := new(proto.ImportResourceState_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/ImportResourceState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *providerV6Client) ReadDataSource(ctx context.Context, in *proto.ReadDataSource_Request, opts ...grpc.CallOption) (*proto.ReadDataSource_Response, error) {
+	out := new(proto.ReadDataSource_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/ReadDataSource", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *providerV6Client) Stop(ctx context.Context, in *proto.Stop_Request, opts ...grpc.CallOption) (*proto.Stop_Response, error) {
+	out := new(proto.Stop_Response)
+	err := c.cc.Invoke(ctx, "/tfplugin6.Provider/StopProvider", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// providerV6ServiceDesc describes the tfplugin6.Provider service in terms of
+// a tfplugin5 ProviderServer, for serving protocol 6 in tests and via
+// GRPCProviderV6Plugin.
+var providerV6ServiceDesc = grpc.ServiceDesc{
+	ServiceName: providerV6ServiceName,
+	HandlerType: (*proto.ProviderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetProviderSchema", Handler: providerV6GetProviderSchemaHandler},
+		{MethodName: "ValidateProviderConfig", Handler: providerV6ValidateProviderConfigHandler},
+		{MethodName: "ValidateResourceConfig", Handler: providerV6ValidateResourceConfigHandler},
+		{MethodName: "ValidateDataResourceConfig", Handler: providerV6ValidateDataResourceConfigHandler},
+		{MethodName: "UpgradeResourceState", Handler: providerV6UpgradeResourceStateHandler},
+		{MethodName: "ConfigureProvider", Handler: providerV6ConfigureProviderHandler},
+		{MethodName: "ReadResource", Handler: providerV6ReadResourceHandler},
+		{MethodName: "PlanResourceChange", Handler: providerV6PlanResourceChangeHandler},
+		{MethodName: "ApplyResourceChange", Handler: providerV6ApplyResourceChangeHandler},
+		{MethodName: "ImportResourceState", Handler: providerV6ImportResourceStateHandler},
+		{MethodName: "ReadDataSource", Handler: providerV6ReadDataSourceHandler},
+		{MethodName: "StopProvider", Handler: providerV6StopProviderHandler},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func providerV6GetProviderSchemaHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.GetProviderSchema_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).GetSchema(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/GetProviderSchema"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).GetSchema(ctx, req.(*proto.GetProviderSchema_Request))
+	})
+}
+
+func providerV6ValidateProviderConfigHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.PrepareProviderConfig_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).PrepareProviderConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/ValidateProviderConfig"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).PrepareProviderConfig(ctx, req.(*proto.PrepareProviderConfig_Request))
+	})
+}
+
+func providerV6ValidateResourceConfigHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.ValidateResourceTypeConfig_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).ValidateResourceTypeConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/ValidateResourceConfig"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).ValidateResourceTypeConfig(ctx, req.(*proto.ValidateResourceTypeConfig_Request))
+	})
+}
+
+func providerV6ValidateDataResourceConfigHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.ValidateDataSourceConfig_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).ValidateDataSourceConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/ValidateDataResourceConfig"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).ValidateDataSourceConfig(ctx, req.(*proto.ValidateDataSourceConfig_Request))
+	})
+}
+
+func providerV6UpgradeResourceStateHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.UpgradeResourceState_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).UpgradeResourceState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/UpgradeResourceState"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).UpgradeResourceState(ctx, req.(*proto.UpgradeResourceState_Request))
+	})
+}
+
+func providerV6ConfigureProviderHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.Configure_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).Configure(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/ConfigureProvider"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).Configure(ctx, req.(*proto.Configure_Request))
+	})
+}
+
+func providerV6ReadResourceHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.ReadResource_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).ReadResource(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/ReadResource"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).ReadResource(ctx, req.(*proto.ReadResource_Request))
+	})
+}
+
+func providerV6PlanResourceChangeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.PlanResourceChange_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).PlanResourceChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/PlanResourceChange"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).PlanResourceChange(ctx, req.(*proto.PlanResourceChange_Request))
+	})
+}
+
+func providerV6ApplyResourceChangeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.ApplyResourceChange_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).ApplyResourceChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/ApplyResourceChange"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).ApplyResourceChange(ctx, req.(*proto.ApplyResourceChange_Request))
+	})
+}
+
+func providerV6ImportResourceStateHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.ImportResourceState_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).ImportResourceState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/ImportResourceState"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).ImportResourceState(ctx, req.(*proto.ImportResourceState_Request))
+	})
+}
+
+func providerV6ReadDataSourceHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.ReadDataSource_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).ReadDataSource(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/ReadDataSource"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).ReadDataSource(ctx, req.(*proto.ReadDataSource_Request))
+	})
+}
+
+func providerV6StopProviderHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.Stop_Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(proto.ProviderServer).Stop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/tfplugin6.Provider/StopProvider"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(proto.ProviderServer).Stop(ctx, req.(*proto.Stop_Request))
+	})
+}
@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/zclconf/go-cty/cty"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	proto "github.com/hashicorp/terraform/internal/tfplugin5"
+	"github.com/hashicorp/terraform/providers"
+)
+
+// stubProviderV6Server is a minimal provider implementation that we serve
+// under the tfplugin6.Provider service name, standing in for a real
+// protocol 6 provider.
+type stubProviderV6Server struct {
+	planCalled bool
+}
+
+func (s *stubProviderV6Server) GetSchema(ctx context.Context, req *proto.GetProviderSchema_Request) (*proto.GetProviderSchema_Response, error) {
+	return providerProtoSchema(), nil
+}
+
+func (s *stubProviderV6Server) PrepareProviderConfig(ctx context.Context, req *proto.PrepareProviderConfig_Request) (*proto.PrepareProviderConfig_Response, error) {
+	return &proto.PrepareProviderConfig_Response{}, nil
+}
+
+func (s *stubProviderV6Server) ValidateResourceTypeConfig(ctx context.Context, req *proto.ValidateResourceTypeConfig_Request) (*proto.ValidateResourceTypeConfig_Response, error) {
+	return &proto.ValidateResourceTypeConfig_Response{}, nil
+}
+
+func (s *stubProviderV6Server) ValidateDataSourceConfig(ctx context.Context, req *proto.ValidateDataSourceConfig_Request) (*proto.ValidateDataSourceConfig_Response, error) {
+	return &proto.ValidateDataSourceConfig_Response{}, nil
+}
+
+func (s *stubProviderV6Server) UpgradeResourceState(ctx context.Context, req *proto.UpgradeResourceState_Request) (*proto.UpgradeResourceState_Response, error) {
+	return &proto.UpgradeResourceState_Response{}, nil
+}
+
+func (s *stubProviderV6Server) Configure(ctx context.Context, req *proto.Configure_Request) (*proto.Configure_Response, error) {
+	return &proto.Configure_Response{}, nil
+}
+
+func (s *stubProviderV6Server) ReadResource(ctx context.Context, req *proto.ReadResource_Request) (*proto.ReadResource_Response, error) {
+	return &proto.ReadResource_Response{}, nil
+}
+
+func (s *stubProviderV6Server) PlanResourceChange(ctx context.Context, req *proto.PlanResourceChange_Request) (*proto.PlanResourceChange_Response, error) {
+	s.planCalled = true
+	return &proto.PlanResourceChange_Response{
+		PlannedState: req.ProposedNewState,
+	}, nil
+}
+
+func (s *stubProviderV6Server) ApplyResourceChange(ctx context.Context, req *proto.ApplyResourceChange_Request) (*proto.ApplyResourceChange_Response, error) {
+	return &proto.ApplyResourceChange_Response{}, nil
+}
+
+func (s *stubProviderV6Server) ImportResourceState(ctx context.Context, req *proto.ImportResourceState_Request) (*proto.ImportResourceState_Response, error) {
+	return &proto.ImportResourceState_Response{}, nil
+}
+
+func (s *stubProviderV6Server) ReadDataSource(ctx context.Context, req *proto.ReadDataSource_Request) (*proto.ReadDataSource_Response, error) {
+	return &proto.ReadDataSource_Response{}, nil
+}
+
+func (s *stubProviderV6Server) Stop(ctx context.Context, req *proto.Stop_Request) (*proto.Stop_Response, error) {
+	return &proto.Stop_Response{}, nil
+}
+
+func TestCheckV6SchemaRepresentable(t *testing.T) {
+	// A schema that decoded cleanly into the tfplugin5 message types is
+	// fully representable.
+	resp := providerProtoSchema()
+	if err := checkV6SchemaRepresentable(resp); err != nil {
+		t.Fatalf("unexpected error for a clean schema: %s", err)
+	}
+
+	// Leftover unrecognized bytes on a decoded attribute mean the server
+	// sent a protocol 6 field, such as nested_type, that the tfplugin5
+	// types silently dropped; that must be an explicit error.
+	resp.ResourceSchemas["resource"].Block.Attributes[0].XXX_unrecognized = []byte{0x52, 0x00}
+	err := checkV6SchemaRepresentable(resp)
+	if err == nil {
+		t.Fatal("unexpected success for a schema with unrecognized fields")
+	}
+	for _, want := range []string{"\"attr\"", "resource type \"resource\"", "protocol version 6"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q: %s", want, err)
+		}
+	}
+}
+
+func TestGRPCProviderV6(t *testing.T) {
+	stub := &stubProviderV6Server{}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pluginImpl := &GRPCProviderV6Plugin{
+		GRPCProvider: func() proto.ProviderServer { return stub },
+	}
+	if err := pluginImpl.GRPCServer(nil, srv); err != nil {
+		t.Fatalf("unexpected error registering server: %s", err)
+	}
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error dialing stub server: %s", err)
+	}
+	defer conn.Close()
+
+	raw, err := pluginImpl.GRPCClient(context.Background(), nil, conn)
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	p := raw.(*GRPCProvider)
+
+	schemaResp := p.GetSchema()
+	checkDiags(t, schemaResp.Diagnostics)
+	if _, ok := schemaResp.ResourceTypes["resource"]; !ok {
+		t.Fatalf("schema from protocol 6 server is missing the \"resource\" resource type")
+	}
+
+	planResp := p.PlanResourceChange(providers.PlanResourceChangeRequest{
+		TypeName: "resource",
+		PriorState: cty.ObjectVal(map[string]cty.Value{
+			"attr": cty.StringVal("foo"),
+		}),
+		ProposedNewState: cty.ObjectVal(map[string]cty.Value{
+			"attr": cty.StringVal("bar"),
+		}),
+		Config: cty.ObjectVal(map[string]cty.Value{
+			"attr": cty.StringVal("bar"),
+		}),
+	})
+	checkDiags(t, planResp.Diagnostics)
+	if !stub.planCalled {
+		t.Fatal("PlanResourceChange was not routed to the protocol 6 server")
+	}
+
+	expectedState := cty.ObjectVal(map[string]cty.Value{
+		"attr": cty.StringVal("bar"),
+	})
+	if !cmp.Equal(expectedState, planResp.PlannedState, typeComparer, valueComparer, equateEmpty) {
+		t.Fatal(cmp.Diff(expectedState, planResp.PlannedState, typeComparer, valueComparer, equateEmpty))
+	}
+}
@@ -11,4 +11,9 @@ var VersionedPlugins = map[int]plugin.PluginSet{
 		"provider":    &GRPCProviderPlugin{},
 		"provisioner": &GRPCProvisionerPlugin{},
 	},
+
+	// Protocol 6 carries only providers; provisioners remain on protocol 5.
+	6: {
+		"provider": &GRPCProviderV6Plugin{},
+	},
 }
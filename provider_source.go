@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/apparentlymart/go-userdirs/userdirs"
 	"github.com/hashicorp/terraform-svchost/disco"
@@ -20,28 +22,28 @@ import (
 // CLI configuration and some default search locations. This will be the
 // provider source used for provider installation in the "terraform init"
 // command, unless overridden by the special -plugin-dir option.
-func providerSource(configs []*cliconfig.ProviderInstallation, services *disco.Disco) (getproviders.Source, tfdiags.Diagnostics) {
+func providerSource(configs []*cliconfig.ProviderInstallation, signing *getproviders.MirrorSigningPolicy, services *disco.Disco) (getproviders.Source, tfdiags.Diagnostics) {
 	if len(configs) == 0 {
 		// If there's no explicit installation configuration then we'll build
 		// up an implicit one with direct registry installation along with
 		// some automatically-selected local filesystem mirrors.
-		return implicitProviderSource(services), nil
+		return implicitProviderSource(signing, services), nil
 	}
 
 	// There should only be zero or one configurations, which is checked by
 	// the validation logic in the cliconfig package. Therefore we'll just
 	// ignore any additional configurations in here.
 	config := configs[0]
-	return explicitProviderSource(config, services)
+	return explicitProviderSource(config, signing, services)
 }
 
-func explicitProviderSource(config *cliconfig.ProviderInstallation, services *disco.Disco) (getproviders.Source, tfdiags.Diagnostics) {
+func explicitProviderSource(config *cliconfig.ProviderInstallation, signing *getproviders.MirrorSigningPolicy, services *disco.Disco) (getproviders.Source, tfdiags.Diagnostics) {
 	var diags tfdiags.Diagnostics
 	var searchRules []getproviders.MultiSourceSelector
 
 	log.Printf("[DEBUG] Explicit provider installation configuration is set")
 	for _, methodConfig := range config.Methods {
-		source, moreDiags := providerSourceForCLIConfigLocation(methodConfig.Location, services)
+		source, moreDiags := providerSourceForCLIConfigLocation(methodConfig.Location, signing, services)
 		diags = diags.Append(moreDiags)
 		if moreDiags.HasErrors() {
 			continue
@@ -86,7 +88,7 @@ func explicitProviderSource(config *cliconfig.ProviderInstallation, services *di
 // one version available in a local directory are implicitly excluded from
 // direct installation, as if the user had listed them explicitly in the
 // "exclude" argument in the direct provider source in the CLI config.
-func implicitProviderSource(services *disco.Disco) getproviders.Source {
+func implicitProviderSource(signing *getproviders.MirrorSigningPolicy, services *disco.Disco) getproviders.Source {
 	// The local search directories we use for implicit configuration are:
 	// - The "terraform.d/plugins" directory in the current working directory,
 	//   which we've historically documented as a place to put plugins as a
@@ -119,6 +121,9 @@ func implicitProviderSource(services *disco.Disco) getproviders.Source {
 		if info, err := os.Stat(dir); err == nil && info.IsDir() {
 			log.Printf("[DEBUG] will search for provider plugins in %s", dir)
 			fsSource := getproviders.NewFilesystemMirrorSource(dir)
+			if signing != nil {
+				fsSource.SetSigningPolicy(signing)
+			}
 
 			// We'll peep into the source to find out what providers it seems
 			// to be providing, so that we can exclude those from direct
@@ -184,7 +189,7 @@ func implicitProviderSource(services *disco.Disco) getproviders.Source {
 	return getproviders.MultiSource(searchRules)
 }
 
-func providerSourceForCLIConfigLocation(loc cliconfig.ProviderInstallationLocation, services *disco.Disco) (getproviders.Source, tfdiags.Diagnostics) {
+func providerSourceForCLIConfigLocation(loc cliconfig.ProviderInstallationLocation, signing *getproviders.MirrorSigningPolicy, services *disco.Disco) (getproviders.Source, tfdiags.Diagnostics) {
 	if loc == cliconfig.ProviderInstallationDirect {
 		return getproviders.NewMemoizeSource(
 			getproviders.NewRegistrySource(services),
@@ -194,7 +199,11 @@ func providerSourceForCLIConfigLocation(loc cliconfig.ProviderInstallationLocati
 	switch loc := loc.(type) {
 
 	case cliconfig.ProviderInstallationFilesystemMirror:
-		return getproviders.NewFilesystemMirrorSource(string(loc)), nil
+		source := getproviders.NewFilesystemMirrorSource(string(loc))
+		if signing != nil {
+			source.SetSigningPolicy(signing)
+		}
+		return source, nil
 
 	case cliconfig.ProviderInstallationNetworkMirror:
 		url, err := url.Parse(string(loc))
@@ -216,7 +225,59 @@ func providerSourceForCLIConfigLocation(loc cliconfig.ProviderInstallationLocati
 			))
 			return nil, diags
 		}
-		return getproviders.NewHTTPMirrorSource(url), nil
+		// Any credentials configured for the mirror's hostname (or for the
+		// hostname of an archive it refers to) in the CLI config are
+		// attached to the mirror requests automatically.
+		source := getproviders.NewAuthenticatedHTTPMirrorSource(url, services.CredentialsSource())
+		if signing != nil {
+			source.SetSigningPolicy(signing)
+		}
+		return source, nil
+
+	case cliconfig.ProviderInstallationOCIMirror:
+		// The location is the registry host, optionally followed by a
+		// repository name prefix under which the provider repositories live.
+		host := string(loc)
+		prefix := ""
+		if slash := strings.Index(host, "/"); slash >= 0 {
+			host, prefix = host[:slash], host[slash+1:]
+		}
+		if host == "" {
+			var diags tfdiags.Diagnostics
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid OCI repository address for provider installation source",
+				fmt.Sprintf("Cannot use %q as an OCI mirror: a registry hostname is required.", string(loc)),
+			))
+			return nil, diags
+		}
+		return getproviders.NewOCISource(host, prefix), nil
+
+	case cliconfig.ProviderInstallationS3Mirror:
+		source, err := getproviders.NewS3MirrorSource(loc.Bucket, loc.Prefix, loc.Region, loc.Endpoint)
+		if err != nil {
+			var diags tfdiags.Diagnostics
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid S3 mirror for provider installation source",
+				fmt.Sprintf("Cannot use the S3 bucket %q as a provider mirror: %s.", loc.Bucket, err),
+			))
+			return nil, diags
+		}
+		return source, nil
+
+	case cliconfig.ProviderInstallationGCSMirror:
+		source, err := getproviders.NewGCSMirrorSource(loc.Bucket, loc.Prefix)
+		if err != nil {
+			var diags tfdiags.Diagnostics
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid GCS mirror for provider installation source",
+				fmt.Sprintf("Cannot use the GCS bucket %q as a provider mirror: %s.", loc.Bucket, err),
+			))
+			return nil, diags
+		}
+		return source, nil
 
 	default:
 		// We should not get here because the set of cases above should
@@ -225,3 +286,38 @@ func providerSourceForCLIConfigLocation(loc cliconfig.ProviderInstallationLocati
 		panic(fmt.Sprintf("unexpected provider source location type %T", loc))
 	}
 }
+
+// mirrorSigningPolicy converts the provider_signing block from the CLI
+// configuration into the policy that the mirror-based provider sources
+// consume, reading each of the configured key files. A nil configuration
+// produces a nil policy, meaning no signature verification for mirrors.
+func mirrorSigningPolicy(config *cliconfig.ProviderSigningConfig) (*getproviders.MirrorSigningPolicy, tfdiags.Diagnostics) {
+	if config == nil {
+		return nil, nil
+	}
+	var diags tfdiags.Diagnostics
+	policy := &getproviders.MirrorSigningPolicy{
+		RequireSignatures: config.RequireSignatures,
+		Keys:              make(map[string][]getproviders.SigningKey),
+	}
+	for namespace, keys := range config.Keys {
+		if keys == nil {
+			continue
+		}
+		for _, filename := range keys.KeyFiles {
+			armor, err := ioutil.ReadFile(filename)
+			if err != nil {
+				diags = diags.Append(tfdiags.Sourceless(
+					tfdiags.Error,
+					"Invalid provider signing key",
+					fmt.Sprintf("Cannot read the signing key file %q configured for namespace %q: %s.", filename, namespace, err),
+				))
+				continue
+			}
+			policy.Keys[namespace] = append(policy.Keys[namespace], getproviders.SigningKey{
+				ASCIIArmor: string(armor),
+			})
+		}
+	}
+	return policy, diags
+}